@@ -0,0 +1,280 @@
+// Command baton-bitbucket-bench syncs a simulated Bitbucket account of configurable size
+// through the resource builders and reports how long the sync took, how many API calls it
+// made and how much memory it allocated, so performance regressions are measurable.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/internal/walk"
+	"github.com/conductorone/baton-bitbucket/pkg/connector"
+	"github.com/conductorone/baton-bitbucket/pkg/connector/bitbucketmock"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/spf13/cobra"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+
+	memorySampleInterval = 10 * time.Millisecond
+)
+
+// benchResult is the outcome of a single simulated sync.
+type benchResult struct {
+	Run          int                         `json:"run"`
+	Duration     time.Duration               `json:"duration_ns"`
+	Resources    int                         `json:"resources"`
+	Entitlements int                         `json:"entitlements"`
+	Grants       int                         `json:"grants"`
+	APICalls     int                         `json:"api_calls"`
+	Calls        []bitbucketmock.MethodCalls `json:"calls"`
+	// TotalAlloc is the number of bytes allocated during the sync.
+	TotalAlloc uint64 `json:"total_alloc_bytes"`
+	Mallocs    uint64 `json:"mallocs"`
+	NumGC      uint32 `json:"num_gc"`
+	// PeakHeap is the largest heap size sampled during the sync.
+	PeakHeap uint64 `json:"peak_heap_bytes"`
+}
+
+type benchReport struct {
+	Size    bitbucketmock.DatasetSize `json:"size"`
+	Latency time.Duration             `json:"latency_ns"`
+	Runs    []benchResult             `json:"runs"`
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err := newBenchCommand(ctx).Execute()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func newBenchCommand(ctx context.Context) *cobra.Command {
+	var size bitbucketmock.DatasetSize
+	var latency time.Duration
+	var runs int
+	var format string
+	var config connector.Config
+
+	cmd := &cobra.Command{
+		Use:           "baton-bitbucket-bench",
+		Short:         "Sync a simulated Bitbucket account and report the sync time, API calls and memory",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(*cobra.Command, []string) error {
+			if format != formatText && format != formatJSON {
+				return fmt.Errorf("unsupported output format: %s", format)
+			}
+
+			if runs < 1 {
+				return fmt.Errorf("at least one run is required")
+			}
+
+			report := benchReport{
+				Size:    size,
+				Latency: latency,
+			}
+
+			data := bitbucketmock.NewDataset(size)
+			for run := 1; run <= runs; run++ {
+				result, err := benchSync(ctx, config, data, latency)
+				if err != nil {
+					return err
+				}
+
+				result.Run = run
+				report.Runs = append(report.Runs, *result)
+			}
+
+			if format == formatJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+
+				return enc.Encode(report)
+			}
+
+			return printReport(report)
+		},
+	}
+
+	cmd.Flags().IntVar(&size.Workspaces, "workspaces", 1, "Number of simulated workspaces")
+	cmd.Flags().IntVar(&size.Members, "members", 100, "Number of members of every workspace")
+	cmd.Flags().IntVar(&size.Groups, "groups", 10, "Number of user groups of every workspace")
+	cmd.Flags().IntVar(&size.GroupMembers, "group-members", 10, "Number of members of every user group")
+	cmd.Flags().IntVar(&size.Projects, "projects", 10, "Number of projects of every workspace")
+	cmd.Flags().IntVar(&size.ReposPerProject, "repos-per-project", 10, "Number of repositories of every project")
+	cmd.Flags().IntVar(&size.Permissions, "permissions", 10, "Number of user and of group permissions of every project and repository")
+	cmd.Flags().DurationVar(&latency, "latency", 0, "Simulated latency of every API call, e.g. 50ms")
+	cmd.Flags().IntVar(&runs, "runs", 1, "Number of syncs to run")
+	cmd.Flags().StringVar(&format, "format", formatText, "Output format of the report: text, json")
+	cmd.Flags().BoolVar(&config.SkipProjectRepositoryGrants, "skip-project-repository-grants", false, "Skip syncing a project membership grant for every repository in the project")
+	cmd.Flags().BoolVar(&config.SkipUserStatus, "skip-user-status", false, "Treat every workspace member as enabled instead of fetching its account status")
+	cmd.Flags().IntVar(&config.UserFetchConcurrency, "user-fetch-concurrency", 0, "Number of users fetched at once while listing workspace members, 0 keeps the default")
+	cmd.Flags().BoolVar(&config.SyncExternalCollaborators, "sync-external-collaborators", false, "List users with repository permissions who are not workspace members")
+	cmd.Flags().BoolVar(&config.DeduplicateUsers, "deduplicate-users", false, "List a user belonging to multiple workspaces as a single resource")
+
+	return cmd
+}
+
+// benchSync runs a sync of the dataset the same way the SDK does: all resources are listed
+// first, followed by the entitlements and the grants of every resource.
+func benchSync(ctx context.Context, config connector.Config, data *bitbucketmock.Dataset, latency time.Duration) (*benchResult, error) {
+	calls := bitbucketmock.NewAPICalls(latency)
+
+	bb, err := connector.NewWithClient(ctx, config, bitbucketmock.NewFake(data, calls))
+	if err != nil {
+		return nil, err
+	}
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	sampler := newHeapSampler(before.HeapAlloc)
+	defer sampler.stop()
+
+	started := time.Now()
+	result := &benchResult{}
+
+	var resources []*v2.Resource
+	err = walk.Resources(ctx, bb, func(resource *v2.Resource) error {
+		resources = append(resources, resource)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resources: %w", err)
+	}
+
+	for _, resource := range resources {
+		entitlements, err := walk.Entitlements(ctx, bb, resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list entitlements of %s: %w", resource.Id.Resource, err)
+		}
+
+		result.Entitlements += len(entitlements)
+	}
+
+	for _, resource := range resources {
+		grants, err := walk.Grants(ctx, bb, resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list grants of %s: %w", resource.Id.Resource, err)
+		}
+
+		result.Grants += len(grants)
+	}
+
+	result.Duration = time.Since(started)
+	result.PeakHeap = sampler.stop()
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	result.Resources = len(resources)
+	result.TotalAlloc = after.TotalAlloc - before.TotalAlloc
+	result.Mallocs = after.Mallocs - before.Mallocs
+	result.NumGC = after.NumGC - before.NumGC
+	result.Calls = calls.Snapshot()
+	for _, method := range result.Calls {
+		result.APICalls += method.Calls
+	}
+
+	return result, nil
+}
+
+// heapSampler keeps the largest heap size seen while the sync runs.
+type heapSampler struct {
+	done chan struct{}
+	peak chan uint64
+}
+
+func newHeapSampler(initial uint64) *heapSampler {
+	s := &heapSampler{
+		done: make(chan struct{}),
+		peak: make(chan uint64, 1),
+	}
+
+	go func() {
+		peak := initial
+		ticker := time.NewTicker(memorySampleInterval)
+		defer ticker.Stop()
+
+		var stats runtime.MemStats
+		for {
+			select {
+			case <-s.done:
+				s.peak <- peak
+				return
+			case <-ticker.C:
+				runtime.ReadMemStats(&stats)
+				peak = max(peak, stats.HeapAlloc)
+			}
+		}
+	}()
+
+	return s
+}
+
+// stop ends the sampling and returns the peak, it can be called more than once.
+func (s *heapSampler) stop() uint64 {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+
+	peak := <-s.peak
+	s.peak <- peak
+
+	return peak
+}
+
+func printReport(report benchReport) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "workspaces: %d, members: %d, groups: %d, projects: %d, repositories per project: %d, permissions: %d, latency: %s\n\n",
+		report.Size.Workspaces, report.Size.Members, report.Size.Groups, report.Size.Projects, report.Size.ReposPerProject, report.Size.Permissions, report.Latency)
+
+	fmt.Fprintln(w, "RUN\tDURATION\tRESOURCES\tENTITLEMENTS\tGRANTS\tAPI CALLS\tALLOCATED\tMALLOCS\tGC\tPEAK HEAP")
+	for _, run := range report.Runs {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\t%d\t%s\t%d\t%d\t%s\n",
+			run.Run, run.Duration.Round(time.Millisecond), run.Resources, run.Entitlements, run.Grants, run.APICalls,
+			formatBytes(run.TotalAlloc), run.Mallocs, run.NumGC, formatBytes(run.PeakHeap))
+	}
+
+	// the calls are the same for every run
+	last := report.Runs[len(report.Runs)-1]
+	fmt.Fprintln(w, "\nMETHOD\tCALLS")
+	for _, method := range last.Calls {
+		fmt.Fprintf(w, "%s\t%d\n", method.Method, method.Calls)
+	}
+
+	return w.Flush()
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/conductorone/baton-bitbucket/pkg/connector"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// actionReport is the outcome of an action, printed as JSON.
+type actionReport interface {
+	Failed() bool
+}
+
+// runAction sets up the connector, runs the action and prints its report.
+// It fails when some of the changes made by the action failed.
+func runAction(ctx context.Context, v *viper.Viper, action func(ctx context.Context, bb *connector.Bitbucket) (actionReport, error)) error {
+	runCtx, stop, err := commandContext(ctx, v)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	bb, err := newBitbucketConnector(runCtx, v)
+	if err != nil {
+		return err
+	}
+
+	_, err = bb.Validate(runCtx)
+	if err != nil {
+		return err
+	}
+
+	report, err := action(runCtx, bb)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	err = enc.Encode(report)
+	if err != nil {
+		return err
+	}
+
+	if report.Failed() {
+		return fmt.Errorf("some of the changes failed, see the report for details")
+	}
+
+	return nil
+}
+
+func newRemoveUserFromGroupsCommand(ctx context.Context, v *viper.Viper) *cobra.Command {
+	var userId string
+
+	cmd := &cobra.Command{
+		Use:   "remove-user-from-groups",
+		Short: "Remove a user from every user group of the synced workspaces and print a report of the removals as JSON",
+		RunE: func(*cobra.Command, []string) error {
+			if userId == "" {
+				return fmt.Errorf("the user id must be provided")
+			}
+
+			return runAction(ctx, v, func(ctx context.Context, bb *connector.Bitbucket) (actionReport, error) {
+				return bb.RemoveUserFromAllGroups(ctx, userId)
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&userId, "user-id", "", "ID of the user resource, i.e. the Bitbucket user UUID")
+
+	return cmd
+}
+
+func newRestrictRepositoryCommand(ctx context.Context, v *viper.Viper) *cobra.Command {
+	var repositoryId string
+
+	cmd := &cobra.Command{
+		Use:   "restrict-repository",
+		Short: "Remove all non-admin user and group permissions of a repository and print a report of the removals as JSON",
+		RunE: func(*cobra.Command, []string) error {
+			if repositoryId == "" {
+				return fmt.Errorf("the repository id must be provided")
+			}
+
+			return runAction(ctx, v, func(ctx context.Context, bb *connector.Bitbucket) (actionReport, error) {
+				return bb.RestrictRepositoryToAdmins(ctx, repositoryId)
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&repositoryId, "repository-id", "", "ID of the repository resource, as listed by the export command")
+
+	return cmd
+}
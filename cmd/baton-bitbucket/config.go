@@ -5,26 +5,143 @@ import (
 )
 
 var (
-	usernameField       = field.StringField("username", field.WithDescription("Username of administrator used to connect to the BitBucket API."))
-	passwordField       = field.StringField("app-password", field.WithDescription("Application password used to connect to the BitBucket API."))
-	tokenField          = field.StringField("token", field.WithDescription("Access token (workspace or project scoped) used to connect to the BitBucket API."))
-	consumerKeyField    = field.StringField("consumer-key", field.WithDescription("OAuth consumer key used to connect to the BitBucket API via oauth."))
-	consumerSecretField = field.StringField("consumer-secret", field.WithDescription("The consumer secret used to connect to the BitBucket API via oauth."))
-	workspacesField     = field.StringSliceField("workspaces", field.WithDescription("Limit syncing to specific workspaces by specifying workspace slugs."))
+	configFileField = field.StringField("config-file", field.WithDescription("Path of a JSON or YAML file with connector options, ${VAR} references are replaced by environment variables."))
+
+	usernameField        = field.StringField("username", field.WithDescription("Username of administrator used to connect to the BitBucket API."))
+	passwordField        = field.StringField("app-password", field.WithDescription("Application password used to connect to the BitBucket API."))
+	tokenField           = field.StringField("token", field.WithDescription("Access token (workspace or project scoped) used to connect to the BitBucket API."))
+	consumerKeyField     = field.StringField("consumer-key", field.WithDescription("OAuth consumer key used to connect to the BitBucket API via oauth."))
+	consumerSecretField  = field.StringField("consumer-secret", field.WithDescription("The consumer secret used to connect to the BitBucket API via oauth."))
+	workspacesField      = field.StringSliceField("workspaces", field.WithDescription("Limit syncing to specific workspaces by specifying workspace slugs."))
+	workspaceTokensField = field.StringSliceField("workspace-tokens", field.WithDescription("Access tokens used for specific workspaces instead of the default credentials, in the format <workspace-slug>=<token>."))
+	debugHTTPField       = field.BoolField("debug-http", field.WithDescription("Log every request sent to the BitBucket API with credentials redacted."))
+	debugHTTPBodyField   = field.BoolField("debug-http-body", field.WithDescription("Include truncated request and response bodies in the debug HTTP logs."))
+
+	passwordFileField       = field.StringField("app-password-file", field.WithDescription("Path of a file containing the application password, e.g. a mounted Kubernetes secret."))
+	tokenFileField          = field.StringField("token-file", field.WithDescription("Path of a file containing the access token, e.g. a mounted Kubernetes secret."))
+	consumerSecretFileField = field.StringField("consumer-secret-file", field.WithDescription("Path of a file containing the OAuth consumer secret, e.g. a mounted Kubernetes secret."))
+
+	httpMaxIdleConnsField        = field.IntField("http-max-idle-conns", field.WithDescription("Maximum number of idle HTTP connections kept in the pool."))
+	httpMaxIdleConnsPerHostField = field.IntField("http-max-idle-conns-per-host", field.WithDescription("Maximum number of idle HTTP connections kept per host."))
+	httpMaxConnsPerHostField     = field.IntField("http-max-conns-per-host", field.WithDescription("Maximum number of HTTP connections per host, 0 means no limit."))
+	httpIdleConnTimeoutField     = field.IntField("http-idle-conn-timeout", field.WithDescription("Number of seconds an idle HTTP connection is kept open."))
+	httpHeadersField             = field.StringSliceField("http-headers", field.WithDescription("Extra headers added to every request sent to the BitBucket and Atlassian APIs, in the format <name>=<value>, e.g. for an API gateway."))
+	cacheDirField                = field.StringField("cache-dir", field.WithDescription("Directory GET responses of the BitBucket API are additionally cached in, e.g. a persistent volume, so they survive restarts."))
+	cacheTTLField                = field.IntField("cache-ttl", field.WithDescription("Number of seconds GET responses of the BitBucket API are cached. Defaults to 3600."))
+	cacheMaxSizeField            = field.IntField("cache-max-size", field.WithDescription("Maximum size of the memory and the disk cache each, in megabytes. Defaults to 2048."))
+	disableHTTPCacheField        = field.BoolField("disable-http-cache", field.WithDescription("Disable caching GET responses of the BitBucket API."))
+	httpDisableHTTP2Field        = field.BoolField("http-disable-http2", field.WithDescription("Disable HTTP/2 when connecting to the BitBucket API."))
+
+	writeMaxRetriesField      = field.IntField("write-max-retries", field.WithDescription("Number of times a write rejected by the rate limit is retried, 0 keeps the default of 3 and a negative value disables retries."))
+	writeRetryBackoffField    = field.IntField("write-retry-backoff", field.WithDescription("Number of seconds before the first retry of a rate limited write, doubled with every further retry. Defaults to 1."))
+	writeRetryMaxBackoffField = field.IntField("write-retry-max-backoff", field.WithDescription("Maximum number of seconds between two retries of a rate limited write. Defaults to 30."))
+	syncTimeoutField          = field.IntField("sync-timeout", field.WithDescription("Number of seconds a sync may take before it fails, 0 means no limit."))
+
+	checkpointDirField    = field.StringField("checkpoint-dir", field.WithDescription("Directory the user group listings are persisted in, so a sync restarted after a crash doesn't fetch them again."))
+	checkpointMaxAgeField = field.IntField("checkpoint-max-age", field.WithDescription("Number of seconds checkpoints are reused by a resumed sync, a new sync deletes them. Defaults to 3600."))
+
+	readOnlyField                    = field.BoolField("read-only", field.WithDescription("Disable every write to BitBucket (Grant/Revoke and the incident response commands) even when the credentials are allowed to write."))
+	skipGrantPreflightField          = field.BoolField("skip-grant-preflight", field.WithDescription("Skip reading the current access before granting it and rely on the write response instead, a revoke still reads the role of the principal so it only deletes the revoked one."))
+	skipProjectRepositoryGrantsField = field.BoolField("skip-project-repository-grants", field.WithDescription("Skip syncing a project membership grant for every repository in the project."))
+
+	entitlementDisplayNameTemplateField = field.StringField("entitlement-display-name-template", field.WithDescription("Go template used to render entitlement display names, e.g. '{{.ProjectKey}} {{.Resource}} {{.Entitlement}}'."))
+	entitlementDescriptionTemplateField = field.StringField("entitlement-description-template", field.WithDescription("Go template used to render entitlement descriptions."))
+
+	atlassianOrgIdField  = field.StringField("atlassian-org-id", field.WithDescription("Atlassian organization ID whose audit events are exposed through the event feed and whose managed account status is synced."))
+	atlassianAPIKeyField = field.StringField("atlassian-api-key", field.WithDescription("Atlassian organization API key used to read the organization audit events and users."))
+
+	directoryIdField     = field.StringField("atlassian-directory-id", field.WithDescription("Atlassian Access directory ID used to match users to directory identities and detect the user groups it manages via SCIM."))
+	directoryAPIKeyField = field.StringField("atlassian-directory-api-key", field.WithDescription("SCIM API key of the Atlassian Access directory."))
+
+	syncUserEmailsField   = field.BoolField("sync-user-emails", field.WithDescription("Set the emails of users, read from the Atlassian Access directory or, with --resolve-emails-via-org, the Atlassian organization."))
+	resolveOrgEmailsField = field.BoolField("resolve-emails-via-org", field.WithDescription("Resolve user emails via the Atlassian organization directory, requires the atlassian organization to be configured and --sync-user-emails."))
+
+	deduplicateUsersField = field.BoolField("deduplicate-users", field.WithDescription("List a user belonging to multiple workspaces as a single resource with a membership grant for each workspace."))
+	globalUsersField      = field.BoolField("global-users", field.WithDescription("List users as top-level resources instead of children of their workspaces."))
+
+	syncExternalCollaboratorsField = field.BoolField("sync-external-collaborators", field.WithDescription("List users with repository permissions who are not workspace members as external collaborators, requires workspace admin credentials and an extra listing per workspace."))
+
+	skipUserStatusField       = field.BoolField("skip-user-status", field.WithDescription("Treat every workspace member as enabled instead of fetching the account status of each member, for faster syncs when suspension is managed by an identity provider."))
+	userFetchConcurrencyField = field.IntField("user-fetch-concurrency", field.WithDescription("Number of users fetched at once while listing workspace members, 0 keeps the default of 10."))
+
+	maxConcurrentRequestsField = field.IntField("max-concurrent-requests", field.WithDescription("Maximum number of requests to the BitBucket API in flight at once across all credentials, 0 means no limit."))
+
+	defaultAccessEntitlementField = field.BoolField("default-access-entitlement", field.WithDescription("Sync a workspace entitlement granted to the default access groups new members are added to automatically."))
+	defaultMemberGroupField       = field.StringField("default-member-group", field.WithDescription("Slug of the user group granting the workspace membership adds users to, which gives them access to the workspace."))
+
+	groupsAsRolesField       = field.BoolField("groups-as-roles", field.WithDescription("Sync user groups as roles instead of groups."))
+	staleRepositoryDaysField = field.IntField("stale-repository-days", field.WithDescription("Number of days without updates after which a repository is flagged as stale in its profile, 0 disables the detection."))
+
+	metricsListenAddrField = field.StringField("metrics-listen-addr", field.WithDescription("Address to serve Prometheus metrics of the syncs and API calls on /metrics, e.g. :9090."))
+
+	pprofListenAddrField = field.StringField("pprof-listen-addr", field.WithDescription("Address to serve Go runtime profiles on /debug/pprof/, e.g. 127.0.0.1:6060. Don't expose it publicly."))
+
+	otlpEndpointField = field.StringField("otlp-endpoint", field.WithDescription("OTLP/HTTP endpoint spans of the API calls and resource syncers are exported to, e.g. http://localhost:4318."))
+
+	managedGroupsField = field.StringSliceField("managed-groups", field.WithDescription("Slugs (or glob patterns) of user groups managed by an identity provider, in addition to the groups of the Atlassian Access directory, their membership is synced as read-only."))
 )
 
 var configFields = []field.SchemaField{
+	configFileField,
 	usernameField,
 	passwordField,
 	tokenField,
 	consumerKeyField,
 	consumerSecretField,
+	passwordFileField,
+	tokenFileField,
+	consumerSecretFileField,
 	workspacesField,
+	workspaceTokensField,
+	debugHTTPField,
+	debugHTTPBodyField,
+	httpMaxIdleConnsField,
+	httpMaxIdleConnsPerHostField,
+	httpMaxConnsPerHostField,
+	httpIdleConnTimeoutField,
+	httpDisableHTTP2Field,
+	cacheDirField,
+	cacheTTLField,
+	cacheMaxSizeField,
+	disableHTTPCacheField,
+	httpHeadersField,
+	writeMaxRetriesField,
+	writeRetryBackoffField,
+	writeRetryMaxBackoffField,
+	syncTimeoutField,
+	checkpointDirField,
+	checkpointMaxAgeField,
+	readOnlyField,
+	skipGrantPreflightField,
+	skipProjectRepositoryGrantsField,
+	entitlementDisplayNameTemplateField,
+	entitlementDescriptionTemplateField,
+	managedGroupsField,
+	atlassianOrgIdField,
+	atlassianAPIKeyField,
+	directoryIdField,
+	directoryAPIKeyField,
+	syncUserEmailsField,
+	resolveOrgEmailsField,
+	deduplicateUsersField,
+	globalUsersField,
+	syncExternalCollaboratorsField,
+	skipUserStatusField,
+	userFetchConcurrencyField,
+	maxConcurrentRequestsField,
+	defaultAccessEntitlementField,
+	defaultMemberGroupField,
+	groupsAsRolesField,
+	staleRepositoryDaysField,
+	otlpEndpointField,
+	metricsListenAddrField,
+	pprofListenAddrField,
 }
 
 var configRelations = []field.SchemaFieldRelationship{
-	field.FieldsRequiredTogether(usernameField, passwordField),
-	field.FieldsRequiredTogether(consumerKeyField, consumerSecretField),
+	field.FieldsRequiredTogether(atlassianOrgIdField, atlassianAPIKeyField),
+	field.FieldsRequiredTogether(directoryIdField, directoryAPIKeyField),
+	field.FieldsDependentOn([]field.SchemaField{resolveOrgEmailsField}, []field.SchemaField{atlassianOrgIdField, syncUserEmailsField}),
 }
 
 var cfg = field.Configuration{
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// loadConfigFile merges connector options of the config file into the configuration.
+// References to environment variables (${VAR}) are interpolated, so credentials don't
+// have to be stored in the file. Flags and environment variables take precedence.
+func loadConfigFile(v *viper.Viper) error {
+	path := v.GetString(configFileField.FieldName)
+	if path == "" {
+		return nil
+	}
+
+	configType := strings.TrimPrefix(filepath.Ext(path), ".")
+	switch configType {
+	case "json", "yaml", "yml":
+	default:
+		return fmt.Errorf("unsupported config file format, expected .json, .yaml or .yml: %s", path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	v.SetConfigType(configType)
+	err = v.MergeConfig(strings.NewReader(os.ExpandEnv(string(content))))
+	if err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/pkg/connector"
+	connectorV2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	sdkSync "github.com/conductorone/baton-sdk/pkg/sync"
+	"github.com/conductorone/baton-sdk/pkg/types"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	defaultDaemonSchedule          = "@every 6h"
+	defaultWorkspaceJitter         = 30 * time.Second
+	defaultCredentialCheckInterval = 5 * time.Minute
+
+	inProcessBufferSize = 1024 * 1024
+)
+
+func newDaemonCommand(ctx context.Context, v *viper.Viper) *cobra.Command {
+	var schedule, outputDir, healthAddr string
+	var jitter, credentialCheckInterval time.Duration
+	var syncOnStart bool
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Stay resident and sync every workspace into its own c1z file on a schedule",
+		RunE: func(*cobra.Command, []string) error {
+			parsedSchedule, err := cron.ParseStandard(schedule)
+			if err != nil {
+				return fmt.Errorf("invalid schedule %q: %w", schedule, err)
+			}
+
+			if jitter < 0 {
+				return fmt.Errorf("workspace jitter must not be negative")
+			}
+
+			if credentialCheckInterval < 0 {
+				return fmt.Errorf("credential check interval must not be negative")
+			}
+
+			runCtx, stop, err := commandContext(ctx, v)
+			if err != nil {
+				return err
+			}
+			defer stop()
+
+			config, auth, err := newConnectorConfig(v)
+			if err != nil {
+				return err
+			}
+
+			err = os.MkdirAll(outputDir, 0o755)
+			if err != nil {
+				return fmt.Errorf("failed to create output directory: %w", err)
+			}
+
+			d := &daemon{
+				config:     config,
+				auth:       auth,
+				outputDir:  outputDir,
+				jitter:     jitter,
+				checkEvery: credentialCheckInterval,
+				status:     newDaemonStatus(),
+				workspaces: make(map[string]*workspaceConnector),
+			}
+			defer d.close()
+
+			shutdownHealth, err := serveHealth(runCtx, healthAddr, d.status)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = shutdownHealth(ctx)
+			}()
+
+			return d.run(runCtx, parsedSchedule, syncOnStart)
+		},
+	}
+
+	cmd.Flags().StringVar(&schedule, "schedule", defaultDaemonSchedule, "Cron expression or descriptor (e.g. '0 */6 * * *', '@daily', '@every 4h') of when the workspaces are synced")
+	cmd.Flags().StringVar(&outputDir, "output-dir", ".", "Directory the <workspace-slug>.c1z files are written to")
+	cmd.Flags().StringVar(&healthAddr, "health-listen-addr", ":8080", "Address to serve /healthz and /readyz on, empty disables the health endpoints")
+	cmd.Flags().DurationVar(&jitter, "workspace-jitter", defaultWorkspaceJitter, "Maximum random delay between the syncs of two workspaces")
+	cmd.Flags().DurationVar(&credentialCheckInterval, "credential-check-interval", defaultCredentialCheckInterval, "How often the credentials are validated between the syncs, 0 only validates them before every run")
+	cmd.Flags().BoolVar(&syncOnStart, "sync-on-start", true, "Sync the workspaces right away instead of waiting for the first scheduled run")
+
+	return cmd
+}
+
+// daemon syncs the workspaces one after another whenever the schedule fires. Every workspace
+// has its own connector, so a workspace failing to sync doesn't affect the others.
+type daemon struct {
+	config    connector.Config
+	auth      uhttp.AuthCredentials
+	outputDir string
+	jitter    time.Duration
+	// checkEvery is the interval the credentials are validated in between the runs
+	checkEvery time.Duration
+	status     *daemonStatus
+
+	// discovery validates the credentials and lists the workspaces to sync when none are configured
+	discovery *connector.Bitbucket
+	// workspaces keeps the connector of every synced workspace between the runs
+	workspaces map[string]*workspaceConnector
+}
+
+type workspaceConnector struct {
+	client types.ConnectorClient
+	close  func()
+}
+
+func (d *daemon) run(ctx context.Context, schedule cron.Schedule, syncOnStart bool) error {
+	l := ctxzap.Extract(ctx)
+
+	if syncOnStart {
+		d.syncAll(ctx)
+	} else {
+		d.checkCredentials(ctx)
+	}
+
+	// a nil channel never fires, disabling the checks between the runs
+	var checks <-chan time.Time
+	if d.checkEvery > 0 {
+		ticker := time.NewTicker(d.checkEvery)
+		defer ticker.Stop()
+		checks = ticker.C
+	}
+
+	for {
+		next := schedule.Next(time.Now())
+		d.status.scheduled(next)
+		l.Info("next sync scheduled", zap.Time("at", next))
+
+		timer := time.NewTimer(time.Until(next))
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				l.Info("daemon stopped")
+				return nil
+			case <-checks:
+				d.checkCredentials(ctx)
+			case <-timer.C:
+				break wait
+			}
+		}
+
+		d.syncAll(ctx)
+	}
+}
+
+// checkCredentials validates the credentials, so the readiness reflects revoked or expired
+// credentials before the next run fails on them.
+func (d *daemon) checkCredentials(ctx context.Context) error {
+	err := d.validateCredentials(ctx)
+	if err != nil {
+		ctxzap.Extract(ctx).Error("credentials are invalid", zap.Error(err))
+	}
+
+	d.status.credentialsChecked(time.Now(), err)
+
+	return err
+}
+
+func (d *daemon) validateCredentials(ctx context.Context) error {
+	if d.discovery == nil {
+		bb, err := connector.New(ctx, d.config, d.auth)
+		if err != nil {
+			return err
+		}
+
+		d.discovery = bb
+	}
+
+	_, err := d.discovery.Validate(ctx)
+
+	return err
+}
+
+// syncAll syncs every workspace, spreading the syncs by a random delay
+// so the workspaces don't hit the API all at once.
+func (d *daemon) syncAll(ctx context.Context) {
+	l := ctxzap.Extract(ctx)
+
+	d.status.started(time.Now())
+
+	err := d.checkCredentials(ctx)
+	if err != nil {
+		d.status.finished(time.Now(), err)
+		return
+	}
+
+	workspaces, err := d.workspaceSlugs(ctx)
+	if err != nil {
+		l.Error("failed to list workspaces to sync", zap.Error(err))
+		d.status.finished(time.Now(), err)
+		return
+	}
+
+	for i, workspaceSlug := range workspaces {
+		if i > 0 && d.jitter > 0 {
+			select {
+			case <-ctx.Done():
+				d.status.finished(time.Now(), ctx.Err())
+				return
+			case <-time.After(rand.N(d.jitter)):
+			}
+		}
+
+		start := time.Now()
+		err := d.syncWorkspace(ctx, workspaceSlug)
+		if err != nil {
+			l.Error("failed to sync workspace", zap.String("workspace", workspaceSlug), zap.Error(err))
+		} else {
+			l.Info("workspace synced", zap.String("workspace", workspaceSlug), zap.Duration("duration", time.Since(start)))
+		}
+
+		d.status.synced(workspaceSlug, time.Now(), err)
+	}
+
+	d.status.finished(time.Now(), nil)
+}
+
+// workspaceSlugs returns the configured workspaces, or all the workspaces visible
+// to the credentials when none are configured.
+func (d *daemon) workspaceSlugs(ctx context.Context) ([]string, error) {
+	if len(d.config.Workspaces) > 0 {
+		rv := append([]string{}, d.config.Workspaces...)
+		for workspaceSlug := range d.config.WorkspaceCredentials {
+			if !containsString(rv, workspaceSlug) {
+				rv = append(rv, workspaceSlug)
+			}
+		}
+
+		return rv, nil
+	}
+
+	// the discovery connector was validated by the credential check of the run
+	workspaces, err := d.discovery.AccessibleWorkspaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]string, 0, len(workspaces))
+	for _, workspace := range workspaces {
+		rv = append(rv, workspace.Slug)
+	}
+
+	return rv, nil
+}
+
+// syncWorkspace syncs the workspace into a partial file which replaces the c1z file of
+// the workspace once the sync succeeds, so readers never see an unfinished sync.
+func (d *daemon) syncWorkspace(ctx context.Context, workspaceSlug string) error {
+	client, err := d.workspaceClient(ctx, workspaceSlug)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(d.outputDir, workspaceSlug+".c1z")
+	partialPath := path + ".partial"
+
+	// a partial file left behind by an interrupted run would be resumed instead of synced from scratch
+	err = os.Remove(partialPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	syncer, err := sdkSync.NewSyncer(ctx, client, sdkSync.WithC1ZPath(partialPath))
+	if err != nil {
+		return err
+	}
+
+	err = syncer.Sync(ctx)
+	if err != nil {
+		if closeErr := syncer.Close(ctx); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+		_ = os.Remove(partialPath)
+		return err
+	}
+
+	err = syncer.Close(ctx)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(partialPath, path)
+}
+
+// workspaceClient returns the client of the connector limited to the workspace, creating it on first use.
+func (d *daemon) workspaceClient(ctx context.Context, workspaceSlug string) (types.ConnectorClient, error) {
+	if wc, ok := d.workspaces[workspaceSlug]; ok {
+		return wc.client, nil
+	}
+
+	config := d.config
+	config.Workspaces = []string{workspaceSlug}
+	config.WorkspaceCredentials = nil
+	if credentials, ok := d.config.WorkspaceCredentials[workspaceSlug]; ok {
+		config.WorkspaceCredentials = map[string]uhttp.AuthCredentials{workspaceSlug: credentials}
+	}
+
+	bb, err := connector.New(ctx, config, d.auth)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := connectorbuilder.NewConnector(ctx, bb)
+	if err != nil {
+		return nil, err
+	}
+
+	client, closeClient, err := newInProcessClient(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	d.workspaces[workspaceSlug] = &workspaceConnector{
+		client: client,
+		close:  closeClient,
+	}
+
+	return client, nil
+}
+
+func (d *daemon) close() {
+	for _, wc := range d.workspaces {
+		wc.close()
+	}
+}
+
+type connectorClient struct {
+	connectorV2.ResourceTypesServiceClient
+	connectorV2.ResourcesServiceClient
+	connectorV2.EntitlementsServiceClient
+	connectorV2.GrantsServiceClient
+	connectorV2.ConnectorServiceClient
+	connectorV2.AssetServiceClient
+	connectorV2.GrantManagerServiceClient
+	connectorV2.ResourceManagerServiceClient
+	connectorV2.AccountManagerServiceClient
+	connectorV2.CredentialManagerServiceClient
+	connectorV2.EventServiceClient
+	connectorV2.TicketsServiceClient
+}
+
+// newInProcessClient serves the connector over an in-memory listener, so the syncer can talk to it
+// without the connector subprocess the SDK runner starts, which only works for the root command.
+func newInProcessClient(ctx context.Context, server types.ConnectorServer) (types.ConnectorClient, func(), error) {
+	listener := bufconn.Listen(inProcessBufferSize)
+
+	s := grpc.NewServer()
+	connectorV2.RegisterConnectorServiceServer(s, server)
+	connectorV2.RegisterGrantsServiceServer(s, server)
+	connectorV2.RegisterEntitlementsServiceServer(s, server)
+	connectorV2.RegisterResourcesServiceServer(s, server)
+	connectorV2.RegisterResourceTypesServiceServer(s, server)
+	connectorV2.RegisterAssetServiceServer(s, server)
+
+	go func() {
+		err := s.Serve(listener)
+		if err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			ctxzap.Extract(ctx).Error("in-process connector server failed", zap.Error(err))
+		}
+	}()
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		s.Stop()
+		return nil, nil, err
+	}
+
+	client := &connectorClient{
+		ResourceTypesServiceClient:     connectorV2.NewResourceTypesServiceClient(conn),
+		ResourcesServiceClient:         connectorV2.NewResourcesServiceClient(conn),
+		EntitlementsServiceClient:      connectorV2.NewEntitlementsServiceClient(conn),
+		GrantsServiceClient:            connectorV2.NewGrantsServiceClient(conn),
+		ConnectorServiceClient:         connectorV2.NewConnectorServiceClient(conn),
+		AssetServiceClient:             connectorV2.NewAssetServiceClient(conn),
+		GrantManagerServiceClient:      connectorV2.NewGrantManagerServiceClient(conn),
+		ResourceManagerServiceClient:   connectorV2.NewResourceManagerServiceClient(conn),
+		AccountManagerServiceClient:    connectorV2.NewAccountManagerServiceClient(conn),
+		CredentialManagerServiceClient: connectorV2.NewCredentialManagerServiceClient(conn),
+		EventServiceClient:             connectorV2.NewEventServiceClient(conn),
+		TicketsServiceClient:           connectorV2.NewTicketsServiceClient(conn),
+	}
+
+	return client, func() {
+		_ = conn.Close()
+		s.Stop()
+	}, nil
+}
+
+type credentialStatus struct {
+	Valid     bool      `json:"valid"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type workspaceSyncStatus struct {
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+	LastSuccessAt time.Time `json:"last_success_at"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// daemonStatus is the state of the scheduled syncs reported by the health endpoints.
+type daemonStatus struct {
+	mtx sync.Mutex
+
+	Running           bool                            `json:"running"`
+	Credentials       credentialStatus                `json:"credentials"`
+	LastRunStartedAt  time.Time                       `json:"last_run_started_at"`
+	LastRunFinishedAt time.Time                       `json:"last_run_finished_at"`
+	LastRunError      string                          `json:"last_run_error,omitempty"`
+	LastSuccessAt     time.Time                       `json:"last_success_at"`
+	NextRunAt         time.Time                       `json:"next_run_at"`
+	Workspaces        map[string]*workspaceSyncStatus `json:"workspaces"`
+}
+
+func newDaemonStatus() *daemonStatus {
+	return &daemonStatus{
+		Workspaces: make(map[string]*workspaceSyncStatus),
+	}
+}
+
+func (s *daemonStatus) scheduled(next time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.NextRunAt = next
+}
+
+func (s *daemonStatus) started(now time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.Running = true
+	s.LastRunStartedAt = now
+}
+
+func (s *daemonStatus) finished(now time.Time, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.Running = false
+	s.LastRunFinishedAt = now
+	s.LastRunError = ""
+	if err != nil {
+		s.LastRunError = err.Error()
+		return
+	}
+
+	for _, status := range s.Workspaces {
+		if status.Error != "" {
+			return
+		}
+	}
+	s.LastSuccessAt = now
+}
+
+func (s *daemonStatus) credentialsChecked(now time.Time, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.Credentials = credentialStatus{
+		Valid:     err == nil,
+		CheckedAt: now,
+	}
+	if err != nil {
+		s.Credentials.Error = err.Error()
+	}
+}
+
+func (s *daemonStatus) synced(workspaceSlug string, now time.Time, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	status, ok := s.Workspaces[workspaceSlug]
+	if !ok {
+		status = &workspaceSyncStatus{}
+		s.Workspaces[workspaceSlug] = status
+	}
+
+	status.LastAttemptAt = now
+	status.Error = ""
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.LastSuccessAt = now
+	}
+}
+
+// ready reports whether the credentials are valid, a run finished and the latest sync of every workspace succeeded.
+func (s *daemonStatus) ready() bool {
+	if !s.Credentials.Valid || s.LastRunFinishedAt.IsZero() || s.LastRunError != "" {
+		return false
+	}
+
+	for _, status := range s.Workspaces {
+		if status.Error != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *daemonStatus) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !s.ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	_ = json.NewEncoder(w).Encode(s)
+}
+
+// serveHealth serves the liveness of the daemon on /healthz and the status of the syncs on /readyz.
+// The returned function stops the listener.
+func serveHealth(ctx context.Context, addr string, status *daemonStatus) (func(context.Context) error, error) {
+	if addr == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for health requests: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.Handle("/readyz", status)
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctxzap.Extract(ctx).Info("serving health endpoints", zap.String("address", listener.Addr().String()))
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ctxzap.Extract(ctx).Error("health listener failed", zap.Error(err))
+		}
+	}()
+
+	return server.Shutdown, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
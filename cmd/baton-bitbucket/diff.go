@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/dotc1z"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// errGrantsChanged makes the diff command exit with a failure when --exit-code is set and grants changed.
+var errGrantsChanged = errors.New("grants changed between the syncs")
+
+// grantChange is a grant of a resource present in only one of the compared syncs.
+type grantChange struct {
+	PrincipalType string `json:"principal_type"`
+	PrincipalId   string `json:"principal_id"`
+	PrincipalName string `json:"principal_name"`
+	Entitlement   string `json:"entitlement"`
+}
+
+// resourceDiff lists the grants of a resource added and removed between two syncs.
+type resourceDiff struct {
+	ResourceType string        `json:"resource_type"`
+	ResourceId   string        `json:"resource_id"`
+	ResourceName string        `json:"resource_name"`
+	Added        []grantChange `json:"added,omitempty"`
+	Removed      []grantChange `json:"removed,omitempty"`
+}
+
+func newDiffCommand(ctx context.Context, v *viper.Viper) *cobra.Command {
+	var format string
+	var exitCode bool
+
+	cmd := &cobra.Command{
+		Use:   "diff <before.c1z> [after.c1z]",
+		Short: "Print the grants added and removed per resource between two syncs, or between a sync and the live API state",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if format != workspacesFormatTable && format != exportFormatJSON {
+				return fmt.Errorf("unsupported output format: %s", format)
+			}
+
+			before, err := loadSyncAccessRows(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			var after []accessRow
+			if len(args) == 2 {
+				after, err = loadSyncAccessRows(ctx, args[1])
+				if err != nil {
+					return err
+				}
+			} else {
+				after, err = loadLiveAccessRows(ctx, v)
+				if err != nil {
+					return err
+				}
+			}
+
+			diffs := diffAccessRows(before, after)
+
+			if format == exportFormatJSON {
+				err = writeJSONDiffs(os.Stdout, diffs)
+			} else {
+				err = writeTableDiffs(os.Stdout, diffs)
+			}
+			if err != nil {
+				return err
+			}
+
+			if exitCode && len(diffs) > 0 {
+				return errGrantsChanged
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", workspacesFormatTable, "Output format of the diff: table, json")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with a failure when any grant was added or removed")
+
+	return cmd
+}
+
+// loadSyncAccessRows flattens the grants of the latest finished sync stored in a c1z file.
+func loadSyncAccessRows(ctx context.Context, path string) ([]accessRow, error) {
+	resources, grants, err := readSync(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return accessRows(resources, grants)
+}
+
+// readSync reads the resources and grants of the latest finished sync stored in a c1z file.
+func readSync(ctx context.Context, path string) ([]*v2.Resource, []*v2.Grant, error) {
+	// opening a missing file would silently read an empty sync
+	_, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := dotc1z.NewC1ZFile(ctx, path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open sync %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var resources []*v2.Resource
+	pageToken := ""
+	for {
+		resp, err := f.ListResources(ctx, &v2.ResourcesServiceListResourcesRequest{PageToken: pageToken})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list resources of sync %s: %w", path, err)
+		}
+
+		resources = append(resources, resp.List...)
+
+		pageToken = resp.NextPageToken
+		if pageToken == "" {
+			break
+		}
+	}
+
+	var grants []*v2.Grant
+	for {
+		resp, err := f.ListGrants(ctx, &v2.GrantsServiceListGrantsRequest{PageToken: pageToken})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list grants of sync %s: %w", path, err)
+		}
+
+		grants = append(grants, resp.List...)
+
+		pageToken = resp.NextPageToken
+		if pageToken == "" {
+			break
+		}
+	}
+
+	return resources, grants, nil
+}
+
+// loadLiveAccessRows flattens the grants currently returned by the Bitbucket API.
+func loadLiveAccessRows(ctx context.Context, v *viper.Viper) ([]accessRow, error) {
+	runCtx, stop, err := commandContext(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	bb, err := newBitbucketConnector(runCtx, v)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = bb.Validate(runCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectAccessRows(runCtx, bb)
+}
+
+func grantKey(row accessRow) string {
+	return row.Entitlement + "/" + row.PrincipalType + "/" + row.PrincipalId
+}
+
+// diffAccessRows groups the grants present in only one of the syncs by their resource, sorted by resource type and ID.
+func diffAccessRows(before, after []accessRow) []resourceDiff {
+	index := func(rows []accessRow) map[string]map[string]accessRow {
+		rv := make(map[string]map[string]accessRow)
+		for _, row := range rows {
+			key := row.ResourceType + "/" + row.ResourceId
+			if rv[key] == nil {
+				rv[key] = make(map[string]accessRow)
+			}
+			rv[key][grantKey(row)] = row
+		}
+
+		return rv
+	}
+
+	beforeGrants := index(before)
+	afterGrants := index(after)
+
+	diffs := make(map[string]*resourceDiff)
+	change := func(key string, row accessRow, added bool) {
+		diff, ok := diffs[key]
+		if !ok {
+			diff = &resourceDiff{
+				ResourceType: row.ResourceType,
+				ResourceId:   row.ResourceId,
+				ResourceName: row.ResourceName,
+			}
+			diffs[key] = diff
+		}
+
+		c := grantChange{
+			PrincipalType: row.PrincipalType,
+			PrincipalId:   row.PrincipalId,
+			PrincipalName: row.PrincipalName,
+			Entitlement:   row.Entitlement,
+		}
+		if added {
+			diff.Added = append(diff.Added, c)
+		} else {
+			diff.Removed = append(diff.Removed, c)
+		}
+	}
+
+	for key, grants := range afterGrants {
+		for gk, row := range grants {
+			if _, ok := beforeGrants[key][gk]; !ok {
+				change(key, row, true)
+			}
+		}
+	}
+	for key, grants := range beforeGrants {
+		for gk, row := range grants {
+			if _, ok := afterGrants[key][gk]; !ok {
+				change(key, row, false)
+			}
+		}
+	}
+
+	rv := make([]resourceDiff, 0, len(diffs))
+	for _, diff := range diffs {
+		sortGrantChanges(diff.Added)
+		sortGrantChanges(diff.Removed)
+		rv = append(rv, *diff)
+	}
+
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].ResourceType != rv[j].ResourceType {
+			return rv[i].ResourceType < rv[j].ResourceType
+		}
+
+		return rv[i].ResourceId < rv[j].ResourceId
+	})
+
+	return rv
+}
+
+func sortGrantChanges(changes []grantChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Entitlement != changes[j].Entitlement {
+			return changes[i].Entitlement < changes[j].Entitlement
+		}
+		if changes[i].PrincipalType != changes[j].PrincipalType {
+			return changes[i].PrincipalType < changes[j].PrincipalType
+		}
+
+		return changes[i].PrincipalId < changes[j].PrincipalId
+	})
+}
+
+func writeTableDiffs(out io.Writer, diffs []resourceDiff) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	var added, removed int
+	fmt.Fprintln(w, "CHANGE\tRESOURCE TYPE\tRESOURCE\tENTITLEMENT\tPRINCIPAL TYPE\tPRINCIPAL")
+	for _, diff := range diffs {
+		resource := displayName(diff.ResourceName, diff.ResourceId)
+		for _, c := range diff.Added {
+			fmt.Fprintf(w, "+\t%s\t%s\t%s\t%s\t%s\n", diff.ResourceType, resource, c.Entitlement, c.PrincipalType, displayName(c.PrincipalName, c.PrincipalId))
+		}
+		for _, c := range diff.Removed {
+			fmt.Fprintf(w, "-\t%s\t%s\t%s\t%s\t%s\n", diff.ResourceType, resource, c.Entitlement, c.PrincipalType, displayName(c.PrincipalName, c.PrincipalId))
+		}
+
+		added += len(diff.Added)
+		removed += len(diff.Removed)
+	}
+
+	fmt.Fprintf(w, "\n%d grants added, %d grants removed across %d resources\n", added, removed, len(diffs))
+
+	return w.Flush()
+}
+
+func displayName(name, id string) string {
+	if name == "" {
+		return id
+	}
+
+	return fmt.Sprintf("%s (%s)", name, id)
+}
+
+func writeJSONDiffs(out io.Writer, diffs []resourceDiff) error {
+	if diffs == nil {
+		diffs = []resourceDiff{}
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(diffs)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/conductorone/baton-bitbucket/pkg/connector"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newDumpCommand(ctx context.Context, v *viper.Viper) *cobra.Command {
+	var target connector.DumpTarget
+	var outputDir string
+
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Write the raw API payloads (members, groups, permissions) of a workspace, project or repository to disk",
+		RunE: func(*cobra.Command, []string) error {
+			if target.Workspace == "" {
+				return fmt.Errorf("the workspace must be provided")
+			}
+
+			runCtx, stop, err := commandContext(ctx, v)
+			if err != nil {
+				return err
+			}
+			defer stop()
+
+			bb, err := newBitbucketConnector(runCtx, v)
+			if err != nil {
+				return err
+			}
+
+			_, err = bb.Validate(runCtx)
+			if err != nil {
+				return err
+			}
+
+			err = os.MkdirAll(outputDir, 0o755)
+			if err != nil {
+				return err
+			}
+
+			return bb.DumpRawPayloads(runCtx, target, func(name string, pages []json.RawMessage) error {
+				content, err := json.MarshalIndent(pages, "", "  ")
+				if err != nil {
+					return err
+				}
+
+				return os.WriteFile(filepath.Join(outputDir, name+".json"), content, 0o600)
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&target.Workspace, "workspace", "", "Slug of the workspace to dump")
+	cmd.Flags().StringVar(&target.Project, "project", "", "Key of a project of the workspace to dump")
+	cmd.Flags().StringVar(&target.Repository, "repository", "", "Slug of a repository of the workspace to dump")
+	cmd.Flags().StringVar(&outputDir, "output-dir", "bitbucket-dump", "Directory the payloads are written to, one JSON file per payload")
+
+	return cmd
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/conductorone/baton-bitbucket/internal/walk"
+	"github.com/conductorone/baton-bitbucket/pkg/connector"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	exportFormatCSV  = "csv"
+	exportFormatJSON = "json"
+)
+
+// accessRow is a single principal → entitlement → resource relation of the export.
+type accessRow struct {
+	PrincipalType string `json:"principal_type"`
+	PrincipalId   string `json:"principal_id"`
+	PrincipalName string `json:"principal_name"`
+	Entitlement   string `json:"entitlement"`
+	ResourceType  string `json:"resource_type"`
+	ResourceId    string `json:"resource_id"`
+	ResourceName  string `json:"resource_name"`
+}
+
+var accessRowHeader = []string{
+	"principal_type",
+	"principal_id",
+	"principal_name",
+	"entitlement",
+	"resource_type",
+	"resource_id",
+	"resource_name",
+}
+
+func (r accessRow) record() []string {
+	return []string{
+		r.PrincipalType,
+		r.PrincipalId,
+		r.PrincipalName,
+		r.Entitlement,
+		r.ResourceType,
+		r.ResourceId,
+		r.ResourceName,
+	}
+}
+
+func newExportCommand(ctx context.Context, v *viper.Viper) *cobra.Command {
+	var format, output string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export a flat list of access (principal, entitlement, resource) as CSV or JSON",
+		RunE: func(*cobra.Command, []string) error {
+			if format != exportFormatCSV && format != exportFormatJSON {
+				return fmt.Errorf("unsupported export format: %s", format)
+			}
+
+			runCtx, stop, err := commandContext(ctx, v)
+			if err != nil {
+				return err
+			}
+			defer stop()
+
+			bb, err := newBitbucketConnector(runCtx, v)
+			if err != nil {
+				return err
+			}
+
+			_, err = bb.Validate(runCtx)
+			if err != nil {
+				return err
+			}
+
+			rows, err := collectAccessRows(runCtx, bb)
+			if err != nil {
+				return err
+			}
+
+			out := io.Writer(os.Stdout)
+			if output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				out = f
+			}
+
+			if format == exportFormatJSON {
+				return writeJSONRows(out, rows)
+			}
+
+			return writeCSVRows(out, rows)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", exportFormatCSV, "Output format of the export: csv, json")
+	cmd.Flags().StringVar(&output, "output", "-", "Path of the export file, - writes to stdout")
+
+	return cmd
+}
+
+// collectAccessRows walks the connector resources and flattens their grants.
+func collectAccessRows(ctx context.Context, bb *connector.Bitbucket) ([]accessRow, error) {
+	resources, grants, err := collectGrants(ctx, bb)
+	if err != nil {
+		return nil, err
+	}
+
+	return accessRows(resources, grants)
+}
+
+// collectGrants walks the connector resources and returns them along with their grants.
+func collectGrants(ctx context.Context, bb *connector.Bitbucket) ([]*v2.Resource, []*v2.Grant, error) {
+	var resources []*v2.Resource
+
+	err := walk.Resources(ctx, bb, func(resource *v2.Resource) error {
+		resources = append(resources, resource)
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rv []*v2.Grant
+	for _, resource := range resources {
+		grants, err := walk.Grants(ctx, bb, resource)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rv = append(rv, grants...)
+	}
+
+	return resources, rv, nil
+}
+
+// accessRows flattens the grants, naming their principals and resources.
+func accessRows(resources []*v2.Resource, grants []*v2.Grant) ([]accessRow, error) {
+	names := make(map[string]string, len(resources))
+	for _, resource := range resources {
+		names[resourceKey(resource.Id)] = resource.DisplayName
+	}
+
+	rows := make([]accessRow, 0, len(grants))
+	for _, g := range grants {
+		resourceId := g.Entitlement.Resource.Id
+		principalId := g.Principal.Id
+
+		_, slug, err := connector.ParseEntitlementID(g.Entitlement.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		rows = append(rows, accessRow{
+			PrincipalType: principalId.ResourceType,
+			PrincipalId:   principalId.Resource,
+			PrincipalName: names[resourceKey(principalId)],
+			Entitlement:   slug,
+			ResourceType:  resourceId.ResourceType,
+			ResourceId:    resourceId.Resource,
+			ResourceName:  names[resourceKey(resourceId)],
+		})
+	}
+
+	return rows, nil
+}
+
+func resourceKey(id *v2.ResourceId) string {
+	return id.ResourceType + "/" + id.Resource
+}
+
+func writeCSVRows(out io.Writer, rows []accessRow) error {
+	w := csv.NewWriter(out)
+
+	err := w.Write(accessRowHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		err = w.Write(row.record())
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
+
+func writeJSONRows(out io.Writer, rows []accessRow) error {
+	if rows == nil {
+		rows = []accessRow{}
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(rows)
+}
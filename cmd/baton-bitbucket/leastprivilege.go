@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/pkg/connector"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const defaultActivityDays = 90
+
+func newLeastPrivilegeCommand(ctx context.Context, v *viper.Viper) *cobra.Command {
+	var format, output string
+	var activityDays int
+
+	cmd := &cobra.Command{
+		Use:   "least-privilege [sync.c1z]",
+		Short: "Recommend lower repository roles for users without recent commits or pull requests",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if format != workspacesFormatTable && format != exportFormatJSON {
+				return fmt.Errorf("unsupported output format: %s", format)
+			}
+			if activityDays <= 0 {
+				return fmt.Errorf("--activity-days must be positive")
+			}
+
+			runCtx, stop, err := commandContext(ctx, v)
+			if err != nil {
+				return err
+			}
+			defer stop()
+
+			bb, err := newBitbucketConnector(runCtx, v)
+			if err != nil {
+				return err
+			}
+
+			_, err = bb.Validate(runCtx)
+			if err != nil {
+				return err
+			}
+
+			var resources []*v2.Resource
+			var grants []*v2.Grant
+			if len(args) == 1 {
+				resources, grants, err = readSync(runCtx, args[0])
+			} else {
+				resources, grants, err = collectGrants(runCtx, bb)
+			}
+			if err != nil {
+				return err
+			}
+
+			window := time.Duration(activityDays) * 24 * time.Hour
+			recommendations, err := recommendLeastPrivilege(runCtx, bb, resources, grants, window)
+			if err != nil {
+				return err
+			}
+
+			out := io.Writer(os.Stdout)
+			if output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				out = f
+			}
+
+			if format == exportFormatJSON {
+				return writeJSONRecommendations(out, recommendations)
+			}
+
+			return writeTableRecommendations(out, recommendations)
+		},
+	}
+
+	cmd.Flags().IntVar(&activityDays, "activity-days", defaultActivityDays, "Number of days of commits and pull requests the roles are compared against")
+	cmd.Flags().StringVar(&format, "format", workspacesFormatTable, "Output format of the report: table, json")
+	cmd.Flags().StringVar(&output, "output", "-", "Path of the report file, - writes to stdout")
+
+	return cmd
+}
+
+// recommendLeastPrivilege reads the activity of the repositories with admins or writers and recommends lower roles.
+func recommendLeastPrivilege(ctx context.Context, bb *connector.Bitbucket, resources []*v2.Resource, grants []*v2.Grant, window time.Duration) ([]connector.PrivilegeRecommendation, error) {
+	l := ctxzap.Extract(ctx)
+
+	repositoryIds, err := connector.LeastPrivilegeCandidates(grants)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().Add(-window)
+	activity := make(map[string]*connector.RepositoryActivity, len(repositoryIds))
+	for _, repositoryId := range repositoryIds {
+		repositoryActivity, err := bb.RepositoryActivity(ctx, repositoryId, since)
+		if err != nil {
+			return nil, err
+		}
+
+		l.Debug("read repository activity", zap.String("repository_id", repositoryId))
+
+		activity[repositoryId] = repositoryActivity
+	}
+
+	return connector.RecommendLeastPrivilege(resources, grants, activity, window)
+}
+
+func writeTableRecommendations(out io.Writer, recommendations []connector.PrivilegeRecommendation) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "WORKSPACE\tREPOSITORY\tUSER\tROLE\tRECOMMENDED\tCOMMITS\tPULL REQUESTS\tMERGES\tREASON")
+	for _, r := range recommendations {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+			displayName(r.WorkspaceName, r.WorkspaceId),
+			displayName(r.RepositoryName, r.RepositoryId),
+			displayName(r.UserName, r.UserId),
+			r.Permission,
+			r.Recommended,
+			r.Commits,
+			r.PullRequests,
+			r.Merges,
+			r.Reason,
+		)
+	}
+
+	fmt.Fprintf(w, "\n%d repository roles could be lowered\n", len(recommendations))
+
+	return w.Flush()
+}
+
+func writeJSONRecommendations(out io.Writer, recommendations []connector.PrivilegeRecommendation) error {
+	if recommendations == nil {
+		recommendations = []connector.PrivilegeRecommendation{}
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(recommendations)
+}
@@ -2,16 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
 	"github.com/conductorone/baton-bitbucket/pkg/connector"
 	configschema "github.com/conductorone/baton-sdk/pkg/config"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/logging"
 	"github.com/conductorone/baton-sdk/pkg/types"
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
@@ -28,13 +37,58 @@ var (
 func main() {
 	ctx := context.Background()
 
-	_, cmd, err := configschema.DefineConfiguration(ctx, "baton-bitbucket", getConnector, cfg)
+	v, cmd, err := configschema.DefineConfiguration(ctx, "baton-bitbucket", getConnector, cfg)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
 	cmd.Version = version
+	shutdownTracing := func(context.Context) error { return nil }
+	shutdownMetrics := func(context.Context) error { return nil }
+	shutdownPprof := func(context.Context) error { return nil }
+	cmd.PersistentPreRunE = func(*cobra.Command, []string) error {
+		err := loadConfigFile(v)
+		if err != nil {
+			return err
+		}
+
+		err = loadSecretFiles(v)
+		if err != nil {
+			return err
+		}
+
+		err = resolveSecretReferences(ctx, v)
+		if err != nil {
+			return err
+		}
+
+		shutdownTracing, err = setupTracing(ctx, v)
+		if err != nil {
+			return err
+		}
+
+		shutdownMetrics, err = setupMetrics(ctx, v)
+		if err != nil {
+			return err
+		}
+
+		shutdownPprof, err = setupPprof(ctx, v)
+		return err
+	}
+	cmd.PersistentPostRunE = func(*cobra.Command, []string) error {
+		return errors.Join(shutdownTracing(ctx), shutdownMetrics(ctx), shutdownPprof(ctx))
+	}
+	cmd.AddCommand(newDaemonCommand(ctx, v))
+	cmd.AddCommand(newDiffCommand(ctx, v))
+	cmd.AddCommand(newDumpCommand(ctx, v))
+	cmd.AddCommand(newExportCommand(ctx, v))
+	cmd.AddCommand(newLeastPrivilegeCommand(ctx, v))
+	cmd.AddCommand(newOrphanedPermissionsCommand(ctx))
+	cmd.AddCommand(newRedundantGroupPermissionsCommand(ctx))
+	cmd.AddCommand(newWorkspacesCommand(ctx, v))
+	cmd.AddCommand(newRemoveUserFromGroupsCommand(ctx, v))
+	cmd.AddCommand(newRestrictRepositoryCommand(ctx, v))
 
 	err = cmd.Execute()
 	if err != nil {
@@ -43,6 +97,23 @@ func main() {
 	}
 }
 
+// commandContext initializes the logger of a subcommand and returns a context which is cancelled
+// on SIGINT or SIGTERM, so the subcommand stops issuing requests and shuts down promptly.
+func commandContext(ctx context.Context, v *viper.Viper) (context.Context, context.CancelFunc, error) {
+	runCtx, err := logging.Init(
+		ctx,
+		logging.WithLogFormat(v.GetString("log-format")),
+		logging.WithLogLevel(v.GetString("log-level")),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	runCtx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+
+	return runCtx, stop, nil
+}
+
 func constructAuth(v *viper.Viper) (uhttp.AuthCredentials, error) {
 	accessToken := v.GetString(tokenField.FieldName)
 	username := v.GetString(usernameField.FieldName)
@@ -70,9 +141,88 @@ func constructAuth(v *viper.Viper) (uhttp.AuthCredentials, error) {
 	return nil, fmt.Errorf("invalid config")
 }
 
+// constructWorkspaceAuth maps workspace slugs to the access tokens configured for them.
+func constructWorkspaceAuth(v *viper.Viper) (map[string]uhttp.AuthCredentials, error) {
+	workspaceTokens := v.GetStringSlice(workspaceTokensField.FieldName)
+	if len(workspaceTokens) == 0 {
+		return nil, nil
+	}
+
+	auth := make(map[string]uhttp.AuthCredentials, len(workspaceTokens))
+	for _, workspaceToken := range workspaceTokens {
+		workspaceSlug, token, ok := strings.Cut(workspaceToken, "=")
+		if !ok || workspaceSlug == "" || token == "" {
+			return nil, fmt.Errorf("invalid workspace token, expected <workspace-slug>=<token>")
+		}
+
+		if _, ok := auth[workspaceSlug]; ok {
+			return nil, fmt.Errorf("multiple tokens provided for workspace %s", workspaceSlug)
+		}
+
+		auth[workspaceSlug] = uhttp.NewBearerAuth(token)
+	}
+
+	return auth, nil
+}
+
+// constructHeaders parses the extra headers added to every API request.
+func constructHeaders(v *viper.Viper) (http.Header, error) {
+	values := v.GetStringSlice(httpHeadersField.FieldName)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	headers := make(http.Header, len(values))
+	for _, value := range values {
+		name, headerValue, ok := strings.Cut(value, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid http header, expected <name>=<value>")
+		}
+
+		headers.Add(name, strings.TrimSpace(headerValue))
+	}
+
+	return headers, nil
+}
+
 func getConnector(ctx context.Context, v *viper.Viper) (types.ConnectorServer, error) {
 	l := ctxzap.Extract(ctx)
 
+	bitbucketConnector, err := newBitbucketConnector(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := connectorbuilder.NewConnector(ctx, bitbucketConnector)
+	if err != nil {
+		l.Error("error creating connector", zap.Error(err))
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// newBitbucketConnector creates the connector from provided configuration.
+func newBitbucketConnector(ctx context.Context, v *viper.Viper) (*connector.Bitbucket, error) {
+	l := ctxzap.Extract(ctx)
+
+	config, auth, err := newConnectorConfig(v)
+	if err != nil {
+		return nil, err
+	}
+
+	bitbucketConnector, err := connector.New(ctx, config, auth)
+	if err != nil {
+		l.Error("error creating connector", zap.Error(err))
+		return nil, err
+	}
+
+	return bitbucketConnector, nil
+}
+
+// newConnectorConfig reads the connector configuration and the default credentials from provided configuration.
+func newConnectorConfig(v *viper.Viper) (connector.Config, uhttp.AuthCredentials, error) {
 	accessToken := v.GetString(tokenField.FieldName)
 	accessTokenNotSet := (accessToken == "")
 	username := v.GetString(usernameField.FieldName)
@@ -84,27 +234,89 @@ func getConnector(ctx context.Context, v *viper.Viper) (types.ConnectorServer, e
 	basicNotSet := (username == "" || password == "")
 	oauthNotSet := (consumerId == "" || consumerSecret == "")
 
-	if accessTokenNotSet && basicNotSet && oauthNotSet {
-		return nil, fmt.Errorf("either an access token, username and password or consumer key and secret must be provided")
+	// the secrets may be read from files, so the pairs can't be required together by the flags
+	if (username == "") != (password == "") {
+		return connector.Config{}, nil, fmt.Errorf("--username and --app-password (or --app-password-file) must be set together")
+	}
+	if (consumerId == "") != (consumerSecret == "") {
+		return connector.Config{}, nil, fmt.Errorf("--consumer-key and --consumer-secret (or --consumer-secret-file) must be set together")
 	}
 
-	// compose the auth options
-	auth, err := constructAuth(v)
+	workspaceAuth, err := constructWorkspaceAuth(v)
 	if err != nil {
-		return nil, err
+		return connector.Config{}, nil, err
 	}
 
-	bitbucketConnector, err := connector.New(ctx, workspaces, auth)
+	headers, err := constructHeaders(v)
 	if err != nil {
-		l.Error("error creating connector", zap.Error(err))
-		return nil, err
+		return connector.Config{}, nil, err
 	}
 
-	c, err := connectorbuilder.NewConnector(ctx, bitbucketConnector)
-	if err != nil {
-		l.Error("error creating connector", zap.Error(err))
-		return nil, err
+	var auth uhttp.AuthCredentials
+	if accessTokenNotSet && basicNotSet && oauthNotSet {
+		// default credentials are optional when all synced workspaces have their own
+		if len(workspaceAuth) == 0 {
+			return connector.Config{}, nil, fmt.Errorf("either an access token, username and password or consumer key and secret must be provided")
+		}
+	} else {
+		// compose the auth options
+		auth, err = constructAuth(v)
+		if err != nil {
+			return connector.Config{}, nil, err
+		}
 	}
 
-	return c, nil
+	config := connector.Config{
+		Workspaces:      workspaces,
+		DebugHTTP:       v.GetBool(debugHTTPField.FieldName),
+		DebugHTTPBodies: v.GetBool(debugHTTPBodyField.FieldName),
+		Headers:         headers,
+		Transport: bitbucket.TransportConfig{
+			MaxIdleConns:        v.GetInt(httpMaxIdleConnsField.FieldName),
+			MaxIdleConnsPerHost: v.GetInt(httpMaxIdleConnsPerHostField.FieldName),
+			MaxConnsPerHost:     v.GetInt(httpMaxConnsPerHostField.FieldName),
+			IdleConnTimeout:     time.Duration(v.GetInt(httpIdleConnTimeoutField.FieldName)) * time.Second,
+			DisableHTTP2:        v.GetBool(httpDisableHTTP2Field.FieldName),
+		},
+		HTTPCache: bitbucket.HTTPCacheConfig{
+			Dir:      v.GetString(cacheDirField.FieldName),
+			TTL:      time.Duration(v.GetInt(cacheTTLField.FieldName)) * time.Second,
+			MaxSize:  v.GetInt(cacheMaxSizeField.FieldName),
+			Disabled: v.GetBool(disableHTTPCacheField.FieldName),
+		},
+		Retry: connector.RetryConfig{
+			MaxRetries:     v.GetInt(writeMaxRetriesField.FieldName),
+			InitialBackoff: time.Duration(v.GetInt(writeRetryBackoffField.FieldName)) * time.Second,
+			MaxBackoff:     time.Duration(v.GetInt(writeRetryMaxBackoffField.FieldName)) * time.Second,
+		},
+		SyncTimeout:                 time.Duration(v.GetInt(syncTimeoutField.FieldName)) * time.Second,
+		CheckpointDir:               v.GetString(checkpointDirField.FieldName),
+		CheckpointMaxAge:            time.Duration(v.GetInt(checkpointMaxAgeField.FieldName)) * time.Second,
+		ReadOnly:                    v.GetBool(readOnlyField.FieldName),
+		SkipGrantPreflight:          v.GetBool(skipGrantPreflightField.FieldName),
+		SkipProjectRepositoryGrants: v.GetBool(skipProjectRepositoryGrantsField.FieldName),
+
+		EntitlementDisplayNameTemplate: v.GetString(entitlementDisplayNameTemplateField.FieldName),
+		EntitlementDescriptionTemplate: v.GetString(entitlementDescriptionTemplateField.FieldName),
+		ManagedGroups:                  v.GetStringSlice(managedGroupsField.FieldName),
+		AtlassianOrgId:                 v.GetString(atlassianOrgIdField.FieldName),
+		AtlassianAPIKey:                v.GetString(atlassianAPIKeyField.FieldName),
+		DirectoryId:                    v.GetString(directoryIdField.FieldName),
+		DirectoryAPIKey:                v.GetString(directoryAPIKeyField.FieldName),
+		SyncUserEmails:                 v.GetBool(syncUserEmailsField.FieldName),
+		ResolveOrgEmails:               v.GetBool(resolveOrgEmailsField.FieldName),
+		DeduplicateUsers:               v.GetBool(deduplicateUsersField.FieldName),
+		GlobalUsers:                    v.GetBool(globalUsersField.FieldName),
+		SkipUserStatus:                 v.GetBool(skipUserStatusField.FieldName),
+		SyncExternalCollaborators:      v.GetBool(syncExternalCollaboratorsField.FieldName),
+		UserFetchConcurrency:           v.GetInt(userFetchConcurrencyField.FieldName),
+		MaxConcurrentRequests:          v.GetInt(maxConcurrentRequestsField.FieldName),
+		DefaultAccessEntitlement:       v.GetBool(defaultAccessEntitlementField.FieldName),
+		DefaultMemberGroup:             v.GetString(defaultMemberGroupField.FieldName),
+		GroupsAsRoles:                  v.GetBool(groupsAsRolesField.FieldName),
+		StaleRepositoryAge:             time.Duration(v.GetInt(staleRepositoryDaysField.FieldName)) * 24 * time.Hour,
+		WorkspaceCredentials:           workspaceAuth,
+	}
+
+	return config, auth, nil
 }
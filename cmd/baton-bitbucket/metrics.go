@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+)
+
+// setupMetrics serves the connector metrics in the Prometheus format on /metrics of the
+// configured address, so a long-running connector can be monitored like any other service.
+// The returned function stops the listener.
+func setupMetrics(ctx context.Context, v *viper.Viper) (func(context.Context) error, error) {
+	addr := v.GetString(metricsListenAddrField.FieldName)
+	if addr == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	otel.SetMeterProvider(provider)
+
+	registry := prometheus.NewRegistry()
+	err := registry.Register(&otelCollector{reader: reader})
+	if err != nil {
+		return nil, fmt.Errorf("failed to register the metrics collector: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics requests: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		ErrorLog: zap.NewStdLog(ctxzap.Extract(ctx)),
+		// serve the metrics which could be collected, a single invalid metric shouldn't hide the others
+		ErrorHandling: promhttp.ContinueOnError,
+	}))
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ctxzap.Extract(ctx).Error("metrics listener failed", zap.Error(err))
+		}
+	}()
+
+	return func(ctx context.Context) error {
+		return errors.Join(server.Shutdown(ctx), provider.Shutdown(ctx))
+	}, nil
+}
+
+// otelCollector exposes the metrics recorded with OpenTelemetry to the Prometheus registry. Metric
+// names have dots replaced with underscores and monotonic sums get the _total suffix. The collector
+// is unchecked: the registry validates the collected metrics and merges the ones sharing a name.
+type otelCollector struct {
+	reader *sdkmetric.ManualReader
+}
+
+func (c *otelCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c *otelCollector) Collect(ch chan<- prometheus.Metric) {
+	var rm metricdata.ResourceMetrics
+	err := c.reader.Collect(context.Background(), &rm)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(prometheus.NewInvalidDesc(err), err)
+		return
+	}
+
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			name := prometheusName(m.Name)
+
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				collectSum(ch, name, m.Description, data.IsMonotonic, data.DataPoints)
+			case metricdata.Sum[float64]:
+				collectSum(ch, name, m.Description, data.IsMonotonic, data.DataPoints)
+			case metricdata.Gauge[int64]:
+				collectPoints(ch, name, m.Description, prometheus.GaugeValue, data.DataPoints)
+			case metricdata.Gauge[float64]:
+				collectPoints(ch, name, m.Description, prometheus.GaugeValue, data.DataPoints)
+			case metricdata.Histogram[int64]:
+				collectHistogram(ch, name, m.Description, data.DataPoints)
+			case metricdata.Histogram[float64]:
+				collectHistogram(ch, name, m.Description, data.DataPoints)
+			}
+		}
+	}
+}
+
+func collectSum[N int64 | float64](ch chan<- prometheus.Metric, name, description string, monotonic bool, points []metricdata.DataPoint[N]) {
+	if !monotonic {
+		collectPoints(ch, name, description, prometheus.GaugeValue, points)
+		return
+	}
+
+	collectPoints(ch, name+"_total", description, prometheus.CounterValue, points)
+}
+
+func collectPoints[N int64 | float64](ch chan<- prometheus.Metric, name, description string, valueType prometheus.ValueType, points []metricdata.DataPoint[N]) {
+	for _, point := range points {
+		labels, values := prometheusLabels(point.Attributes)
+		desc := prometheus.NewDesc(name, description, labels, nil)
+
+		metric, err := prometheus.NewConstMetric(desc, valueType, float64(point.Value), values...)
+		if err != nil {
+			metric = prometheus.NewInvalidMetric(desc, err)
+		}
+		ch <- metric
+	}
+}
+
+func collectHistogram[N int64 | float64](ch chan<- prometheus.Metric, name, description string, points []metricdata.HistogramDataPoint[N]) {
+	for _, point := range points {
+		labels, values := prometheusLabels(point.Attributes)
+		desc := prometheus.NewDesc(name, description, labels, nil)
+
+		// OpenTelemetry bucket counts are per bucket, Prometheus buckets are cumulative
+		buckets := make(map[float64]uint64, len(point.Bounds))
+		var cumulative uint64
+		for i, bound := range point.Bounds {
+			cumulative += point.BucketCounts[i]
+			buckets[bound] = cumulative
+		}
+
+		metric, err := prometheus.NewConstHistogram(desc, point.Count, float64(point.Sum), buckets, values...)
+		if err != nil {
+			metric = prometheus.NewInvalidMetric(desc, err)
+		}
+		ch <- metric
+	}
+}
+
+// prometheusLabels returns the names and values of the labels of the attributes.
+func prometheusLabels(attrs attribute.Set) ([]string, []string) {
+	names := make([]string, 0, attrs.Len())
+	values := make([]string, 0, attrs.Len())
+	for _, kv := range attrs.ToSlice() {
+		names = append(names, prometheusName(string(kv.Key)))
+		values = append(values, kv.Value.Emit())
+	}
+
+	return names, values
+}
+
+func prometheusName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/conductorone/baton-bitbucket/pkg/connector"
+	"github.com/spf13/cobra"
+)
+
+// errOrphanedGrants makes the orphaned-permissions command exit with a failure when --exit-code is set and grants were found.
+var errOrphanedGrants = errors.New("orphaned permissions found")
+
+func newOrphanedPermissionsCommand(ctx context.Context) *cobra.Command {
+	var format string
+	var exitCode bool
+
+	cmd := &cobra.Command{
+		Use:   "orphaned-permissions <sync.c1z>",
+		Short: "Print the permissions of a sync held by users which are not active members of the workspace",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if format != workspacesFormatTable && format != exportFormatJSON {
+				return fmt.Errorf("unsupported output format: %s", format)
+			}
+
+			resources, grants, err := readSync(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			orphans, err := connector.FindOrphanedGrants(resources, grants)
+			if err != nil {
+				return err
+			}
+
+			if format == exportFormatJSON {
+				err = writeJSONOrphans(os.Stdout, orphans)
+			} else {
+				err = writeTableOrphans(os.Stdout, orphans)
+			}
+			if err != nil {
+				return err
+			}
+
+			if exitCode && len(orphans) > 0 {
+				return errOrphanedGrants
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", workspacesFormatTable, "Output format of the report: table, json")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with a failure when any orphaned permission was found")
+
+	return cmd
+}
+
+func writeTableOrphans(out io.Writer, orphans []connector.OrphanedGrant) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	users := make(map[string]struct{})
+	fmt.Fprintln(w, "REASON\tWORKSPACE\tUSER\tRESOURCE TYPE\tRESOURCE\tENTITLEMENT")
+	for _, o := range orphans {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			o.Reason,
+			displayName(o.WorkspaceName, o.WorkspaceId),
+			displayName(o.PrincipalName, o.PrincipalId),
+			o.ResourceType,
+			displayName(o.ResourceName, o.ResourceId),
+			o.Entitlement,
+		)
+
+		users[o.PrincipalId] = struct{}{}
+	}
+
+	fmt.Fprintf(w, "\n%d orphaned permissions held by %d users\n", len(orphans), len(users))
+
+	return w.Flush()
+}
+
+func writeJSONOrphans(out io.Writer, orphans []connector.OrphanedGrant) error {
+	if orphans == nil {
+		orphans = []connector.OrphanedGrant{}
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(orphans)
+}
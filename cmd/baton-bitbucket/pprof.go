@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// setupPprof serves the Go runtime profiles under /debug/pprof/ of the configured address,
+// e.g. to find what keeps memory growing during very large syncs. The returned function stops the listener.
+func setupPprof(ctx context.Context, v *viper.Viper) (func(context.Context) error, error) {
+	addr := v.GetString(pprofListenAddrField.FieldName)
+	if addr == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for pprof requests: %w", err)
+	}
+
+	// the default mux is not used, so the profiles are only exposed on the pprof listener
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctxzap.Extract(ctx).Info("serving pprof profiles", zap.String("address", listener.Addr().String()))
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ctxzap.Extract(ctx).Error("pprof listener failed", zap.Error(err))
+		}
+	}()
+
+	return server.Shutdown, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/conductorone/baton-bitbucket/pkg/connector"
+	"github.com/spf13/cobra"
+)
+
+// errRedundantGroupGrants makes the redundant-group-permissions command exit with a failure when --exit-code is set and permissions were found.
+var errRedundantGroupGrants = errors.New("redundant group permissions found")
+
+func newRedundantGroupPermissionsCommand(ctx context.Context) *cobra.Command {
+	var format string
+	var exitCode bool
+
+	cmd := &cobra.Command{
+		Use:   "redundant-group-permissions <sync.c1z>",
+		Short: "Print the user group permissions of a sync whose members all have equal or higher direct access",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if format != workspacesFormatTable && format != exportFormatJSON {
+				return fmt.Errorf("unsupported output format: %s", format)
+			}
+
+			resources, grants, err := readSync(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			redundant, err := connector.FindRedundantGroupGrants(resources, grants)
+			if err != nil {
+				return err
+			}
+
+			if format == exportFormatJSON {
+				err = writeJSONRedundantGroupGrants(os.Stdout, redundant)
+			} else {
+				err = writeTableRedundantGroupGrants(os.Stdout, redundant)
+			}
+			if err != nil {
+				return err
+			}
+
+			if exitCode && len(redundant) > 0 {
+				return errRedundantGroupGrants
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", workspacesFormatTable, "Output format of the report: table, json")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with a failure when any redundant group permission was found")
+
+	return cmd
+}
+
+func writeTableRedundantGroupGrants(out io.Writer, redundant []connector.RedundantGroupGrant) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	groups := make(map[string]struct{})
+	fmt.Fprintln(w, "WORKSPACE\tGROUP\tRESOURCE TYPE\tRESOURCE\tENTITLEMENT\tPERMISSION\tMEMBERS")
+	for _, r := range redundant {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n",
+			displayName(r.WorkspaceName, r.WorkspaceId),
+			displayName(r.GroupName, r.GroupId),
+			r.ResourceType,
+			displayName(r.ResourceName, r.ResourceId),
+			r.Entitlement,
+			r.Permission,
+			r.Members,
+		)
+
+		groups[r.GroupId] = struct{}{}
+	}
+
+	fmt.Fprintf(w, "\n%d redundant permissions of %d user groups, their members have equal or higher access directly\n", len(redundant), len(groups))
+
+	return w.Flush()
+}
+
+func writeJSONRedundantGroupGrants(out io.Writer, redundant []connector.RedundantGroupGrant) error {
+	if redundant == nil {
+		redundant = []connector.RedundantGroupGrant{}
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(redundant)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/spf13/viper"
+)
+
+const (
+	vaultRefScheme = "vault://"
+	awsSMRefScheme = "aws-sm://"
+
+	secretRefTimeout = 30 * time.Second
+)
+
+// resolveSecretReferences replaces option values referencing a secret of HashiCorp Vault
+// (vault://<path>#<key>) or AWS Secrets Manager (aws-sm://<secret-id>[#<key>]) by the secret,
+// so plaintext credentials don't have to be passed to the connector at all.
+func resolveSecretReferences(ctx context.Context, v *viper.Viper) error {
+	ctx, cancel := context.WithTimeout(ctx, secretRefTimeout)
+	defer cancel()
+
+	for _, f := range configFields {
+		if f.FieldType != reflect.String {
+			continue
+		}
+
+		ref := v.GetString(f.FieldName)
+
+		var secret string
+		var err error
+		switch {
+		case strings.HasPrefix(ref, vaultRefScheme):
+			secret, err = readVaultSecret(ctx, strings.TrimPrefix(ref, vaultRefScheme))
+		case strings.HasPrefix(ref, awsSMRefScheme):
+			secret, err = readAWSSecret(ctx, strings.TrimPrefix(ref, awsSMRefScheme))
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to resolve the secret of --%s: %w", f.FieldName, err)
+		}
+
+		v.Set(f.FieldName, secret)
+	}
+
+	return nil
+}
+
+// readVaultSecret reads the key of a secret from the Vault server at $VAULT_ADDR with $VAULT_TOKEN.
+// The path is the API path of the secret, e.g. secret/data/bitbucket for the KV v2 engine mounted at secret.
+func readVaultSecret(ctx context.Context, ref string) (string, error) {
+	secretPath, key, ok := strings.Cut(ref, "#")
+	if !ok || secretPath == "" || key == "" {
+		return "", fmt.Errorf("invalid vault reference, expected vault://<path>#<key>")
+	}
+
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR must be set to resolve vault references")
+	}
+
+	secretURL, err := url.JoinPath(addr, "v1", secretPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid VAULT_ADDR: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, secretURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault responded with %s for %s", resp.Status, secretPath)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse vault response: %w", err)
+	}
+
+	// the KV v2 engine nests the secret under data, next to its metadata
+	data := body.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	secret, ok := data[key].(string)
+	if !ok || secret == "" {
+		return "", fmt.Errorf("vault secret %s has no key %s", secretPath, key)
+	}
+
+	return secret, nil
+}
+
+// readAWSSecret reads a secret of AWS Secrets Manager with the default AWS credentials. With a key,
+// the secret is parsed as a JSON object and the value of the key is returned.
+func readAWSSecret(ctx context.Context, ref string) (string, error) {
+	secretId, key, hasKey := strings.Cut(ref, "#")
+	if secretId == "" || (hasKey && key == "") {
+		return "", fmt.Errorf("invalid aws-sm reference, expected aws-sm://<secret-id>[#<key>]")
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretId),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	secret := aws.ToString(out.SecretString)
+	if !hasKey {
+		return secret, nil
+	}
+
+	var values map[string]interface{}
+	err = json.Unmarshal([]byte(secret), &values)
+	if err != nil {
+		return "", fmt.Errorf("aws secret %s is not a JSON object: %w", secretId, err)
+	}
+
+	value, ok := values[key].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("aws secret %s has no key %s", secretId, key)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/conductorone/baton-sdk/pkg/field"
+	"github.com/spf13/viper"
+)
+
+// secretFileFields maps the credential options to the options reading them from a file.
+var secretFileFields = []struct {
+	secret field.SchemaField
+	file   field.SchemaField
+}{
+	{secret: passwordField, file: passwordFileField},
+	{secret: tokenField, file: tokenFileField},
+	{secret: consumerSecretField, file: consumerSecretFileField},
+}
+
+// loadSecretFiles sets the credentials read from files, e.g. Kubernetes secrets mounted into the
+// container, so they don't have to be passed through environment variables. The trailing newline
+// most secret files end with is trimmed.
+func loadSecretFiles(v *viper.Viper) error {
+	for _, f := range secretFileFields {
+		path := v.GetString(f.file.FieldName)
+		if path == "" {
+			continue
+		}
+
+		// the secret is set by this function, so the options can't be declared mutually exclusive
+		if v.GetString(f.secret.FieldName) != "" {
+			return fmt.Errorf("only one of --%s and --%s can be set", f.secret.FieldName, f.file.FieldName)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read --%s: %w", f.file.FieldName, err)
+		}
+
+		secret := strings.TrimSpace(string(content))
+		if secret == "" {
+			return fmt.Errorf("--%s is empty: %s", f.file.FieldName, path)
+		}
+
+		v.Set(f.secret.FieldName, secret)
+	}
+
+	return nil
+}
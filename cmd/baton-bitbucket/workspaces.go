@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const workspacesFormatTable = "table"
+
+func newWorkspacesCommand(ctx context.Context, v *viper.Viper) *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "list-workspaces",
+		Short: "List the workspaces visible to the configured credentials along with their permission level",
+		RunE: func(*cobra.Command, []string) error {
+			if format != workspacesFormatTable && format != exportFormatJSON {
+				return fmt.Errorf("unsupported output format: %s", format)
+			}
+
+			runCtx, stop, err := commandContext(ctx, v)
+			if err != nil {
+				return err
+			}
+			defer stop()
+
+			// the listing is meant to build the workspace selection, so it must not be limited by it
+			v.Set(workspacesField.FieldName, []string{})
+
+			bb, err := newBitbucketConnector(runCtx, v)
+			if err != nil {
+				return err
+			}
+
+			_, err = bb.Validate(runCtx)
+			if err != nil {
+				return err
+			}
+
+			workspaces, err := bb.AccessibleWorkspaces(runCtx)
+			if err != nil {
+				return err
+			}
+
+			if format == exportFormatJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+
+				return enc.Encode(workspaces)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SLUG\tID\tNAME\tPERMISSION")
+			for _, workspace := range workspaces {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", workspace.Slug, workspace.Id, workspace.Name, workspace.Permission)
+			}
+
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", workspacesFormatTable, "Output format of the listing: table, json")
+
+	return cmd
+}
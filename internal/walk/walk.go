@@ -0,0 +1,162 @@
+// Package walk traverses the resources of a connector the way a sync does, for the commands and
+// tests which need them without running a sync.
+package walk
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+)
+
+// Resources calls fn for every resource reachable from the top-level resources of the connector,
+// the same way a sync traverses them. Parents are always visited before their children.
+func Resources(ctx context.Context, c connectorbuilder.ConnectorBuilder, fn func(resource *v2.Resource) error) error {
+	type listing struct {
+		resourceTypeId string
+		parentId       *v2.ResourceId
+	}
+
+	// like a sync, start with the top-level resources of every resource type
+	syncers := make(map[string]connectorbuilder.ResourceSyncer)
+	var queue []listing
+	for _, syncer := range c.ResourceSyncers(ctx) {
+		resourceTypeId := syncer.ResourceType(ctx).Id
+		syncers[resourceTypeId] = syncer
+		queue = append(queue, listing{resourceTypeId: resourceTypeId})
+	}
+
+	seen := make(map[string]struct{})
+
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+
+		syncer, ok := syncers[next.resourceTypeId]
+		if !ok {
+			return fmt.Errorf("bitbucket-connector: unknown resource type: %s", next.resourceTypeId)
+		}
+
+		pageToken := ""
+		for {
+			err := ctx.Err()
+			if err != nil {
+				return err
+			}
+
+			resources, nextPageToken, _, err := syncer.List(ctx, next.parentId, &pagination.Token{Token: pageToken})
+			if err != nil {
+				return err
+			}
+
+			for _, resource := range resources {
+				key := resource.Id.ResourceType + "/" + resource.Id.Resource
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+
+				err = fn(resource)
+				if err != nil {
+					return err
+				}
+
+				annos := annotations.Annotations(resource.Annotations)
+				for _, a := range annos {
+					child := &v2.ChildResourceType{}
+					if !a.MessageIs(child) {
+						continue
+					}
+
+					err = a.UnmarshalTo(child)
+					if err != nil {
+						return err
+					}
+
+					queue = append(queue, listing{resourceTypeId: child.ResourceTypeId, parentId: resource.Id})
+				}
+			}
+
+			if nextPageToken == "" {
+				break
+			}
+			pageToken = nextPageToken
+		}
+	}
+
+	return nil
+}
+
+// ResourceSyncer returns the syncer of the resource type.
+func ResourceSyncer(ctx context.Context, c connectorbuilder.ConnectorBuilder, resourceTypeId string) (connectorbuilder.ResourceSyncer, error) {
+	for _, syncer := range c.ResourceSyncers(ctx) {
+		if syncer.ResourceType(ctx).Id == resourceTypeId {
+			return syncer, nil
+		}
+	}
+
+	return nil, fmt.Errorf("bitbucket-connector: unknown resource type: %s", resourceTypeId)
+}
+
+// Entitlements returns all entitlements of provided resource.
+func Entitlements(ctx context.Context, c connectorbuilder.ConnectorBuilder, resource *v2.Resource) ([]*v2.Entitlement, error) {
+	syncer, err := ResourceSyncer(ctx, c, resource.Id.ResourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*v2.Entitlement
+
+	pageToken := ""
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		entitlements, nextPageToken, _, err := syncer.Entitlements(ctx, resource, &pagination.Token{Token: pageToken})
+		if err != nil {
+			return nil, err
+		}
+
+		rv = append(rv, entitlements...)
+
+		if nextPageToken == "" {
+			return rv, nil
+		}
+		pageToken = nextPageToken
+	}
+}
+
+// Grants returns all grants of provided resource.
+func Grants(ctx context.Context, c connectorbuilder.ConnectorBuilder, resource *v2.Resource) ([]*v2.Grant, error) {
+	syncer, err := ResourceSyncer(ctx, c, resource.Id.ResourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*v2.Grant
+
+	pageToken := ""
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		grants, nextPageToken, _, err := syncer.Grants(ctx, resource, &pagination.Token{Token: pageToken})
+		if err != nil {
+			return nil, err
+		}
+
+		rv = append(rv, grants...)
+
+		if nextPageToken == "" {
+			return rv, nil
+		}
+		pageToken = nextPageToken
+	}
+}
@@ -0,0 +1,162 @@
+package atlassian
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+)
+
+const (
+	BaseURL = "https://api.atlassian.com/admin/v1/"
+
+	OrgEventsBaseURL = BaseURL + "orgs/%s/events"
+	OrgUsersBaseURL  = BaseURL + "orgs/%s/users"
+)
+
+// Client talks to the Atlassian Admin API of a single organization.
+type Client struct {
+	wrapper *uhttp.BaseHttpClient
+	orgId   string
+	headers http.Header
+}
+
+// NewClient creates a client for the organization with given id, authenticated by an organization API key.
+func NewClient(ctx context.Context, orgId string, apiKey string) (*Client, error) {
+	httpClient, err := uhttp.NewBearerAuth(apiKey).GetClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapper, err := uhttp.NewBaseHttpClientWithContext(ctx, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		wrapper: wrapper,
+		orgId:   orgId,
+	}, nil
+}
+
+type errorResponse struct {
+	Errors []struct {
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+func (er *errorResponse) Message() string {
+	if len(er.Errors) == 0 {
+		return "Error: unknown"
+	}
+
+	return fmt.Sprintf("Error: %s %s", er.Errors[0].Title, er.Errors[0].Detail)
+}
+
+// SetHeaders sets static headers added to every request sent to the Admin API.
+func (c *Client) SetHeaders(headers http.Header) {
+	c.headers = headers.Clone()
+}
+
+// ListEvents lists audit events of the organization which happened since provided time,
+// oldest first. The returned cursor is empty when there are no more pages.
+func (c *Client) ListEvents(ctx context.Context, since time.Time, cursor string) ([]Event, string, error) {
+	urlAddress, err := url.Parse(fmt.Sprintf(OrgEventsBaseURL, url.PathEscape(c.orgId)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := urlAddress.Query()
+	if !since.IsZero() {
+		query.Set("from", strconv.FormatInt(since.UnixMilli(), 10))
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	query.Set("sortOrder", "asc")
+	urlAddress.RawQuery = query.Encode()
+
+	var eventsResponse ListResponse[Event]
+	err = c.get(ctx, urlAddress, &eventsResponse)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return eventsResponse.Data, eventsResponse.Meta.Next, nil
+}
+
+// ListUsers lists a page of managed accounts of the organization.
+// The returned cursor is empty when there are no more pages.
+func (c *Client) ListUsers(ctx context.Context, cursor string) ([]OrgUser, string, error) {
+	urlAddress, err := url.Parse(fmt.Sprintf(OrgUsersBaseURL, url.PathEscape(c.orgId)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if cursor != "" {
+		query := urlAddress.Query()
+		query.Set("cursor", cursor)
+		urlAddress.RawQuery = query.Encode()
+	}
+
+	var usersResponse ListResponse[OrgUser]
+	err = c.get(ctx, urlAddress, &usersResponse)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return usersResponse.Data, usersResponse.Links.Next, nil
+}
+
+// ListAllUsers lists all managed accounts of the organization looping through all pages.
+func (c *Client) ListAllUsers(ctx context.Context) ([]OrgUser, error) {
+	var rv []OrgUser
+
+	cursor := ""
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		users, next, err := c.ListUsers(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		rv = append(rv, users...)
+
+		if next == "" {
+			return rv, nil
+		}
+		cursor = next
+	}
+}
+
+func (c *Client) get(ctx context.Context, urlAddress *url.URL, resourceResponse interface{}) error {
+	return get(ctx, c.wrapper, c.headers, urlAddress, resourceResponse)
+}
+
+func get(ctx context.Context, wrapper *uhttp.BaseHttpClient, headers http.Header, urlAddress *url.URL, resourceResponse interface{}) error {
+	req, err := wrapper.NewRequest(ctx, http.MethodGet, urlAddress, uhttp.WithAcceptJSONHeader())
+	if err != nil {
+		return err
+	}
+
+	for name, values := range headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+
+	var errRes errorResponse
+	resp, err := wrapper.Do(req, uhttp.WithErrorResponse(&errRes), uhttp.WithJSONResponse(resourceResponse))
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+
+	return err
+}
@@ -0,0 +1,140 @@
+package atlassian
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+)
+
+const (
+	SCIMBaseURL = "https://api.atlassian.com/scim/"
+
+	DirectoryUsersBaseURL  = SCIMBaseURL + "directory/%s/Users"
+	DirectoryGroupsBaseURL = SCIMBaseURL + "directory/%s/Groups"
+
+	directoryPageSize = 100
+)
+
+// DirectoryClient reads users and groups of an Atlassian Access user directory via SCIM.
+type DirectoryClient struct {
+	wrapper     *uhttp.BaseHttpClient
+	directoryId string
+	headers     http.Header
+}
+
+// NewDirectoryClient creates a client for the directory with given id, authenticated by a SCIM API key.
+func NewDirectoryClient(ctx context.Context, directoryId string, apiKey string) (*DirectoryClient, error) {
+	httpClient, err := uhttp.NewBearerAuth(apiKey).GetClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapper, err := uhttp.NewBaseHttpClientWithContext(ctx, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DirectoryClient{
+		wrapper:     wrapper,
+		directoryId: directoryId,
+	}, nil
+}
+
+// SetHeaders sets static headers added to every request sent to the SCIM API.
+func (c *DirectoryClient) SetHeaders(headers http.Header) {
+	c.headers = headers.Clone()
+}
+
+// ListUsers lists a page of directory users, startIndex is 1-based as defined by SCIM.
+// It returns the index of the next page or 0 when there are no more users.
+func (c *DirectoryClient) ListUsers(ctx context.Context, startIndex int) ([]DirectoryUser, int, error) {
+	urlAddress, err := url.Parse(fmt.Sprintf(DirectoryUsersBaseURL, url.PathEscape(c.directoryId)))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := urlAddress.Query()
+	query.Set("startIndex", strconv.Itoa(startIndex))
+	query.Set("count", strconv.Itoa(directoryPageSize))
+	urlAddress.RawQuery = query.Encode()
+
+	var usersResponse SCIMListResponse[DirectoryUser]
+	err = get(ctx, c.wrapper, c.headers, urlAddress, &usersResponse)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	next := startIndex + len(usersResponse.Resources)
+	if len(usersResponse.Resources) == 0 || next > usersResponse.TotalResults {
+		next = 0
+	}
+
+	return usersResponse.Resources, next, nil
+}
+
+// ListAllUsers lists all directory users looping through all pages.
+func (c *DirectoryClient) ListAllUsers(ctx context.Context) ([]DirectoryUser, error) {
+	var rv []DirectoryUser
+
+	startIndex := 1
+	for startIndex != 0 {
+		users, next, err := c.ListUsers(ctx, startIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		rv = append(rv, users...)
+		startIndex = next
+	}
+
+	return rv, nil
+}
+
+// ListGroups lists a page of directory groups, the groups an identity provider provisions via SCIM.
+// startIndex is 1-based as defined by SCIM, it returns the index of the next page or 0 when there are no more groups.
+func (c *DirectoryClient) ListGroups(ctx context.Context, startIndex int) ([]SCIMGroup, int, error) {
+	urlAddress, err := url.Parse(fmt.Sprintf(DirectoryGroupsBaseURL, url.PathEscape(c.directoryId)))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := urlAddress.Query()
+	query.Set("startIndex", strconv.Itoa(startIndex))
+	query.Set("count", strconv.Itoa(directoryPageSize))
+	urlAddress.RawQuery = query.Encode()
+
+	var groupsResponse SCIMListResponse[SCIMGroup]
+	err = get(ctx, c.wrapper, c.headers, urlAddress, &groupsResponse)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	next := startIndex + len(groupsResponse.Resources)
+	if len(groupsResponse.Resources) == 0 || next > groupsResponse.TotalResults {
+		next = 0
+	}
+
+	return groupsResponse.Resources, next, nil
+}
+
+// ListAllGroups lists all directory groups looping through all pages.
+func (c *DirectoryClient) ListAllGroups(ctx context.Context) ([]SCIMGroup, error) {
+	var rv []SCIMGroup
+
+	startIndex := 1
+	for startIndex != 0 {
+		groups, next, err := c.ListGroups(ctx, startIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		rv = append(rv, groups...)
+		startIndex = next
+	}
+
+	return rv, nil
+}
@@ -0,0 +1,99 @@
+package atlassian
+
+import "time"
+
+type ListResponse[T any] struct {
+	Data []T `json:"data"`
+	Meta struct {
+		Next     string `json:"next"`
+		PageSize int    `json:"page_size"`
+	} `json:"meta"`
+	Links struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
+// AccountStatusActive is the status of managed accounts which can log in,
+// other statuses are "inactive" (deactivated) and "closed".
+const AccountStatusActive = "active"
+
+type OrgUser struct {
+	AccountId     string `json:"account_id"`
+	AccountType   string `json:"account_type"`
+	AccountStatus string `json:"account_status"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+}
+
+type Event struct {
+	Id         string          `json:"id"`
+	Attributes EventAttributes `json:"attributes"`
+}
+
+type EventAttributes struct {
+	Time    time.Time      `json:"time"`
+	Action  string         `json:"action"`
+	Actor   EventActor     `json:"actor"`
+	Context []EventContext `json:"context"`
+}
+
+type EventActor struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type EventContext struct {
+	Id         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+type SCIMListResponse[T any] struct {
+	TotalResults int `json:"totalResults"`
+	StartIndex   int `json:"startIndex"`
+	ItemsPerPage int `json:"itemsPerPage"`
+	Resources    []T `json:"Resources"`
+}
+
+type DirectoryUser struct {
+	Id          string           `json:"id"`
+	UserName    string           `json:"userName"`
+	DisplayName string           `json:"displayName"`
+	Active      bool             `json:"active"`
+	Emails      []DirectoryEmail `json:"emails"`
+	Groups      []DirectoryGroup `json:"groups"`
+	External    struct {
+		AccountId string `json:"atlassianAccountId"`
+	} `json:"urn:scim:schemas:extension:atlassian-external:1.0"`
+}
+
+type DirectoryEmail struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary"`
+}
+
+type DirectoryGroup struct {
+	Value   string `json:"value"`
+	Display string `json:"display"`
+}
+
+// SCIMGroup is a group of the directory, Atlassian Access syncs it to Bitbucket as a user group of the same name.
+type SCIMGroup struct {
+	Id          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+// PrimaryEmail returns the primary email of the user, or the first one when none is marked as primary.
+func (u *DirectoryUser) PrimaryEmail() string {
+	for _, email := range u.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+
+	return ""
+}
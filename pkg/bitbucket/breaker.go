@@ -0,0 +1,106 @@
+package bitbucket
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+type breakerState struct {
+	failures  int
+	openUntil time.Time
+}
+
+// circuitBreaker pauses requests to an endpoint after it keeps responding with server errors,
+// so a degraded Bitbucket API is not hammered (and rate limit is not burned) by retries.
+type circuitBreaker struct {
+	mtx       sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	endpoints map[string]*breakerState
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		endpoints: make(map[string]*breakerState),
+	}
+}
+
+// wait blocks while the circuit of given endpoint is open.
+func (cb *circuitBreaker) wait(ctx context.Context, endpoint string) error {
+	if cb == nil {
+		return nil
+	}
+
+	cb.mtx.Lock()
+	state, ok := cb.endpoints[endpoint]
+	var openUntil time.Time
+	if ok {
+		openUntil = state.openUntil
+	}
+	cb.mtx.Unlock()
+
+	delay := time.Until(openUntil)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// record updates the circuit of given endpoint based on the response status code.
+func (cb *circuitBreaker) record(ctx context.Context, endpoint string, statusCode int) {
+	if cb == nil {
+		return
+	}
+
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	if statusCode < http.StatusInternalServerError {
+		delete(cb.endpoints, endpoint)
+		return
+	}
+
+	state, ok := cb.endpoints[endpoint]
+	if !ok {
+		state = &breakerState{}
+		cb.endpoints[endpoint] = state
+	}
+
+	state.failures++
+	if state.failures < cb.threshold {
+		return
+	}
+
+	// open the circuit, the next request after cool-down acts as a probe
+	// and another server error opens the circuit right away
+	state.failures = cb.threshold - 1
+	state.openUntil = time.Now().Add(cb.cooldown)
+
+	ctxzap.Extract(ctx).Warn(
+		"bitbucket: endpoint keeps returning server errors, pausing requests",
+		zap.String("endpoint", endpoint),
+		zap.Int("status", statusCode),
+		zap.Duration("cooldown", cb.cooldown),
+	)
+}
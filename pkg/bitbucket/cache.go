@@ -0,0 +1,417 @@
+package bitbucket
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaults of the in-memory cache
+	defaultCacheTTL     = time.Hour
+	defaultCacheMaxSize = 2048
+
+	cacheFileSuffix = ".http"
+)
+
+// HTTPCacheConfig configures where the GET responses of the Bitbucket API are cached and for how long.
+// Zero values keep the defaults of the in-memory cache.
+type HTTPCacheConfig struct {
+	// Dir additionally caches the responses on disk, e.g. on a persistent volume of a container,
+	// so they survive restarts. Empty keeps them in memory only.
+	Dir string
+	// TTL is how long a response is reused.
+	TTL time.Duration
+	// MaxSize bounds the memory and the disk cache each, in megabytes.
+	MaxSize int
+	// Disabled turns both caches off.
+	Disabled bool
+}
+
+// IsSet reports whether any of the cache settings differ from the defaults.
+func (hc HTTPCacheConfig) IsSet() bool {
+	return hc != HTTPCacheConfig{}
+}
+
+func (hc HTTPCacheConfig) ttl() time.Duration {
+	if hc.TTL <= 0 {
+		return defaultCacheTTL
+	}
+
+	return hc.TTL
+}
+
+func (hc HTTPCacheConfig) maxSize() int {
+	if hc.MaxSize <= 0 {
+		return defaultCacheMaxSize
+	}
+
+	return hc.MaxSize
+}
+
+// memoryCache keeps the successful GET responses of a client in memory. Like the disk cache, any
+// other request clears it, as the cached listings can't be told apart from the ones the write changed.
+type memoryCache struct {
+	ttl     time.Duration
+	maxSize int
+
+	mtx     sync.Mutex
+	entries map[string]*list.Element
+	// order holds the entries from the oldest to the newest
+	order *list.List
+	size  int
+}
+
+type memoryCacheEntry struct {
+	key        string
+	statusCode int
+	header     http.Header
+	body       []byte
+	expires    time.Time
+}
+
+// newMemoryCache returns nil, disabling the cache, when caching is disabled.
+func newMemoryCache(config HTTPCacheConfig) *memoryCache {
+	if config.Disabled {
+		return nil
+	}
+
+	return &memoryCache{
+		ttl:     config.ttl(),
+		maxSize: config.maxSize() * 1024 * 1024,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func memoryCacheKey(req *http.Request) string {
+	return req.URL.String() + "\x00" + req.Header.Get("Accept")
+}
+
+// get returns the cached response of the request along with its body, nil when there is none or it expired.
+func (c *memoryCache) get(req *http.Request) (*http.Response, []byte) {
+	if c == nil || req.Method != http.MethodGet {
+		return nil, nil
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	element, ok := c.entries[memoryCacheKey(req)]
+	if !ok {
+		return nil, nil
+	}
+
+	entry := element.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		return nil, nil
+	}
+
+	ctxzap.Extract(req.Context()).Debug("bitbucket: memory cache hit", zap.String("url", req.URL.Path))
+
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", entry.statusCode, http.StatusText(entry.statusCode)),
+		StatusCode: entry.statusCode,
+		Header:     entry.header.Clone(),
+		Body:       io.NopCloser(bytes.NewReader(entry.body)),
+		Request:    req,
+	}, entry.body
+}
+
+// set caches the response of the request, evicting the oldest responses above the size limit.
+func (c *memoryCache) set(req *http.Request, resp *http.Response, body []byte) {
+	if c == nil || len(body) > c.maxSize {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	key := memoryCacheKey(req)
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.order.PushBack(&memoryCacheEntry{
+		key:        key,
+		statusCode: resp.StatusCode,
+		header:     resp.Header.Clone(),
+		body:       body,
+		expires:    time.Now().Add(c.ttl),
+	})
+	c.size += len(body)
+
+	for c.size > c.maxSize {
+		c.remove(c.order.Front())
+	}
+}
+
+// clear removes all cached responses.
+func (c *memoryCache) clear() {
+	if c == nil {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.size = 0
+}
+
+func (c *memoryCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*memoryCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= len(entry.body)
+}
+
+// DiskCache keeps successful GET responses in a directory. It can be shared by the clients of all
+// credentials, the credentials are part of the cache keys. Any other request clears the cache, as
+// the cached listings can't be told apart from the ones the write changed.
+type DiskCache struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+
+	mtx  sync.Mutex
+	size int64
+}
+
+// NewDiskCache returns nil, disabling the disk cache, when no directory is configured or caching is disabled.
+func NewDiskCache(config HTTPCacheConfig) (*DiskCache, error) {
+	if config.Dir == "" || config.Disabled {
+		return nil, nil
+	}
+
+	err := os.MkdirAll(config.Dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket: failed to create cache directory: %w", err)
+	}
+
+	c := &DiskCache{
+		dir:     config.Dir,
+		ttl:     config.ttl(),
+		maxSize: int64(config.maxSize()) * 1024 * 1024,
+	}
+
+	// responses cached by an earlier process count against the size limit
+	for _, entry := range c.entries() {
+		c.size += entry.size
+	}
+
+	return c, nil
+}
+
+// Transport wraps provided transport, which has to send the requests with their credentials
+// already set, so responses are only reused for the same credentials.
+func (c *DiskCache) Transport(next http.RoundTripper) http.RoundTripper {
+	if c == nil {
+		return next
+	}
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &diskCacheTransport{
+		cache: c,
+		next:  next,
+	}
+}
+
+type diskCacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (c *DiskCache) entries() []diskCacheEntry {
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*"+cacheFileSuffix))
+	if err != nil {
+		return nil
+	}
+
+	entries := make([]diskCacheEntry, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, diskCacheEntry{path: path, size: info.Size(), modTime: info.ModTime()})
+	}
+
+	return entries
+}
+
+func (c *DiskCache) path(req *http.Request) string {
+	hash := sha256.New()
+	for _, part := range []string{req.URL.String(), req.Header.Get("Authorization"), req.Header.Get("Accept")} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+
+	return filepath.Join(c.dir, fmt.Sprintf("%x", hash.Sum(nil))+cacheFileSuffix)
+}
+
+// get returns the cached response of the request, nil when there is none or it expired.
+func (c *DiskCache) get(req *http.Request) *http.Response {
+	path := c.path(req)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	if time.Since(info.ModTime()) > c.ttl {
+		c.remove(path, info.Size())
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		c.remove(path, info.Size())
+		return nil
+	}
+
+	return resp
+}
+
+// set caches the dumped response of the request, evicting the oldest responses above the size limit.
+func (c *DiskCache) set(req *http.Request, data []byte) error {
+	path := c.path(req)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if info, err := os.Stat(path); err == nil {
+		c.remove(path, info.Size())
+	}
+
+	// write to a temporary file first, so a crash doesn't leave a truncated response behind
+	f, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	c.size += int64(len(data))
+	if c.size > c.maxSize {
+		c.evict()
+	}
+
+	return nil
+}
+
+// evict removes the oldest responses until the cache is within its size limit.
+func (c *DiskCache) evict() {
+	entries := c.entries()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+
+	for _, entry := range entries {
+		if c.size <= c.maxSize {
+			return
+		}
+
+		c.remove(entry.path, entry.size)
+	}
+}
+
+// Clear removes all cached responses.
+func (c *DiskCache) Clear() {
+	if c == nil {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, entry := range c.entries() {
+		c.remove(entry.path, entry.size)
+	}
+}
+
+func (c *DiskCache) remove(path string, size int64) {
+	if os.Remove(path) == nil {
+		c.size -= size
+	}
+}
+
+type diskCacheTransport struct {
+	cache *DiskCache
+	next  http.RoundTripper
+}
+
+func (t *diskCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l := ctxzap.Extract(req.Context())
+
+	if req.Method != http.MethodGet {
+		t.cache.Clear()
+		return t.next.RoundTrip(req)
+	}
+
+	if resp := t.cache.get(req); resp != nil {
+		l.Debug("bitbucket: disk cache hit", zap.String("url", req.URL.Path))
+		return resp, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	data, err := httputil.DumpResponse(resp, true)
+	// the dump consumed the body, give the caller a fresh one
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err == nil {
+		err = t.cache.set(req, data)
+	}
+	if err != nil {
+		l.Warn("bitbucket: failed to cache response on disk", zap.String("url", req.URL.Path), zap.Error(err))
+	}
+
+	return resp, nil
+}
@@ -1,35 +1,42 @@
 package bitbucket
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 
-	"github.com/conductorone/baton-sdk/pkg/uhttp"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 const (
-	V1BaseURL = "https://api.bitbucket.org/1.0/"
-	BaseURL   = "https://api.bitbucket.org/2.0/"
+	V1BaseURL       = "https://api.bitbucket.org/1.0/"
+	BaseURL         = "https://api.bitbucket.org/2.0/"
+	InternalBaseURL = "https://api.bitbucket.org/internal/"
 
 	WorkspacesBaseURL          = BaseURL + "workspaces"
 	WorkspaceBaseURL           = WorkspacesBaseURL + "/%s"
 	WorkspaceMembersBaseURL    = WorkspacesBaseURL + "/%s/members"
+	WorkspaceMemberBaseURL     = WorkspaceMembersBaseURL + "/%s"
 	WorkspaceProjectsBaseURL   = WorkspacesBaseURL + "/%s/projects"
+	WorkspaceProjectBaseURL    = WorkspaceProjectsBaseURL + "/%s"
 	ProjectRepositoriesBaseURL = BaseURL + "repositories/%s"
+	RepositoryBaseURL          = ProjectRepositoriesBaseURL + "/%s"
 	UserBaseURL                = BaseURL + "users/%s"
 	CurrentUserBaseURL         = BaseURL + "user"
 
-	WorkspaceUserGroupsBaseURL = V1BaseURL + "groups/%s"
-	UserGroupMembersBaseURL    = WorkspaceUserGroupsBaseURL + "/%s/members"
-	GroupMemberModifyBaseURL   = WorkspaceUserGroupsBaseURL + "/%s/members/%s"
+	CurrentUserWorkspacePermissionsBaseURL = CurrentUserBaseURL + "/permissions/workspaces"
+	WorkspaceRepoPermissionsBaseURL        = WorkspaceBaseURL + "/permissions/repositories"
 
+	ProjectBranchingModelBaseURL   = WorkspacesBaseURL + "/%s/projects/%s/branching-model"
 	ProjectPermissionsBaseURL      = WorkspacesBaseURL + "/%s/projects/%s/permissions-config"
 	ProjectGroupPermissionsBaseURL = ProjectPermissionsBaseURL + "/groups"
 	ProjectGroupPermissionBaseURL  = ProjectPermissionsBaseURL + "/groups/%s"
@@ -41,23 +48,51 @@ const (
 	RepoGroupPermissionBaseURL  = RepoPermissionsBaseURL + "/groups/%s"
 	RepoUserPermissionsBaseURL  = RepoPermissionsBaseURL + "/users"
 	RepoUserPermissionBaseURL   = RepoPermissionsBaseURL + "/users/%s"
+
+	RepoBranchRestrictionsBaseURL = ProjectRepositoriesBaseURL + "/%s/branch-restrictions"
+	RepoEnvironmentsBaseURL       = ProjectRepositoriesBaseURL + "/%s/environments"
+	RepoPipelinesConfigBaseURL    = ProjectRepositoriesBaseURL + "/%s/pipelines_config"
+	RepoCommitsBaseURL            = ProjectRepositoriesBaseURL + "/%s/commits"
+	RepoPullRequestsBaseURL       = ProjectRepositoriesBaseURL + "/%s/pullrequests"
+
+	// Pipelines runners are only exposed by the internal API.
+	WorkspaceRunnersBaseURL = InternalBaseURL + "workspaces/%s/pipelines-config/runners"
+	RepoRunnersBaseURL      = InternalBaseURL + "repositories/%s/%s/pipelines-config/runners"
 )
 
 type Client struct {
-	wrapper      *uhttp.BaseHttpClient
+	// V1 holds the endpoints of the deprecated 1.0 API.
+	V1         *V1Client
+	Workspaces *WorkspacesClient
+	Users      *UsersClient
+	Projects   *ProjectsClient
+	Repos      *ReposClient
+
+	httpClient *http.Client
+	// cache holds the GET responses in memory, nil when caching is disabled
+	cache *memoryCache
+	// baseURL replaces https://api.bitbucket.org/ in the endpoint URLs, nil keeps it
+	baseURL   *url.URL
+	userAgent string
+	// mtx guards the scope and the workspace ids, which are set again whenever the
+	// credentials are validated, also while a sync reads them
+	mtx          sync.RWMutex
 	scope        Scope
 	workspaceIDs map[string]bool
-}
-
+	breaker      *circuitBreaker
+	rateLimits   *rateLimitTracker
+	scopes       *grantedScopes
+	// headers are added to every request, e.g. the API key of a gateway the traffic must pass
+	headers http.Header
+	// pageSizes holds the page sizes of endpoints which failed on the requested ones
+	pageSizes *PageSizes
+	// limit bounds the requests in flight, nil doesn't limit them
+	limit *RequestLimit
+}
+
+// NewClient creates a client sending the requests with provided http client, the same as New with WithHTTPClient.
 func NewClient(ctx context.Context, httpClient *http.Client) (*Client, error) {
-	wrapper, err := uhttp.NewBaseHttpClientWithContext(ctx, httpClient)
-	if err != nil {
-		return nil, err
-	}
-
-	return &Client{
-		wrapper: wrapper,
-	}, nil
+	return New(ctx, WithHTTPClient(httpClient))
 }
 
 type LoginResponse struct {
@@ -75,56 +110,133 @@ type errorResponse struct {
 	} `json:"error"`
 }
 
-func (er *errorResponse) Message() string {
-	return fmt.Sprintf("Error: %s", er.Error.Message)
+// responseError describes a failed response, with the message of its error payload when it has one.
+func responseError(resp *http.Response, body []byte) error {
+	message := strings.TrimSpace(string(body))
+
+	var errRes errorResponse
+	if isJSONContentType(resp.Header.Get("Content-Type")) && json.Unmarshal(body, &errRes) == nil && errRes.Error.Message != "" {
+		message = errRes.Error.Message
+	}
+
+	if message == "" {
+		return fmt.Errorf("bitbucket: request failed with status %d", resp.StatusCode)
+	}
+
+	return fmt.Errorf("bitbucket: request failed with status %d: %s", resp.StatusCode, message)
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
 }
 
 type UpdatePermissionPayload struct {
 	Permission string `json:"permission"`
 }
 
+// ClearCache drops the GET responses cached in memory, e.g. when a new sync must not be served the
+// responses of the previous one. The disk cache is kept, as it is meant to outlive the process.
+func (c *Client) ClearCache() {
+	c.cache.clear()
+}
+
+// SetHeaders sets static headers added to every request sent to the Bitbucket API.
+func (c *Client) SetHeaders(headers http.Header) {
+	c.headers = headers.Clone()
+}
+
+// SetPageSizes shares the page sizes remembered for failing endpoints, e.g. among the clients of all credentials.
+func (c *Client) SetPageSizes(pageSizes *PageSizes) {
+	c.pageSizes = pageSizes
+}
+
+// SetRequestLimit bounds the requests in flight, the limit can be shared with other clients.
+func (c *Client) SetRequestLimit(limit *RequestLimit) {
+	c.limit = limit
+}
+
+// RateLimits returns the latest known rate limit state of every resource requested by the client.
+func (c *Client) RateLimits() []RateLimit {
+	return c.rateLimits.RateLimits()
+}
+
+func (c *Client) setScope(scope Scope) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.scope = scope
+}
+
+func (c *Client) currentScope() Scope {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return c.scope
+}
+
 func (c *Client) SetupUserScope(userId string) {
-	c.scope = &UserScoped{
+	c.setScope(&UserScoped{
 		Username: userId,
-	}
+	})
 }
 
 func (c *Client) SetupWorkspaceScope(workspaceId string) {
-	c.scope = &WorkspaceScoped{
+	c.setScope(&WorkspaceScoped{
 		Workspace: workspaceId,
-	}
+	})
 }
 
 func (c *Client) IsUserScoped() bool {
-	_, ok := c.scope.(*UserScoped)
+	_, ok := c.currentScope().(*UserScoped)
 	return ok
 }
 
+// SetupProjectScope limits the client to the single project a project access token is bound to.
+func (c *Client) SetupProjectScope(workspaceId, projectId string) {
+	c.setScope(&ProjectScoped{
+		Workspace: workspaceId,
+		Project:   projectId,
+	})
+}
+
+// SetupRepositoryScope limits the client to the single repository a repository access token is bound to.
+func (c *Client) SetupRepositoryScope(workspaceId, projectId, repositoryId string) {
+	c.setScope(&RepositoryScoped{
+		Workspace:  workspaceId,
+		Project:    projectId,
+		Repository: repositoryId,
+	})
+}
+
 func (c *Client) IsWorkspaceScoped() bool {
-	_, ok := c.scope.(*WorkspaceScoped)
+	_, ok := c.currentScope().(*WorkspaceScoped)
+	return ok
+}
+
+func (c *Client) IsProjectScoped() bool {
+	_, ok := c.currentScope().(*ProjectScoped)
+	return ok
+}
+
+func (c *Client) IsRepositoryScoped() bool {
+	_, ok := c.currentScope().(*RepositoryScoped)
 	return ok
 }
 
 // If client have access only to one workspace, method `WorkspaceId`
 // returns that id otherwise it returns error.
 func (c *Client) WorkspaceId() (string, error) {
-	if c.IsWorkspaceScoped() {
-		return c.scope.(*WorkspaceScoped).Workspace, nil
-	} else {
-		return "", status.Error(codes.InvalidArgument, "client is not workspace scoped")
-	}
-}
-
-func isPermissionDeniedErr(err error) bool {
-	e, ok := status.FromError(err)
-	if ok && e.Code() == codes.PermissionDenied {
-		return true
-	}
-	// In most cases the error code is unknown and the error message contains "status 403".
-	if (!ok || e.Code() == codes.Unknown) && strings.Contains(err.Error(), "status 403") {
-		return true
+	switch scope := c.currentScope().(type) {
+	case *WorkspaceScoped, *ProjectScoped, *RepositoryScoped:
+		return scope.WorkspaceId(), nil
+	default:
+		return "", ErrNotWorkspaceScoped
 	}
-	return false
 }
 
 func (c *Client) checkPermissions(ctx context.Context, workspace *Workspace) (bool, error) {
@@ -142,25 +254,25 @@ func (c *Client) checkPermissions(ctx context.Context, workspace *Workspace) (bo
 		Limit: 1,
 		Page:  "",
 	}
-	_, err := c.GetWorkspaceUserGroups(ctx, workspace.Id)
+	_, err := c.V1.Groups.List(ctx, workspace.Id)
 	if err != nil {
-		if isPermissionDeniedErr(err) {
+		if errors.Is(err, ErrPermissionDenied) {
 			logMissingPermission("userGroups", err)
 			return false, nil
 		}
 		return false, err
 	}
-	_, _, err = c.GetWorkspaceMembers(ctx, workspace.Id, paginationVars)
+	_, _, err = c.Workspaces.Members(ctx, workspace.Id, paginationVars)
 	if err != nil {
-		if isPermissionDeniedErr(err) {
+		if errors.Is(err, ErrPermissionDenied) {
 			logMissingPermission("users", err)
 			return false, nil
 		}
 		return false, err
 	}
-	_, _, err = c.GetWorkspaceProjects(ctx, workspace.Id, paginationVars)
+	_, _, err = c.Projects.List(ctx, workspace.Id, paginationVars)
 	if err != nil {
-		if isPermissionDeniedErr(err) {
+		if errors.Is(err, ErrPermissionDenied) {
 			logMissingPermission("projects", err)
 			return false, nil
 		}
@@ -170,13 +282,15 @@ func (c *Client) checkPermissions(ctx context.Context, workspace *Workspace) (bo
 }
 
 func (c *Client) filterWorkspaces(ctx context.Context, workspaces []Workspace) ([]Workspace, error) {
+	c.mtx.RLock()
+	workspaceIDs := c.workspaceIDs
+	c.mtx.RUnlock()
+
 	filteredWorkspaces := make([]Workspace, 0)
 
 	for _, workspace := range workspaces {
-		// We call this function in order to initialize the workspaceID's map. In that case we need to return all workspaces,
-		// so they can be filtered and only the valid ones are set in the workspaceIds map.
-		_, ok := c.workspaceIDs[workspace.Id]
-		if c.workspaceIDs != nil && len(c.workspaceIDs) > 0 && !ok {
+		_, ok := workspaceIDs[workspace.Id]
+		if len(workspaceIDs) > 0 && !ok {
 			continue
 		}
 
@@ -190,19 +304,20 @@ func (c *Client) filterWorkspaces(ctx context.Context, workspaces []Workspace) (
 // returns list of workspace ids otherwise it returns error.
 func (c *Client) SetWorkspaceIDs(ctx context.Context, workspaceIDs []string) error {
 	if !c.IsUserScoped() {
-		return status.Error(codes.InvalidArgument, "client is not user scoped")
+		return ErrNotUserScoped
 	}
-	c.workspaceIDs = make(map[string]bool)
 	givenWorkspaceIDs := make(map[string]bool)
 	for _, workspaceId := range workspaceIDs {
 		givenWorkspaceIDs[workspaceId] = true
 	}
 
-	workspaces, err := c.GetAllWorkspaces(ctx)
+	// all workspaces are checked, the current ids keep limiting the requests until they are replaced
+	workspaces, err := collectPages(ctx, c.Workspaces.listUnfiltered)
 	if err != nil {
 		return err
 	}
 
+	validWorkspaceIDs := make(map[string]bool)
 	for _, workspace := range workspaces {
 		workspace := workspace
 		if _, ok := givenWorkspaceIDs[workspace.Id]; !ok && len(givenWorkspaceIDs) > 0 {
@@ -215,114 +330,28 @@ func (c *Client) SetWorkspaceIDs(ctx context.Context, workspaceIDs []string) err
 		if !ok {
 			continue
 		}
-		c.workspaceIDs[workspace.Id] = true
-	}
-	if len(c.workspaceIDs) == 0 {
-		return status.Error(codes.Unauthenticated, "no authenticated workspaces found")
-	}
-	return nil
-}
-
-// GetWorkspaces lists all workspaces current user belongs to.
-func (c *Client) GetWorkspaces(ctx context.Context, getWorkspacesVars PaginationVars) ([]Workspace, string, error) {
-	urlAddress, err := url.Parse(WorkspacesBaseURL)
-	if err != nil {
-		return nil, "", err
-	}
-
-	var workspacesResponse ListResponse[Workspace]
-	err = c.get(
-		ctx,
-		urlAddress,
-		&workspacesResponse,
-		[]QueryParam{
-			&getWorkspacesVars,
-			prepareFilters(""),
-		},
-	)
-	if err != nil {
-		return nil, "", err
-	}
-	workspacesResponse.Values, err = c.filterWorkspaces(ctx, workspacesResponse.Values)
-	if err != nil {
-		return nil, "", err
-	}
-
-	return handlePagination(workspacesResponse)
-}
-
-// GetAllWorkspaces lists all workspaces looping through all pages.
-func (c *Client) GetAllWorkspaces(ctx context.Context) ([]Workspace, error) {
-	var allWorkspaces []Workspace
-	var next string
-
-	for {
-		pagination := PaginationVars{
-			Limit: 50,
-			Page:  next,
-		}
-
-		workspaces, nextPage, err := c.GetWorkspaces(ctx, pagination)
-		if err != nil {
-			return nil, err
-		}
-
-		allWorkspaces = append(allWorkspaces, workspaces...)
-		next = nextPage
-
-		if next == "" {
-			break
-		}
+		validWorkspaceIDs[workspace.Id] = true
 	}
 
-	return allWorkspaces, nil
-}
+	c.mtx.Lock()
+	c.workspaceIDs = validWorkspaceIDs
+	c.mtx.Unlock()
 
-// GetWorkspace get specific workspace based on provided id.
-func (c *Client) GetWorkspace(ctx context.Context, workspaceId string) (*Workspace, error) {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	urlAddress, err := url.Parse(fmt.Sprintf(WorkspaceBaseURL, encodedWorkspaceId))
-	if err != nil {
-		return nil, err
+	if len(validWorkspaceIDs) == 0 {
+		return ErrNoWorkspaces
 	}
-
-	var workspaceResponse Workspace
-	err = c.get(
-		ctx,
-		urlAddress,
-		&workspaceResponse,
-		[]QueryParam{
-			prepareFilters(""),
-		},
-	)
-	if err != nil {
-		if isPermissionDeniedErr(err) {
-			return nil, status.Error(codes.PermissionDenied, "missing permission to get workspace")
-		}
-		return nil, err
-	}
-
-	return &workspaceResponse, nil
+	return nil
 }
 
-// GetWorkspaceMembers lists all users that belong under specified workspace.
-func (c *Client) GetWorkspaceMembers(ctx context.Context, workspaceId string, getWorkspacesVars PaginationVars) ([]User, string, error) {
+// searchWorkspaceMembers lists users of the workspace matching the query, all of them when it is empty.
+func (c *Client) searchWorkspaceMembers(ctx context.Context, workspaceId string, getWorkspacesVars PaginationVars, query string) ([]User, string, error) {
 	encodedWorkspaceId := url.PathEscape(workspaceId)
 	urlAddress, err := url.Parse(fmt.Sprintf(WorkspaceMembersBaseURL, encodedWorkspaceId))
 	if err != nil {
 		return nil, "", err
 	}
 
-	var workspaceMembersResponse ListResponse[WorkspaceMember]
-	err = c.get(
-		ctx,
-		urlAddress,
-		&workspaceMembersResponse,
-		[]QueryParam{
-			&getWorkspacesVars,
-			prepareFilters("", "-*.workspace"),
-		},
-	)
+	workspaceMembersResponse, err := getPage[WorkspaceMember](ctx, c, WorkspaceMembersBaseURL, urlAddress, getWorkspacesVars, prepareFilters(query, "-*.workspace"))
 	if err != nil {
 		return nil, "", err
 	}
@@ -332,736 +361,134 @@ func (c *Client) GetWorkspaceMembers(ctx context.Context, workspaceId string, ge
 	return mapUsers(members), page, nil
 }
 
-// GetWorkspaceUserGroups lists all user groups that belong under specified workspace (This method is supported only for v1 API).
-func (c *Client) GetWorkspaceUserGroups(ctx context.Context, workspaceId string) ([]UserGroup, error) {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	urlAddress, err := url.Parse(fmt.Sprintf(WorkspaceUserGroupsBaseURL, encodedWorkspaceId))
-	if err != nil {
-		return nil, err
-	}
-
-	var workspaceUserGroupsResponse []UserGroup
-	err = c.get(
-		ctx,
-		urlAddress,
-		&workspaceUserGroupsResponse,
-		nil,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return workspaceUserGroupsResponse, nil
-}
-
-// GetUserGroupMembers lists all members that belong in specified user group (This method is supported only for v1 API).
-func (c *Client) GetUserGroupMembers(ctx context.Context, workspaceId string, groupSlug string) ([]User, error) {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	urlAddress, err := url.Parse(fmt.Sprintf(UserGroupMembersBaseURL, encodedWorkspaceId, groupSlug))
-	if err != nil {
-		return nil, err
-	}
-
-	var userGroupMembersResponse []User
-	err = c.get(
-		ctx,
-		urlAddress,
-		&userGroupMembersResponse,
-		nil,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return userGroupMembersResponse, nil
-}
-
-// AddUserToGroup adds new member under specified user group (This method is supported only for v1 API).
-func (c *Client) AddUserToGroup(ctx context.Context, workspaceId string, groupSlug string, userId string) error {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	encodedUserId := url.PathEscape(userId)
-	urlAddress, err := url.Parse(fmt.Sprintf(GroupMemberModifyBaseURL, encodedWorkspaceId, groupSlug, encodedUserId))
-	if err != nil {
-		return err
-	}
-
-	err = c.put(
-		ctx,
-		urlAddress,
-		struct{}{}, // required empty body
-		nil,
-		nil,
-	)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// RemoveUserFromGroup removes member from specified user group (This method is supported only for v1 API).
-func (c *Client) RemoveUserFromGroup(ctx context.Context, workspaceId string, groupSlug string, userId string) error {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	encodedUserId := url.PathEscape(userId)
-	urlAddress, err := url.Parse(fmt.Sprintf(GroupMemberModifyBaseURL, encodedWorkspaceId, groupSlug, encodedUserId))
-	if err != nil {
-		return err
-	}
-
-	err = c.delete(ctx, urlAddress)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// GetCurrentUser get information about currently logged in user or team.
-func (c *Client) GetCurrentUser(ctx context.Context) (*User, error) {
-	urlAddress, err := url.Parse(CurrentUserBaseURL)
-	if err != nil {
-		return nil, err
-	}
-
-	var userResponse User
-	err = c.get(
-		ctx,
-		urlAddress,
-		&userResponse,
-		[]QueryParam{
-			prepareFilters(""),
-		},
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &userResponse, nil
-}
-
-// GetUser get detail information about specified user.
-func (c *Client) GetUser(ctx context.Context, userId string) (*User, error) {
-	encodedUserId := url.PathEscape(userId)
-	urlAddress, err := url.Parse(fmt.Sprintf(UserBaseURL, encodedUserId))
-	if err != nil {
-		return nil, err
-	}
-
-	var userResponse User
-	err = c.get(
-		ctx,
-		urlAddress,
-		&userResponse,
-		[]QueryParam{
-			prepareFilters(""),
-		},
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &userResponse, nil
-}
-
-// GetWorkspaceProjects lists all projects that belong under specified workspace.
-func (c *Client) GetWorkspaceProjects(ctx context.Context, workspaceId string, getWorkspaceProjectsVars PaginationVars) ([]Project, string, error) {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	urlAddress, err := url.Parse(fmt.Sprintf(WorkspaceProjectsBaseURL, encodedWorkspaceId))
-	if err != nil {
-		return nil, "", err
-	}
-
-	var workspaceProjectsResponse ListResponse[Project]
-	err = c.get(
-		ctx,
-		urlAddress,
-		&workspaceProjectsResponse,
-		[]QueryParam{
-			&getWorkspaceProjectsVars,
-			prepareFilters("", "-*.workspace", "-*.owner"),
-		},
-	)
-
-	if err != nil {
-		return nil, "", err
-	}
-
-	return handlePagination(workspaceProjectsResponse)
-}
-
-// GetAllWorkspaceProjects lists all projects looping through all pages.
-func (c *Client) GetAllWorkspaceProjects(ctx context.Context, workspaceId string) ([]Project, error) {
-	var allProjects []Project
-	var next string
-
-	for {
-		pagination := PaginationVars{
-			Limit: 50,
-			Page:  next,
-		}
-
-		projects, nextPage, err := c.GetWorkspaceProjects(ctx, workspaceId, pagination)
-		if err != nil {
-			return nil, err
-		}
-
-		allProjects = append(allProjects, projects...)
-		next = nextPage
-
-		if next == "" {
-			break
-		}
-	}
-
-	return allProjects, nil
-}
-
-// GetProjectRepos lists all repositories that belong under specified project (which belongs under specified workspace).
-func (c *Client) GetProjectRepos(ctx context.Context, workspaceId string, projectId string, getProjectReposVars PaginationVars) ([]Repository, string, error) {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	urlAddress, err := url.Parse(fmt.Sprintf(ProjectRepositoriesBaseURL, encodedWorkspaceId))
-	if err != nil {
-		return nil, "", err
-	}
-
-	var projectRepositoriesResponse ListResponse[Repository]
-	err = c.get(
-		ctx,
-		urlAddress,
-		&projectRepositoriesResponse,
-		[]QueryParam{
-			&getProjectReposVars,
-			prepareFilters(
-				fmt.Sprintf("project.uuid=\"%s\"", projectId),
-				"-*.workspace",
-				"-*.owner",
-			),
-		},
-	)
-
-	if err != nil {
-		return nil, "", err
-	}
-
-	return handlePagination(projectRepositoriesResponse)
-}
-
-// GetAllProjectRepos lists all repositories looping through all pages.
-func (c *Client) GetAllProjectRepos(ctx context.Context, workspaceId string, projectId string) ([]Repository, error) {
-	var allRepos []Repository
-	var next string
-
-	for {
-		pagination := PaginationVars{
-			Limit: 50,
-			Page:  next,
-		}
-
-		repos, nextPage, err := c.GetProjectRepos(ctx, workspaceId, projectId, pagination)
-		if err != nil {
-			return nil, err
-		}
-
-		allRepos = append(allRepos, repos...)
-		next = nextPage
-
-		if next == "" {
-			break
-		}
-	}
-
-	return allRepos, nil
-}
-
-// GetProjectGroupPermissions lists all group permissions that belong under specified project.
-func (c *Client) GetProjectGroupPermissions(ctx context.Context, workspaceId string, projectKey string, getPermissionsVars PaginationVars) ([]GroupPermission, string, error) {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	urlAddress, err := url.Parse(fmt.Sprintf(ProjectGroupPermissionsBaseURL, encodedWorkspaceId, projectKey))
-	if err != nil {
-		return nil, "", err
-	}
-
-	var projectGroupPermissionsResponse ListResponse[GroupPermission]
-	err = c.get(
-		ctx,
-		urlAddress,
-		&projectGroupPermissionsResponse,
-		[]QueryParam{
-			&getPermissionsVars,
-			prepareFilters("", "-*.*.workspace", "-*.*.owner"),
-		},
-	)
-
-	if err != nil {
-		return nil, "", err
-	}
-
-	return handlePagination(projectGroupPermissionsResponse)
-}
-
-// GetProjectGroupPermission returns group permission of specific group under provided project.
-func (c *Client) GetProjectGroupPermission(
-	ctx context.Context,
-	workspaceId string,
-	projectKey string,
-	groupSlug string,
-) (*GroupPermission, error) {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	urlAddress, err := url.Parse(fmt.Sprintf(ProjectGroupPermissionBaseURL, encodedWorkspaceId, projectKey, groupSlug))
-	if err != nil {
-		return nil, err
-	}
-
-	var projectGroupPermissionsResponse GroupPermission
-	err = c.get(
-		ctx,
-		urlAddress,
-		&projectGroupPermissionsResponse,
-		[]QueryParam{
-			prepareFilters("", "-*.*.workspace", "-*.*.owner"),
-		},
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &projectGroupPermissionsResponse, nil
-}
-
-// UpdateProjectGroupPermission updates group permission of specific group under provided project.
-func (c *Client) UpdateProjectGroupPermission(
-	ctx context.Context,
-	workspaceId string,
-	projectKey string,
-	groupSlug string,
-	permission string,
-) error {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	urlAddress, err := url.Parse(fmt.Sprintf(ProjectGroupPermissionBaseURL, encodedWorkspaceId, projectKey, groupSlug))
-	if err != nil {
-		return err
-	}
-
-	err = c.put(
-		ctx,
-		urlAddress,
-		UpdatePermissionPayload{
-			Permission: permission,
-		},
-		nil,
-		nil,
-	)
-
+func (c *Client) delete(ctx context.Context, endpoint string, urlAddress *url.URL) error {
+	req, err := c.createRequest(ctx, urlAddress, http.MethodDelete, nil, nil)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return c.do(req, endpoint, nil)
 }
 
-// DeleteProjectGroupPermission removes group permission of specific group under provided project.
-func (c *Client) DeleteProjectGroupPermission(
-	ctx context.Context,
-	workspaceId string,
-	projectKey string,
-	groupSlug string,
-) error {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	urlAddress, err := url.Parse(fmt.Sprintf(ProjectGroupPermissionBaseURL, encodedWorkspaceId, projectKey, groupSlug))
-	if err != nil {
-		return err
-	}
-
-	err = c.delete(ctx, urlAddress)
+func (c *Client) get(ctx context.Context, endpoint string, urlAddress *url.URL, resourceResponse interface{}, paramOptions []QueryParam) error {
+	req, err := c.createRequest(ctx, urlAddress, http.MethodGet, nil, paramOptions)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// GetProjectUserPermissions lists all user permissions that belong under specified project.
-func (c *Client) GetProjectUserPermissions(ctx context.Context, workspaceId string, projectKey string, getPermissionsVars PaginationVars) ([]UserPermission, string, error) {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	urlAddress, err := url.Parse(fmt.Sprintf(ProjectUserPermissionsBaseURL, encodedWorkspaceId, projectKey))
-	if err != nil {
-		return nil, "", err
-	}
-
-	var projectUserPermissionsResponse ListResponse[UserPermission]
-	err = c.get(
-		ctx,
-		urlAddress,
-		&projectUserPermissionsResponse,
-		[]QueryParam{
-			&getPermissionsVars,
-			prepareFilters(""),
-		},
-	)
-
-	if err != nil {
-		return nil, "", err
-	}
-
-	return handlePagination(projectUserPermissionsResponse)
-}
-
-// GetProjectUserPermission returns user permission of specific user under provided project.
-func (c *Client) GetProjectUserPermission(
-	ctx context.Context,
-	workspaceId string,
-	projectKey string,
-	userId string,
-) (*UserPermission, error) {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	encodedUserId := url.PathEscape(userId)
-	urlAddress, err := url.Parse(fmt.Sprintf(ProjectUserPermissionBaseURL, encodedWorkspaceId, projectKey, encodedUserId))
-	if err != nil {
-		return nil, err
-	}
-
-	var projectUserPermissionsResponse UserPermission
-	err = c.get(
-		ctx,
-		urlAddress,
-		&projectUserPermissionsResponse,
-		[]QueryParam{
-			prepareFilters(""),
-		},
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &projectUserPermissionsResponse, nil
+	return c.do(req, endpoint, resourceResponse)
 }
 
-// UpdateProjectUserPermission updates user permission of specific user under provided project.
-func (c *Client) UpdateProjectUserPermission(
-	ctx context.Context,
-	workspaceId string,
-	projectKey string,
-	userId string,
-	permission string,
-) error {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	encodedUserId := url.PathEscape(userId)
-	urlAddress, err := url.Parse(fmt.Sprintf(ProjectUserPermissionBaseURL, encodedWorkspaceId, projectKey, encodedUserId))
-	if err != nil {
-		return err
-	}
-
-	err = c.put(
-		ctx,
-		urlAddress,
-		UpdatePermissionPayload{
-			Permission: permission,
-		},
-		nil,
-		nil,
-	)
-
+func (c *Client) put(ctx context.Context, endpoint string, urlAddress *url.URL, data, resourceResponse interface{}, paramOptions []QueryParam) error {
+	req, err := c.createRequest(ctx, urlAddress, http.MethodPut, data, paramOptions)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return c.do(req, endpoint, resourceResponse)
 }
 
-// DeleteProjectUserPermission removes user permission of specific user under provided project.
-func (c *Client) DeleteProjectUserPermission(
-	ctx context.Context,
-	workspaceId string,
-	projectKey string,
-	userId string,
-) error {
-	encodedWorkspaceId := url.PathEscape(workspaceId)
-	encodedUserId := url.PathEscape(userId)
-	urlAddress, err := url.Parse(fmt.Sprintf(ProjectUserPermissionBaseURL, encodedWorkspaceId, projectKey, encodedUserId))
+// do sends the request, decodes the JSON payload of the response into the resource response, unless
+// it is nil, and converts failed responses into typed errors. The endpoint is the URL template the
+// request was built from, so the requests to all resources of an endpoint share its circuit breaker.
+func (c *Client) do(req *http.Request, endpoint string, resourceResponse interface{}) (err error) {
+	// a cancelled sync must not issue more requests, nor be served from the response cache
+	err = req.Context().Err()
 	if err != nil {
 		return err
 	}
 
-	err = c.delete(ctx, urlAddress)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// GetRepositoryGroupPermissions lists all group permissions that belong under specified repository.
-func (c *Client) GetRepositoryGroupPermissions(ctx context.Context, workspaceId string, repoId string, getPermissionsVars PaginationVars) ([]GroupPermission, string, error) {
-	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
-	urlAddress, err := url.Parse(fmt.Sprintf(RepoGroupPermissionsBaseURL, encodedWorkspaceId, encodedRepoId))
-	if err != nil {
-		return nil, "", err
-	}
-
-	var repositoryGroupPermissionsResponse ListResponse[GroupPermission]
-	err = c.get(
-		ctx,
-		urlAddress,
-		&repositoryGroupPermissionsResponse,
-		[]QueryParam{
-			&getPermissionsVars,
-			prepareFilters("", "-*.*.workspace", "-*.*.owner"),
-		},
-	)
+	endpoint = req.Method + " " + endpoint
 
-	if err != nil {
-		return nil, "", err
-	}
+	ctx, span := startRequestSpan(req)
+	req = req.WithContext(ctx)
 
-	return handlePagination(repositoryGroupPermissionsResponse)
-}
+	var r *http.Response
+	defer func() {
+		apiMetrics.record(ctx, req, r, err)
+		endRequestSpan(span, r, err)
+	}()
 
-// GetRepoGroupPermission returns group permission of specific group under provided repository.
-func (c *Client) GetRepoGroupPermission(
-	ctx context.Context,
-	workspaceId string,
-	repoId string,
-	groupSlug string,
-) (*GroupPermission, error) {
-	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
-	urlAddress, err := url.Parse(fmt.Sprintf(RepoGroupPermissionBaseURL, encodedWorkspaceId, encodedRepoId, groupSlug))
-	if err != nil {
-		return nil, err
-	}
-
-	var repoGroupPermissionsResponse GroupPermission
-	err = c.get(
-		ctx,
-		urlAddress,
-		&repoGroupPermissionsResponse,
-		[]QueryParam{
-			prepareFilters("", "-*.*.workspace", "-*.*.owner"),
-		},
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &repoGroupPermissionsResponse, nil
-}
-
-// UpdateRepoGroupPermission updates group permission of specific group under provided repository.
-func (c *Client) UpdateRepoGroupPermission(
-	ctx context.Context,
-	workspaceId string,
-	repoId string,
-	groupSlug string,
-	permission string,
-) error {
-	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
-	urlAddress, err := url.Parse(fmt.Sprintf(RepoGroupPermissionBaseURL, encodedWorkspaceId, encodedRepoId, groupSlug))
-	if err != nil {
-		return err
-	}
-
-	err = c.put(
-		ctx,
-		urlAddress,
-		UpdatePermissionPayload{
-			Permission: permission,
-		},
-		nil,
-		nil,
-	)
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// DeleteRepoGroupPermission removes group permission of specific group under provided repository.
-func (c *Client) DeleteRepoGroupPermission(
-	ctx context.Context,
-	workspaceId string,
-	repoId string,
-	groupSlug string,
-) error {
-	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
-	urlAddress, err := url.Parse(fmt.Sprintf(RepoGroupPermissionBaseURL, encodedWorkspaceId, encodedRepoId, groupSlug))
+	err = c.breaker.wait(ctx, endpoint)
 	if err != nil {
 		return err
 	}
 
-	err = c.delete(ctx, urlAddress)
-
+	release, err := c.limit.acquire(ctx)
 	if err != nil {
 		return err
 	}
+	defer release()
 
-	return nil
-}
-
-// GetRepositoryUserPermissions lists all user permissions that belong under specified repository.
-func (c *Client) GetRepositoryUserPermissions(ctx context.Context, workspaceId string, repoId string, getPermissionsVars PaginationVars) ([]UserPermission, string, error) {
-	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
-	urlAddress, err := url.Parse(fmt.Sprintf(RepoUserPermissionsBaseURL, encodedWorkspaceId, encodedRepoId))
-	if err != nil {
-		return nil, "", err
-	}
-
-	var repositoryUserPermissionsResponse ListResponse[UserPermission]
-	err = c.get(
-		ctx,
-		urlAddress,
-		&repositoryUserPermissionsResponse,
-		[]QueryParam{
-			&getPermissionsVars,
-			prepareFilters(""),
-		},
-	)
-
-	if err != nil {
-		return nil, "", err
-	}
-
-	return handlePagination(repositoryUserPermissionsResponse)
-}
-
-// GetRepoUserPermission returns user permission of specific user under provided repository.
-func (c *Client) GetRepoUserPermission(
-	ctx context.Context,
-	workspaceId string,
-	repoId string,
-	userId string,
-) (*UserPermission, error) {
-	encodedWorkspaceId, encodedUserId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(userId), url.PathEscape(repoId)
-	urlAddress, err := url.Parse(fmt.Sprintf(RepoUserPermissionBaseURL, encodedWorkspaceId, encodedRepoId, encodedUserId))
-	if err != nil {
-		return nil, err
-	}
-
-	var repoUserPermissionsResponse UserPermission
-	err = c.get(
-		ctx,
-		urlAddress,
-		&repoUserPermissionsResponse,
-		[]QueryParam{
-			prepareFilters(""),
-		},
-	)
-
-	if err != nil {
-		return nil, err
+	r, err = c.send(req, resourceResponse)
+	if r != nil {
+		c.breaker.record(ctx, endpoint, r.StatusCode)
+		c.rateLimits.record(ctx, r.Header)
+		c.scopes.record(r.Header)
 	}
-
-	return &repoUserPermissionsResponse, nil
-}
-
-// UpdateRepoUserPermission updates user permission of specific user under provided repository.
-func (c *Client) UpdateRepoUserPermission(
-	ctx context.Context,
-	workspaceId string,
-	repoId string,
-	userId string,
-	permission string,
-) error {
-	encodedWorkspaceId, encodedUserId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(userId), url.PathEscape(repoId)
-	urlAddress, err := url.Parse(fmt.Sprintf(RepoUserPermissionBaseURL, encodedWorkspaceId, encodedRepoId, encodedUserId))
 	if err != nil {
-		return err
-	}
+		err = wrapError(r, err)
 
-	err = c.put(
-		ctx,
-		urlAddress,
-		UpdatePermissionPayload{
-			Permission: permission,
-		},
-		nil,
-		nil,
-	)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			ctxzap.Extract(ctx).Debug(
+				"bitbucket: request failed",
+				append(apiErr.LogFields(), zap.String("endpoint", endpoint), zap.Error(err))...,
+			)
+		}
 
-	if err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// DeleteRepoUserPermission removes user permission of specific user under provided repository.
-func (c *Client) DeleteRepoUserPermission(
-	ctx context.Context,
-	workspaceId string,
-	repoId string,
-	userId string,
-) error {
-	encodedWorkspaceId, encodedUserId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(userId), url.PathEscape(repoId)
-	url, err := url.Parse(fmt.Sprintf(RepoUserPermissionBaseURL, encodedWorkspaceId, encodedRepoId, encodedUserId))
-	if err != nil {
-		return err
+// send sends the request, or serves it from the cache, and decodes the payload of the response. The
+// returned response is set whenever a response was received, its body has already been read.
+func (c *Client) send(req *http.Request, resourceResponse interface{}) (*http.Response, error) {
+	// a write may change any listing, so the cached ones can't be trusted anymore
+	if req.Method != http.MethodGet {
+		c.cache.clear()
 	}
 
-	err = c.delete(ctx, url)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
+	resp, body := c.cache.get(req)
+	if resp == nil {
+		var err error
+		resp, err = c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
 
-func (c *Client) delete(ctx context.Context, urlAddress *url.URL) error {
-	req, err := c.createRequest(ctx, urlAddress, http.MethodDelete, nil, nil)
-	if err != nil {
-		return err
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
 	}
 
-	var errRes errorResponse
-	r, err := c.wrapper.Do(req, uhttp.WithErrorResponse(&errRes))
-	if err != nil {
-		return err
+	if resp.StatusCode >= 300 {
+		return resp, responseError(resp, body)
 	}
 
-	defer r.Body.Close()
-
-	return nil
-}
-
-func (c *Client) get(ctx context.Context, urlAddress *url.URL, resourceResponse interface{}, paramOptions []QueryParam) error {
-	req, err := c.createRequest(ctx, urlAddress, http.MethodGet, nil, paramOptions)
-	if err != nil {
-		return err
+	if req.Method == http.MethodGet && resp.StatusCode == http.StatusOK {
+		c.cache.set(req, resp, body)
 	}
 
-	var errRes errorResponse
-	r, err := c.wrapper.Do(req, uhttp.WithErrorResponse(&errRes), uhttp.WithJSONResponse(resourceResponse))
-	if err != nil {
-		return err
+	if resourceResponse == nil || len(body) == 0 {
+		return resp, nil
 	}
 
-	defer r.Body.Close()
-
-	return nil
-}
-
-func (c *Client) put(ctx context.Context, urlAddress *url.URL, data, resourceResponse interface{}, paramOptions []QueryParam) error {
-	req, err := c.createRequest(ctx, urlAddress, http.MethodPut, data, paramOptions)
-	if err != nil {
-		return err
+	if !isJSONContentType(resp.Header.Get("Content-Type")) {
+		return resp, fmt.Errorf("bitbucket: unexpected content type %q", resp.Header.Get("Content-Type"))
 	}
 
-	var errRes errorResponse
-	r, err := c.wrapper.Do(req, uhttp.WithErrorResponse(&errRes), uhttp.WithJSONResponse(resourceResponse))
+	err := json.Unmarshal(body, resourceResponse)
 	if err != nil {
-		return err
+		return resp, fmt.Errorf("bitbucket: failed to decode response: %w", err)
 	}
 
-	defer r.Body.Close()
-
-	return nil
+	return resp, nil
 }
 
 func (c *Client) createRequest(
@@ -1071,23 +498,33 @@ func (c *Client) createRequest(
 	data interface{},
 	paramOptions []QueryParam,
 ) (*http.Request, error) {
-	opts := []uhttp.RequestOption{
-		uhttp.WithAcceptJSONHeader(),
-	}
+	var body io.Reader
 	if data != nil {
-		opts = append(opts, uhttp.WithJSONBody(data))
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(payload)
 	}
 
-	req, err := c.wrapper.NewRequest(
-		ctx,
-		method,
-		urlAddress,
-		opts...,
-	)
+	req, err := http.NewRequestWithContext(ctx, method, c.resolve(urlAddress).String(), body)
 	if err != nil {
 		return nil, err
 	}
 
+	req.Header.Set("Accept", "application/json")
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	for name, values := range c.headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+
 	if paramOptions != nil {
 		queryParams := url.Values{}
 		for _, q := range paramOptions {
@@ -1112,7 +549,9 @@ func mapUsers(members []WorkspaceMember) []User {
 	var users []User
 
 	for _, member := range members {
-		users = append(users, member.User)
+		user := member.User
+		user.JoinedOn = member.AddedOn
+		users = append(users, user)
 	}
 
 	return users
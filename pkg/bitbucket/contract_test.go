@@ -0,0 +1,302 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// The fixtures in testdata/contract hold the responses of the endpoints for a sandbox workspace,
+// stored like the dump command writes them: a list of the pages of the response. The ones named
+// after a payload of the dump are refreshed with
+//
+//	baton-bitbucket dump --workspace <sandbox> --project <key> --repository <slug> --output-dir pkg/bitbucket/testdata/contract
+//
+// the others by storing the first page of their endpoint in a list. Payloads no model decodes,
+// like workspace-permissions, are left out. Review the diff for personal data before committing.
+
+// contract is the model a fixture decodes into and the fields of the fixture the model
+// deliberately leaves out, as dot-separated paths, with [] for the items of an array.
+type contract struct {
+	model   interface{}
+	ignored []string
+}
+
+// untypedFields are left out wherever they appear, they link to other endpoints and
+// tell the type of an object, rather than holding data.
+var untypedFields = map[string]struct{}{
+	"links": {},
+	"type":  {},
+}
+
+// fields shared by the payloads of several endpoints
+var (
+	v1UserFields     = []string{"avatar", "resource_uri", "is_staff", "is_active"}
+	projectFields    = []string{"owner", "is_private", "created_on", "updated_on", "has_publicly_visible_repos"}
+	repositoryFields = []string{"scm", "website", "owner", "fork_policy", "override_settings", "parent", "enforced_signed_commits"}
+	groupRefFields   = []string{"owner", "workspace", "full_slug"}
+)
+
+var contracts = map[string]contract{
+	"user": {
+		model:   User{},
+		ignored: []string{"has_2fa_enabled", "is_staff", "location", "kind"},
+	},
+	"workspace": {
+		model:   Workspace{},
+		ignored: []string{"is_private", "created_on", "updated_on", "forking_mode", "is_privacy_enforced"},
+	},
+	"user-workspace-permissions": {
+		model:   WorkspacePermission{},
+		ignored: []string{"last_accessed", "added_on", "user"},
+	},
+	"workspace-members": {
+		model:   WorkspaceMember{},
+		ignored: []string{"workspace"},
+	},
+	"workspace-groups": {
+		model:   UserGroup{},
+		ignored: append(prefixed("members[]", v1UserFields), "owner", "email_forwarding_disabled", "account_privilege"),
+	},
+	"workspace-projects": {
+		model:   Project{},
+		ignored: projectFields,
+	},
+	"workspace-runners": {
+		model:   Runner{},
+		ignored: []string{"state.version", "oauth_client"},
+	},
+	"project": {
+		model:   Project{},
+		ignored: projectFields,
+	},
+	"project-branching-model": {
+		model: BranchingModel{},
+	},
+	"project-user-permissions": {
+		model:   UserPermission{},
+		ignored: []string{"project"},
+	},
+	"project-group-permissions": {
+		model:   GroupPermission{},
+		ignored: append(prefixed("group", groupRefFields), "project"),
+	},
+	"project-repositories": {
+		model:   Repository{},
+		ignored: repositoryFields,
+	},
+	"repository": {
+		model:   Repository{},
+		ignored: repositoryFields,
+	},
+	"repository-user-permissions": {
+		model:   UserPermission{},
+		ignored: []string{"repository"},
+	},
+	"repository-group-permissions": {
+		model:   GroupPermission{},
+		ignored: append(prefixed("group", groupRefFields), "repository"),
+	},
+	"repository-user-privileges": {
+		model:   repositoryPrivilege{},
+		ignored: append(prefixed("user", v1UserFields), "user.first_name", "user.last_name", "repo"),
+	},
+	"repository-group-privileges": {
+		model:   repositoryGroupPrivilege{},
+		ignored: append(prefixed("group.members[]", v1UserFields), "group.owner", "group.email_forwarding_disabled", "group.account_privilege", "repo", "repository"),
+	},
+	"repository-branch-restrictions": {
+		model:   BranchRestriction{},
+		ignored: prefixed("groups[]", groupRefFields),
+	},
+	"repository-environments": {
+		model:   Environment{},
+		ignored: []string{"rank", "hidden", "lock", "environment_type.rank", "environment_lock_enabled", "deployment_gate_enabled", "category"},
+	},
+	"repository-pipelines-config": {
+		model:   PipelinesConfig{},
+		ignored: []string{"repository"},
+	},
+	"repository-commits": {
+		model:   Commit{},
+		ignored: []string{"message", "summary", "parents", "repository"},
+	},
+	"repository-pullrequests": {
+		model: PullRequest{},
+		ignored: []string{
+			"title", "description", "comment_count", "task_count", "close_source_branch", "reason",
+			"merge_commit", "source", "destination", "summary",
+		},
+	},
+}
+
+func prefixed(prefix string, fields []string) []string {
+	rv := make([]string, 0, len(fields))
+	for _, field := range fields {
+		rv = append(rv, prefix+"."+field)
+	}
+
+	return rv
+}
+
+func TestModelsDecodeFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "contract", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		fixtures[name] = struct{}{}
+
+		t.Run(name, func(t *testing.T) {
+			c, ok := contracts[name]
+			if !ok {
+				t.Fatalf("no model registered for fixture %s", name)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var pages []json.RawMessage
+			err = json.Unmarshal(data, &pages)
+			if err != nil {
+				t.Fatalf("fixture is not a list of pages: %v", err)
+			}
+
+			items := fixtureItems(t, pages)
+			if len(items) == 0 {
+				t.Fatal("fixture has no items")
+			}
+
+			for i, item := range items {
+				for _, field := range droppedFields(t, item, reflect.TypeOf(c.model), c.ignored) {
+					t.Errorf("item %d: field %s is not decoded by %T", i, field, c.model)
+				}
+			}
+		})
+	}
+
+	for name := range contracts {
+		if _, ok := fixtures[name]; !ok {
+			t.Errorf("no fixture for %s", name)
+		}
+	}
+}
+
+// fixtureItems returns the objects of the pages, the values of 2.0 listings, the items of 1.0
+// listings or the page itself when it isn't a listing.
+func fixtureItems(t *testing.T, pages []json.RawMessage) []json.RawMessage {
+	var rv []json.RawMessage
+	for _, page := range pages {
+		var items []json.RawMessage
+		if json.Unmarshal(page, &items) == nil {
+			rv = append(rv, items...)
+			continue
+		}
+
+		var listing struct {
+			Values *[]json.RawMessage `json:"values"`
+		}
+		err := json.Unmarshal(page, &listing)
+		if err != nil {
+			t.Fatalf("page is neither an object nor a list: %v", err)
+		}
+
+		if listing.Values != nil {
+			rv = append(rv, *listing.Values...)
+			continue
+		}
+
+		rv = append(rv, page)
+	}
+
+	return rv
+}
+
+// droppedFields decodes the item into a new value of the model and returns the fields of the
+// item which don't survive encoding that value again.
+func droppedFields(t *testing.T, item json.RawMessage, model reflect.Type, ignored []string) []string {
+	value := reflect.New(model)
+	err := json.Unmarshal(item, value.Interface())
+	if err != nil {
+		t.Fatalf("failed to decode into %s: %v", model, err)
+	}
+
+	decoded, err := json.Marshal(value.Interface())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := fieldPaths(t, item)
+	got := fieldPaths(t, decoded)
+
+	var rv []string
+	for path := range want {
+		if _, ok := got[path]; ok || isIgnored(path, ignored) {
+			continue
+		}
+		rv = append(rv, path)
+	}
+	sort.Strings(rv)
+
+	return rv
+}
+
+// fieldPaths returns the paths of the leaves of the JSON document.
+func fieldPaths(t *testing.T, data []byte) map[string]struct{} {
+	var doc interface{}
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rv := make(map[string]struct{})
+	collectFieldPaths(rv, "", doc)
+
+	return rv
+}
+
+func collectFieldPaths(paths map[string]struct{}, prefix string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if _, ok := untypedFields[key]; ok {
+				continue
+			}
+
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			collectFieldPaths(paths, path, child)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			paths[prefix] = struct{}{}
+		}
+		for _, child := range v {
+			collectFieldPaths(paths, prefix+"[]", child)
+		}
+	default:
+		paths[prefix] = struct{}{}
+	}
+}
+
+// isIgnored reports whether the path is one of the ignored fields or nested in one.
+func isIgnored(path string, ignored []string) bool {
+	for _, field := range ignored {
+		if path == field || strings.HasPrefix(path, field+".") || strings.HasPrefix(path, field+"[]") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,146 @@
+package bitbucket
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	redacted         = "[REDACTED]"
+	maxLoggedBodyLen = 2048
+)
+
+var (
+	sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+	sensitiveParams  = []string{"access_token", "refresh_token", "client_secret", "token", "password"}
+
+	// matches JSON attributes like `"access_token": "value"` so that the value can be masked.
+	sensitiveJSONValue = regexp.MustCompile(`(?i)("(?:access_token|refresh_token|client_secret|token|password|secret)"\s*:\s*)"[^"]*"`)
+)
+
+type debugTransport struct {
+	base      http.RoundTripper
+	logBodies bool
+	// redactedHeaders are redacted in addition to the well-known sensitive headers
+	redactedHeaders []string
+}
+
+// NewDebugTransport wraps provided transport and logs method, url, status and duration
+// of every request sent to the Bitbucket API. Credentials and the values of redactedHeaders
+// are redacted from the output.
+func NewDebugTransport(base http.RoundTripper, logBodies bool, redactedHeaders []string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &debugTransport{
+		base:            base,
+		logBodies:       logBodies,
+		redactedHeaders: redactedHeaders,
+	}
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l := ctxzap.Extract(req.Context())
+
+	fields := []zap.Field{
+		zap.String("method", req.Method),
+		zap.String("url", redactURL(req)),
+		zap.Any("request_headers", redactHeaders(req.Header, t.redactedHeaders...)),
+	}
+
+	if t.logBodies && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			fields = append(fields, zap.String("request_body", readLoggedBody(body)))
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	fields = append(fields, zap.Duration("duration", time.Since(start)))
+
+	if err != nil {
+		l.Info("bitbucket: http request failed", append(fields, zap.Error(err))...)
+		return resp, err
+	}
+
+	fields = append(fields, zap.Int("status", resp.StatusCode), zap.String("request_id", resp.Header.Get(requestIdHeader)))
+
+	if t.logBodies && resp.Body != nil {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		fields = append(fields, zap.String("response_body", truncateBody(body)))
+	}
+
+	l.Info("bitbucket: http request", fields...)
+
+	return resp, nil
+}
+
+func redactURL(req *http.Request) string {
+	u := *req.URL
+	query := u.Query()
+
+	for _, param := range sensitiveParams {
+		if query.Has(param) {
+			query.Set(param, redacted)
+		}
+	}
+
+	u.RawQuery = query.Encode()
+	u.User = nil
+
+	return u.String()
+}
+
+func redactHeaders(headers http.Header, extra ...string) map[string]string {
+	rv := make(map[string]string, len(headers))
+
+	for name, values := range headers {
+		rv[name] = strings.Join(values, ",")
+	}
+
+	for _, name := range slices.Concat(sensitiveHeaders, extra) {
+		name = http.CanonicalHeaderKey(name)
+		if _, ok := rv[name]; ok {
+			rv[name] = redacted
+		}
+	}
+
+	return rv
+}
+
+func readLoggedBody(body io.ReadCloser) string {
+	defer body.Close()
+
+	payload, err := io.ReadAll(io.LimitReader(body, maxLoggedBodyLen+1))
+	if err != nil {
+		return ""
+	}
+
+	return truncateBody(payload)
+}
+
+func truncateBody(body []byte) string {
+	payload := sensitiveJSONValue.ReplaceAllString(string(body), `$1"`+redacted+`"`)
+
+	if len(payload) > maxLoggedBodyLen {
+		return payload[:maxLoggedBodyLen] + "...(truncated)"
+	}
+
+	return payload
+}
@@ -0,0 +1,25 @@
+// Package bitbucket is a client of the Bitbucket Cloud REST API, covering workspaces, user groups,
+// projects, repositories and their permissions. It can be used on its own, without the connector:
+//
+//	client, err := bitbucket.New(
+//		ctx,
+//		bitbucket.WithToken(token),
+//		bitbucket.WithUserAgent("audit-tool/1.0"),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//
+//	err = client.Workspaces.ForEachMember(ctx, workspaceId, func(user bitbucket.User) error {
+//		fmt.Println(user.Name)
+//		return nil
+//	})
+//
+// The endpoints are grouped by what they act on: Workspaces, Users, Projects and Repos hold the 2.0
+// endpoints, V1 the deprecated 1.0 ones, e.g. client.V1.Groups.List.
+//
+// Failed requests return an *APIError, which matches ErrNotFound, ErrPermissionDenied and the other
+// sentinel errors via errors.Is. Listings are paginated with PaginationVars, the ForEach methods
+// walk all pages. Requests to an endpoint are paused while it keeps responding with server errors,
+// see WithCircuitBreaker, and the latest rate limit state is available from RateLimits.
+package bitbucket
@@ -0,0 +1,158 @@
+package bitbucket
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const requestIdHeader = "X-Request-Id"
+
+// rateLimitHeaders are the headers describing the rate limit state of a response.
+var rateLimitHeaders = []string{
+	rateLimitLimitHeader,
+	rateLimitRemainingHeader,
+	rateLimitResourceHeader,
+	rateLimitNearLimitHeader,
+	retryAfterHeader,
+}
+
+var (
+	ErrUnauthorized     = errors.New("bitbucket: unauthorized")
+	ErrPermissionDenied = errors.New("bitbucket: permission denied")
+	ErrNotFound         = errors.New("bitbucket: not found")
+	ErrRateLimited      = errors.New("bitbucket: rate limited")
+	ErrConflict         = errors.New("bitbucket: conflict")
+	// ErrServerError matches the 5xx responses, which are usually transient.
+	ErrServerError = errors.New("bitbucket: server error")
+	// ErrUnexpectedResponse matches the successful responses which aren't the expected JSON payload.
+	ErrUnexpectedResponse = errors.New("bitbucket: unexpected response")
+
+	// ErrNotWorkspaceScoped is returned by WorkspaceId when the credentials are not scoped to a single workspace.
+	ErrNotWorkspaceScoped = errors.New("bitbucket: client is not workspace scoped")
+	// ErrNotUserScoped is returned by SetWorkspaceIDs when the credentials are scoped to a single workspace.
+	ErrNotUserScoped = errors.New("bitbucket: client is not user scoped")
+	// ErrNoWorkspaces is returned by SetWorkspaceIDs when the credentials can't sync any of the workspaces.
+	ErrNoWorkspaces = errors.New("bitbucket: no authenticated workspaces found")
+)
+
+// APIError is returned by the client when Bitbucket responds with an unsuccessful status code.
+// It matches one of the sentinel errors above via errors.Is.
+type APIError struct {
+	StatusCode int
+	// RequestId identifies the request for Atlassian support.
+	RequestId string
+	// RateLimit holds the rate limit headers of the response, if any.
+	RateLimit map[string]string
+	Err       error
+}
+
+func (e *APIError) Error() string {
+	var details []string
+	if e.RequestId != "" {
+		details = append(details, "request id: "+e.RequestId)
+	}
+
+	names := make([]string, 0, len(e.RateLimit))
+	for name := range e.RateLimit {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		details = append(details, fmt.Sprintf("%s: %s", name, e.RateLimit[name]))
+	}
+
+	if len(details) == 0 {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("%s (%s)", e.Err.Error(), strings.Join(details, ", "))
+}
+
+// LogFields returns the response details worth logging along with the error.
+func (e *APIError) LogFields() []zap.Field {
+	return []zap.Field{
+		zap.Int("status", e.StatusCode),
+		zap.String("request_id", e.RequestId),
+		zap.Any("rate_limit", e.RateLimit),
+	}
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func (e *APIError) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrPermissionDenied
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	case http.StatusConflict:
+		return target == ErrConflict
+	}
+
+	if e.StatusCode >= http.StatusInternalServerError {
+		return target == ErrServerError
+	}
+
+	return false
+}
+
+// IsPlanError reports whether Bitbucket rejected the request because the workspace is not on the
+// Premium plan. A plan error is told apart from missing access of the credentials by its message,
+// as both can be denied with the same status.
+func IsPlanError(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	if apiErr.StatusCode != http.StatusBadRequest && apiErr.StatusCode != http.StatusForbidden && apiErr.StatusCode != http.StatusPaymentRequired {
+		return false
+	}
+
+	return strings.Contains(strings.ToLower(apiErr.Err.Error()), "premium")
+}
+
+// wrapError converts the error of a request into an APIError
+// whenever the request reached Bitbucket and we know the response status.
+func wrapError(resp *http.Response, err error) error {
+	if err == nil || resp == nil {
+		return err
+	}
+
+	// the request succeeded, but the payload couldn't be decoded
+	if resp.StatusCode < 300 {
+		return fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+	}
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestId:  resp.Header.Get(requestIdHeader),
+		Err:        err,
+	}
+
+	for _, name := range rateLimitHeaders {
+		value := resp.Header.Get(name)
+		if value == "" {
+			continue
+		}
+
+		if apiErr.RateLimit == nil {
+			apiErr.RateLimit = make(map[string]string)
+		}
+		apiErr.RateLimit[name] = value
+	}
+
+	return apiErr
+}
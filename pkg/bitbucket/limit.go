@@ -0,0 +1,36 @@
+package bitbucket
+
+import (
+	"context"
+)
+
+// RequestLimit bounds the number of requests in flight. It is shared by the clients of all
+// credentials, so the parallel parts of a sync, like fetching user details, stay within it together.
+type RequestLimit struct {
+	slots chan struct{}
+}
+
+// NewRequestLimit returns nil, which doesn't limit the requests, when max is not positive.
+func NewRequestLimit(max int) *RequestLimit {
+	if max <= 0 {
+		return nil
+	}
+
+	return &RequestLimit{
+		slots: make(chan struct{}, max),
+	}
+}
+
+// acquire waits for a free slot, the returned function frees it.
+func (l *RequestLimit) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
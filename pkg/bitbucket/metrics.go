@@ -0,0 +1,90 @@
+package bitbucket
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// requestMetrics counts the requests sent to the Bitbucket API. Like the rate limit gauges,
+// they are reported via the global meter provider, which is a no-op unless one is configured.
+type requestMetrics struct {
+	requests metric.Int64Counter
+	errors   metric.Int64Counter
+}
+
+var apiMetrics = newRequestMetrics(otel.Meter(instrumentationName))
+
+func newRequestMetrics(meter metric.Meter) *requestMetrics {
+	requests, err := meter.Int64Counter(
+		"bitbucket.api.requests",
+		metric.WithDescription("Requests sent to the Bitbucket API."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	errors, err := meter.Int64Counter(
+		"bitbucket.api.errors",
+		metric.WithDescription("Requests to the Bitbucket API which failed."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return &requestMetrics{
+		requests: requests,
+		errors:   errors,
+	}
+}
+
+// record counts the request, failed requests without a response are counted with status 0.
+func (m *requestMetrics) record(ctx context.Context, req *http.Request, resp *http.Response, err error) {
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+
+	attrs := metric.WithAttributes(
+		attribute.String("method", req.Method),
+		attribute.String("status", strconv.Itoa(statusCode)),
+	)
+
+	countRequest(ctx)
+	if m.requests != nil {
+		m.requests.Add(ctx, 1, attrs)
+	}
+	if err != nil && m.errors != nil {
+		m.errors.Add(ctx, 1, attrs)
+	}
+}
+
+type requestCounterKey struct{}
+
+// RequestCounter counts the requests sent to the Bitbucket API with a context it was attached to.
+type RequestCounter struct {
+	n atomic.Int64
+}
+
+// WithRequestCounter attaches a new request counter to the context.
+func WithRequestCounter(ctx context.Context) (context.Context, *RequestCounter) {
+	counter := &RequestCounter{}
+
+	return context.WithValue(ctx, requestCounterKey{}, counter), counter
+}
+
+// Count returns the number of requests sent so far.
+func (c *RequestCounter) Count() int64 {
+	return c.n.Load()
+}
+
+func countRequest(ctx context.Context) {
+	if counter, ok := ctx.Value(requestCounterKey{}).(*RequestCounter); ok {
+		counter.n.Add(1)
+	}
+}
@@ -1,5 +1,7 @@
 package bitbucket
 
+import "strings"
+
 type BaseResource struct {
 	Id string `json:"uuid"`
 }
@@ -10,16 +12,48 @@ type Workspace struct {
 	Name string `json:"name"`
 }
 
+// WorkspacePermission is the permission (owner, collaborator or member) of the current user in a workspace.
+type WorkspacePermission struct {
+	Permission string    `json:"permission"`
+	Workspace  Workspace `json:"workspace"`
+}
+
 type WorkspaceMember struct {
-	User User `json:"user"`
+	User    User   `json:"user"`
+	AddedOn string `json:"added_on"`
 }
 
 type User struct {
 	BaseResource
-	Type     string `json:"type"`
-	Name     string `json:"display_name"`
-	Username string `json:"username"`
-	Status   string `json:"account_status"`
+	Type      string `json:"type"`
+	Name      string `json:"display_name"`
+	Username  string `json:"username"`
+	Nickname  string `json:"nickname"`
+	Status    string `json:"account_status"`
+	AccountId string `json:"account_id"`
+	CreatedOn string `json:"created_on"`
+	Links     struct {
+		Avatar Link `json:"avatar"`
+	} `json:"links"`
+	// JoinedOn is when the user was added to the workspace it was listed as a member of,
+	// only set when Bitbucket reports it.
+	JoinedOn string `json:"-"`
+}
+
+// Matches reports whether the user goes by the identifier, which is compared case-insensitively
+// to its UUID, nickname, username and Atlassian account ID.
+func (u *User) Matches(identifier string) bool {
+	for _, id := range []string{u.Id, u.Nickname, u.Username, u.AccountId} {
+		if id != "" && strings.EqualFold(id, identifier) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Link struct {
+	Href string `json:"href"`
 }
 
 type UserGroup struct {
@@ -27,6 +61,8 @@ type UserGroup struct {
 	Slug       string `json:"slug"`
 	Permission string `json:"permission"`
 	Members    []User `json:"members"`
+	// AutoAdd is set on default access groups, new workspace members are added to them automatically.
+	AutoAdd bool `json:"auto_add"`
 }
 
 type Project struct {
@@ -34,20 +70,132 @@ type Project struct {
 	Key         string `json:"key"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// Workspace is only set when the project is fetched on its own.
+	Workspace *Workspace `json:"workspace"`
 }
 
 type Repository struct {
 	BaseResource
-	Slug        string `json:"slug"`
-	Name        string `json:"name"`
-	FullName    string `json:"full_name"`
-	Description string `json:"description"`
+	Slug        string  `json:"slug"`
+	Name        string  `json:"name"`
+	FullName    string  `json:"full_name"`
+	Description string  `json:"description"`
+	MainBranch  *Branch `json:"mainbranch"`
+	IsPrivate   bool    `json:"is_private"`
+	HasWiki     bool    `json:"has_wiki"`
+	HasIssues   bool    `json:"has_issues"`
+	Language    string  `json:"language"`
+	Size        int64   `json:"size"` // in bytes
+	CreatedOn   string  `json:"created_on"`
+	UpdatedOn   string  `json:"updated_on"`
+	Project     *struct {
+		BaseResource
+		Key  string `json:"key"`
+		Name string `json:"name"`
+	} `json:"project"`
+	// Workspace is only set when the repository is fetched on its own.
+	Workspace *Workspace `json:"workspace"`
+	Links     struct {
+		HTML Link `json:"html"`
+	} `json:"links"`
+}
+
+type BranchingModel struct {
+	Development *BranchingModelBranch `json:"development"`
+	Production  *BranchingModelBranch `json:"production"`
+	BranchTypes []BranchType          `json:"branch_types"`
+}
+
+type BranchingModelBranch struct {
+	Name          string `json:"name"`
+	UseMainBranch bool   `json:"use_mainbranch"`
+	Enabled       *bool  `json:"enabled,omitempty"`
+}
+
+type BranchType struct {
+	Kind    string `json:"kind"`
+	Prefix  string `json:"prefix"`
+	Enabled *bool  `json:"enabled,omitempty"`
+}
+
+type Branch struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type BranchRestriction struct {
+	Id              int    `json:"id"`
+	Kind            string `json:"kind"`
+	BranchMatchKind string `json:"branch_match_kind"`
+	BranchType      string `json:"branch_type"`
+	Pattern         string `json:"pattern"`
+	// Value is the threshold of merge checks, e.g. the number of approvals required to merge.
+	Value  *int        `json:"value"`
+	Users  []User      `json:"users"`
+	Groups []UserGroup `json:"groups"`
+}
+
+type Runner struct {
+	BaseResource
+	Name      string      `json:"name"`
+	Labels    []string    `json:"labels"`
+	State     RunnerState `json:"state"`
+	CreatedOn string      `json:"created_on"`
+	UpdatedOn string      `json:"updated_on"`
+}
+
+type RunnerState struct {
+	Status string `json:"status"`
+	// UpdatedOn is refreshed whenever the runner reports to Pipelines.
+	UpdatedOn string `json:"updated_on"`
+	Cordoned  bool   `json:"cordoned"`
+}
+
+type PipelinesConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+type Environment struct {
+	BaseResource
+	Name            string          `json:"name"`
+	Slug            string          `json:"slug"`
+	EnvironmentType EnvironmentType `json:"environment_type"`
+	Restrictions    struct {
+		// AdminOnly limits deployments to repository admins.
+		AdminOnly bool `json:"admin_only"`
+	} `json:"restrictions"`
+}
+
+type EnvironmentType struct {
+	Name string `json:"name"`
+}
+
+// Commit is a commit of a repository, its author only has a user when the author email
+// belongs to a Bitbucket account.
+type Commit struct {
+	Hash   string `json:"hash"`
+	Date   string `json:"date"`
+	Author struct {
+		Raw  string `json:"raw"`
+		User *User  `json:"user"`
+	} `json:"author"`
+}
+
+type PullRequest struct {
+	Id        int    `json:"id"`
+	State     string `json:"state"`
+	Author    *User  `json:"author"`
+	ClosedBy  *User  `json:"closed_by"`
+	CreatedOn string `json:"created_on"`
+	UpdatedOn string `json:"updated_on"`
 }
 
 type Permission struct {
 	Slug  string `json:"slug"`
 	Name  string `json:"name"`
 	Value string `json:"permission"`
+	// Legacy is set on the permissions read from the 1.0 privileges endpoints.
+	Legacy bool `json:"-"`
 }
 
 type GroupPermission struct {
@@ -0,0 +1,53 @@
+package bitbucket
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const oauthScopesHeader = "X-OAuth-Scopes"
+
+// grantedScopes keeps the OAuth scopes Bitbucket reports for the credentials of the client.
+type grantedScopes struct {
+	mtx    sync.Mutex
+	scopes []string
+	known  bool
+}
+
+// record updates the scopes from the response headers, responses without them are ignored.
+func (s *grantedScopes) record(header http.Header) {
+	if s == nil {
+		return
+	}
+
+	values := header.Values(oauthScopesHeader)
+	if len(values) == 0 {
+		return
+	}
+
+	var scopes []string
+	for _, value := range values {
+		for _, scope := range strings.Split(value, ",") {
+			scope = strings.TrimSpace(scope)
+			if scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.scopes = scopes
+	s.known = true
+}
+
+// OAuthScopes returns the OAuth scopes granted to the credentials, as reported by the latest response.
+// The second value is false when Bitbucket didn't report them yet.
+func (c *Client) OAuthScopes() ([]string, bool) {
+	c.scopes.mtx.Lock()
+	defer c.scopes.mtx.Unlock()
+
+	return append([]string(nil), c.scopes.scopes...), c.scopes.known
+}
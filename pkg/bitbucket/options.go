@@ -0,0 +1,183 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// defaultAPIURL is what the endpoint URLs are relative to, WithBaseURL replaces it.
+var defaultAPIURL, _ = url.Parse("https://api.bitbucket.org/")
+
+// Option configures a Client created by New.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	httpClient       *http.Client
+	token            string
+	baseURL          string
+	userAgent        string
+	headers          http.Header
+	cache            HTTPCacheConfig
+	pageSizes        *PageSizes
+	limit            *RequestLimit
+	breakerThreshold int
+	breakerCooldown  time.Duration
+}
+
+// WithHTTPClient sends the requests with provided http client, which is expected to authenticate them.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *clientOptions) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithToken authenticates the requests with an access token, e.g. an OAuth access token or
+// a workspace, project or repository access token.
+func WithToken(token string) Option {
+	return func(o *clientOptions) {
+		o.token = token
+	}
+}
+
+// WithBaseURL sends the requests to another host than api.bitbucket.org, e.g. a proxy or a fake
+// of the API in tests. The 1.0, 2.0 and internal paths of the endpoints are appended to it.
+func WithBaseURL(baseURL string) Option {
+	return func(o *clientOptions) {
+		o.baseURL = baseURL
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(userAgent string) Option {
+	return func(o *clientOptions) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithHeaders adds static headers to every request, e.g. the API key of a gateway the traffic must pass.
+func WithHeaders(headers http.Header) Option {
+	return func(o *clientOptions) {
+		o.headers = headers
+	}
+}
+
+// WithHTTPCache configures the cache of GET responses.
+func WithHTTPCache(config HTTPCacheConfig) Option {
+	return func(o *clientOptions) {
+		o.cache = config
+	}
+}
+
+// WithPageSizes shares the page sizes remembered for failing endpoints with other clients.
+func WithPageSizes(pageSizes *PageSizes) Option {
+	return func(o *clientOptions) {
+		o.pageSizes = pageSizes
+	}
+}
+
+// WithRequestLimit bounds the requests in flight, the limit can be shared with other clients.
+func WithRequestLimit(limit *RequestLimit) Option {
+	return func(o *clientOptions) {
+		o.limit = limit
+	}
+}
+
+// WithCircuitBreaker pauses the requests to an endpoint for the cooldown once it responded with
+// threshold server errors in a row. It defaults to 5 errors and 30 seconds.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(o *clientOptions) {
+		o.breakerThreshold = threshold
+		o.breakerCooldown = cooldown
+	}
+}
+
+// New creates a client of the Bitbucket Cloud API. Without WithHTTPClient or WithToken,
+// the requests are sent unauthenticated.
+func New(ctx context.Context, opts ...Option) (*Client, error) {
+	o := &clientOptions{
+		pageSizes:        NewPageSizes(),
+		breakerThreshold: defaultBreakerThreshold,
+		breakerCooldown:  defaultBreakerCooldown,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.httpClient != nil && o.token != "" {
+		return nil, fmt.Errorf("bitbucket: WithHTTPClient and WithToken can't be combined")
+	}
+
+	httpClient := o.httpClient
+	switch {
+	case o.token != "":
+		httpClient = &http.Client{
+			Transport: &oauth2.Transport{
+				Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: o.token}),
+				Base:   NewTransport(TransportConfig{}),
+			},
+		}
+	case httpClient == nil:
+		httpClient = &http.Client{Transport: NewTransport(TransportConfig{})}
+	}
+
+	var baseURL *url.URL
+	if o.baseURL != "" {
+		var err error
+		baseURL, err = url.Parse(o.baseURL)
+		if err != nil {
+			return nil, fmt.Errorf("bitbucket: invalid base url: %w", err)
+		}
+		if baseURL.Scheme == "" || baseURL.Host == "" {
+			return nil, fmt.Errorf("bitbucket: invalid base url %q: scheme and host are required", o.baseURL)
+		}
+	}
+
+	c := &Client{
+		httpClient: httpClient,
+		cache:      newMemoryCache(o.cache),
+		baseURL:    baseURL,
+		userAgent:  o.userAgent,
+		headers:    o.headers.Clone(),
+		breaker:    newCircuitBreaker(o.breakerThreshold, o.breakerCooldown),
+		rateLimits: newRateLimitTracker(),
+		scopes:     &grantedScopes{},
+		pageSizes:  o.pageSizes,
+		limit:      o.limit,
+	}
+
+	c.V1 = &V1Client{
+		Groups:     &GroupsV1Client{client: c},
+		Privileges: &PrivilegesV1Client{client: c},
+	}
+	c.Workspaces = &WorkspacesClient{client: c}
+	c.Users = &UsersClient{client: c}
+	c.Projects = &ProjectsClient{client: c}
+	c.Repos = &ReposClient{client: c}
+
+	return c, nil
+}
+
+// resolve returns the URL of an endpoint on the base URL of the client.
+func (c *Client) resolve(urlAddress *url.URL) *url.URL {
+	if c.baseURL == nil || urlAddress.Host != defaultAPIURL.Host {
+		return urlAddress
+	}
+
+	prefix := strings.TrimSuffix(c.baseURL.Path, "/")
+
+	resolved := *urlAddress
+	resolved.Scheme = c.baseURL.Scheme
+	resolved.Host = c.baseURL.Host
+	resolved.Path = prefix + urlAddress.Path
+	if urlAddress.RawPath != "" {
+		resolved.RawPath = strings.TrimSuffix(c.baseURL.EscapedPath(), "/") + urlAddress.RawPath
+	}
+
+	return &resolved
+}
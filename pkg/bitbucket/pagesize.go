@@ -0,0 +1,190 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// minPageSize is the smallest page size a listing is downshifted to.
+const minPageSize = 5
+
+// PageSizes remembers the page size every endpoint works with, once it rejected or timed out
+// on larger pages. It can be shared by the clients of all credentials and is reset between syncs.
+type PageSizes struct {
+	mtx   sync.Mutex
+	sizes map[string]int
+}
+
+func NewPageSizes() *PageSizes {
+	return &PageSizes{
+		sizes: make(map[string]int),
+	}
+}
+
+// Reset forgets the remembered page sizes, so the next sync tries the requested ones again.
+func (p *PageSizes) Reset() {
+	if p == nil {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.sizes = make(map[string]int)
+}
+
+// size returns the page size to request a page of given length with, which always divides the length.
+func (p *PageSizes) size(endpoint string, limit int) int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	working, ok := p.sizes[endpoint]
+	if !ok || working >= limit {
+		return limit
+	}
+
+	return chunkSize(limit, working)
+}
+
+// downshift remembers a smaller page size for the endpoint after the current one failed,
+// false when the size can't get any smaller.
+func (p *PageSizes) downshift(endpoint string, limit, failed int) (int, bool) {
+	smaller := chunkSize(limit, failed/2)
+	if smaller < minPageSize || smaller >= failed {
+		return 0, false
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if working, ok := p.sizes[endpoint]; !ok || smaller < working {
+		p.sizes[endpoint] = smaller
+	}
+
+	return smaller, true
+}
+
+// chunkSize returns the largest divisor of the limit not larger than max, so a page of the
+// limit maps to a whole number of smaller pages.
+func chunkSize(limit, max int) int {
+	for size := min(limit, max); size > 1; size-- {
+		if limit%size == 0 {
+			return size
+		}
+	}
+
+	return 1
+}
+
+// isPageSizeError reports whether the request failed because of the size of the requested page:
+// Bitbucket rejects too large pagelen values, and large pages of slow endpoints time out.
+func isPageSizeError(ctx context.Context, err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusBadRequest:
+			return strings.Contains(strings.ToLower(apiErr.Error()), "pagelen")
+		case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+			return true
+		}
+
+		return false
+	}
+
+	// a cancelled or expired sync is not a timeout of the endpoint
+	var netErr net.Error
+	return ctx.Err() == nil && errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// getPage requests a page of a listing. When the endpoint rejects the page size or times out on it,
+// the page is requested again as several smaller pages, and the working size is remembered for the
+// endpoint. The returned page and its next page token are always in units of the requested size,
+// so callers are not affected by a downshift, e.g. when resuming from a stored page token.
+func getPage[T any](ctx context.Context, c *Client, endpoint string, urlAddress *url.URL, vars PaginationVars, params ...QueryParam) (ListResponse[T], error) {
+	// only numbered pages can be split, cursors of other listings are opaque
+	_, numbered := pageNumber(vars.Page)
+	if vars.Limit <= 0 || c.pageSizes == nil || !numbered {
+		return getChunks[T](ctx, c, endpoint, urlAddress, vars, vars.Limit, params)
+	}
+
+	size := c.pageSizes.size(endpoint, vars.Limit)
+	for {
+		resp, err := getChunks[T](ctx, c, endpoint, urlAddress, vars, size, params)
+		if err == nil || !isPageSizeError(ctx, err) {
+			return resp, err
+		}
+
+		smaller, ok := c.pageSizes.downshift(endpoint, vars.Limit, size)
+		if !ok {
+			return resp, err
+		}
+
+		ctxzap.Extract(ctx).Warn(
+			"bitbucket: endpoint failed on the page size, retrying with smaller pages",
+			zap.String("endpoint", endpoint),
+			zap.Int("page_size", size),
+			zap.Int("smaller_page_size", smaller),
+			zap.Error(err),
+		)
+
+		size = smaller
+	}
+}
+
+// getChunks requests a page of the limit as pages of given size.
+func getChunks[T any](ctx context.Context, c *Client, endpoint string, urlAddress *url.URL, vars PaginationVars, size int, params []QueryParam) (ListResponse[T], error) {
+	var resp ListResponse[T]
+
+	if size == vars.Limit {
+		err := c.get(ctx, endpoint, urlAddress, &resp, append([]QueryParam{&vars}, params...))
+		return resp, err
+	}
+
+	page, _ := pageNumber(vars.Page)
+	chunks := vars.Limit / size
+
+	for i := 0; i < chunks; i++ {
+		chunkVars := PaginationVars{
+			Limit: size,
+			Page:  strconv.Itoa((page-1)*chunks + i + 1),
+		}
+
+		var chunk ListResponse[T]
+		err := c.get(ctx, endpoint, urlAddress, &chunk, append([]QueryParam{&chunkVars}, params...))
+		if err != nil {
+			return ListResponse[T]{}, err
+		}
+
+		resp.Values = append(resp.Values, chunk.Values...)
+		if chunk.Next == "" {
+			return resp, nil
+		}
+	}
+
+	resp.Next = "?page=" + strconv.Itoa(page+1)
+
+	return resp, nil
+}
+
+// pageNumber parses the token of a numbered page, the first page has no token.
+func pageNumber(page string) (int, bool) {
+	if page == "" {
+		return 1, true
+	}
+
+	n, err := strconv.Atoi(page)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+
+	return n, true
+}
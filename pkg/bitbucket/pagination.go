@@ -0,0 +1,100 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// DefaultPageSize is the page length used when iterating over all pages of a listing.
+const DefaultPageSize = 50
+
+const (
+	pageRetries      = 3
+	pageRetryBackoff = time.Second
+)
+
+// pageFetcher returns a single page of results together with the token of the next page.
+type pageFetcher[T any] func(ctx context.Context, pagination PaginationVars) ([]T, string, error)
+
+// forEachPage walks through all pages returned by fetch and calls fn for every item. A page failing
+// with a server error is fetched again, so the pages already walked are not lost to a transient error.
+// Iteration stops at the first other error returned either by fetch or fn, or once the context is done.
+func forEachPage[T any](ctx context.Context, fetch pageFetcher[T], fn func(T) error) error {
+	var next string
+
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		items, nextPage, err := fetchPage(ctx, fetch, next)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			err = fn(item)
+			if err != nil {
+				return err
+			}
+		}
+
+		next = nextPage
+		if next == "" {
+			return nil
+		}
+	}
+}
+
+// fetchPage fetches a single page, retrying it with an exponential backoff while it fails with a server error.
+func fetchPage[T any](ctx context.Context, fetch pageFetcher[T], page string) ([]T, string, error) {
+	backoff := pageRetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		items, nextPage, err := fetch(ctx, PaginationVars{
+			Limit: DefaultPageSize,
+			Page:  page,
+		})
+		if err == nil || !errors.Is(err, ErrServerError) || attempt == pageRetries {
+			return items, nextPage, err
+		}
+
+		ctxzap.Extract(ctx).Warn(
+			"bitbucket: page failed with a server error, retrying",
+			zap.String("page", page),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, "", ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= 2
+	}
+}
+
+// collectPages gathers all items of a paginated listing into a single slice.
+func collectPages[T any](ctx context.Context, fetch pageFetcher[T]) ([]T, error) {
+	var all []T
+
+	err := forEachPage(ctx, fetch, func(item T) error {
+		all = append(all, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return all, nil
+}
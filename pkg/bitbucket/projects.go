@@ -0,0 +1,331 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// ProjectsClient holds the 2.0 endpoints of the projects of a workspace and their permissions.
+type ProjectsClient struct {
+	client *Client
+}
+
+// List lists all projects that belong under specified workspace.
+func (p *ProjectsClient) List(ctx context.Context, workspaceId string, getWorkspaceProjectsVars PaginationVars) ([]Project, string, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	urlAddress, err := url.Parse(fmt.Sprintf(WorkspaceProjectsBaseURL, encodedWorkspaceId))
+	if err != nil {
+		return nil, "", err
+	}
+
+	workspaceProjectsResponse, err := getPage[Project](ctx, p.client, WorkspaceProjectsBaseURL, urlAddress, getWorkspaceProjectsVars, prepareFilters("", "-*.workspace", "-*.owner"))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(workspaceProjectsResponse)
+}
+
+// Get returns specific project, including its workspace. The workspace can be {}
+// when the project is identified by its UUID.
+func (p *ProjectsClient) Get(ctx context.Context, workspaceId string, projectId string) (*Project, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	encodedProjectId := url.PathEscape(projectId)
+	urlAddress, err := url.Parse(fmt.Sprintf(WorkspaceProjectBaseURL, encodedWorkspaceId, encodedProjectId))
+	if err != nil {
+		return nil, err
+	}
+
+	var projectResponse Project
+	err = p.client.get(
+		ctx,
+		WorkspaceProjectBaseURL,
+		urlAddress,
+		&projectResponse,
+		[]QueryParam{
+			prepareFilters("", "-owner"),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &projectResponse, nil
+}
+
+// All lists all projects looping through all pages.
+func (p *ProjectsClient) All(ctx context.Context, workspaceId string) ([]Project, error) {
+	return collectPages(ctx, func(ctx context.Context, pagination PaginationVars) ([]Project, string, error) {
+		return p.List(ctx, workspaceId, pagination)
+	})
+}
+
+// BranchingModel returns the branching model configured for specified project.
+func (p *ProjectsClient) BranchingModel(ctx context.Context, workspaceId string, projectKey string) (*BranchingModel, error) {
+	encodedWorkspaceId, encodedProjectKey := url.PathEscape(workspaceId), url.PathEscape(projectKey)
+	urlAddress, err := url.Parse(fmt.Sprintf(ProjectBranchingModelBaseURL, encodedWorkspaceId, encodedProjectKey))
+	if err != nil {
+		return nil, err
+	}
+
+	var branchingModelResponse BranchingModel
+	err = p.client.get(
+		ctx,
+		ProjectBranchingModelBaseURL,
+		urlAddress,
+		&branchingModelResponse,
+		[]QueryParam{
+			prepareFilters(""),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &branchingModelResponse, nil
+}
+
+// GroupPermissions lists all group permissions that belong under specified project.
+func (p *ProjectsClient) GroupPermissions(ctx context.Context, workspaceId string, projectKey string, getPermissionsVars PaginationVars) ([]GroupPermission, string, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	urlAddress, err := url.Parse(fmt.Sprintf(ProjectGroupPermissionsBaseURL, encodedWorkspaceId, projectKey))
+	if err != nil {
+		return nil, "", err
+	}
+
+	projectGroupPermissionsResponse, err := getPage[GroupPermission](ctx, p.client, ProjectGroupPermissionsBaseURL, urlAddress, getPermissionsVars, prepareFilters("", "-*.*.workspace", "-*.*.owner", "-values.project"))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(projectGroupPermissionsResponse)
+}
+
+// GroupPermission returns group permission of specific group under provided project.
+func (p *ProjectsClient) GroupPermission(
+	ctx context.Context,
+	workspaceId string,
+	projectKey string,
+	groupSlug string,
+) (*GroupPermission, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	urlAddress, err := url.Parse(fmt.Sprintf(ProjectGroupPermissionBaseURL, encodedWorkspaceId, projectKey, groupSlug))
+	if err != nil {
+		return nil, err
+	}
+
+	var projectGroupPermissionsResponse GroupPermission
+	err = p.client.get(
+		ctx,
+		ProjectGroupPermissionBaseURL,
+		urlAddress,
+		&projectGroupPermissionsResponse,
+		[]QueryParam{
+			prepareFilters("", "-*.*.workspace", "-*.*.owner"),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &projectGroupPermissionsResponse, nil
+}
+
+// UpdateGroupPermission updates group permission of specific group under provided project.
+func (p *ProjectsClient) UpdateGroupPermission(
+	ctx context.Context,
+	workspaceId string,
+	projectKey string,
+	groupSlug string,
+	permission string,
+) error {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	urlAddress, err := url.Parse(fmt.Sprintf(ProjectGroupPermissionBaseURL, encodedWorkspaceId, projectKey, groupSlug))
+	if err != nil {
+		return err
+	}
+
+	err = p.client.put(
+		ctx,
+		ProjectGroupPermissionBaseURL,
+		urlAddress,
+		UpdatePermissionPayload{
+			Permission: permission,
+		},
+		nil,
+		nil,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteGroupPermission removes group permission of specific group under provided project.
+func (p *ProjectsClient) DeleteGroupPermission(
+	ctx context.Context,
+	workspaceId string,
+	projectKey string,
+	groupSlug string,
+) error {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	urlAddress, err := url.Parse(fmt.Sprintf(ProjectGroupPermissionBaseURL, encodedWorkspaceId, projectKey, groupSlug))
+	if err != nil {
+		return err
+	}
+
+	err = p.client.delete(ctx, ProjectGroupPermissionBaseURL, urlAddress)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// HasPermissions reports whether the project permissions API is available for specified workspace.
+// Bitbucket only exposes project permissions for workspaces on the Premium plan, others are denied
+// access with a message saying so. Other denials, e.g. of credentials which are not admins of the
+// project, are returned as ErrPermissionDenied errors, as they don't tell the plan.
+func (p *ProjectsClient) HasPermissions(ctx context.Context, workspaceId string, projectKey string) (bool, error) {
+	_, _, err := p.UserPermissions(ctx, workspaceId, projectKey, PaginationVars{Limit: 1})
+	if err != nil {
+		if IsPlanError(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UserPermissions lists all user permissions that belong under specified project.
+func (p *ProjectsClient) UserPermissions(ctx context.Context, workspaceId string, projectKey string, getPermissionsVars PaginationVars) ([]UserPermission, string, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	urlAddress, err := url.Parse(fmt.Sprintf(ProjectUserPermissionsBaseURL, encodedWorkspaceId, projectKey))
+	if err != nil {
+		return nil, "", err
+	}
+
+	projectUserPermissionsResponse, err := getPage[UserPermission](ctx, p.client, ProjectUserPermissionsBaseURL, urlAddress, getPermissionsVars, prepareFilters("", "-values.project"))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(projectUserPermissionsResponse)
+}
+
+// UserPermission returns user permission of specific user under provided project.
+func (p *ProjectsClient) UserPermission(
+	ctx context.Context,
+	workspaceId string,
+	projectKey string,
+	userId string,
+) (*UserPermission, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	encodedUserId := url.PathEscape(userId)
+	urlAddress, err := url.Parse(fmt.Sprintf(ProjectUserPermissionBaseURL, encodedWorkspaceId, projectKey, encodedUserId))
+	if err != nil {
+		return nil, err
+	}
+
+	var projectUserPermissionsResponse UserPermission
+	err = p.client.get(
+		ctx,
+		ProjectUserPermissionBaseURL,
+		urlAddress,
+		&projectUserPermissionsResponse,
+		[]QueryParam{
+			prepareFilters(""),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &projectUserPermissionsResponse, nil
+}
+
+// UpdateUserPermission updates user permission of specific user under provided project.
+func (p *ProjectsClient) UpdateUserPermission(
+	ctx context.Context,
+	workspaceId string,
+	projectKey string,
+	userId string,
+	permission string,
+) error {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	encodedUserId := url.PathEscape(userId)
+	urlAddress, err := url.Parse(fmt.Sprintf(ProjectUserPermissionBaseURL, encodedWorkspaceId, projectKey, encodedUserId))
+	if err != nil {
+		return err
+	}
+
+	err = p.client.put(
+		ctx,
+		ProjectUserPermissionBaseURL,
+		urlAddress,
+		UpdatePermissionPayload{
+			Permission: permission,
+		},
+		nil,
+		nil,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteUserPermission removes user permission of specific user under provided project.
+func (p *ProjectsClient) DeleteUserPermission(
+	ctx context.Context,
+	workspaceId string,
+	projectKey string,
+	userId string,
+) error {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	encodedUserId := url.PathEscape(userId)
+	urlAddress, err := url.Parse(fmt.Sprintf(ProjectUserPermissionBaseURL, encodedWorkspaceId, projectKey, encodedUserId))
+	if err != nil {
+		return err
+	}
+
+	err = p.client.delete(ctx, ProjectUserPermissionBaseURL, urlAddress)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ForEach calls fn for every project that belongs under specified workspace.
+func (p *ProjectsClient) ForEach(ctx context.Context, workspaceId string, fn func(Project) error) error {
+	return forEachPage(ctx, func(ctx context.Context, pagination PaginationVars) ([]Project, string, error) {
+		return p.List(ctx, workspaceId, pagination)
+	}, fn)
+}
+
+// ForEachGroupPermission calls fn for every group permission under specified project.
+func (p *ProjectsClient) ForEachGroupPermission(ctx context.Context, workspaceId string, projectKey string, fn func(GroupPermission) error) error {
+	return forEachPage(ctx, func(ctx context.Context, pagination PaginationVars) ([]GroupPermission, string, error) {
+		return p.GroupPermissions(ctx, workspaceId, projectKey, pagination)
+	}, fn)
+}
+
+// ForEachUserPermission calls fn for every user permission under specified project.
+func (p *ProjectsClient) ForEachUserPermission(ctx context.Context, workspaceId string, projectKey string, fn func(UserPermission) error) error {
+	return forEachPage(ctx, func(ctx context.Context, pagination PaginationVars) ([]UserPermission, string, error) {
+		return p.UserPermissions(ctx, workspaceId, projectKey, pagination)
+	}, fn)
+}
@@ -0,0 +1,171 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The tests in this file share a client among goroutines the way the connector does, with
+// the credentials validated again while a sync is running, so the state of the client is
+// checked by running them with -race:
+//
+//	go test -race -run Concurrent ./pkg/bitbucket
+
+const (
+	raceWorkers    = 8
+	raceIterations = 20
+	raceMembers    = 3
+	raceUserId     = "{race-user}"
+)
+
+var raceWorkspaces = []Workspace{
+	{BaseResource: BaseResource{Id: "{race-workspace-0}"}, Slug: "race-workspace-0", Name: "Race Workspace 0"},
+	{BaseResource: BaseResource{Id: "{race-workspace-1}"}, Slug: "race-workspace-1", Name: "Race Workspace 1"},
+	{BaseResource: BaseResource{Id: "{race-workspace-2}"}, Slug: "race-workspace-2", Name: "Race Workspace 2"},
+}
+
+// newRaceServer serves the endpoints read while validating the credentials and listing
+// workspace members, with the rate limit and scope headers of the API.
+func newRaceServer(t *testing.T) *httptest.Server {
+	members := make([]WorkspaceMember, 0, raceMembers)
+	for i := 0; i < raceMembers; i++ {
+		members = append(members, WorkspaceMember{User: User{
+			BaseResource: BaseResource{Id: fmt.Sprintf("{race-member-%d}", i)},
+			Type:         "user",
+			Name:         fmt.Sprintf("Member %d", i),
+		}})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(oauthScopesHeader, "account, project, repository")
+		w.Header().Set(rateLimitResourceHeader, "api")
+		w.Header().Set(rateLimitLimitHeader, "1000")
+		w.Header().Set(rateLimitRemainingHeader, "900")
+		w.Header().Set("Content-Type", "application/json")
+
+		var body interface{}
+		switch path := r.URL.Path; {
+		case path == "/2.0/workspaces":
+			body = ListResponse[Workspace]{Values: raceWorkspaces}
+		case strings.HasPrefix(path, "/1.0/groups/"):
+			body = []UserGroup{}
+		case strings.HasSuffix(path, "/members"):
+			body = ListResponse[WorkspaceMember]{Values: members}
+		case strings.HasSuffix(path, "/projects"):
+			body = ListResponse[Project]{}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newRaceClient(ctx context.Context, t *testing.T) *Client {
+	t.Helper()
+
+	server := newRaceServer(t)
+
+	client, err := New(ctx, WithBaseURL(server.URL), WithHTTPCache(HTTPCacheConfig{Disabled: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestConcurrentValidationAndSync(t *testing.T) {
+	ctx := context.Background()
+	client := newRaceClient(ctx, t)
+
+	client.SetupUserScope(raceUserId)
+	err := client.SetWorkspaceIDs(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*raceWorkers)
+
+	// the credentials are validated again while the workspaces are synced, like the health
+	// checks of the platform do
+	for w := 0; w < raceWorkers/4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			for i := 0; i < raceIterations; i++ {
+				client.SetupUserScope(raceUserId)
+
+				err := client.SetWorkspaceIDs(ctx, nil)
+				if err != nil {
+					errs <- fmt.Errorf("failed to set workspace ids: %w", err)
+					return
+				}
+			}
+		}()
+	}
+
+	for w := 0; w < raceWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			<-start
+
+			workspace := raceWorkspaces[w%len(raceWorkspaces)]
+			for i := 0; i < raceIterations; i++ {
+				if !client.IsUserScoped() {
+					errs <- fmt.Errorf("client lost its user scope")
+					return
+				}
+
+				workspaces, err := client.Workspaces.All(ctx)
+				if err != nil {
+					errs <- fmt.Errorf("failed to list workspaces: %w", err)
+					return
+				}
+				if len(workspaces) != len(raceWorkspaces) {
+					errs <- fmt.Errorf("listed %d workspaces, expected %d", len(workspaces), len(raceWorkspaces))
+					return
+				}
+
+				members := 0
+				err = client.Workspaces.ForEachMember(ctx, workspace.Id, func(User) error {
+					members++
+					return nil
+				})
+				if err != nil {
+					errs <- fmt.Errorf("failed to list members of %s: %w", workspace.Slug, err)
+					return
+				}
+				if members != raceMembers {
+					errs <- fmt.Errorf("listed %d members of %s, expected %d", members, workspace.Slug, raceMembers)
+					return
+				}
+
+				_ = client.RateLimits()
+				_, _ = client.OAuthScopes()
+			}
+		}(w)
+	}
+
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,163 @@
+package bitbucket
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	rateLimitLimitHeader     = "X-RateLimit-Limit"
+	rateLimitRemainingHeader = "X-RateLimit-Remaining"
+	rateLimitResourceHeader  = "X-RateLimit-Resource"
+	rateLimitNearLimitHeader = "X-RateLimit-NearLimit"
+	retryAfterHeader         = "Retry-After"
+)
+
+// RateLimit is the rate limit state of a Bitbucket resource, as reported by its latest response.
+type RateLimit struct {
+	// Resource is the rate limited resource, e.g. api or api-paginated.
+	Resource string
+	// Limit is the number of requests allowed per hour.
+	Limit int
+	// Remaining is the number of requests left in the current window, -1 when not reported.
+	Remaining int
+	// NearLimit is set once less than 20% of the limit is left.
+	NearLimit bool
+	UpdatedAt time.Time
+}
+
+// rateLimitTracker parses the rate limit headers of every response, so operators see a sync
+// approaching throttling before it fails. The state is exported as OpenTelemetry gauges via
+// the global meter provider, which is a no-op unless one is configured.
+type rateLimitTracker struct {
+	mtx        sync.Mutex
+	byResource map[string]*RateLimit
+}
+
+func newRateLimitTracker() *rateLimitTracker {
+	t := &rateLimitTracker{
+		byResource: make(map[string]*RateLimit),
+	}
+	t.registerGauges(otel.Meter(instrumentationName))
+
+	return t
+}
+
+func (t *rateLimitTracker) registerGauges(meter metric.Meter) {
+	limit, err := meter.Int64ObservableGauge(
+		"bitbucket.ratelimit.limit",
+		metric.WithDescription("Requests allowed per hour by the Bitbucket rate limit."),
+	)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+
+	remaining, err := meter.Int64ObservableGauge(
+		"bitbucket.ratelimit.remaining",
+		metric.WithDescription("Requests left in the current Bitbucket rate limit window."),
+	)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+
+	nearLimit, err := meter.Int64ObservableGauge(
+		"bitbucket.ratelimit.near_limit",
+		metric.WithDescription("1 when less than 20% of the Bitbucket rate limit is left."),
+	)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, rateLimit := range t.RateLimits() {
+			attrs := metric.WithAttributes(attribute.String("resource", rateLimit.Resource))
+
+			o.ObserveInt64(limit, int64(rateLimit.Limit), attrs)
+			if rateLimit.Remaining >= 0 {
+				o.ObserveInt64(remaining, int64(rateLimit.Remaining), attrs)
+			}
+
+			var near int64
+			if rateLimit.NearLimit {
+				near = 1
+			}
+			o.ObserveInt64(nearLimit, near, attrs)
+		}
+
+		return nil
+	}, limit, remaining, nearLimit)
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// record updates the state of the resource from the response headers.
+func (t *rateLimitTracker) record(ctx context.Context, header http.Header) {
+	if t == nil {
+		return
+	}
+
+	limit, err := strconv.Atoi(header.Get(rateLimitLimitHeader))
+	if err != nil {
+		// the response is not rate limited
+		return
+	}
+
+	remaining, err := strconv.Atoi(header.Get(rateLimitRemainingHeader))
+	if err != nil {
+		remaining = -1
+	}
+
+	rateLimit := RateLimit{
+		Resource:  header.Get(rateLimitResourceHeader),
+		Limit:     limit,
+		Remaining: remaining,
+		NearLimit: header.Get(rateLimitNearLimitHeader) == "true",
+		UpdatedAt: time.Now(),
+	}
+
+	t.mtx.Lock()
+	previous, ok := t.byResource[rateLimit.Resource]
+	t.byResource[rateLimit.Resource] = &rateLimit
+	t.mtx.Unlock()
+
+	wasNearLimit := ok && previous.NearLimit
+	if rateLimit.NearLimit && !wasNearLimit {
+		ctxzap.Extract(ctx).Warn(
+			"bitbucket: approaching the rate limit",
+			zap.String("resource", rateLimit.Resource),
+			zap.Int("limit", rateLimit.Limit),
+			zap.Int("remaining", rateLimit.Remaining),
+		)
+	}
+}
+
+// RateLimits returns the latest known state of every rate limited resource.
+func (t *rateLimitTracker) RateLimits() []RateLimit {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	rv := make([]RateLimit, 0, len(t.byResource))
+	for _, rateLimit := range t.byResource {
+		rv = append(rv, *rateLimit)
+	}
+
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Resource < rv[j].Resource
+	})
+
+	return rv
+}
@@ -0,0 +1,44 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+)
+
+// GetRawPages fetches the payload at provided API URL without decoding it nor filtering its fields,
+// following the next links of paginated listings. Every page is returned as it was received.
+func (c *Client) GetRawPages(ctx context.Context, rawURL string) ([]json.RawMessage, error) {
+	var pages []json.RawMessage
+
+	next := rawURL
+	for next != "" {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		urlAddress, err := url.Parse(next)
+		if err != nil {
+			return nil, err
+		}
+
+		// the URLs are arbitrary, so every path is an endpoint of its own
+		var page json.RawMessage
+		err = c.get(ctx, urlAddress.Path, urlAddress, &page, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		pages = append(pages, page)
+
+		// v1 listings are plain arrays without pagination
+		var pagination PaginationData
+		if json.Unmarshal(page, &pagination) != nil {
+			break
+		}
+		next = pagination.Next
+	}
+
+	return pages, nil
+}
@@ -0,0 +1,453 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ReposClient holds the 2.0 endpoints of repositories, their permissions and their settings.
+type ReposClient struct {
+	client *Client
+}
+
+// List lists all repositories that belong under specified project (which belongs under specified workspace).
+func (r *ReposClient) List(ctx context.Context, workspaceId string, projectId string, getProjectReposVars PaginationVars) ([]Repository, string, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	urlAddress, err := url.Parse(fmt.Sprintf(ProjectRepositoriesBaseURL, encodedWorkspaceId))
+	if err != nil {
+		return nil, "", err
+	}
+
+	projectRepositoriesResponse, err := getPage[Repository](ctx, r.client, ProjectRepositoriesBaseURL, urlAddress, getProjectReposVars, prepareFilters(
+		fmt.Sprintf("project.uuid=\"%s\"", projectId),
+		"-*.workspace",
+		"-*.owner",
+		"+values.links.html.href",
+	))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(projectRepositoriesResponse)
+}
+
+// Get returns specific repository, including its workspace and project. The workspace
+// can be {} when the repository is identified by its UUID.
+func (r *ReposClient) Get(ctx context.Context, workspaceId string, repoId string) (*Repository, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	encodedRepoId := url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepositoryBaseURL, encodedWorkspaceId, encodedRepoId))
+	if err != nil {
+		return nil, err
+	}
+
+	var repositoryResponse Repository
+	err = r.client.get(
+		ctx,
+		RepositoryBaseURL,
+		urlAddress,
+		&repositoryResponse,
+		[]QueryParam{
+			prepareFilters(
+				"",
+				"-owner",
+				"+links.html.href",
+			),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &repositoryResponse, nil
+}
+
+// All lists all repositories looping through all pages.
+func (r *ReposClient) All(ctx context.Context, workspaceId string, projectId string) ([]Repository, error) {
+	return collectPages(ctx, func(ctx context.Context, pagination PaginationVars) ([]Repository, string, error) {
+		return r.List(ctx, workspaceId, projectId, pagination)
+	})
+}
+
+// GroupPermissions lists all group permissions that belong under specified repository.
+func (r *ReposClient) GroupPermissions(ctx context.Context, workspaceId string, repoId string, getPermissionsVars PaginationVars) ([]GroupPermission, string, error) {
+	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoGroupPermissionsBaseURL, encodedWorkspaceId, encodedRepoId))
+	if err != nil {
+		return nil, "", err
+	}
+
+	repositoryGroupPermissionsResponse, err := getPage[GroupPermission](ctx, r.client, RepoGroupPermissionsBaseURL, urlAddress, getPermissionsVars, prepareFilters("", "-*.*.workspace", "-*.*.owner", "-values.repository"))
+
+	// older workspace configurations only expose the 1.0 group privileges, which aren't paginated
+	if isEndpointUnavailable(err) && getPermissionsVars.Page == "" {
+		permissions, legacyErr := r.client.V1.Privileges.RepositoryGroups(ctx, workspaceId, repoId)
+		if legacyErr == nil {
+			logPrivilegesFallback(ctx, RepoGroupPermissionsBaseURL, workspaceId, repoId, err)
+			return permissions, "", nil
+		}
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(repositoryGroupPermissionsResponse)
+}
+
+// GroupPermission returns group permission of specific group under provided repository.
+func (r *ReposClient) GroupPermission(
+	ctx context.Context,
+	workspaceId string,
+	repoId string,
+	groupSlug string,
+) (*GroupPermission, error) {
+	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoGroupPermissionBaseURL, encodedWorkspaceId, encodedRepoId, groupSlug))
+	if err != nil {
+		return nil, err
+	}
+
+	var repoGroupPermissionsResponse GroupPermission
+	err = r.client.get(
+		ctx,
+		RepoGroupPermissionBaseURL,
+		urlAddress,
+		&repoGroupPermissionsResponse,
+		[]QueryParam{
+			prepareFilters("", "-*.*.workspace", "-*.*.owner"),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &repoGroupPermissionsResponse, nil
+}
+
+// UpdateGroupPermission updates group permission of specific group under provided repository.
+func (r *ReposClient) UpdateGroupPermission(
+	ctx context.Context,
+	workspaceId string,
+	repoId string,
+	groupSlug string,
+	permission string,
+) error {
+	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoGroupPermissionBaseURL, encodedWorkspaceId, encodedRepoId, groupSlug))
+	if err != nil {
+		return err
+	}
+
+	err = r.client.put(
+		ctx,
+		RepoGroupPermissionBaseURL,
+		urlAddress,
+		UpdatePermissionPayload{
+			Permission: permission,
+		},
+		nil,
+		nil,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteGroupPermission removes group permission of specific group under provided repository.
+func (r *ReposClient) DeleteGroupPermission(
+	ctx context.Context,
+	workspaceId string,
+	repoId string,
+	groupSlug string,
+) error {
+	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoGroupPermissionBaseURL, encodedWorkspaceId, encodedRepoId, groupSlug))
+	if err != nil {
+		return err
+	}
+
+	err = r.client.delete(ctx, RepoGroupPermissionBaseURL, urlAddress)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UserPermissions lists all user permissions that belong under specified repository.
+func (r *ReposClient) UserPermissions(ctx context.Context, workspaceId string, repoId string, getPermissionsVars PaginationVars) ([]UserPermission, string, error) {
+	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoUserPermissionsBaseURL, encodedWorkspaceId, encodedRepoId))
+	if err != nil {
+		return nil, "", err
+	}
+
+	repositoryUserPermissionsResponse, err := getPage[UserPermission](ctx, r.client, RepoUserPermissionsBaseURL, urlAddress, getPermissionsVars, prepareFilters("", "-values.repository"))
+
+	// older workspace configurations only expose the 1.0 privileges, which aren't paginated
+	if isEndpointUnavailable(err) && getPermissionsVars.Page == "" {
+		permissions, legacyErr := r.client.V1.Privileges.RepositoryUsers(ctx, workspaceId, repoId)
+		if legacyErr == nil {
+			logPrivilegesFallback(ctx, RepoUserPermissionsBaseURL, workspaceId, repoId, err)
+			return permissions, "", nil
+		}
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(repositoryUserPermissionsResponse)
+}
+
+// UserPermission returns user permission of specific user under provided repository.
+func (r *ReposClient) UserPermission(
+	ctx context.Context,
+	workspaceId string,
+	repoId string,
+	userId string,
+) (*UserPermission, error) {
+	encodedWorkspaceId, encodedUserId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(userId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoUserPermissionBaseURL, encodedWorkspaceId, encodedRepoId, encodedUserId))
+	if err != nil {
+		return nil, err
+	}
+
+	var repoUserPermissionsResponse UserPermission
+	err = r.client.get(
+		ctx,
+		RepoUserPermissionBaseURL,
+		urlAddress,
+		&repoUserPermissionsResponse,
+		[]QueryParam{
+			prepareFilters(""),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &repoUserPermissionsResponse, nil
+}
+
+// UpdateUserPermission updates user permission of specific user under provided repository.
+func (r *ReposClient) UpdateUserPermission(
+	ctx context.Context,
+	workspaceId string,
+	repoId string,
+	userId string,
+	permission string,
+) error {
+	encodedWorkspaceId, encodedUserId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(userId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoUserPermissionBaseURL, encodedWorkspaceId, encodedRepoId, encodedUserId))
+	if err != nil {
+		return err
+	}
+
+	err = r.client.put(
+		ctx,
+		RepoUserPermissionBaseURL,
+		urlAddress,
+		UpdatePermissionPayload{
+			Permission: permission,
+		},
+		nil,
+		nil,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteUserPermission removes user permission of specific user under provided repository.
+func (r *ReposClient) DeleteUserPermission(
+	ctx context.Context,
+	workspaceId string,
+	repoId string,
+	userId string,
+) error {
+	encodedWorkspaceId, encodedUserId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(userId), url.PathEscape(repoId)
+	url, err := url.Parse(fmt.Sprintf(RepoUserPermissionBaseURL, encodedWorkspaceId, encodedRepoId, encodedUserId))
+	if err != nil {
+		return err
+	}
+
+	err = r.client.delete(ctx, RepoUserPermissionBaseURL, url)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// BranchRestrictions lists all branch restrictions configured for specified repository.
+func (r *ReposClient) BranchRestrictions(ctx context.Context, workspaceId string, repoId string, getRestrictionsVars PaginationVars) ([]BranchRestriction, string, error) {
+	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoBranchRestrictionsBaseURL, encodedWorkspaceId, encodedRepoId))
+	if err != nil {
+		return nil, "", err
+	}
+
+	branchRestrictionsResponse, err := getPage[BranchRestriction](ctx, r.client, RepoBranchRestrictionsBaseURL, urlAddress, getRestrictionsVars, prepareFilters("", "-*.*.workspace", "-*.*.owner"))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(branchRestrictionsResponse)
+}
+
+// Runners lists Pipelines runners registered to specified repository.
+func (r *ReposClient) Runners(ctx context.Context, workspaceId string, repoId string, getRunnersVars PaginationVars) ([]Runner, string, error) {
+	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoRunnersBaseURL, encodedWorkspaceId, encodedRepoId))
+	if err != nil {
+		return nil, "", err
+	}
+
+	runnersResponse, err := getPage[Runner](ctx, r.client, RepoRunnersBaseURL, urlAddress, getRunnersVars)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(runnersResponse)
+}
+
+// Environments lists deployment environments of specified repository.
+func (r *ReposClient) Environments(ctx context.Context, workspaceId string, repoId string, getEnvironmentsVars PaginationVars) ([]Environment, string, error) {
+	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoEnvironmentsBaseURL, encodedWorkspaceId, encodedRepoId))
+	if err != nil {
+		return nil, "", err
+	}
+
+	environmentsResponse, err := getPage[Environment](ctx, r.client, RepoEnvironmentsBaseURL, urlAddress, getEnvironmentsVars, prepareFilters(""))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(environmentsResponse)
+}
+
+// Commits lists the commits of all branches of specified repository, newest first.
+func (r *ReposClient) Commits(ctx context.Context, workspaceId string, repoId string, getCommitsVars PaginationVars) ([]Commit, string, error) {
+	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoCommitsBaseURL, encodedWorkspaceId, encodedRepoId))
+	if err != nil {
+		return nil, "", err
+	}
+
+	commitsResponse, err := getPage[Commit](ctx, r.client, RepoCommitsBaseURL, urlAddress, getCommitsVars, prepareFilters("", "-values.repository", "-values.parents", "-values.summary", "-values.rendered"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(commitsResponse)
+}
+
+// PullRequests lists the pull requests of specified repository in any state which were updated since provided time.
+func (r *ReposClient) PullRequests(ctx context.Context, workspaceId string, repoId string, since time.Time, getPullRequestsVars PaginationVars) ([]PullRequest, string, error) {
+	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoPullRequestsBaseURL, encodedWorkspaceId, encodedRepoId))
+	if err != nil {
+		return nil, "", err
+	}
+
+	pullRequestsResponse, err := getPage[PullRequest](
+		ctx,
+		r.client,
+		RepoPullRequestsBaseURL,
+		urlAddress,
+		getPullRequestsVars,
+		prepareFilters(fmt.Sprintf("updated_on >= %s", since.UTC().Format("2006-01-02T15:04:05-07:00")), "-values.source", "-values.destination", "-values.summary", "-values.rendered"),
+		&StateVars{States: []string{"OPEN", "MERGED", "DECLINED", "SUPERSEDED"}},
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(pullRequestsResponse)
+}
+
+// PipelinesConfig returns the Pipelines configuration of specified repository.
+func (r *ReposClient) PipelinesConfig(ctx context.Context, workspaceId string, repoId string) (*PipelinesConfig, error) {
+	encodedWorkspaceId, encodedRepoId := url.PathEscape(workspaceId), url.PathEscape(repoId)
+	urlAddress, err := url.Parse(fmt.Sprintf(RepoPipelinesConfigBaseURL, encodedWorkspaceId, encodedRepoId))
+	if err != nil {
+		return nil, err
+	}
+
+	var pipelinesConfigResponse PipelinesConfig
+	err = r.client.get(
+		ctx,
+		RepoPipelinesConfigBaseURL,
+		urlAddress,
+		&pipelinesConfigResponse,
+		[]QueryParam{
+			prepareFilters("", "-repository"),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipelinesConfigResponse, nil
+}
+
+// ForEach calls fn for every repository that belongs under specified project.
+func (r *ReposClient) ForEach(ctx context.Context, workspaceId string, projectId string, fn func(Repository) error) error {
+	return forEachPage(ctx, func(ctx context.Context, pagination PaginationVars) ([]Repository, string, error) {
+		return r.List(ctx, workspaceId, projectId, pagination)
+	}, fn)
+}
+
+// ForEachGroupPermission calls fn for every group permission under specified repository.
+func (r *ReposClient) ForEachGroupPermission(ctx context.Context, workspaceId string, repoId string, fn func(GroupPermission) error) error {
+	return forEachPage(ctx, func(ctx context.Context, pagination PaginationVars) ([]GroupPermission, string, error) {
+		return r.GroupPermissions(ctx, workspaceId, repoId, pagination)
+	}, fn)
+}
+
+// ForEachUserPermission calls fn for every user permission under specified repository.
+func (r *ReposClient) ForEachUserPermission(ctx context.Context, workspaceId string, repoId string, fn func(UserPermission) error) error {
+	return forEachPage(ctx, func(ctx context.Context, pagination PaginationVars) ([]UserPermission, string, error) {
+		return r.UserPermissions(ctx, workspaceId, repoId, pagination)
+	}, fn)
+}
+
+// ForEachCommit calls fn for every commit of specified repository, newest first.
+func (r *ReposClient) ForEachCommit(ctx context.Context, workspaceId string, repoId string, fn func(Commit) error) error {
+	return forEachPage(ctx, func(ctx context.Context, pagination PaginationVars) ([]Commit, string, error) {
+		return r.Commits(ctx, workspaceId, repoId, pagination)
+	}, fn)
+}
+
+// ForEachPullRequest calls fn for every pull request of specified repository updated since provided time.
+func (r *ReposClient) ForEachPullRequest(ctx context.Context, workspaceId string, repoId string, since time.Time, fn func(PullRequest) error) error {
+	return forEachPage(ctx, func(ctx context.Context, pagination PaginationVars) ([]PullRequest, string, error) {
+		return r.PullRequests(ctx, workspaceId, repoId, since, pagination)
+	}, fn)
+}
+
+// ForEachBranchRestriction calls fn for every branch restriction of specified repository.
+func (r *ReposClient) ForEachBranchRestriction(ctx context.Context, workspaceId string, repoId string, fn func(BranchRestriction) error) error {
+	return forEachPage(ctx, func(ctx context.Context, pagination PaginationVars) ([]BranchRestriction, string, error) {
+		return r.BranchRestrictions(ctx, workspaceId, repoId, pagination)
+	}, fn)
+}
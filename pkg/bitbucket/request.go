@@ -43,6 +43,17 @@ func (fV *FilterVars) setup(params *url.Values) {
 	}
 }
 
+// StateVars selects the states of the listed pull requests, Bitbucket lists only the open ones by default.
+type StateVars struct {
+	States []string
+}
+
+func (sV *StateVars) setup(params *url.Values) {
+	for _, state := range sV.States {
+		params.Add("state", state)
+	}
+}
+
 var defaultFilters = []string{
 	"-links",
 	"-*.links",
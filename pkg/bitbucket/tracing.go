@@ -0,0 +1,48 @@
+package bitbucket
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the metrics and spans emitted by the client.
+const instrumentationName = "github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+
+var tracer = otel.Tracer(instrumentationName)
+
+// startRequestSpan starts a span covering a request to the Bitbucket API, including the time
+// spent waiting for a paused endpoint. It is a no-op unless a tracer provider is configured.
+func startRequestSpan(req *http.Request) (context.Context, trace.Span) {
+	return tracer.Start(
+		req.Context(),
+		"bitbucket "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.path", req.URL.Path),
+			attribute.String("bitbucket.page", req.URL.Query().Get("page")),
+		),
+	)
+}
+
+// endRequestSpan records the outcome of the request and ends the span.
+func endRequestSpan(span trace.Span, resp *http.Response, err error) {
+	if resp != nil {
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", resp.StatusCode),
+			attribute.String("bitbucket.request_id", resp.Header.Get(requestIdHeader)),
+		)
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,65 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// UsersClient holds the 2.0 endpoints of users.
+type UsersClient struct {
+	client *Client
+}
+
+// Current returns information about currently logged in user or team.
+func (u *UsersClient) Current(ctx context.Context) (*User, error) {
+	urlAddress, err := url.Parse(CurrentUserBaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var userResponse User
+	err = u.client.get(
+		ctx,
+		CurrentUserBaseURL,
+		urlAddress,
+		&userResponse,
+		[]QueryParam{
+			// keep the avatar, it is the only link worth syncing
+			prepareFilters("", "+links.avatar.href"),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &userResponse, nil
+}
+
+// Get returns detail information about specified user.
+func (u *UsersClient) Get(ctx context.Context, userId string) (*User, error) {
+	encodedUserId := url.PathEscape(userId)
+	urlAddress, err := url.Parse(fmt.Sprintf(UserBaseURL, encodedUserId))
+	if err != nil {
+		return nil, err
+	}
+
+	var userResponse User
+	err = u.client.get(
+		ctx,
+		UserBaseURL,
+		urlAddress,
+		&userResponse,
+		[]QueryParam{
+			// keep the avatar, it is the only link worth syncing
+			prepareFilters("", "+links.avatar.href"),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &userResponse, nil
+}
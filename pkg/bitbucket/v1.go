@@ -0,0 +1,235 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// V1Client holds the endpoints of the deprecated 1.0 API, which the 2.0 API has no counterpart of
+// or which older workspace configurations still depend on. They are kept apart from the 2.0 endpoints,
+// so whatever relies on them is easy to find once Bitbucket removes them.
+type V1Client struct {
+	Groups     *GroupsV1Client
+	Privileges *PrivilegesV1Client
+}
+
+// GroupsV1Client holds the 1.0 endpoints of user groups, the 2.0 API has none.
+type GroupsV1Client struct {
+	client *Client
+}
+
+// PrivilegesV1Client holds the 1.0 endpoints of repository permissions, the fallback for workspaces
+// without the 2.0 permissions-config endpoints.
+type PrivilegesV1Client struct {
+	client *Client
+}
+
+// List lists all user groups that belong under specified workspace.
+func (g *GroupsV1Client) List(ctx context.Context, workspaceId string) ([]UserGroup, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	urlAddress, err := url.Parse(fmt.Sprintf(WorkspaceUserGroupsBaseURL, encodedWorkspaceId))
+	if err != nil {
+		return nil, err
+	}
+
+	var workspaceUserGroupsResponse []UserGroup
+	err = g.client.get(
+		ctx,
+		WorkspaceUserGroupsBaseURL,
+		urlAddress,
+		&workspaceUserGroupsResponse,
+		nil,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return workspaceUserGroupsResponse, nil
+}
+
+// Members lists all members that belong in specified user group.
+func (g *GroupsV1Client) Members(ctx context.Context, workspaceId string, groupSlug string) ([]User, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	urlAddress, err := url.Parse(fmt.Sprintf(UserGroupMembersBaseURL, encodedWorkspaceId, groupSlug))
+	if err != nil {
+		return nil, err
+	}
+
+	var userGroupMembersResponse []User
+	err = g.client.get(
+		ctx,
+		UserGroupMembersBaseURL,
+		urlAddress,
+		&userGroupMembersResponse,
+		nil,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return userGroupMembersResponse, nil
+}
+
+// AddMember adds new member under specified user group.
+func (g *GroupsV1Client) AddMember(ctx context.Context, workspaceId string, groupSlug string, userId string) error {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	encodedUserId := url.PathEscape(userId)
+	urlAddress, err := url.Parse(fmt.Sprintf(GroupMemberModifyBaseURL, encodedWorkspaceId, groupSlug, encodedUserId))
+	if err != nil {
+		return err
+	}
+
+	err = g.client.put(
+		ctx,
+		GroupMemberModifyBaseURL,
+		urlAddress,
+		struct{}{}, // required empty body
+		nil,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RemoveMember removes member from specified user group.
+func (g *GroupsV1Client) RemoveMember(ctx context.Context, workspaceId string, groupSlug string, userId string) error {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	encodedUserId := url.PathEscape(userId)
+	urlAddress, err := url.Parse(fmt.Sprintf(GroupMemberModifyBaseURL, encodedWorkspaceId, groupSlug, encodedUserId))
+	if err != nil {
+		return err
+	}
+
+	err = g.client.delete(ctx, GroupMemberModifyBaseURL, urlAddress)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const (
+	WorkspaceUserGroupsBaseURL = V1BaseURL + "groups/%s"
+	UserGroupMembersBaseURL    = WorkspaceUserGroupsBaseURL + "/%s/members"
+	GroupMemberModifyBaseURL   = WorkspaceUserGroupsBaseURL + "/%s/members/%s"
+
+	// The 1.0 privileges endpoints predate the permissions-config ones, which are not available
+	// on some older workspace configurations.
+	RepoPrivilegesBaseURL      = V1BaseURL + "privileges/%s/%s"
+	RepoGroupPrivilegesBaseURL = V1BaseURL + "group-privileges/%s/%s"
+)
+
+type repositoryPrivilege struct {
+	Privilege string `json:"privilege"`
+	User      User   `json:"user"`
+}
+
+type repositoryGroupPrivilege struct {
+	Privilege string    `json:"privilege"`
+	Group     UserGroup `json:"group"`
+}
+
+// isEndpointUnavailable reports whether the 2.0 endpoint doesn't exist for the workspace,
+// rather than failing for the request.
+func isEndpointUnavailable(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusNotFound, http.StatusGone, http.StatusNotImplemented:
+		return true
+	}
+
+	return false
+}
+
+// legacyPrivilegesURL returns the 1.0 privileges URL of a repository. The 1.0 API only
+// knows repositories by their slugs, so the slug is read when the repository is given by its UUID.
+func (p *PrivilegesV1Client) legacyPrivilegesURL(ctx context.Context, baseURL, workspaceId, repoId string) (*url.URL, error) {
+	repoSlug := repoId
+	if strings.HasPrefix(repoId, "{") {
+		repository, err := p.client.Repos.Get(ctx, workspaceId, repoId)
+		if err != nil {
+			return nil, err
+		}
+
+		repoSlug = repository.Slug
+	}
+
+	return url.Parse(fmt.Sprintf(baseURL, url.PathEscape(workspaceId), url.PathEscape(repoSlug)))
+}
+
+// logPrivilegesFallback warns that the permissions of a repository were read from the 1.0 API.
+func logPrivilegesFallback(ctx context.Context, endpoint, workspaceId, repoId string, err error) {
+	ctxzap.Extract(ctx).Warn(
+		"bitbucket: permissions-config endpoint is unavailable, falling back to the 1.0 privileges",
+		zap.String("endpoint", endpoint),
+		zap.String("workspace_id", workspaceId),
+		zap.String("repository_id", repoId),
+		zap.Error(err),
+	)
+}
+
+// RepositoryUsers lists the user permissions of a repository from the 1.0 privileges endpoint,
+// all of them in a single page.
+func (p *PrivilegesV1Client) RepositoryUsers(ctx context.Context, workspaceId string, repoId string) ([]UserPermission, error) {
+	urlAddress, err := p.legacyPrivilegesURL(ctx, RepoPrivilegesBaseURL, workspaceId, repoId)
+	if err != nil {
+		return nil, err
+	}
+
+	var privilegesResponse []repositoryPrivilege
+	err = p.client.get(ctx, RepoPrivilegesBaseURL, urlAddress, &privilegesResponse, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := make([]UserPermission, 0, len(privilegesResponse))
+	for _, privilege := range privilegesResponse {
+		permissions = append(permissions, UserPermission{
+			Permission: Permission{Value: privilege.Privilege, Legacy: true},
+			User:       privilege.User,
+		})
+	}
+
+	return permissions, nil
+}
+
+// RepositoryGroups lists the group permissions of a repository from the 1.0 group-privileges
+// endpoint, all of them in a single page.
+func (p *PrivilegesV1Client) RepositoryGroups(ctx context.Context, workspaceId string, repoId string) ([]GroupPermission, error) {
+	urlAddress, err := p.legacyPrivilegesURL(ctx, RepoGroupPrivilegesBaseURL, workspaceId, repoId)
+	if err != nil {
+		return nil, err
+	}
+
+	var privilegesResponse []repositoryGroupPrivilege
+	err = p.client.get(ctx, RepoGroupPrivilegesBaseURL, urlAddress, &privilegesResponse, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := make([]GroupPermission, 0, len(privilegesResponse))
+	for _, privilege := range privilegesResponse {
+		permissions = append(permissions, GroupPermission{
+			Permission: Permission{Value: privilege.Privilege, Legacy: true},
+			Group:      privilege.Group,
+		})
+	}
+
+	return permissions, nil
+}
@@ -0,0 +1,216 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// WorkspacesClient holds the 2.0 endpoints of workspaces and their members.
+type WorkspacesClient struct {
+	client *Client
+}
+
+// List lists all workspaces current user belongs to.
+func (w *WorkspacesClient) List(ctx context.Context, getWorkspacesVars PaginationVars) ([]Workspace, string, error) {
+	workspaces, nextPage, err := w.listUnfiltered(ctx, getWorkspacesVars)
+	if err != nil {
+		return nil, "", err
+	}
+
+	workspaces, err = w.client.filterWorkspaces(ctx, workspaces)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return workspaces, nextPage, nil
+}
+
+// listUnfiltered lists the workspaces including the ones the client isn't limited to.
+func (w *WorkspacesClient) listUnfiltered(ctx context.Context, getWorkspacesVars PaginationVars) ([]Workspace, string, error) {
+	urlAddress, err := url.Parse(WorkspacesBaseURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	workspacesResponse, err := getPage[Workspace](ctx, w.client, WorkspacesBaseURL, urlAddress, getWorkspacesVars, prepareFilters(""))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(workspacesResponse)
+}
+
+// All lists all workspaces looping through all pages.
+func (w *WorkspacesClient) All(ctx context.Context) ([]Workspace, error) {
+	return collectPages(ctx, w.List)
+}
+
+// CurrentUserPermissions lists workspaces the current user is a member of along with its permission.
+func (w *WorkspacesClient) CurrentUserPermissions(ctx context.Context, getPermissionsVars PaginationVars) ([]WorkspacePermission, string, error) {
+	urlAddress, err := url.Parse(CurrentUserWorkspacePermissionsBaseURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	permissionsResponse, err := getPage[WorkspacePermission](ctx, w.client, CurrentUserWorkspacePermissionsBaseURL, urlAddress, getPermissionsVars, prepareFilters(""))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(permissionsResponse)
+}
+
+// AllCurrentUserPermissions lists workspace permissions of the current user looping through all pages.
+func (w *WorkspacesClient) AllCurrentUserPermissions(ctx context.Context) ([]WorkspacePermission, error) {
+	return collectPages(ctx, w.CurrentUserPermissions)
+}
+
+// Get returns specific workspace based on provided id.
+func (w *WorkspacesClient) Get(ctx context.Context, workspaceId string) (*Workspace, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	urlAddress, err := url.Parse(fmt.Sprintf(WorkspaceBaseURL, encodedWorkspaceId))
+	if err != nil {
+		return nil, err
+	}
+
+	var workspaceResponse Workspace
+	err = w.client.get(
+		ctx,
+		WorkspaceBaseURL,
+		urlAddress,
+		&workspaceResponse,
+		[]QueryParam{
+			prepareFilters(""),
+		},
+	)
+	if err != nil {
+		if errors.Is(err, ErrPermissionDenied) {
+			return nil, fmt.Errorf("bitbucket: missing permission to get workspace: %w", err)
+		}
+		return nil, err
+	}
+
+	return &workspaceResponse, nil
+}
+
+// Members lists all users that belong under specified workspace.
+func (w *WorkspacesClient) Members(ctx context.Context, workspaceId string, getWorkspacesVars PaginationVars) ([]User, string, error) {
+	return w.client.searchWorkspaceMembers(ctx, workspaceId, getWorkspacesVars, "")
+}
+
+// Member returns the user with given UUID or Atlassian account ID, when it is a member of the workspace.
+func (w *WorkspacesClient) Member(ctx context.Context, workspaceId string, userId string) (*User, error) {
+	encodedWorkspaceId, encodedUserId := url.PathEscape(workspaceId), url.PathEscape(userId)
+	urlAddress, err := url.Parse(fmt.Sprintf(WorkspaceMemberBaseURL, encodedWorkspaceId, encodedUserId))
+	if err != nil {
+		return nil, err
+	}
+
+	var workspaceMemberResponse WorkspaceMember
+	err = w.client.get(
+		ctx,
+		WorkspaceMemberBaseURL,
+		urlAddress,
+		&workspaceMemberResponse,
+		[]QueryParam{
+			prepareFilters("", "-workspace"),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	user := workspaceMemberResponse.User
+	user.JoinedOn = workspaceMemberResponse.AddedOn
+
+	return &user, nil
+}
+
+// FindMember resolves a member of the workspace by its email, nickname, username or Atlassian
+// account ID, for requests identifying users otherwise than by their UUID. Bitbucket only filters members
+// by email for admins of the workspace, other identifiers are matched while walking all members.
+func (w *WorkspacesClient) FindMember(ctx context.Context, workspaceId string, identifier string) (*User, error) {
+	if strings.Contains(identifier, "@") {
+		users, _, err := w.client.searchWorkspaceMembers(ctx, workspaceId, PaginationVars{Limit: 1}, fmt.Sprintf("user.email IN (%q)", identifier))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(users) == 0 {
+			return nil, fmt.Errorf("%w: no member of workspace %s has email %s", ErrNotFound, workspaceId, identifier)
+		}
+
+		return &users[0], nil
+	}
+
+	var found *User
+	errFound := errors.New("member found")
+	err := w.ForEachMember(ctx, workspaceId, func(user User) error {
+		if !user.Matches(identifier) {
+			return nil
+		}
+
+		found = &user
+
+		return errFound
+	})
+	if err != nil && !errors.Is(err, errFound) {
+		return nil, err
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("%w: no member of workspace %s matches %s", ErrNotFound, workspaceId, identifier)
+	}
+
+	return found, nil
+}
+
+// RepositoryUserPermissions lists the user permissions of all repositories of the workspace,
+// which is only allowed to workspace admins.
+func (w *WorkspacesClient) RepositoryUserPermissions(ctx context.Context, workspaceId string, getPermissionsVars PaginationVars) ([]UserPermission, string, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	urlAddress, err := url.Parse(fmt.Sprintf(WorkspaceRepoPermissionsBaseURL, encodedWorkspaceId))
+	if err != nil {
+		return nil, "", err
+	}
+
+	workspaceRepoPermissionsResponse, err := getPage[UserPermission](ctx, w.client, WorkspaceRepoPermissionsBaseURL, urlAddress, getPermissionsVars, prepareFilters("", "-values.repository"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(workspaceRepoPermissionsResponse)
+}
+
+// Runners lists Pipelines runners registered to specified workspace.
+func (w *WorkspacesClient) Runners(ctx context.Context, workspaceId string, getRunnersVars PaginationVars) ([]Runner, string, error) {
+	encodedWorkspaceId := url.PathEscape(workspaceId)
+	urlAddress, err := url.Parse(fmt.Sprintf(WorkspaceRunnersBaseURL, encodedWorkspaceId))
+	if err != nil {
+		return nil, "", err
+	}
+
+	runnersResponse, err := getPage[Runner](ctx, w.client, WorkspaceRunnersBaseURL, urlAddress, getRunnersVars)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return handlePagination(runnersResponse)
+}
+
+// ForEach calls fn for every workspace current user belongs to.
+func (w *WorkspacesClient) ForEach(ctx context.Context, fn func(Workspace) error) error {
+	return forEachPage(ctx, w.List, fn)
+}
+
+// ForEachMember calls fn for every user that belongs under specified workspace.
+func (w *WorkspacesClient) ForEachMember(ctx context.Context, workspaceId string, fn func(User) error) error {
+	return forEachPage(ctx, func(ctx context.Context, pagination PaginationVars) ([]User, string, error) {
+		return w.Members(ctx, workspaceId, pagination)
+	}, fn)
+}
@@ -0,0 +1,284 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// errReadOnly is returned by the actions when the connector is configured as read-only.
+var errReadOnly = errors.New("bitbucket-connector: the connector is read-only, writes to Bitbucket are disabled")
+
+const (
+	removalRemoved = "removed"
+	removalManaged = "skipped_managed"
+	removalFailed  = "failed"
+)
+
+// GroupRemoval is the outcome of removing the user from a single user group.
+type GroupRemoval struct {
+	WorkspaceId   string `json:"workspace_id"`
+	WorkspaceSlug string `json:"workspace_slug"`
+	GroupSlug     string `json:"group_slug"`
+	GroupName     string `json:"group_name"`
+	// Status is one of removed, skipped_managed or failed.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RemoveUserFromGroupsReport lists every user group of the synced workspaces the user was a member of.
+type RemoveUserFromGroupsReport struct {
+	UserId string         `json:"user_id"`
+	Groups []GroupRemoval `json:"groups"`
+}
+
+// Failed reports whether the user could not be removed from some of the groups.
+func (r *RemoveUserFromGroupsReport) Failed() bool {
+	for _, group := range r.Groups {
+		if group.Status == removalFailed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RemoveUserFromAllGroups removes the user from every user group of the synced workspaces.
+// It is meant for emergencies, so a failure to remove the user from one group doesn't stop
+// the removal from the others and is recorded in the report instead. Groups managed by an
+// identity provider are left alone, as the membership would be restored by the next provisioning.
+func (bb *Bitbucket) RemoveUserFromAllGroups(ctx context.Context, userId string) (*RemoveUserFromGroupsReport, error) {
+	l := ctxzap.Extract(ctx)
+
+	if bb.readOnly {
+		return nil, errReadOnly
+	}
+
+	report := &RemoveUserFromGroupsReport{
+		UserId: userId,
+		Groups: []GroupRemoval{},
+	}
+
+	page := ""
+	for {
+		workspaces, nextPage, err := syncedWorkspaces(ctx, bb.index, workspaceSet(bb.workspaces), page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, workspace := range workspaces {
+			userGroups, err := bb.api.GetWorkspaceUserGroups(ctx, workspace.Id)
+			if err != nil {
+				return nil, fmt.Errorf("bitbucket-connector: failed to list user groups: %w", err)
+			}
+
+			for _, userGroup := range userGroups {
+				if !contains(userId, mapUserIDs(userGroup.Members)) {
+					continue
+				}
+
+				removal := GroupRemoval{
+					WorkspaceId:   workspace.Id,
+					WorkspaceSlug: workspace.Slug,
+					GroupSlug:     userGroup.Slug,
+					GroupName:     userGroup.Name,
+					Status:        removalRemoved,
+				}
+
+				// the report would list every remaining group as failed otherwise
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+
+				managed, err := bb.managedGroups.IsManaged(ctx, userGroup.Slug, userGroup.Name)
+				if err != nil {
+					return nil, err
+				}
+
+				if managed {
+					removal.Status = removalManaged
+					report.Groups = append(report.Groups, removal)
+					continue
+				}
+
+				err = bb.retry.withRateLimitRetry(ctx, func() error {
+					return bb.api.RemoveUserFromGroup(ctx, workspace.Id, userGroup.Slug, userId)
+				})
+				if err != nil && !errors.Is(err, bitbucket.ErrNotFound) {
+					l.Error(
+						"bitbucket-connector: failed to remove user from user group",
+						zap.String("user_id", userId),
+						zap.String("workspace_id", workspace.Id),
+						zap.String("group_slug", userGroup.Slug),
+						zap.Error(err),
+					)
+
+					removal.Status = removalFailed
+					removal.Error = err.Error()
+				} else {
+					bb.members.Set(workspace.Id, userGroup.Slug, userId, false)
+					bb.checkpoints.Delete(ctx, workspace.Id)
+				}
+
+				report.Groups = append(report.Groups, removal)
+			}
+		}
+
+		if nextPage == "" {
+			return report, nil
+		}
+		page = nextPage
+	}
+}
+
+// PermissionRemoval is the outcome of removing a single non-admin permission from the repository.
+type PermissionRemoval struct {
+	// PrincipalType is either user or user_group.
+	PrincipalType string `json:"principal_type"`
+	// PrincipalId is the user UUID or the group slug.
+	PrincipalId   string `json:"principal_id"`
+	PrincipalName string `json:"principal_name"`
+	Permission    string `json:"permission"`
+	// Status is either removed or failed.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RestrictRepositoryReport lists every non-admin permission of the repository.
+type RestrictRepositoryReport struct {
+	RepositoryId string              `json:"repository_id"`
+	Permissions  []PermissionRemoval `json:"permissions"`
+}
+
+// Failed reports whether some of the permissions could not be removed.
+func (r *RestrictRepositoryReport) Failed() bool {
+	for _, permission := range r.Permissions {
+		if permission.Status == removalFailed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RestrictRepositoryToAdmins removes every user and group permission of the repository other
+// than admin, so only its admins keep access while the repository is quarantined. Like the
+// group removal, failures are recorded in the report and don't stop the other removals.
+// Access inherited from the project or the workspace is not affected.
+func (bb *Bitbucket) RestrictRepositoryToAdmins(ctx context.Context, repositoryResourceId string) (*RestrictRepositoryReport, error) {
+	l := ctxzap.Extract(ctx)
+
+	if bb.readOnly {
+		return nil, errReadOnly
+	}
+
+	composedProjectId, repositoryId, err := DecomposeRepositoryId(repositoryResourceId)
+	if err != nil {
+		return nil, err
+	}
+
+	workspaceId, _, _, err := DecomposeProjectId(composedProjectId)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RestrictRepositoryReport{
+		RepositoryId: repositoryResourceId,
+		Permissions:  []PermissionRemoval{},
+	}
+
+	// collect the permissions first, as deleting them would shift the listed pages
+	var groupPermissions []bitbucket.GroupPermission
+	err = bb.api.ForEachRepositoryGroupPermission(ctx, workspaceId, repositoryId, func(permission bitbucket.GroupPermission) error {
+		if permission.Value != roleAdmin {
+			groupPermissions = append(groupPermissions, permission)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket-connector: failed to list repository group permissions: %w", err)
+	}
+
+	var userPermissions []bitbucket.UserPermission
+	err = bb.api.ForEachRepositoryUserPermission(ctx, workspaceId, repositoryId, func(permission bitbucket.UserPermission) error {
+		if permission.Value != roleAdmin {
+			userPermissions = append(userPermissions, permission)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket-connector: failed to list repository user permissions: %w", err)
+	}
+
+	// the cached permissions would no longer match, even when some of the removals fail
+	defer bb.permissions.Invalidate(repositoryPermissionsKey(workspaceId, repositoryId))
+
+	removePermission := func(removal PermissionRemoval, remove func() error) {
+		// removals after a cancellation fail without reaching Bitbucket
+		if ctx.Err() != nil {
+			return
+		}
+
+		err := bb.retry.withRateLimitRetry(ctx, remove)
+		if err != nil && !errors.Is(err, bitbucket.ErrNotFound) {
+			l.Error(
+				"bitbucket-connector: failed to remove repository permission",
+				zap.String("repository_id", repositoryId),
+				zap.String("principal_type", removal.PrincipalType),
+				zap.String("principal_id", removal.PrincipalId),
+				zap.Error(err),
+			)
+
+			removal.Status = removalFailed
+			removal.Error = err.Error()
+		}
+
+		report.Permissions = append(report.Permissions, removal)
+	}
+
+	for _, permission := range groupPermissions {
+		groupSlug := permission.Group.Slug
+
+		removePermission(
+			PermissionRemoval{
+				PrincipalType: resourceTypeUserGroup.Id,
+				PrincipalId:   groupSlug,
+				PrincipalName: permission.Group.Name,
+				Permission:    permission.Value,
+				Status:        removalRemoved,
+			},
+			func() error {
+				return bb.api.DeleteRepoGroupPermission(ctx, workspaceId, repositoryId, groupSlug)
+			},
+		)
+	}
+
+	for _, permission := range userPermissions {
+		userId := permission.User.Id
+
+		removePermission(
+			PermissionRemoval{
+				PrincipalType: resourceTypeUser.Id,
+				PrincipalId:   userId,
+				PrincipalName: permission.User.Name,
+				Permission:    permission.Value,
+				Status:        removalRemoved,
+			},
+			func() error {
+				return bb.api.DeleteRepoUserPermission(ctx, workspaceId, repositoryId, userId)
+			},
+		)
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return report, nil
+}
@@ -0,0 +1,7 @@
+// Package bitbucketmock provides a configurable fake of the Bitbucket client
+// that can be used to unit test connector logic without issuing HTTP requests.
+//
+// The Client is generated from connector.BitbucketClient, regenerate it after changing the interface.
+package bitbucketmock
+
+//go:generate go run ./internal/mockgen -source ../client.go -interface BitbucketClient -out client.go
@@ -0,0 +1,470 @@
+package bitbucketmock
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+)
+
+// DatasetSize is the shape of the simulated Bitbucket account.
+type DatasetSize struct {
+	Workspaces      int `json:"workspaces"`
+	Members         int `json:"members"`
+	Groups          int `json:"groups"`
+	GroupMembers    int `json:"group_members"`
+	Projects        int `json:"projects"`
+	ReposPerProject int `json:"repos_per_project"`
+	Permissions     int `json:"permissions"`
+}
+
+type fakeWorkspace struct {
+	workspace bitbucket.Workspace
+	members   []bitbucket.User
+	groups    []bitbucket.UserGroup
+	projects  []bitbucket.Project
+	repos     map[string][]bitbucket.Repository
+}
+
+// Dataset is a simulated Bitbucket account. Every workspace has the same members and
+// every project and repository grants access to the same number of users and groups.
+type Dataset struct {
+	workspaces       []bitbucket.Workspace
+	byId             map[string]*fakeWorkspace
+	users            map[string]bitbucket.User
+	userPermissions  []bitbucket.UserPermission
+	groupPermissions []bitbucket.GroupPermission
+}
+
+var permissionValues = []string{"read", "write", "admin"}
+
+// NewDataset generates an account of provided size.
+func NewDataset(size DatasetSize) *Dataset {
+	users := make([]bitbucket.User, 0, size.Members)
+	for i := 0; i < size.Members; i++ {
+		users = append(users, bitbucket.User{
+			BaseResource: bitbucket.BaseResource{Id: fmt.Sprintf("{user-%d}", i)},
+			Type:         "user",
+			Name:         fmt.Sprintf("User %d", i),
+			Username:     fmt.Sprintf("user-%d", i),
+			AccountId:    fmt.Sprintf("account-%d", i),
+		})
+	}
+
+	groups := make([]bitbucket.UserGroup, 0, size.Groups)
+	for i := 0; i < size.Groups; i++ {
+		group := bitbucket.UserGroup{
+			Name:       fmt.Sprintf("Group %d", i),
+			Slug:       fmt.Sprintf("group-%d", i),
+			Permission: "read",
+		}
+		for j := 0; j < size.GroupMembers && len(users) > 0; j++ {
+			group.Members = append(group.Members, users[(i+j)%len(users)])
+		}
+		groups = append(groups, group)
+	}
+
+	d := &Dataset{
+		byId:  make(map[string]*fakeWorkspace, size.Workspaces),
+		users: make(map[string]bitbucket.User, len(users)),
+	}
+
+	for _, user := range users {
+		d.users[user.Id] = user
+	}
+
+	for i := 0; i < size.Permissions && len(users) > 0; i++ {
+		d.userPermissions = append(d.userPermissions, bitbucket.UserPermission{
+			Permission: bitbucket.Permission{Value: permissionValues[i%len(permissionValues)]},
+			User:       users[i%len(users)],
+		})
+	}
+	for i := 0; i < size.Permissions && i < len(groups); i++ {
+		group := groups[i]
+		group.Members = nil
+		d.groupPermissions = append(d.groupPermissions, bitbucket.GroupPermission{
+			Permission: bitbucket.Permission{Value: permissionValues[i%len(permissionValues)]},
+			Group:      group,
+		})
+	}
+
+	for w := 0; w < size.Workspaces; w++ {
+		workspace := bitbucket.Workspace{
+			BaseResource: bitbucket.BaseResource{Id: fmt.Sprintf("{workspace-%d}", w)},
+			Slug:         fmt.Sprintf("workspace-%d", w),
+			Name:         fmt.Sprintf("Workspace %d", w),
+		}
+
+		fw := &fakeWorkspace{
+			workspace: workspace,
+			members:   users,
+			groups:    groups,
+			repos:     make(map[string][]bitbucket.Repository, size.Projects),
+		}
+
+		for p := 0; p < size.Projects; p++ {
+			project := bitbucket.Project{
+				BaseResource: bitbucket.BaseResource{Id: fmt.Sprintf("{project-%d-%d}", w, p)},
+				Key:          fmt.Sprintf("P%d", p),
+				Name:         fmt.Sprintf("Project %d", p),
+			}
+			fw.projects = append(fw.projects, project)
+
+			for r := 0; r < size.ReposPerProject; r++ {
+				repository := bitbucket.Repository{
+					BaseResource: bitbucket.BaseResource{Id: fmt.Sprintf("{repository-%d-%d-%d}", w, p, r)},
+					Slug:         fmt.Sprintf("repository-%d-%d", p, r),
+					Name:         fmt.Sprintf("Repository %d-%d", p, r),
+					FullName:     fmt.Sprintf("%s/repository-%d-%d", workspace.Slug, p, r),
+					IsPrivate:    true,
+				}
+				repository.Project = &struct {
+					bitbucket.BaseResource
+					Key  string `json:"key"`
+					Name string `json:"name"`
+				}{BaseResource: project.BaseResource, Key: project.Key, Name: project.Name}
+
+				fw.repos[project.Id] = append(fw.repos[project.Id], repository)
+			}
+		}
+
+		d.workspaces = append(d.workspaces, workspace)
+		d.byId[workspace.Id] = fw
+	}
+
+	return d
+}
+
+func (d *Dataset) workspace(workspaceId string) (*fakeWorkspace, error) {
+	fw, ok := d.byId[workspaceId]
+	if !ok {
+		return nil, fmt.Errorf("%w: workspace %s", bitbucket.ErrNotFound, workspaceId)
+	}
+
+	return fw, nil
+}
+
+// page returns the page of items selected by the pagination vars, page tokens are page numbers.
+func page[T any](items []T, vars bitbucket.PaginationVars) ([]T, string, error) {
+	limit := vars.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	number := 1
+	if vars.Page != "" {
+		var err error
+		number, err = strconv.Atoi(vars.Page)
+		if err != nil || number < 1 {
+			return nil, "", fmt.Errorf("invalid page token: %s", vars.Page)
+		}
+	}
+
+	start := min((number-1)*limit, len(items))
+	end := min(start+limit, len(items))
+
+	nextToken := ""
+	if end < len(items) {
+		nextToken = strconv.Itoa(number + 1)
+	}
+
+	return items[start:end], nextToken, nil
+}
+
+// MethodCalls is the number of calls of an API method.
+type MethodCalls struct {
+	Method string `json:"method"`
+	Calls  int    `json:"calls"`
+}
+
+// APICalls counts the calls of every API method.
+type APICalls struct {
+	mtx     sync.Mutex
+	latency time.Duration
+	calls   map[string]int
+}
+
+// NewAPICalls returns a counter delaying every call by the latency.
+func NewAPICalls(latency time.Duration) *APICalls {
+	return &APICalls{
+		latency: latency,
+		calls:   make(map[string]int),
+	}
+}
+
+// call records the call and waits for the simulated latency of the API.
+func (c *APICalls) call(ctx context.Context, method string) error {
+	if c == nil {
+		return ctx.Err()
+	}
+
+	c.mtx.Lock()
+	c.calls[method]++
+	c.mtx.Unlock()
+
+	if c.latency <= 0 {
+		return ctx.Err()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.latency):
+		return nil
+	}
+}
+
+// Snapshot returns the number of calls of every method sorted by the method name.
+func (c *APICalls) Snapshot() []MethodCalls {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	rv := make([]MethodCalls, 0, len(c.calls))
+	for method, calls := range c.calls {
+		rv = append(rv, MethodCalls{Method: method, Calls: calls})
+	}
+
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Method < rv[j].Method
+	})
+
+	return rv
+}
+
+// NewFake serves the dataset through the client interface of the resource builders, as
+// a user with access to all of its workspaces. Reads are counted when calls is set, writes are
+// not supported.
+func NewFake(d *Dataset, calls *APICalls) *Client {
+	return &Client{
+		IsUserScopedFunc: func() bool {
+			return true
+		},
+		GetWorkspacesFunc: func(ctx context.Context, vars bitbucket.PaginationVars) ([]bitbucket.Workspace, string, error) {
+			if err := calls.call(ctx, "GetWorkspaces"); err != nil {
+				return nil, "", err
+			}
+
+			return page(d.workspaces, vars)
+		},
+		GetWorkspaceFunc: func(ctx context.Context, workspaceId string) (*bitbucket.Workspace, error) {
+			if err := calls.call(ctx, "GetWorkspace"); err != nil {
+				return nil, err
+			}
+
+			fw, err := d.workspace(workspaceId)
+			if err != nil {
+				return nil, err
+			}
+
+			return &fw.workspace, nil
+		},
+		GetWorkspaceMembersFunc: func(ctx context.Context, workspaceId string, vars bitbucket.PaginationVars) ([]bitbucket.User, string, error) {
+			if err := calls.call(ctx, "GetWorkspaceMembers"); err != nil {
+				return nil, "", err
+			}
+
+			fw, err := d.workspace(workspaceId)
+			if err != nil {
+				return nil, "", err
+			}
+
+			return page(fw.members, vars)
+		},
+		GetWorkspaceProjectsFunc: func(ctx context.Context, workspaceId string, vars bitbucket.PaginationVars) ([]bitbucket.Project, string, error) {
+			if err := calls.call(ctx, "GetWorkspaceProjects"); err != nil {
+				return nil, "", err
+			}
+
+			fw, err := d.workspace(workspaceId)
+			if err != nil {
+				return nil, "", err
+			}
+
+			return page(fw.projects, vars)
+		},
+		GetProjectReposFunc: func(ctx context.Context, workspaceId string, projectId string, vars bitbucket.PaginationVars) ([]bitbucket.Repository, string, error) {
+			if err := calls.call(ctx, "GetProjectRepos"); err != nil {
+				return nil, "", err
+			}
+
+			fw, err := d.workspace(workspaceId)
+			if err != nil {
+				return nil, "", err
+			}
+
+			return page(fw.repos[projectId], vars)
+		},
+		GetUserFunc: func(ctx context.Context, userId string) (*bitbucket.User, error) {
+			if err := calls.call(ctx, "GetUser"); err != nil {
+				return nil, err
+			}
+
+			user, ok := d.users[userId]
+			if !ok {
+				return nil, fmt.Errorf("%w: user %s", bitbucket.ErrNotFound, userId)
+			}
+
+			return &user, nil
+		},
+		GetWorkspaceUserGroupsFunc: func(ctx context.Context, workspaceId string) ([]bitbucket.UserGroup, error) {
+			if err := calls.call(ctx, "GetWorkspaceUserGroups"); err != nil {
+				return nil, err
+			}
+
+			fw, err := d.workspace(workspaceId)
+			if err != nil {
+				return nil, err
+			}
+
+			return fw.groups, nil
+		},
+		GetUserGroupMembersFunc: func(ctx context.Context, workspaceId string, groupSlug string) ([]bitbucket.User, error) {
+			if err := calls.call(ctx, "GetUserGroupMembers"); err != nil {
+				return nil, err
+			}
+
+			fw, err := d.workspace(workspaceId)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, group := range fw.groups {
+				if group.Slug == groupSlug {
+					return group.Members, nil
+				}
+			}
+
+			return nil, fmt.Errorf("%w: group %s", bitbucket.ErrNotFound, groupSlug)
+		},
+		GetProjectBranchingModelFunc: func(ctx context.Context, workspaceId string, projectKey string) (*bitbucket.BranchingModel, error) {
+			if err := calls.call(ctx, "GetProjectBranchingModel"); err != nil {
+				return nil, err
+			}
+
+			return &bitbucket.BranchingModel{}, nil
+		},
+		HasProjectPermissionsFunc: func(ctx context.Context, workspaceId string, projectKey string) (bool, error) {
+			if err := calls.call(ctx, "HasProjectPermissions"); err != nil {
+				return false, err
+			}
+
+			return true, nil
+		},
+		GetProjectGroupPermissionsFunc: func(ctx context.Context, workspaceId string, projectKey string, vars bitbucket.PaginationVars) ([]bitbucket.GroupPermission, string, error) {
+			if err := calls.call(ctx, "GetProjectGroupPermissions"); err != nil {
+				return nil, "", err
+			}
+
+			return page(d.groupPermissions, vars)
+		},
+		GetProjectUserPermissionsFunc: func(ctx context.Context, workspaceId string, projectKey string, vars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error) {
+			if err := calls.call(ctx, "GetProjectUserPermissions"); err != nil {
+				return nil, "", err
+			}
+
+			return page(d.userPermissions, vars)
+		},
+		ForEachProjectGroupPermissionFunc: func(ctx context.Context, workspaceId string, projectKey string, fn func(bitbucket.GroupPermission) error) error {
+			if err := calls.call(ctx, "ForEachProjectGroupPermission"); err != nil {
+				return err
+			}
+
+			return forEach(d.groupPermissions, fn)
+		},
+		ForEachProjectUserPermissionFunc: func(ctx context.Context, workspaceId string, projectKey string, fn func(bitbucket.UserPermission) error) error {
+			if err := calls.call(ctx, "ForEachProjectUserPermission"); err != nil {
+				return err
+			}
+
+			return forEach(d.userPermissions, fn)
+		},
+		GetRepositoryGroupPermissionsFunc: func(ctx context.Context, workspaceId string, repoId string, vars bitbucket.PaginationVars) ([]bitbucket.GroupPermission, string, error) {
+			if err := calls.call(ctx, "GetRepositoryGroupPermissions"); err != nil {
+				return nil, "", err
+			}
+
+			return page(d.groupPermissions, vars)
+		},
+		GetRepositoryUserPermissionsFunc: func(ctx context.Context, workspaceId string, repoId string, vars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error) {
+			if err := calls.call(ctx, "GetRepositoryUserPermissions"); err != nil {
+				return nil, "", err
+			}
+
+			return page(d.userPermissions, vars)
+		},
+		GetWorkspaceRepositoryUserPermissionsFunc: func(ctx context.Context, workspaceId string, vars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error) {
+			if err := calls.call(ctx, "GetWorkspaceRepositoryUserPermissions"); err != nil {
+				return nil, "", err
+			}
+
+			return page(d.userPermissions, vars)
+		},
+		ForEachRepositoryGroupPermissionFunc: func(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.GroupPermission) error) error {
+			if err := calls.call(ctx, "ForEachRepositoryGroupPermission"); err != nil {
+				return err
+			}
+
+			return forEach(d.groupPermissions, fn)
+		},
+		ForEachRepositoryUserPermissionFunc: func(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.UserPermission) error) error {
+			if err := calls.call(ctx, "ForEachRepositoryUserPermission"); err != nil {
+				return err
+			}
+
+			return forEach(d.userPermissions, fn)
+		},
+		GetRepositoryBranchRestrictionsFunc: func(ctx context.Context, workspaceId string, repoId string, vars bitbucket.PaginationVars) ([]bitbucket.BranchRestriction, string, error) {
+			if err := calls.call(ctx, "GetRepositoryBranchRestrictions"); err != nil {
+				return nil, "", err
+			}
+
+			return nil, "", nil
+		},
+		ForEachRepositoryBranchRestrictionFunc: func(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.BranchRestriction) error) error {
+			return calls.call(ctx, "ForEachRepositoryBranchRestriction")
+		},
+		GetRepositoryPipelinesConfigFunc: func(ctx context.Context, workspaceId string, repoId string) (*bitbucket.PipelinesConfig, error) {
+			if err := calls.call(ctx, "GetRepositoryPipelinesConfig"); err != nil {
+				return nil, err
+			}
+
+			return &bitbucket.PipelinesConfig{}, nil
+		},
+		GetRepositoryEnvironmentsFunc: func(ctx context.Context, workspaceId string, repoId string, vars bitbucket.PaginationVars) ([]bitbucket.Environment, string, error) {
+			if err := calls.call(ctx, "GetRepositoryEnvironments"); err != nil {
+				return nil, "", err
+			}
+
+			return nil, "", nil
+		},
+		GetWorkspaceRunnersFunc: func(ctx context.Context, workspaceId string, vars bitbucket.PaginationVars) ([]bitbucket.Runner, string, error) {
+			if err := calls.call(ctx, "GetWorkspaceRunners"); err != nil {
+				return nil, "", err
+			}
+
+			return nil, "", nil
+		},
+		GetRepositoryRunnersFunc: func(ctx context.Context, workspaceId string, repoId string, vars bitbucket.PaginationVars) ([]bitbucket.Runner, string, error) {
+			if err := calls.call(ctx, "GetRepositoryRunners"); err != nil {
+				return nil, "", err
+			}
+
+			return nil, "", nil
+		},
+	}
+}
+
+func forEach[T any](items []T, fn func(T) error) error {
+	for _, item := range items {
+		err := fn(item)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
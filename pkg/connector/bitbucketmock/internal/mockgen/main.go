@@ -0,0 +1,227 @@
+// Command mockgen generates the Client of bitbucketmock from the BitbucketClient interface of the
+// connector: a field holding a function for every method of the interface, which the method calls.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	source := flag.String("source", "", "file declaring the interface")
+	name := flag.String("interface", "", "name of the interface")
+	out := flag.String("out", "", "file to write the mock to")
+	flag.Parse()
+
+	if *source == "" || *name == "" || *out == "" {
+		log.Fatal("mockgen: -source, -interface and -out are required")
+	}
+
+	data, err := os.ReadFile(*source)
+	if err != nil {
+		log.Fatalf("mockgen: %v", err)
+	}
+
+	code, err := generate(data, *name)
+	if err != nil {
+		log.Fatalf("mockgen: %v", err)
+	}
+
+	err = os.WriteFile(*out, code, 0o644)
+	if err != nil {
+		log.Fatalf("mockgen: %v", err)
+	}
+}
+
+// method is a method of the interface, with its signature as written in the source.
+type method struct {
+	name    string
+	params  string
+	results string
+	args    []string
+	zeros   []string
+}
+
+func generate(data []byte, name string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", data, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	iface := findInterface(file, name)
+	if iface == nil {
+		return nil, fmt.Errorf("interface %s not found", name)
+	}
+
+	source := func(node ast.Node) string {
+		return string(data[fset.Position(node.Pos()).Offset:fset.Position(node.End()).Offset])
+	}
+
+	var methods []method
+	for _, field := range iface.Methods.List {
+		fn, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s embeds %s, only methods are supported", name, source(field.Type))
+		}
+
+		m := method{name: field.Names[0].Name}
+
+		var params []string
+		for _, param := range fn.Params.List {
+			if len(param.Names) == 0 {
+				return nil, fmt.Errorf("%s.%s has unnamed parameters", name, m.name)
+			}
+			for _, paramName := range param.Names {
+				params = append(params, paramName.Name+" "+source(param.Type))
+				m.args = append(m.args, paramName.Name)
+			}
+		}
+		m.params = strings.Join(params, ", ")
+
+		if fn.Results != nil {
+			var results []string
+			for _, result := range fn.Results.List {
+				results = append(results, source(result.Type))
+				m.zeros = append(m.zeros, zeroValue(m.name, result.Type))
+			}
+
+			m.results = strings.Join(results, ", ")
+			if len(results) > 1 {
+				m.results = "(" + m.results + ")"
+			}
+		}
+
+		methods = append(methods, m)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by internal/mockgen from the %s interface; DO NOT EDIT.\n\n", name)
+	buf.WriteString("package bitbucketmock\n\n")
+
+	std, others := imports(file)
+	buf.WriteString("import (\n")
+	for _, path := range std {
+		fmt.Fprintf(&buf, "\t%s\n", path)
+	}
+	buf.WriteString("\n")
+	for _, path := range others {
+		fmt.Fprintf(&buf, "\t%s\n", path)
+	}
+	buf.WriteString(")\n\n")
+
+	fmt.Fprintf(&buf, "var _ connector.%s = (*Client)(nil)\n\n", name)
+
+	buf.WriteString("// Client implements the client interface consumed by the resource builders.\n")
+	buf.WriteString("// Each method delegates to the matching `<Method>Func` field, calling a method\n")
+	buf.WriteString("// whose function is not set returns an Unimplemented error (or a zero value).\n")
+	buf.WriteString("type Client struct {\n")
+	for _, m := range methods {
+		fmt.Fprintf(&buf, "\t%sFunc func(%s) %s\n", m.name, m.params, m.results)
+	}
+	buf.WriteString("}\n")
+
+	for _, m := range methods {
+		fmt.Fprintf(&buf, "\nfunc (m *Client) %s(%s) %s {\n", m.name, m.params, m.results)
+		fmt.Fprintf(&buf, "\tif m.%sFunc == nil {\n", m.name)
+		if len(m.zeros) > 0 {
+			fmt.Fprintf(&buf, "\t\treturn %s\n", strings.Join(m.zeros, ", "))
+		} else {
+			buf.WriteString("\t\treturn\n")
+		}
+		buf.WriteString("\t}\n")
+
+		call := fmt.Sprintf("m.%sFunc(%s)", m.name, strings.Join(m.args, ", "))
+		if len(m.zeros) > 0 {
+			fmt.Fprintf(&buf, "\treturn %s\n", call)
+		} else {
+			fmt.Fprintf(&buf, "\t%s\n", call)
+		}
+		buf.WriteString("}\n")
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+func findInterface(file *ast.File, name string) *ast.InterfaceType {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			if typeSpec.Name.Name != name {
+				continue
+			}
+
+			iface, _ := typeSpec.Type.(*ast.InterfaceType)
+			return iface
+		}
+	}
+
+	return nil
+}
+
+// imports returns the imports of the source file, along with the ones of the generated code,
+// the ones of the standard library apart from the others.
+func imports(file *ast.File) ([]string, []string) {
+	paths := map[string]struct{}{
+		strconv.Quote("github.com/conductorone/baton-bitbucket/pkg/connector"): {},
+		strconv.Quote("google.golang.org/grpc/codes"):                          {},
+		strconv.Quote("google.golang.org/grpc/status"):                         {},
+	}
+	for _, spec := range file.Imports {
+		path := spec.Path.Value
+		if spec.Name != nil {
+			path = spec.Name.Name + " " + path
+		}
+		paths[path] = struct{}{}
+	}
+
+	var std, others []string
+	for path := range paths {
+		// the first element of the paths of other modules is a domain
+		if strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+			others = append(others, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(others)
+
+	return std, others
+}
+
+// zeroValue returns what a method returns when its function isn't set.
+func zeroValue(methodName string, expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "error":
+			return fmt.Sprintf("status.Error(codes.Unimplemented, %q)", "bitbucketmock: "+methodName+" not configured")
+		case "string":
+			return `""`
+		case "bool":
+			return "false"
+		case "int", "int64", "float64":
+			return "0"
+		}
+	case *ast.SelectorExpr:
+		return fmt.Sprintf("%s.%s{}", t.X.(*ast.Ident).Name, t.Sel.Name)
+	}
+
+	return "nil"
+}
@@ -0,0 +1,323 @@
+package connector_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/conductorone/baton-bitbucket/internal/walk"
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	"github.com/conductorone/baton-bitbucket/pkg/connector"
+	"github.com/conductorone/baton-bitbucket/pkg/connector/bitbucketmock"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+)
+
+// The tests in this file call the resource builders directly, page by page, the way the SDK does,
+// against the mock client whose listings are cut into small pages.
+
+const (
+	builderWorkspaceId = "{workspace-0}"
+	builderProjectId   = "v1:{workspace-0}:{project-0-0}:P0"
+	// the mock returns pages of this many items, so every listing of the dataset spans several pages
+	builderPageSize = 2
+)
+
+var builderDatasetSize = bitbucketmock.DatasetSize{
+	Workspaces:      1,
+	Members:         4,
+	Groups:          3,
+	GroupMembers:    2,
+	Projects:        3,
+	ReposPerProject: 5,
+	Permissions:     3,
+}
+
+// requestedPages records the page tokens the builders requested, per API method.
+type requestedPages map[string][]string
+
+// newPagedClient returns the mock serving the dataset in pages of builderPageSize items.
+func newPagedClient(pages requestedPages) *bitbucketmock.Client {
+	fake := bitbucketmock.NewFake(bitbucketmock.NewDataset(builderDatasetSize), bitbucketmock.NewAPICalls(0))
+
+	listProjects := fake.GetWorkspaceProjectsFunc
+	fake.GetWorkspaceProjectsFunc = func(ctx context.Context, workspaceId string, vars bitbucket.PaginationVars) ([]bitbucket.Project, string, error) {
+		pages["GetWorkspaceProjects"] = append(pages["GetWorkspaceProjects"], vars.Page)
+		vars.Limit = builderPageSize
+		return listProjects(ctx, workspaceId, vars)
+	}
+
+	listRepos := fake.GetProjectReposFunc
+	fake.GetProjectReposFunc = func(ctx context.Context, workspaceId string, projectId string, vars bitbucket.PaginationVars) ([]bitbucket.Repository, string, error) {
+		pages["GetProjectRepos"] = append(pages["GetProjectRepos"], vars.Page)
+		vars.Limit = builderPageSize
+		return listRepos(ctx, workspaceId, projectId, vars)
+	}
+
+	listGroupPermissions := fake.GetProjectGroupPermissionsFunc
+	fake.GetProjectGroupPermissionsFunc = func(ctx context.Context, workspaceId string, projectKey string, vars bitbucket.PaginationVars) ([]bitbucket.GroupPermission, string, error) {
+		pages["GetProjectGroupPermissions"] = append(pages["GetProjectGroupPermissions"], vars.Page)
+		vars.Limit = builderPageSize
+		return listGroupPermissions(ctx, workspaceId, projectKey, vars)
+	}
+
+	listUserPermissions := fake.GetProjectUserPermissionsFunc
+	fake.GetProjectUserPermissionsFunc = func(ctx context.Context, workspaceId string, projectKey string, vars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error) {
+		pages["GetProjectUserPermissions"] = append(pages["GetProjectUserPermissions"], vars.Page)
+		vars.Limit = builderPageSize
+		return listUserPermissions(ctx, workspaceId, projectKey, vars)
+	}
+
+	return fake
+}
+
+func newBuilderConnector(t *testing.T, client connector.BitbucketClient) *connector.Bitbucket {
+	t.Helper()
+
+	bb, err := connector.NewWithClient(context.Background(), connector.Config{}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bb
+}
+
+func resourceSyncer(ctx context.Context, t *testing.T, bb *connector.Bitbucket, resourceTypeId string) connectorbuilder.ResourceSyncer {
+	t.Helper()
+
+	syncer, err := walk.ResourceSyncer(ctx, bb, resourceTypeId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return syncer
+}
+
+func projectResource(ctx context.Context, t *testing.T, bb *connector.Bitbucket) *v2.Resource {
+	t.Helper()
+
+	projects, _, _, err := resourceSyncer(ctx, t, bb, "project").List(
+		ctx,
+		&v2.ResourceId{ResourceType: "workspace", Resource: builderWorkspaceId},
+		&pagination.Token{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, project := range projects {
+		if project.Id.Resource == builderProjectId {
+			return project
+		}
+	}
+
+	t.Fatalf("project %s is not listed", builderProjectId)
+
+	return nil
+}
+
+func sameStrings(t *testing.T, what string, got, want []string) {
+	t.Helper()
+
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("got %d %s %v, want %d %v", len(got), what, got, len(want), want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %s %v, want %v", what, got, want)
+		}
+	}
+}
+
+func TestProjectListPaging(t *testing.T) {
+	ctx := context.Background()
+	pages := make(requestedPages)
+	bb := newBuilderConnector(t, newPagedClient(pages))
+	syncer := resourceSyncer(ctx, t, bb, "project")
+	parentId := &v2.ResourceId{ResourceType: "workspace", Resource: builderWorkspaceId}
+
+	var ids []string
+	token := ""
+	for calls := 1; ; calls++ {
+		if calls > 10 {
+			t.Fatalf("listing projects doesn't end, last token %q", token)
+		}
+
+		projects, nextToken, _, err := syncer.List(ctx, parentId, &pagination.Token{Token: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, project := range projects {
+			if project.ParentResourceId.GetResource() != builderWorkspaceId {
+				t.Errorf("project %s has parent %v, want workspace %s", project.Id.Resource, project.ParentResourceId, builderWorkspaceId)
+			}
+			ids = append(ids, project.Id.Resource)
+		}
+
+		if nextToken == "" {
+			break
+		}
+		token = nextToken
+	}
+
+	sameStrings(t, "requested pages", pages["GetWorkspaceProjects"], []string{"", "2"})
+	sameStrings(t, "projects", ids, []string{
+		"v1:{workspace-0}:{project-0-0}:P0",
+		"v1:{workspace-0}:{project-0-1}:P1",
+		"v1:{workspace-0}:{project-0-2}:P2",
+	})
+}
+
+func TestProjectGrantsPaging(t *testing.T) {
+	ctx := context.Background()
+	pages := make(requestedPages)
+	bb := newBuilderConnector(t, newPagedClient(pages))
+	project := projectResource(ctx, t, bb)
+	syncer := resourceSyncer(ctx, t, bb, "project")
+
+	var grants []string
+	token := ""
+	for calls := 1; ; calls++ {
+		if calls > 20 {
+			t.Fatalf("listing project grants doesn't end, last token %q", token)
+		}
+
+		page, nextToken, _, err := syncer.Grants(ctx, project, &pagination.Token{Token: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, grant := range page {
+			if grant.Entitlement.Resource.GetId().GetResource() != builderProjectId {
+				t.Errorf("grant %s is for resource %v, want project %s", grant.Id, grant.Entitlement.Resource.GetId(), builderProjectId)
+			}
+			grants = append(grants, grant.Entitlement.Id+" "+grant.Principal.Id.ResourceType+" "+grant.Principal.Id.Resource)
+		}
+
+		if nextToken == "" {
+			break
+		}
+		if nextToken == token {
+			t.Fatalf("listing project grants returned the same token %q twice", token)
+		}
+		token = nextToken
+	}
+
+	// every listing is paged through from its first page to its last one
+	sameStrings(t, "repository pages", pages["GetProjectRepos"], []string{"", "2", "3"})
+	sameStrings(t, "group permission pages", pages["GetProjectGroupPermissions"], []string{"", "2"})
+	sameStrings(t, "user permission pages", pages["GetProjectUserPermissions"], []string{"", "2"})
+
+	entitlement := "project:" + builderProjectId + ":"
+	sameStrings(t, "grants", grants, []string{
+		entitlement + "repository repository " + builderProjectId + ":{repository-0-0-0}",
+		entitlement + "repository repository " + builderProjectId + ":{repository-0-0-1}",
+		entitlement + "repository repository " + builderProjectId + ":{repository-0-0-2}",
+		entitlement + "repository repository " + builderProjectId + ":{repository-0-0-3}",
+		entitlement + "repository repository " + builderProjectId + ":{repository-0-0-4}",
+		entitlement + "read user_group v1:{workspace-0}:group-0",
+		entitlement + "write user_group v1:{workspace-0}:group-1",
+		entitlement + "admin user_group v1:{workspace-0}:group-2",
+		entitlement + "read user {user-0}",
+		entitlement + "write user {user-1}",
+		entitlement + "admin user {user-2}",
+	})
+}
+
+func TestProjectGrantsUseListedRepositories(t *testing.T) {
+	ctx := context.Background()
+	pages := make(requestedPages)
+	bb := newBuilderConnector(t, newPagedClient(pages))
+	project := projectResource(ctx, t, bb)
+
+	// the SDK lists the repositories of every project before collecting grants
+	token := ""
+	for {
+		_, nextToken, _, err := resourceSyncer(ctx, t, bb, "repository").List(ctx, project.Id, &pagination.Token{Token: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nextToken == "" {
+			break
+		}
+		token = nextToken
+	}
+	sameStrings(t, "repository pages", pages["GetProjectRepos"], []string{"", "2", "3"})
+
+	grants, err := walk.Grants(ctx, bb, project)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var repositories []string
+	for _, grant := range grants {
+		if grant.Principal.Id.ResourceType == "repository" {
+			repositories = append(repositories, grant.Principal.Id.Resource)
+		}
+	}
+
+	sameStrings(t, "repository pages", pages["GetProjectRepos"], []string{"", "2", "3"})
+	sameStrings(t, "granted repositories", repositories, []string{
+		builderProjectId + ":{repository-0-0-0}",
+		builderProjectId + ":{repository-0-0-1}",
+		builderProjectId + ":{repository-0-0-2}",
+		builderProjectId + ":{repository-0-0-3}",
+		builderProjectId + ":{repository-0-0-4}",
+	})
+}
+
+func TestProjectGrantUpdatesPermission(t *testing.T) {
+	ctx := context.Background()
+	fake := newPagedClient(make(requestedPages))
+
+	type update struct {
+		workspaceId, projectKey, userId, permission string
+	}
+	var updates []update
+	// the principal is checked to be a member of the workspace before the grant
+	fake.GetWorkspaceMemberFunc = func(ctx context.Context, workspaceId string, userId string) (*bitbucket.User, error) {
+		return fake.GetUser(ctx, userId)
+	}
+	fake.UpdateProjectUserPermissionFunc = func(ctx context.Context, workspaceId string, projectKey string, userId string, permission string) error {
+		updates = append(updates, update{workspaceId, projectKey, userId, permission})
+		return nil
+	}
+
+	bb := newBuilderConnector(t, fake)
+	project := projectResource(ctx, t, bb)
+
+	entitlements, err := walk.Entitlements(ctx, bb, project)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var write *v2.Entitlement
+	for _, entitlement := range entitlements {
+		if entitlement.Slug == "write" {
+			write = entitlement
+		}
+	}
+	if write == nil {
+		t.Fatalf("project %s has no write entitlement", builderProjectId)
+	}
+
+	provisioner, ok := resourceSyncer(ctx, t, bb, "project").(connectorbuilder.ResourceProvisioner)
+	if !ok {
+		t.Fatalf("projects are not provisionable")
+	}
+
+	user := &v2.Resource{Id: &v2.ResourceId{ResourceType: "user", Resource: "{user-3}"}}
+	_, err = provisioner.Grant(ctx, user, write)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := update{builderWorkspaceId, "P0", "{user-3}", "write"}
+	if len(updates) != 1 || updates[0] != want {
+		t.Fatalf("got permission updates %v, want %v", updates, []update{want})
+	}
+}
@@ -0,0 +1,164 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCheckpointMaxAge = time.Hour
+
+	groupCheckpointPrefix = "user-groups-"
+	groupCheckpointSuffix = ".json"
+)
+
+// groupCheckpoint is a user group listing of a workspace persisted on disk.
+type groupCheckpoint struct {
+	WorkspaceId string                `json:"workspace_id"`
+	SavedAt     time.Time             `json:"saved_at"`
+	Groups      []bitbucket.UserGroup `json:"groups"`
+}
+
+// groupCheckpoints persists the user group listings of the v1 API, which are unpaginated and
+// expensive for large workspaces, so a sync restarted after the process died reuses them
+// instead of fetching every workspace again. A new sync deletes the checkpoints of the previous
+// one, only a resumed sync reuses them, as long as they are not older than the max age.
+type groupCheckpoints struct {
+	dir    string
+	maxAge time.Duration
+}
+
+// newGroupCheckpoints returns nil, disabling the checkpoints, when no directory is configured.
+func newGroupCheckpoints(dir string, maxAge time.Duration) (*groupCheckpoints, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	if maxAge <= 0 {
+		maxAge = defaultCheckpointMaxAge
+	}
+
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket-connector: failed to create checkpoint directory: %w", err)
+	}
+
+	return &groupCheckpoints{
+		dir:    dir,
+		maxAge: maxAge,
+	}, nil
+}
+
+func (c *groupCheckpoints) path(workspaceId string) string {
+	return filepath.Join(c.dir, groupCheckpointPrefix+strings.Trim(workspaceId, "{}")+groupCheckpointSuffix)
+}
+
+// Reset removes all checkpoints. It is only called when a sync starts from scratch, a resumed
+// sync doesn't list the workspaces from the first page again and keeps the checkpoints.
+func (c *groupCheckpoints) Reset() {
+	if c == nil {
+		return
+	}
+
+	paths, err := filepath.Glob(filepath.Join(c.dir, groupCheckpointPrefix+"*"+groupCheckpointSuffix))
+	if err != nil {
+		return
+	}
+
+	for _, path := range paths {
+		_ = os.Remove(path)
+	}
+}
+
+// Delete removes the checkpoint of the workspace, e.g. after its group memberships were changed,
+// so a resumed sync fetches the groups again instead of reporting the memberships before the change.
+func (c *groupCheckpoints) Delete(ctx context.Context, workspaceId string) {
+	if c == nil {
+		return
+	}
+
+	err := os.Remove(c.path(workspaceId))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		ctxzap.Extract(ctx).Warn("bitbucket-connector: failed to delete user group checkpoint", zap.String("workspace_id", workspaceId), zap.Error(err))
+	}
+}
+
+// Load returns the checkpointed user groups of the workspace, false when there is no fresh checkpoint.
+// Unreadable checkpoints are ignored, so the groups are fetched again.
+func (c *groupCheckpoints) Load(ctx context.Context, workspaceId string) ([]bitbucket.UserGroup, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	l := ctxzap.Extract(ctx)
+
+	data, err := os.ReadFile(c.path(workspaceId))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			l.Warn("bitbucket-connector: failed to read user group checkpoint", zap.String("workspace_id", workspaceId), zap.Error(err))
+		}
+		return nil, false
+	}
+
+	var checkpoint groupCheckpoint
+	err = json.Unmarshal(data, &checkpoint)
+	if err != nil {
+		l.Warn("bitbucket-connector: failed to parse user group checkpoint", zap.String("workspace_id", workspaceId), zap.Error(err))
+		return nil, false
+	}
+
+	if checkpoint.WorkspaceId != workspaceId || time.Since(checkpoint.SavedAt) > c.maxAge {
+		return nil, false
+	}
+
+	l.Info(
+		"bitbucket-connector: resuming user groups from checkpoint",
+		zap.String("workspace_id", workspaceId),
+		zap.Time("saved_at", checkpoint.SavedAt),
+		zap.Int("groups", len(checkpoint.Groups)),
+	)
+
+	return checkpoint.Groups, true
+}
+
+// Save persists the user groups of the workspace. Failures are only logged, as they don't affect the running sync.
+func (c *groupCheckpoints) Save(ctx context.Context, workspaceId string, groups []bitbucket.UserGroup) {
+	if c == nil {
+		return
+	}
+
+	l := ctxzap.Extract(ctx)
+
+	data, err := json.Marshal(groupCheckpoint{
+		WorkspaceId: workspaceId,
+		SavedAt:     time.Now(),
+		Groups:      groups,
+	})
+	if err != nil {
+		l.Warn("bitbucket-connector: failed to encode user group checkpoint", zap.String("workspace_id", workspaceId), zap.Error(err))
+		return
+	}
+
+	// a process dying while writing must not leave a truncated checkpoint behind
+	path := c.path(workspaceId)
+	tmp := path + ".tmp"
+
+	err = os.WriteFile(tmp, data, 0o600)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		l.Warn("bitbucket-connector: failed to write user group checkpoint", zap.String("workspace_id", workspaceId), zap.Error(err))
+	}
+}
@@ -0,0 +1,246 @@
+package connector
+
+import (
+	"context"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+)
+
+// BitbucketClient is the subset of the Bitbucket API used by the resource builders.
+// apiClient implements it with the sub-clients of *bitbucket.Client, and it can be replaced
+// by a mock in order to exercise the builders without issuing HTTP requests.
+type BitbucketClient interface {
+	IsUserScoped() bool
+	WorkspaceId() (string, error)
+
+	GetWorkspaces(ctx context.Context, getWorkspacesVars bitbucket.PaginationVars) ([]bitbucket.Workspace, string, error)
+	GetWorkspace(ctx context.Context, workspaceId string) (*bitbucket.Workspace, error)
+	GetWorkspaceMembers(ctx context.Context, workspaceId string, getWorkspacesVars bitbucket.PaginationVars) ([]bitbucket.User, string, error)
+	GetWorkspaceMember(ctx context.Context, workspaceId string, userId string) (*bitbucket.User, error)
+	FindWorkspaceMember(ctx context.Context, workspaceId string, identifier string) (*bitbucket.User, error)
+	GetWorkspaceProjects(ctx context.Context, workspaceId string, getWorkspaceProjectsVars bitbucket.PaginationVars) ([]bitbucket.Project, string, error)
+	GetProjectRepos(ctx context.Context, workspaceId string, projectId string, getProjectReposVars bitbucket.PaginationVars) ([]bitbucket.Repository, string, error)
+	GetUser(ctx context.Context, userId string) (*bitbucket.User, error)
+
+	GetWorkspaceUserGroups(ctx context.Context, workspaceId string) ([]bitbucket.UserGroup, error)
+	GetUserGroupMembers(ctx context.Context, workspaceId string, groupSlug string) ([]bitbucket.User, error)
+	AddUserToGroup(ctx context.Context, workspaceId string, groupSlug string, userId string) error
+	RemoveUserFromGroup(ctx context.Context, workspaceId string, groupSlug string, userId string) error
+
+	ForEachProjectGroupPermission(ctx context.Context, workspaceId string, projectKey string, fn func(bitbucket.GroupPermission) error) error
+	ForEachProjectUserPermission(ctx context.Context, workspaceId string, projectKey string, fn func(bitbucket.UserPermission) error) error
+	ForEachRepositoryGroupPermission(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.GroupPermission) error) error
+	ForEachRepositoryUserPermission(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.UserPermission) error) error
+
+	GetProjectBranchingModel(ctx context.Context, workspaceId string, projectKey string) (*bitbucket.BranchingModel, error)
+
+	HasProjectPermissions(ctx context.Context, workspaceId string, projectKey string) (bool, error)
+	GetProjectGroupPermissions(ctx context.Context, workspaceId string, projectKey string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.GroupPermission, string, error)
+	GetProjectGroupPermission(ctx context.Context, workspaceId string, projectKey string, groupSlug string) (*bitbucket.GroupPermission, error)
+	UpdateProjectGroupPermission(ctx context.Context, workspaceId string, projectKey string, groupSlug string, permission string) error
+	DeleteProjectGroupPermission(ctx context.Context, workspaceId string, projectKey string, groupSlug string) error
+	GetProjectUserPermissions(ctx context.Context, workspaceId string, projectKey string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error)
+	GetProjectUserPermission(ctx context.Context, workspaceId string, projectKey string, userId string) (*bitbucket.UserPermission, error)
+	UpdateProjectUserPermission(ctx context.Context, workspaceId string, projectKey string, userId string, permission string) error
+	DeleteProjectUserPermission(ctx context.Context, workspaceId string, projectKey string, userId string) error
+
+	GetRepositoryGroupPermissions(ctx context.Context, workspaceId string, repoId string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.GroupPermission, string, error)
+	GetRepoGroupPermission(ctx context.Context, workspaceId string, repoId string, groupSlug string) (*bitbucket.GroupPermission, error)
+	UpdateRepoGroupPermission(ctx context.Context, workspaceId string, repoId string, groupSlug string, permission string) error
+	DeleteRepoGroupPermission(ctx context.Context, workspaceId string, repoId string, groupSlug string) error
+	GetRepositoryUserPermissions(ctx context.Context, workspaceId string, repoId string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error)
+	GetWorkspaceRepositoryUserPermissions(ctx context.Context, workspaceId string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error)
+	GetRepoUserPermission(ctx context.Context, workspaceId string, repoId string, userId string) (*bitbucket.UserPermission, error)
+	UpdateRepoUserPermission(ctx context.Context, workspaceId string, repoId string, userId string, permission string) error
+	DeleteRepoUserPermission(ctx context.Context, workspaceId string, repoId string, userId string) error
+
+	GetRepositoryBranchRestrictions(ctx context.Context, workspaceId string, repoId string, getRestrictionsVars bitbucket.PaginationVars) ([]bitbucket.BranchRestriction, string, error)
+	ForEachRepositoryBranchRestriction(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.BranchRestriction) error) error
+	ForEachRepositoryCommit(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.Commit) error) error
+	ForEachRepositoryPullRequest(ctx context.Context, workspaceId string, repoId string, since time.Time, fn func(bitbucket.PullRequest) error) error
+	GetRepositoryPipelinesConfig(ctx context.Context, workspaceId string, repoId string) (*bitbucket.PipelinesConfig, error)
+	GetRepositoryEnvironments(ctx context.Context, workspaceId string, repoId string, getEnvironmentsVars bitbucket.PaginationVars) ([]bitbucket.Environment, string, error)
+
+	GetWorkspaceRunners(ctx context.Context, workspaceId string, getRunnersVars bitbucket.PaginationVars) ([]bitbucket.Runner, string, error)
+	GetRepositoryRunners(ctx context.Context, workspaceId string, repoId string, getRunnersVars bitbucket.PaginationVars) ([]bitbucket.Runner, string, error)
+}
+
+var _ BitbucketClient = apiClient{}
+
+// apiClient maps the calls of the resource builders to the endpoints of the Bitbucket client.
+type apiClient struct {
+	*bitbucket.Client
+}
+
+func (c apiClient) GetWorkspaces(ctx context.Context, getWorkspacesVars bitbucket.PaginationVars) ([]bitbucket.Workspace, string, error) {
+	return c.Workspaces.List(ctx, getWorkspacesVars)
+}
+
+func (c apiClient) GetWorkspace(ctx context.Context, workspaceId string) (*bitbucket.Workspace, error) {
+	return c.Workspaces.Get(ctx, workspaceId)
+}
+
+func (c apiClient) GetWorkspaceMembers(ctx context.Context, workspaceId string, getWorkspacesVars bitbucket.PaginationVars) ([]bitbucket.User, string, error) {
+	return c.Workspaces.Members(ctx, workspaceId, getWorkspacesVars)
+}
+
+func (c apiClient) GetWorkspaceMember(ctx context.Context, workspaceId string, userId string) (*bitbucket.User, error) {
+	return c.Workspaces.Member(ctx, workspaceId, userId)
+}
+
+func (c apiClient) FindWorkspaceMember(ctx context.Context, workspaceId string, identifier string) (*bitbucket.User, error) {
+	return c.Workspaces.FindMember(ctx, workspaceId, identifier)
+}
+
+func (c apiClient) GetWorkspaceProjects(ctx context.Context, workspaceId string, getWorkspaceProjectsVars bitbucket.PaginationVars) ([]bitbucket.Project, string, error) {
+	return c.Projects.List(ctx, workspaceId, getWorkspaceProjectsVars)
+}
+
+func (c apiClient) GetProjectRepos(ctx context.Context, workspaceId string, projectId string, getProjectReposVars bitbucket.PaginationVars) ([]bitbucket.Repository, string, error) {
+	return c.Repos.List(ctx, workspaceId, projectId, getProjectReposVars)
+}
+
+func (c apiClient) GetUser(ctx context.Context, userId string) (*bitbucket.User, error) {
+	return c.Users.Get(ctx, userId)
+}
+
+func (c apiClient) GetWorkspaceUserGroups(ctx context.Context, workspaceId string) ([]bitbucket.UserGroup, error) {
+	return c.V1.Groups.List(ctx, workspaceId)
+}
+
+func (c apiClient) GetUserGroupMembers(ctx context.Context, workspaceId string, groupSlug string) ([]bitbucket.User, error) {
+	return c.V1.Groups.Members(ctx, workspaceId, groupSlug)
+}
+
+func (c apiClient) AddUserToGroup(ctx context.Context, workspaceId string, groupSlug string, userId string) error {
+	return c.V1.Groups.AddMember(ctx, workspaceId, groupSlug, userId)
+}
+
+func (c apiClient) RemoveUserFromGroup(ctx context.Context, workspaceId string, groupSlug string, userId string) error {
+	return c.V1.Groups.RemoveMember(ctx, workspaceId, groupSlug, userId)
+}
+
+func (c apiClient) ForEachProjectGroupPermission(ctx context.Context, workspaceId string, projectKey string, fn func(bitbucket.GroupPermission) error) error {
+	return c.Projects.ForEachGroupPermission(ctx, workspaceId, projectKey, fn)
+}
+
+func (c apiClient) ForEachProjectUserPermission(ctx context.Context, workspaceId string, projectKey string, fn func(bitbucket.UserPermission) error) error {
+	return c.Projects.ForEachUserPermission(ctx, workspaceId, projectKey, fn)
+}
+
+func (c apiClient) ForEachRepositoryGroupPermission(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.GroupPermission) error) error {
+	return c.Repos.ForEachGroupPermission(ctx, workspaceId, repoId, fn)
+}
+
+func (c apiClient) ForEachRepositoryUserPermission(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.UserPermission) error) error {
+	return c.Repos.ForEachUserPermission(ctx, workspaceId, repoId, fn)
+}
+
+func (c apiClient) GetProjectBranchingModel(ctx context.Context, workspaceId string, projectKey string) (*bitbucket.BranchingModel, error) {
+	return c.Projects.BranchingModel(ctx, workspaceId, projectKey)
+}
+
+func (c apiClient) HasProjectPermissions(ctx context.Context, workspaceId string, projectKey string) (bool, error) {
+	return c.Projects.HasPermissions(ctx, workspaceId, projectKey)
+}
+
+func (c apiClient) GetProjectGroupPermissions(ctx context.Context, workspaceId string, projectKey string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.GroupPermission, string, error) {
+	return c.Projects.GroupPermissions(ctx, workspaceId, projectKey, getPermissionsVars)
+}
+
+func (c apiClient) GetProjectGroupPermission(ctx context.Context, workspaceId string, projectKey string, groupSlug string) (*bitbucket.GroupPermission, error) {
+	return c.Projects.GroupPermission(ctx, workspaceId, projectKey, groupSlug)
+}
+
+func (c apiClient) UpdateProjectGroupPermission(ctx context.Context, workspaceId string, projectKey string, groupSlug string, permission string) error {
+	return c.Projects.UpdateGroupPermission(ctx, workspaceId, projectKey, groupSlug, permission)
+}
+
+func (c apiClient) DeleteProjectGroupPermission(ctx context.Context, workspaceId string, projectKey string, groupSlug string) error {
+	return c.Projects.DeleteGroupPermission(ctx, workspaceId, projectKey, groupSlug)
+}
+
+func (c apiClient) GetProjectUserPermissions(ctx context.Context, workspaceId string, projectKey string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error) {
+	return c.Projects.UserPermissions(ctx, workspaceId, projectKey, getPermissionsVars)
+}
+
+func (c apiClient) GetProjectUserPermission(ctx context.Context, workspaceId string, projectKey string, userId string) (*bitbucket.UserPermission, error) {
+	return c.Projects.UserPermission(ctx, workspaceId, projectKey, userId)
+}
+
+func (c apiClient) UpdateProjectUserPermission(ctx context.Context, workspaceId string, projectKey string, userId string, permission string) error {
+	return c.Projects.UpdateUserPermission(ctx, workspaceId, projectKey, userId, permission)
+}
+
+func (c apiClient) DeleteProjectUserPermission(ctx context.Context, workspaceId string, projectKey string, userId string) error {
+	return c.Projects.DeleteUserPermission(ctx, workspaceId, projectKey, userId)
+}
+
+func (c apiClient) GetRepositoryGroupPermissions(ctx context.Context, workspaceId string, repoId string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.GroupPermission, string, error) {
+	return c.Repos.GroupPermissions(ctx, workspaceId, repoId, getPermissionsVars)
+}
+
+func (c apiClient) GetRepoGroupPermission(ctx context.Context, workspaceId string, repoId string, groupSlug string) (*bitbucket.GroupPermission, error) {
+	return c.Repos.GroupPermission(ctx, workspaceId, repoId, groupSlug)
+}
+
+func (c apiClient) UpdateRepoGroupPermission(ctx context.Context, workspaceId string, repoId string, groupSlug string, permission string) error {
+	return c.Repos.UpdateGroupPermission(ctx, workspaceId, repoId, groupSlug, permission)
+}
+
+func (c apiClient) DeleteRepoGroupPermission(ctx context.Context, workspaceId string, repoId string, groupSlug string) error {
+	return c.Repos.DeleteGroupPermission(ctx, workspaceId, repoId, groupSlug)
+}
+
+func (c apiClient) GetRepositoryUserPermissions(ctx context.Context, workspaceId string, repoId string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error) {
+	return c.Repos.UserPermissions(ctx, workspaceId, repoId, getPermissionsVars)
+}
+
+func (c apiClient) GetWorkspaceRepositoryUserPermissions(ctx context.Context, workspaceId string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error) {
+	return c.Workspaces.RepositoryUserPermissions(ctx, workspaceId, getPermissionsVars)
+}
+
+func (c apiClient) GetRepoUserPermission(ctx context.Context, workspaceId string, repoId string, userId string) (*bitbucket.UserPermission, error) {
+	return c.Repos.UserPermission(ctx, workspaceId, repoId, userId)
+}
+
+func (c apiClient) UpdateRepoUserPermission(ctx context.Context, workspaceId string, repoId string, userId string, permission string) error {
+	return c.Repos.UpdateUserPermission(ctx, workspaceId, repoId, userId, permission)
+}
+
+func (c apiClient) DeleteRepoUserPermission(ctx context.Context, workspaceId string, repoId string, userId string) error {
+	return c.Repos.DeleteUserPermission(ctx, workspaceId, repoId, userId)
+}
+
+func (c apiClient) GetRepositoryBranchRestrictions(ctx context.Context, workspaceId string, repoId string, getRestrictionsVars bitbucket.PaginationVars) ([]bitbucket.BranchRestriction, string, error) {
+	return c.Repos.BranchRestrictions(ctx, workspaceId, repoId, getRestrictionsVars)
+}
+
+func (c apiClient) ForEachRepositoryBranchRestriction(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.BranchRestriction) error) error {
+	return c.Repos.ForEachBranchRestriction(ctx, workspaceId, repoId, fn)
+}
+
+func (c apiClient) ForEachRepositoryCommit(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.Commit) error) error {
+	return c.Repos.ForEachCommit(ctx, workspaceId, repoId, fn)
+}
+
+func (c apiClient) ForEachRepositoryPullRequest(ctx context.Context, workspaceId string, repoId string, since time.Time, fn func(bitbucket.PullRequest) error) error {
+	return c.Repos.ForEachPullRequest(ctx, workspaceId, repoId, since, fn)
+}
+
+func (c apiClient) GetRepositoryPipelinesConfig(ctx context.Context, workspaceId string, repoId string) (*bitbucket.PipelinesConfig, error) {
+	return c.Repos.PipelinesConfig(ctx, workspaceId, repoId)
+}
+
+func (c apiClient) GetRepositoryEnvironments(ctx context.Context, workspaceId string, repoId string, getEnvironmentsVars bitbucket.PaginationVars) ([]bitbucket.Environment, string, error) {
+	return c.Repos.Environments(ctx, workspaceId, repoId, getEnvironmentsVars)
+}
+
+func (c apiClient) GetWorkspaceRunners(ctx context.Context, workspaceId string, getRunnersVars bitbucket.PaginationVars) ([]bitbucket.Runner, string, error) {
+	return c.Workspaces.Runners(ctx, workspaceId, getRunnersVars)
+}
+
+func (c apiClient) GetRepositoryRunners(ctx context.Context, workspaceId string, repoId string, getRunnersVars bitbucket.PaginationVars) ([]bitbucket.Runner, string, error) {
+	return c.Repos.Runners(ctx, workspaceId, repoId, getRunnersVars)
+}
@@ -3,12 +3,17 @@ package connector
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"time"
 
+	"github.com/conductorone/baton-bitbucket/pkg/atlassian"
 	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/sdk"
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"golang.org/x/oauth2"
 )
 
 var (
@@ -30,6 +35,14 @@ var (
 			v2.ResourceType_TRAIT_GROUP,
 		},
 	}
+	// resourceTypeUserGroupRole replaces resourceTypeUserGroup when the user groups are synced as roles.
+	resourceTypeUserGroupRole = &v2.ResourceType{
+		Id:          "user_group",
+		DisplayName: "Role",
+		Traits: []v2.ResourceType_Trait{
+			v2.ResourceType_TRAIT_ROLE,
+		},
+	}
 	resourceTypeUser = &v2.ResourceType{
 		Id:          "user",
 		DisplayName: "User",
@@ -40,75 +53,472 @@ var (
 	resourceTypeRepository = &v2.ResourceType{
 		Id:          "repository",
 		DisplayName: "Repository",
+		Traits: []v2.ResourceType_Trait{
+			v2.ResourceType_TRAIT_GROUP,
+		},
+	}
+	resourceTypeRunner = &v2.ResourceType{
+		Id:          "runner",
+		DisplayName: "Runner",
+	}
+	resourceTypeEnvironment = &v2.ResourceType{
+		Id:          "environment",
+		DisplayName: "Deployment Environment",
 	}
 )
 
+// Config holds the options used to set up the connector.
+type Config struct {
+	// Workspaces limits syncing to the workspaces with given slugs.
+	Workspaces []string
+	// DebugHTTP enables logging of every request sent to the Bitbucket API.
+	DebugHTTP bool
+	// DebugHTTPBodies additionally logs truncated request and response bodies.
+	DebugHTTPBodies bool
+	// Headers are added to every request sent to the Bitbucket and Atlassian APIs, e.g. when
+	// the traffic has to pass an API gateway. Their values are redacted from the debug logs.
+	Headers http.Header
+	// Transport tunes the connection pool used to reach the Bitbucket API.
+	Transport bitbucket.TransportConfig
+	// HTTPCache sets where the GET responses of the Bitbucket API are cached, for how long and
+	// how large the caches grow.
+	HTTPCache bitbucket.HTTPCacheConfig
+	// ReadOnly disables every write to Bitbucket, Grant/Revoke are not offered to the platform
+	// and the incident response actions fail, even when the credentials are allowed to write.
+	ReadOnly bool
+	// SkipGrantPreflight disables reading the current access before Grant writes, Revoke only reads the
+	// role of the principal instead of every permission of the project or repository.
+	SkipGrantPreflight bool
+	// SkipProjectRepositoryGrants disables the repository membership grants of projects.
+	SkipProjectRepositoryGrants bool
+	// EntitlementDisplayNameTemplate overrides generated entitlement display names,
+	// see EntitlementTemplateData for the available fields.
+	EntitlementDisplayNameTemplate string
+	// EntitlementDescriptionTemplate overrides generated entitlement descriptions.
+	EntitlementDescriptionTemplate string
+	// ManagedGroups lists slug patterns of user groups managed by an identity provider, in addition
+	// to the groups of the Atlassian Access directory, which are detected when it is configured.
+	ManagedGroups []string
+	// AtlassianOrgId and AtlassianAPIKey enable the event feed of organization audit events
+	// and flag users whose managed Atlassian account is deactivated.
+	AtlassianOrgId  string
+	AtlassianAPIKey string
+	// DirectoryId and DirectoryAPIKey enable matching users to Atlassian Access directory identities
+	// and detecting the user groups the directory manages.
+	DirectoryId     string
+	DirectoryAPIKey string
+	// SyncUserEmails sets the emails of users, as known to the Atlassian Access directory.
+	// It is off by default, as the emails need the directory or organization credentials.
+	SyncUserEmails bool
+	// ResolveOrgEmails resolves user emails via the Atlassian organization directory, it requires SyncUserEmails.
+	ResolveOrgEmails bool
+	// DeduplicateUsers lists a user belonging to multiple workspaces only once,
+	// under the first workspace, with a membership grant for each workspace.
+	DeduplicateUsers bool
+	// UserFetchConcurrency bounds the number of users fetched at once while listing
+	// workspace members, zero keeps the default of 10.
+	UserFetchConcurrency int
+	// MaxConcurrentRequests bounds the requests in flight to the Bitbucket API across all
+	// credentials and parallel parts of a sync, zero doesn't limit them.
+	MaxConcurrentRequests int
+	// SkipUserStatus treats every workspace member as enabled instead of fetching the account
+	// status of each member, which speeds up syncs when suspension is managed by an identity provider.
+	SkipUserStatus bool
+	// SyncExternalCollaborators lists the users with repository permissions who are not members of
+	// the workspace. It is off by default, as it pages through the repository permissions of every workspace.
+	SyncExternalCollaborators bool
+	// GlobalUsers lists users as top-level resources instead of children of their workspaces.
+	GlobalUsers bool
+	// DefaultAccessEntitlement emits a workspace entitlement granted to the default access
+	// groups, which new workspace members are added to automatically.
+	DefaultAccessEntitlement bool
+	// DefaultMemberGroup is the slug of a user group which gives access to the workspace, granting
+	// the workspace membership adds the user to it, as Bitbucket has no API to invite members.
+	DefaultMemberGroup string
+	// GroupsAsRoles syncs user groups with the role trait instead of the group trait, their IDs and
+	// the IDs of their entitlements and grants stay the same.
+	GroupsAsRoles bool
+	// StaleRepositoryAge flags repositories not updated for longer as stale in their profile,
+	// zero disables the detection.
+	StaleRepositoryAge time.Duration
+	// Retry tunes the retries of writes rejected by the rate limit.
+	Retry RetryConfig
+	// CheckpointDir persists the user group listings of every workspace, so a sync restarted
+	// after the process died doesn't fetch them again. Empty disables the checkpoints.
+	CheckpointDir string
+	// CheckpointMaxAge is how long checkpoints are reused by a resumed sync, zero keeps the default
+	// of an hour. A new sync deletes the checkpoints of the previous one regardless of their age.
+	CheckpointMaxAge time.Duration
+	// SyncTimeout bounds the duration of a sync, zero means no limit.
+	SyncTimeout time.Duration
+	// WorkspaceCredentials maps workspace slugs to credentials used for all requests to
+	// the workspace instead of the default credentials.
+	WorkspaceCredentials map[string]uhttp.AuthCredentials
+}
+
 type Bitbucket struct {
-	client     *bitbucket.Client
-	workspaces []string
+	// client uses the default credentials, nil when only workspace credentials are configured
+	client *bitbucket.Client
+	// api is what the resource builders use, it routes requests by workspace when
+	// workspaces have their own credentials and is limited to a single project or
+	// repository when the default credentials are a project or repository access token
+	api         BitbucketClient
+	routes      *workspaceClients
+	responses   responseCaches
+	pageSizes   *bitbucket.PageSizes
+	scoped      *scopedClient
+	workspaces  []string
+	permissions *permissionCache
+	plans       *workspacePlans
+	members     *groupMemberCache
+	repos       *projectRepoCache
+	index       *workspaceIndex
+	retry       *retryPolicy
+	deadline    *syncDeadline
+	timings     *syncTimings
+	org         *atlassian.Client
+	directory   *userDirectory
+	orgUsers    *orgUsers
+	details     *userDetails
+	checkpoints *groupCheckpoints
+	canonical   *canonicalUsers
+	external    *externalCollaborators
+
+	readOnly       bool
+	skipPreflight  bool
+	skipRepoGrants bool
+	skipUserStatus bool
+	names          *entitlementNames
+	managedGroups  *managedGroups
+	syncEmails     bool
+	resolveEmails  bool
+	globalUsers    bool
+	defaultAccess  bool
+	memberGroup    string
+	groupsAsRoles  bool
+	staleRepoAge   time.Duration
 }
 
 func (bb *Bitbucket) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
-	return []connectorbuilder.ResourceSyncer{
-		workspaceBuilder(bb.client, bb.workspaces),
-		projectBuilder(bb.client),
-		userBuilder(bb.client),
-		userGroupBuilder(bb.client),
-		repositoryBuilder(bb.client),
+	return withInstrumentation(bb.deadline, bb.timings, !bb.readOnly, []connectorbuilder.ResourceSyncer{
+		workspaceBuilder(bb.api, bb.index, bb.workspaces, bb.names, bb.syncCaches(), bb.globalUsers, bb.defaultAccess, bb.memberGroup, bb.members, bb.retry, bb.checkpoints, bb.skipPreflight),
+		projectBuilder(bb.api, bb.permissions, bb.repos, bb.retry, bb.skipPreflight, bb.skipRepoGrants, bb.names, bb.plans),
+		userBuilder(bb.api, bb.index, bb.directory, bb.orgUsers, bb.details, bb.skipUserStatus, bb.syncEmails, bb.resolveEmails, bb.canonical, bb.globalUsers, bb.workspaces, bb.external),
+		userGroupBuilder(bb.api, bb.skipPreflight, bb.names, bb.managedGroups, bb.members, bb.retry, bb.checkpoints, bb.groupsAsRoles),
+		repositoryBuilder(bb.api, bb.permissions, bb.repos, bb.retry, bb.skipPreflight, bb.names, bb.staleRepoAge),
+		runnerBuilder(bb.api),
+		environmentBuilder(bb.api, bb.names),
+	})
+}
+
+// syncCaches returns the state which is dropped when a new sync starts.
+func (bb *Bitbucket) syncCaches() []syncCache {
+	caches := []syncCache{bb.index, bb.members, bb.repos, bb.plans, bb.permissions, bb.directory, bb.managedGroups, bb.orgUsers, bb.details, bb.checkpoints, bb.pageSizes, bb.responses}
+
+	// top-level users may be listed before the workspaces, so they reset the listed users themselves
+	if !bb.globalUsers {
+		caches = append(caches, bb.canonical, bb.external)
+	}
+
+	return caches
+}
+
+// responseCaches are the clients of all credentials, whose GET responses cached in memory are dropped
+// when a new sync starts, so a long-running process doesn't serve a sync the responses of the previous one.
+type responseCaches []*bitbucket.Client
+
+func (c responseCaches) Reset() {
+	for _, client := range c {
+		client.ClearCache()
 	}
 }
 
 // Metadata returns metadata about the connector.
 func (bb *Bitbucket) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error) {
+	description := "Provisions user group memberships, project roles and repository roles, the other entitlements are read-only"
+	if bb.memberGroup != "" {
+		description = "Provisions workspace memberships, user group memberships, project roles and repository roles, the other entitlements are read-only"
+	}
+	if bb.readOnly {
+		description = "Read-only, provisioning is disabled by the connector configuration"
+	}
+
 	return &v2.ConnectorMetadata{
 		DisplayName: "Bitbucket",
+		Description: description,
 	}, nil
 }
 
 // Validate hits the Bitbucket API to validate that the configured credentials are valid and compatible.
 func (bb *Bitbucket) Validate(ctx context.Context) (annotations.Annotations, error) {
-	// get the scope of used credentials
-	user, err := bb.client.GetCurrentUser(ctx)
+	annos, err := bb.validate(ctx)
+
+	return annos, statusError(err)
+}
+
+func (bb *Bitbucket) validate(ctx context.Context) (annotations.Annotations, error) {
+	if bb.client != nil {
+		// get the scope of used credentials
+		user, err := bb.client.Users.Current(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("bitbucket-connector: failed to get current user: %w", err)
+		}
+		if isScopedPrincipal(user) {
+			if bb.scoped == nil {
+				return nil, fmt.Errorf("bitbucket-connector: project and repository access tokens can't be combined with workspace credentials")
+			}
+
+			err = bb.scoped.Resolve(ctx, user)
+		} else {
+			err = setClientScope(bb.client, user)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = validateScopes(ctx, bb.client, "the default credentials")
+		if err != nil {
+			return nil, err
+		}
+
+		if bb.client.IsUserScoped() {
+			err = bb.client.SetWorkspaceIDs(ctx, bb.workspaces)
+			if err != nil {
+				return nil, fmt.Errorf("bitbucket-connector: failed to get workspace ids: %w", err)
+			}
+		}
+	}
+
+	if bb.routes != nil {
+		err := bb.routes.Resolve(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// newClient creates a Bitbucket API client authenticated with provided credentials.
+func newClient(ctx context.Context, config Config, auth uhttp.AuthCredentials, pageSizes *bitbucket.PageSizes, limit *bitbucket.RequestLimit, cache *bitbucket.DiskCache) (*bitbucket.Client, error) {
+	httpClient, err := auth.GetClient(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("bitbucket-connector: failed to get current user: %w", err)
+		return nil, fmt.Errorf("bitbucket-connector: failed to get http client: %w", err)
+	}
+
+	switch t := httpClient.Transport.(type) {
+	case *oauth2.Transport:
+		// the credentials wrap the SDK transport with the oauth2 one, so only the base
+		// transport it delegates to is swapped
+		if config.Transport.IsSet() {
+			t.Base = bitbucket.NewTransport(config.Transport)
+		}
+
+		// the base transport sees the requests with their credentials, which the disk cache keys them by
+		t.Base = cache.Transport(t.Base)
+	case nil, *http.Transport, *uhttp.Transport:
+		// the credentials don't wrap the transport, it is replaced as a whole
+		if config.Transport.IsSet() {
+			httpClient.Transport = bitbucket.NewTransport(config.Transport)
+		}
+	default:
+		if config.Transport.IsSet() {
+			return nil, fmt.Errorf("bitbucket-connector: the transport settings can't be applied to the %T transport of the credentials", t)
+		}
+	}
+
+	if config.DebugHTTP {
+		redacted := make([]string, 0, len(config.Headers))
+		for name := range config.Headers {
+			redacted = append(redacted, name)
+		}
+
+		httpClient.Transport = bitbucket.NewDebugTransport(httpClient.Transport, config.DebugHTTPBodies, redacted)
 	}
-	err = bb.setScope(user)
+
+	return bitbucket.New(
+		ctx,
+		bitbucket.WithHTTPClient(httpClient),
+		bitbucket.WithUserAgent("baton-sdk/"+sdk.Version),
+		bitbucket.WithHTTPCache(config.HTTPCache),
+		bitbucket.WithHeaders(config.Headers),
+		bitbucket.WithPageSizes(pageSizes),
+		bitbucket.WithRequestLimit(limit),
+	)
+}
+
+// New creates the connector. The auth holds the default credentials, it can be nil
+// when every synced workspace has its own credentials in the config.
+func New(ctx context.Context, config Config, auth uhttp.AuthCredentials) (*Bitbucket, error) {
+	if auth == nil && len(config.WorkspaceCredentials) == 0 {
+		return nil, fmt.Errorf("bitbucket-connector: no credentials configured")
+	}
+
+	// the clients of all credentials remember the page sizes of failing endpoints together
+	// and share the limit of concurrent requests
+	pageSizes := bitbucket.NewPageSizes()
+	limit := bitbucket.NewRequestLimit(config.MaxConcurrentRequests)
+
+	// the responses of all credentials are cached on disk together, keyed by the credentials
+	cache, err := bitbucket.NewDiskCache(config.HTTPCache)
 	if err != nil {
 		return nil, err
 	}
 
-	if bb.client.IsUserScoped() {
-		err = bb.client.SetWorkspaceIDs(ctx, bb.workspaces)
+	var client *bitbucket.Client
+	var responses responseCaches
+	if auth != nil {
+		client, err = newClient(ctx, config, auth, pageSizes, limit, cache)
 		if err != nil {
-			return nil, fmt.Errorf("bitbucket-connector: failed to get workspace ids: %w", err)
+			return nil, err
 		}
+
+		responses = append(responses, client)
 	}
-	return nil, nil
+
+	workspaces := config.Workspaces
+
+	var api BitbucketClient
+	var routes *workspaceClients
+	if len(config.WorkspaceCredentials) > 0 {
+		bySlug := make(map[string]*bitbucket.Client, len(config.WorkspaceCredentials))
+		for workspaceSlug, credentials := range config.WorkspaceCredentials {
+			bySlug[workspaceSlug], err = newClient(ctx, config, credentials, pageSizes, limit, cache)
+			if err != nil {
+				return nil, err
+			}
+			responses = append(responses, bySlug[workspaceSlug])
+
+			// workspaces with their own credentials are always synced
+			if len(workspaces) > 0 && !contains(workspaceSlug, workspaces) {
+				workspaces = append(workspaces, workspaceSlug)
+			}
+		}
+
+		routes = newWorkspaceClients(client, bySlug)
+		api = routes
+	}
+
+	// project and repository access tokens are only detected by Validate, the client narrows the synced resources once they are
+	var scoped *scopedClient
+	if routes == nil {
+		scoped = newScopedClient(client)
+		api = scoped
+	}
+
+	bb, err := newBitbucket(ctx, config, api, workspaces)
+	if err != nil {
+		return nil, err
+	}
+
+	bb.client = client
+	bb.routes = routes
+	bb.responses = responses
+	bb.pageSizes = pageSizes
+	bb.scoped = scoped
+
+	return bb, nil
 }
 
-func New(ctx context.Context, workspaces []string, auth uhttp.AuthCredentials) (*Bitbucket, error) {
-	httpClient, err := auth.GetClient(ctx)
+// NewWithClient creates the connector on top of any implementation of the Bitbucket API,
+// e.g. a fake simulating workspaces of a given size. Credentials of the config are ignored.
+func NewWithClient(ctx context.Context, config Config, api BitbucketClient) (*Bitbucket, error) {
+	return newBitbucket(ctx, config, api, config.Workspaces)
+}
+
+// newBitbucket sets up the state shared by the resource builders on top of the API they use.
+func newBitbucket(ctx context.Context, config Config, api BitbucketClient, workspaces []string) (*Bitbucket, error) {
+	names, err := newEntitlementNames(config.EntitlementDisplayNameTemplate, config.EntitlementDescriptionTemplate)
 	if err != nil {
-		return nil, fmt.Errorf("bitbucket-connector: failed to get http client: %w", err)
+		return nil, err
+	}
+
+	if config.ResolveOrgEmails && config.AtlassianOrgId == "" {
+		return nil, fmt.Errorf("bitbucket-connector: resolving emails requires an atlassian organization")
+	}
+
+	if config.ResolveOrgEmails && !config.SyncUserEmails {
+		return nil, fmt.Errorf("bitbucket-connector: resolving emails requires syncing user emails")
+	}
+
+	var org *atlassian.Client
+	var users *orgUsers
+	if config.AtlassianOrgId != "" {
+		org, err = atlassian.NewClient(ctx, config.AtlassianOrgId, config.AtlassianAPIKey)
+		if err != nil {
+			return nil, fmt.Errorf("bitbucket-connector: failed to create atlassian client: %w", err)
+		}
+		org.SetHeaders(config.Headers)
+
+		users = newOrgUsers(org)
 	}
 
-	client, err := bitbucket.NewClient(ctx, httpClient)
+	// a top-level user is listed once, regardless of how many workspaces it belongs to
+	var canonical *canonicalUsers
+	if config.DeduplicateUsers || config.GlobalUsers {
+		canonical = newCanonicalUsers()
+	}
+
+	checkpoints, err := newGroupCheckpoints(config.CheckpointDir, config.CheckpointMaxAge)
 	if err != nil {
 		return nil, err
 	}
+
+	var directory *userDirectory
+	var directoryClient *atlassian.DirectoryClient
+	if config.DirectoryId != "" {
+		directoryClient, err = atlassian.NewDirectoryClient(ctx, config.DirectoryId, config.DirectoryAPIKey)
+		if err != nil {
+			return nil, fmt.Errorf("bitbucket-connector: failed to create directory client: %w", err)
+		}
+		directoryClient.SetHeaders(config.Headers)
+
+		directory = newUserDirectory(directoryClient)
+	}
+
 	return &Bitbucket{
-		client:     client,
-		workspaces: workspaces,
+		api:         api,
+		workspaces:  workspaces,
+		permissions: newPermissionCache(api),
+		plans:       newWorkspacePlans(api),
+		members:     newGroupMemberCache(api),
+		repos:       newProjectRepoCache(api, !config.SkipProjectRepositoryGrants),
+		index:       newWorkspaceIndex(api),
+		retry:       newRetryPolicy(config.Retry),
+		deadline:    newSyncDeadline(config.SyncTimeout),
+		timings:     newSyncTimings(),
+		org:         org,
+		directory:   directory,
+		orgUsers:    users,
+		details:     newUserDetails(api, config.UserFetchConcurrency),
+		checkpoints: checkpoints,
+		canonical:   canonical,
+		external:    newExternalCollaborators(api, config.SyncExternalCollaborators),
+
+		readOnly:       config.ReadOnly,
+		skipPreflight:  config.SkipGrantPreflight,
+		skipRepoGrants: config.SkipProjectRepositoryGrants,
+		skipUserStatus: config.SkipUserStatus,
+		names:          names,
+		managedGroups:  newManagedGroups(directoryClient, config.ManagedGroups),
+		syncEmails:     config.SyncUserEmails,
+		resolveEmails:  config.ResolveOrgEmails,
+		globalUsers:    config.GlobalUsers,
+		defaultAccess:  config.DefaultAccessEntitlement,
+		memberGroup:    config.DefaultMemberGroup,
+		groupsAsRoles:  config.GroupsAsRoles,
+		staleRepoAge:   config.StaleRepositoryAge,
 	}, nil
 }
 
-func (bb *Bitbucket) setScope(user *bitbucket.User) error {
+// setClientScope sets the scope of the client based on the type of the authenticated principal.
+func setClientScope(client *bitbucket.Client, user *bitbucket.User) error {
 	// check the type of user then set the scope
 	switch user.Type {
 	case "user":
-		bb.client.SetupUserScope(user.Id)
+		client.SetupUserScope(user.Id)
 	case "team":
-		bb.client.SetupWorkspaceScope(user.Id)
+		client.SetupWorkspaceScope(user.Id)
 	default:
 		return fmt.Errorf("bitbucket-connector: unsupported user type: %s", user.Type)
 	}
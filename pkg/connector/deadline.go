@@ -0,0 +1,62 @@
+package connector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// syncDeadline bounds the duration of a sync, so a sync which doesn't fit into its window fails
+// instead of running on. The deadline is set when a sync starts listing the workspaces, calls
+// made before that, e.g. by a sync resumed in a new process, are not bounded.
+type syncDeadline struct {
+	timeout time.Duration
+
+	mtx      sync.Mutex
+	deadline time.Time
+}
+
+func newSyncDeadline(timeout time.Duration) *syncDeadline {
+	return &syncDeadline{
+		timeout: timeout,
+	}
+}
+
+// start sets the deadline of a new sync.
+func (d *syncDeadline) start() {
+	if d == nil || d.timeout <= 0 {
+		return
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.deadline = time.Now().Add(d.timeout)
+}
+
+// bound returns a context which is cancelled at the deadline of the sync. It fails once the deadline
+// passed, with a code the SDK doesn't retry, so the sync stops right away.
+func (d *syncDeadline) bound(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	if d == nil {
+		return ctx, func() {}, nil
+	}
+
+	d.mtx.Lock()
+	deadline := d.deadline
+	d.mtx.Unlock()
+
+	if deadline.IsZero() {
+		return ctx, func() {}, nil
+	}
+
+	if !time.Now().Before(deadline) {
+		return nil, nil, status.Errorf(codes.DeadlineExceeded, "bitbucket-connector: sync exceeded its timeout of %s", d.timeout)
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+
+	return ctx, cancel, nil
+}
@@ -0,0 +1,120 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/conductorone/baton-bitbucket/pkg/atlassian"
+)
+
+// userDirectory matches Bitbucket users to identities of an Atlassian Access
+// directory by their Atlassian account id. The directory is loaded on first use
+// and kept for the rest of the sync.
+type userDirectory struct {
+	client *atlassian.DirectoryClient
+	mtx    sync.Mutex
+	users  map[string]*atlassian.DirectoryUser
+}
+
+func newUserDirectory(client *atlassian.DirectoryClient) *userDirectory {
+	return &userDirectory{
+		client: client,
+	}
+}
+
+// Reset drops the loaded directory, so the next sync sees fresh identities.
+func (d *userDirectory) Reset() {
+	if d == nil {
+		return
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.users = nil
+}
+
+// Lookup returns the directory identity of the Atlassian account, nil when there is none
+// or no directory is configured.
+func (d *userDirectory) Lookup(ctx context.Context, accountId string) (*atlassian.DirectoryUser, error) {
+	if d == nil || accountId == "" {
+		return nil, nil
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.users == nil {
+		users, err := d.client.ListAllUsers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("bitbucket-connector: failed to list directory users: %w", err)
+		}
+
+		d.users = make(map[string]*atlassian.DirectoryUser, len(users))
+		for i := range users {
+			d.users[users[i].External.AccountId] = &users[i]
+		}
+	}
+
+	return d.users[accountId], nil
+}
+
+// orgUsers looks up managed accounts of the Atlassian organization. The accounts
+// carry emails, which Bitbucket endpoints don't expose for workspace members, and
+// the account status, which is kept even when the Bitbucket membership lingers.
+type orgUsers struct {
+	client *atlassian.Client
+	mtx    sync.Mutex
+	users  map[string]*atlassian.OrgUser
+}
+
+func newOrgUsers(client *atlassian.Client) *orgUsers {
+	return &orgUsers{
+		client: client,
+	}
+}
+
+// Reset drops the loaded accounts, so the next sync sees fresh ones.
+func (o *orgUsers) Reset() {
+	if o == nil {
+		return
+	}
+
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	o.users = nil
+}
+
+// Lookup returns the managed account of the Atlassian account id, nil when the account
+// is not managed by the organization or no organization is configured.
+func (o *orgUsers) Lookup(ctx context.Context, accountId string) (*atlassian.OrgUser, error) {
+	if o == nil || accountId == "" {
+		return nil, nil
+	}
+
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	if o.users == nil {
+		users, err := o.client.ListAllUsers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("bitbucket-connector: failed to list organization users: %w", err)
+		}
+
+		o.users = make(map[string]*atlassian.OrgUser, len(users))
+		for i := range users {
+			o.users[users[i].AccountId] = &users[i]
+		}
+	}
+
+	return o.users[accountId], nil
+}
+
+// userIdentity is what is known about a Bitbucket user outside of Bitbucket.
+type userIdentity struct {
+	directory *atlassian.DirectoryUser
+	account   *atlassian.OrgUser
+	email     string
+}
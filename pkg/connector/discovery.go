@@ -0,0 +1,92 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+)
+
+// permissionAccessToken is reported for workspaces accessed with workspace, project or repository
+// access tokens, which are not members of the workspace and have no workspace permission.
+const permissionAccessToken = "access_token"
+
+// AccessibleWorkspace is a workspace the configured credentials can see.
+type AccessibleWorkspace struct {
+	Slug string `json:"slug"`
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// Permission is owner, collaborator or member for user credentials and access_token otherwise.
+	Permission string `json:"permission"`
+}
+
+// AccessibleWorkspaces lists all workspaces visible to the configured credentials, regardless of
+// the workspaces selected for syncing, so the selection can be built from their slugs.
+func (bb *Bitbucket) AccessibleWorkspaces(ctx context.Context) ([]AccessibleWorkspace, error) {
+	var clients []*bitbucket.Client
+	if bb.client != nil {
+		clients = append(clients, bb.client)
+	}
+	if bb.routes != nil {
+		for _, client := range bb.routes.bySlug {
+			clients = append(clients, client)
+		}
+	}
+
+	rv := []AccessibleWorkspace{}
+	seen := make(map[string]struct{})
+	for _, client := range clients {
+		workspaces, err := accessibleWorkspaces(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, workspace := range workspaces {
+			if _, ok := seen[workspace.Id]; ok {
+				continue
+			}
+			seen[workspace.Id] = struct{}{}
+
+			rv = append(rv, workspace)
+		}
+	}
+
+	return rv, nil
+}
+
+func accessibleWorkspaces(ctx context.Context, client *bitbucket.Client) ([]AccessibleWorkspace, error) {
+	if !client.IsUserScoped() {
+		workspaceId, err := client.WorkspaceId()
+		if err != nil {
+			return nil, fmt.Errorf("bitbucket-connector: failed to get workspace id: %w", err)
+		}
+
+		workspace, err := client.Workspaces.Get(ctx, workspaceId)
+		if err != nil {
+			return nil, fmt.Errorf("bitbucket-connector: failed to get workspace: %w", err)
+		}
+
+		return []AccessibleWorkspace{accessibleWorkspace(workspace, permissionAccessToken)}, nil
+	}
+
+	permissions, err := client.Workspaces.AllCurrentUserPermissions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket-connector: failed to list workspace permissions: %w", err)
+	}
+
+	rv := make([]AccessibleWorkspace, 0, len(permissions))
+	for _, permission := range permissions {
+		rv = append(rv, accessibleWorkspace(&permission.Workspace, permission.Permission))
+	}
+
+	return rv, nil
+}
+
+func accessibleWorkspace(workspace *bitbucket.Workspace, permission string) AccessibleWorkspace {
+	return AccessibleWorkspace{
+		Slug:       workspace.Slug,
+		Id:         workspace.Id,
+		Name:       workspace.Name,
+		Permission: permission,
+	}
+}
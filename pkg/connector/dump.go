@@ -0,0 +1,103 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+)
+
+// DumpTarget selects the workspace and optionally one of its projects or repositories to dump.
+type DumpTarget struct {
+	// Workspace is the workspace slug.
+	Workspace string
+	// Project is the project key.
+	Project string
+	// Repository is the repository slug.
+	Repository string
+}
+
+// rawPayload is a single API payload of the dump.
+type rawPayload struct {
+	name string
+	url  string
+}
+
+func (t DumpTarget) payloads() []rawPayload {
+	workspace := url.PathEscape(t.Workspace)
+
+	rv := []rawPayload{
+		{"workspace", fmt.Sprintf(bitbucket.WorkspaceBaseURL, workspace)},
+		{"workspace-members", fmt.Sprintf(bitbucket.WorkspaceMembersBaseURL, workspace)},
+		{"workspace-permissions", fmt.Sprintf(bitbucket.WorkspaceBaseURL+"/permissions", workspace)},
+		{"workspace-groups", fmt.Sprintf(bitbucket.WorkspaceUserGroupsBaseURL, workspace)},
+		{"workspace-projects", fmt.Sprintf(bitbucket.WorkspaceProjectsBaseURL, workspace)},
+	}
+
+	if t.Project != "" {
+		project := url.PathEscape(t.Project)
+
+		rv = append(rv,
+			rawPayload{"project", fmt.Sprintf(bitbucket.WorkspaceProjectsBaseURL+"/%s", workspace, project)},
+			rawPayload{"project-user-permissions", fmt.Sprintf(bitbucket.ProjectUserPermissionsBaseURL, workspace, project)},
+			rawPayload{"project-group-permissions", fmt.Sprintf(bitbucket.ProjectGroupPermissionsBaseURL, workspace, project)},
+			rawPayload{"project-repositories", fmt.Sprintf(bitbucket.ProjectRepositoriesBaseURL+"?q=%s", workspace, url.QueryEscape(fmt.Sprintf("project.key=%q", t.Project)))},
+		)
+	}
+
+	if t.Repository != "" {
+		repository := url.PathEscape(t.Repository)
+
+		rv = append(rv,
+			rawPayload{"repository", fmt.Sprintf(bitbucket.ProjectRepositoriesBaseURL+"/%s", workspace, repository)},
+			rawPayload{"repository-user-permissions", fmt.Sprintf(bitbucket.RepoUserPermissionsBaseURL, workspace, repository)},
+			rawPayload{"repository-group-permissions", fmt.Sprintf(bitbucket.RepoGroupPermissionsBaseURL, workspace, repository)},
+			rawPayload{"repository-branch-restrictions", fmt.Sprintf(bitbucket.RepoBranchRestrictionsBaseURL, workspace, repository)},
+		)
+	}
+
+	return rv
+}
+
+// DumpRawPayloads fetches the raw API payloads (members, groups and permissions) behind the
+// resources of the target and passes each of them to write, so they can be attached to support
+// requests when synced grants look wrong. Every paginated listing is passed as a list of its pages.
+// Payloads which failed to be fetched are reported in the returned error.
+func (bb *Bitbucket) DumpRawPayloads(ctx context.Context, target DumpTarget, write func(name string, pages []json.RawMessage) error) error {
+	if target.Workspace == "" {
+		return fmt.Errorf("bitbucket-connector: workspace of the dump must be provided")
+	}
+
+	client := bb.client
+	if bb.routes != nil {
+		if workspaceClient, ok := bb.routes.bySlug[target.Workspace]; ok {
+			client = workspaceClient
+		}
+	}
+	if client == nil {
+		return fmt.Errorf("bitbucket-connector: no credentials configured for workspace %s", target.Workspace)
+	}
+
+	// payloads the credentials can't read are skipped, the rest of the dump is still useful
+	var errs []error
+	for _, payload := range target.payloads() {
+		pages, err := client.GetRawPages(ctx, payload.url)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("bitbucket-connector: failed to get %s: %w", payload.name, err))
+			continue
+		}
+
+		err = write(payload.name, pages)
+		if err != nil {
+			return err
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,291 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	deployEntitlement = "deploy"
+
+	environmentAdminOnlyProfileKey = "environment_admin_only"
+)
+
+type environmentResourceType struct {
+	resourceType *v2.ResourceType
+	client       BitbucketClient
+	names        *entitlementNames
+}
+
+func (e *environmentResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return e.resourceType
+}
+
+// ComposeEnvironmentId composes the environment ID out of the composed ID of its repository.
+func ComposeEnvironmentId(repositoryId, environmentId string) string {
+	return composeChildId(repositoryId, environmentId)
+}
+
+// DecomposeEnvironmentId returns the composed repository ID and the environment ID.
+func DecomposeEnvironmentId(id string) (string, string, error) {
+	segments, err := decodeResourceId(id, 5)
+	if err != nil {
+		return "", "", fmt.Errorf("bitbucket-connector: invalid environment resource id: %w", err)
+	}
+
+	return encodeResourceId(segments[:4]...), segments[4], nil
+}
+
+// Create a new connector resource for a Bitbucket deployment environment.
+func environmentResource(ctx context.Context, environment *bitbucket.Environment, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"environment_id":               environment.Id,
+		"environment_name":             environment.Name,
+		"environment_type":             environment.EnvironmentType.Name,
+		environmentAdminOnlyProfileKey: environment.Restrictions.AdminOnly,
+	}
+
+	resource, err := rs.NewGroupResource(
+		environment.Name,
+		resourceTypeEnvironment,
+		ComposeEnvironmentId(parentResourceID.Resource, environment.Id),
+		[]rs.GroupTraitOption{
+			rs.WithGroupProfile(profile),
+		},
+		rs.WithParentResourceID(parentResourceID),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (e *environmentResourceType) List(ctx context.Context, parentId *v2.ResourceId, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentId == nil {
+		return nil, "", nil, nil
+	}
+
+	composedProjectId, repositoryId, err := DecomposeRepositoryId(parentId.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	workspaceId, _, _, err := DecomposeProjectId(composedProjectId)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	bag, err := parsePageToken(token.Token, &v2.ResourceId{ResourceType: resourceTypeEnvironment.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	environments, nextToken, err := e.client.GetRepositoryEnvironments(
+		ctx,
+		workspaceId,
+		repositoryId,
+		bitbucket.PaginationVars{
+			Limit: ResourcesPageSize,
+			Page:  bag.PageToken(),
+		},
+	)
+	if err != nil {
+		// environments are only available for repositories with Pipelines enabled
+		if errors.Is(err, bitbucket.ErrPermissionDenied) || errors.Is(err, bitbucket.ErrNotFound) {
+			ctxzap.Extract(ctx).Debug(
+				"bitbucket-connector: not allowed to list deployment environments",
+				zap.String("repository_id", repositoryId),
+			)
+
+			return nil, "", nil, nil
+		}
+
+		return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to list deployment environments: %w", err)
+	}
+
+	pageToken, err := bag.NextToken(nextToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Resource
+	for _, environment := range environments {
+		environmentCopy := environment
+
+		er, err := environmentResource(ctx, &environmentCopy, parentId)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		rv = append(rv, er)
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+func (e *environmentResourceType) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var rv []*v2.Entitlement
+
+	// deployment restrictions are configured in the environment settings
+	rv = append(rv, ent.NewPermissionEntitlement(
+		resource,
+		deployEntitlement,
+		ent.WithGrantableTo(resourceTypeUser, resourceTypeUserGroup),
+		ent.WithDisplayName(e.names.DisplayName(resource, deployEntitlement, fmt.Sprintf("%s Environment %s", resource.DisplayName, titleCase(deployEntitlement)))),
+		ent.WithDescription(e.names.Description(resource, deployEntitlement, fmt.Sprintf("Allowed to deploy to %s environment in Bitbucket", resource.DisplayName))),
+		ent.WithAnnotation(&v2.EntitlementImmutable{}),
+	))
+
+	return rv, "", nil, nil
+}
+
+// Grants lists who is allowed to deploy to restricted environments. Deployments to admin-only
+// environments are limited to repository admins, deployments to other environments are open
+// to everyone with write access to the repository, which the repository grants already cover.
+func (e *environmentResourceType) Grants(ctx context.Context, resource *v2.Resource, token *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	groupTrait, err := rs.GetGroupTrait(resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if !groupTrait.GetProfile().GetFields()[environmentAdminOnlyProfileKey].GetBoolValue() {
+		return nil, "", nil, nil
+	}
+
+	bag, err := parsePageToken(token.Token, resource.Id)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	repositoryResourceId, _, err := DecomposeEnvironmentId(resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	composedProjectId, repositoryId, err := DecomposeRepositoryId(repositoryResourceId)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	workspaceId, _, _, err := DecomposeProjectId(composedProjectId)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Grant
+	switch bag.ResourceTypeID() {
+	case resourceTypeEnvironment.Id:
+		bag.Pop()
+		bag.Push(pagination.PageState{
+			ResourceTypeID: resourceTypeUserGroup.Id,
+		})
+		bag.Push(pagination.PageState{
+			ResourceTypeID: resourceTypeUser.Id,
+		})
+
+	case resourceTypeUserGroup.Id:
+		permissions, nextToken, err := e.client.GetRepositoryGroupPermissions(
+			ctx,
+			workspaceId,
+			repositoryId,
+			bitbucket.PaginationVars{
+				Limit: ResourcesPageSize,
+				Page:  bag.PageToken(),
+			},
+		)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to list repository group permissions: %w", err)
+		}
+
+		err = bag.Next(nextToken)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		for _, permission := range permissions {
+			if permission.Value != roleAdmin {
+				continue
+			}
+
+			groupId := userGroupResourceId(workspaceId, permission.Group.Slug)
+
+			rv = append(rv, grant.NewGrant(
+				resource,
+				deployEntitlement,
+				groupId,
+				groupMembersExpandable(groupId),
+				grantSource(permissionSource(permission.Permission, "/2.0/repositories/{workspace}/{repo_slug}/permissions-config/groups", "/1.0/group-privileges/{workspace}/{repo_slug}"), grantSourceInherited, permission.Value),
+				grant.WithAnnotation(&v2.GrantImmutable{}),
+			))
+		}
+
+	case resourceTypeUser.Id:
+		permissions, nextToken, err := e.client.GetRepositoryUserPermissions(
+			ctx,
+			workspaceId,
+			repositoryId,
+			bitbucket.PaginationVars{
+				Limit: ResourcesPageSize,
+				Page:  bag.PageToken(),
+			},
+		)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to list repository user permissions: %w", err)
+		}
+
+		err = bag.Next(nextToken)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		for _, permission := range permissions {
+			if permission.Value != roleAdmin {
+				continue
+			}
+
+			userId, err := rs.NewResourceID(resourceTypeUser, permission.User.Id)
+			if err != nil {
+				return nil, "", nil, err
+			}
+
+			rv = append(rv, grant.NewGrant(
+				resource,
+				deployEntitlement,
+				userId,
+				grantSource(permissionSource(permission.Permission, "/2.0/repositories/{workspace}/{repo_slug}/permissions-config/users", "/1.0/privileges/{workspace}/{repo_slug}"), grantSourceInherited, permission.Value),
+				grant.WithAnnotation(&v2.GrantImmutable{}),
+			))
+		}
+
+	default:
+		return nil, "", nil, fmt.Errorf("bitbucket-connector: invalid grant resource type: %s", bag.ResourceTypeID())
+	}
+
+	pageToken, err := bag.Marshal()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+func environmentBuilder(client BitbucketClient, names *entitlementNames) *environmentResourceType {
+	return &environmentResourceType{
+		resourceType: resourceTypeEnvironment,
+		client:       client,
+		names:        names,
+	}
+}
@@ -0,0 +1,116 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/pkg/atlassian"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// eventCursor is the stream cursor of the event feed. Since is the time of the
+// next event to fetch and Cursor the Atlassian page cursor within that window.
+type eventCursor struct {
+	Since  time.Time `json:"since"`
+	Cursor string    `json:"cursor,omitempty"`
+}
+
+// ListEvents exposes the audit events of the configured Atlassian organization
+// (members added, groups changed, tokens created, ...) as usage events.
+// Without an organization configured the feed is always empty.
+func (bb *Bitbucket) ListEvents(
+	ctx context.Context,
+	earliestEvent *timestamppb.Timestamp,
+	pToken *pagination.StreamToken,
+) ([]*v2.Event, *pagination.StreamState, annotations.Annotations, error) {
+	if bb.org == nil {
+		return nil, &pagination.StreamState{Cursor: pToken.Cursor}, nil, nil
+	}
+
+	var cursor eventCursor
+	if pToken.Cursor != "" {
+		err := json.Unmarshal([]byte(pToken.Cursor), &cursor)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("bitbucket-connector: invalid event cursor: %w", err)
+		}
+	} else if earliestEvent != nil {
+		cursor.Since = earliestEvent.AsTime()
+	}
+
+	events, nextCursor, err := bb.org.ListEvents(ctx, cursor.Since, cursor.Cursor)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("bitbucket-connector: failed to list organization events: %w", err)
+	}
+
+	rv := make([]*v2.Event, 0, len(events))
+	for _, event := range events {
+		rv = append(rv, auditEvent(event))
+	}
+
+	next := eventCursor{
+		Since:  cursor.Since,
+		Cursor: nextCursor,
+	}
+
+	// once the window is exhausted, continue right after the latest event seen
+	if nextCursor == "" && len(events) > 0 {
+		next.Since = events[len(events)-1].Attributes.Time.Add(time.Millisecond)
+	}
+
+	cursorData, err := json.Marshal(next)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return rv, &pagination.StreamState{
+		Cursor:  string(cursorData),
+		HasMore: nextCursor != "",
+	}, nil, nil
+}
+
+// auditEvent converts Atlassian organization event into a usage event. Actors are
+// identified by their Atlassian account id, the first event context is the target.
+func auditEvent(event atlassian.Event) *v2.Event {
+	usage := &v2.UsageEvent{
+		ActorResource: &v2.Resource{
+			Id: &v2.ResourceId{
+				ResourceType: resourceTypeUser.Id,
+				Resource:     event.Attributes.Actor.Id,
+			},
+			DisplayName: event.Attributes.Actor.Name,
+		},
+	}
+
+	if len(event.Attributes.Context) > 0 {
+		target := event.Attributes.Context[0]
+
+		resourceType := target.Type
+		switch target.Type {
+		case "users":
+			resourceType = resourceTypeUser.Id
+		case "groups":
+			resourceType = resourceTypeUserGroup.Id
+		}
+
+		usage.TargetResource = &v2.Resource{
+			Id: &v2.ResourceId{
+				ResourceType: resourceType,
+				Resource:     target.Id,
+			},
+			Description: event.Attributes.Action,
+		}
+	}
+
+	return &v2.Event{
+		Id:         event.Id,
+		OccurredAt: timestamppb.New(event.Attributes.Time),
+		Event: &v2.Event_UsageEvent{
+			UsageEvent: usage,
+		},
+	}
+}
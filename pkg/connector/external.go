@@ -0,0 +1,150 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+)
+
+// externalCollaborators finds the users which have access to repositories of a workspace without
+// being its members, e.g. because they were invited by email before workspace membership was required.
+// They are listed as external collaborators, so the repository grants don't reference unknown users.
+// It is nil unless the external collaborators are synced, and reset whenever a new sync starts listing workspaces.
+type externalCollaborators struct {
+	client BitbucketClient
+	mtx    sync.Mutex
+	// members are the users known to be members of every workspace
+	members map[string]map[string]struct{}
+	// found are the external collaborators of every workspace which were already returned
+	found map[string]map[string]struct{}
+}
+
+// newExternalCollaborators returns nil, disabling the listing of external collaborators, when they are not synced.
+func newExternalCollaborators(client BitbucketClient, enabled bool) *externalCollaborators {
+	if !enabled {
+		return nil
+	}
+
+	return &externalCollaborators{
+		client:  client,
+		members: make(map[string]map[string]struct{}),
+		found:   make(map[string]map[string]struct{}),
+	}
+}
+
+// Reset forgets the known members and external collaborators.
+func (e *externalCollaborators) Reset() {
+	if e == nil {
+		return
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.members = make(map[string]map[string]struct{})
+	e.found = make(map[string]map[string]struct{})
+}
+
+// AddMembers records users listed as members of the workspace.
+func (e *externalCollaborators) AddMembers(workspaceId string, users []bitbucket.User) {
+	if e == nil {
+		return
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	members := workspaceUsers(e.members, workspaceId)
+	for _, user := range users {
+		members[user.Id] = struct{}{}
+	}
+}
+
+// Find returns the users of the repository permissions which are not members of the workspace and
+// were not returned before. Users which were not listed as members, e.g. because the sync resumed
+// after the members were listed, are looked up in the workspace without holding the lock.
+func (e *externalCollaborators) Find(ctx context.Context, workspaceId string, permissions []bitbucket.UserPermission) ([]bitbucket.User, error) {
+	unknown := e.unknown(workspaceId, permissions)
+
+	var rv []bitbucket.User
+	for _, user := range unknown {
+		_, err := e.client.GetWorkspaceMember(ctx, workspaceId, user.Id)
+		if err == nil {
+			e.AddMembers(workspaceId, []bitbucket.User{user})
+			continue
+		}
+		if !errors.Is(err, bitbucket.ErrNotFound) {
+			return nil, fmt.Errorf("bitbucket-connector: failed to get workspace member: %w", err)
+		}
+
+		if e.markFound(workspaceId, user.Id) {
+			rv = append(rv, user)
+		}
+	}
+
+	return rv, nil
+}
+
+// unknown returns the distinct users of the permissions which are neither known members nor returned before.
+func (e *externalCollaborators) unknown(workspaceId string, permissions []bitbucket.UserPermission) []bitbucket.User {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	members := workspaceUsers(e.members, workspaceId)
+	found := workspaceUsers(e.found, workspaceId)
+	seen := make(map[string]struct{}, len(permissions))
+
+	var rv []bitbucket.User
+	for _, permission := range permissions {
+		user := permission.User
+		if user.Id == "" {
+			continue
+		}
+
+		if _, ok := members[user.Id]; ok {
+			continue
+		}
+
+		if _, ok := found[user.Id]; ok {
+			continue
+		}
+
+		if _, ok := seen[user.Id]; ok {
+			continue
+		}
+		seen[user.Id] = struct{}{}
+
+		rv = append(rv, user)
+	}
+
+	return rv
+}
+
+// markFound records the external collaborator, false when it was already returned, e.g. by a concurrent Find.
+func (e *externalCollaborators) markFound(workspaceId, userId string) bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	found := workspaceUsers(e.found, workspaceId)
+	if _, ok := found[userId]; ok {
+		return false
+	}
+
+	found[userId] = struct{}{}
+
+	return true
+}
+
+// workspaceUsers returns the set of users of the workspace, creating it when missing.
+func workspaceUsers(sets map[string]map[string]struct{}, workspaceId string) map[string]struct{} {
+	users, ok := sets[workspaceId]
+	if !ok {
+		users = make(map[string]struct{})
+		sets[workspaceId] = users
+	}
+
+	return users
+}
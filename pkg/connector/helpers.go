@@ -1,18 +1,140 @@
 package connector
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 var ResourcesPageSize = 50
 
+const (
+	defaultWriteRetries   = 3
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// RetryConfig tunes how writes rejected by the Bitbucket rate limit are retried.
+// Zero values keep the defaults.
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt, a negative value disables retries.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry, it doubles with every further retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two retries.
+	MaxBackoff time.Duration
+}
+
+type retryPolicy struct {
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func newRetryPolicy(config RetryConfig) *retryPolicy {
+	p := &retryPolicy{
+		maxRetries:     defaultWriteRetries,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+	}
+
+	if config.MaxRetries < 0 {
+		p.maxRetries = 0
+	} else if config.MaxRetries > 0 {
+		p.maxRetries = config.MaxRetries
+	}
+	if config.InitialBackoff > 0 {
+		p.initialBackoff = config.InitialBackoff
+	}
+	if config.MaxBackoff > 0 {
+		p.maxBackoff = config.MaxBackoff
+	}
+
+	return p
+}
+
+// withRateLimitRetry retries the write operation with exponential backoff
+// while Bitbucket keeps responding that the rate limit was exceeded.
+func (p *retryPolicy) withRateLimitRetry(ctx context.Context, write func() error) error {
+	backoff := p.initialBackoff
+
+	for attempt := 0; ; attempt++ {
+		err := write()
+		if err == nil || !errors.Is(err, bitbucket.ErrRateLimited) || attempt >= p.maxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(backoff, p.maxBackoff)):
+		}
+
+		backoff *= 2
+	}
+}
+
+// alreadyExistsAnnotations marks a Grant that did not change anything because the access was already in place.
+func alreadyExistsAnnotations() annotations.Annotations {
+	return grantMetadataAnnotations("already_exists")
+}
+
+// alreadyRevokedAnnotations marks a Revoke that did not change anything because the access was already gone.
+func alreadyRevokedAnnotations() annotations.Annotations {
+	return grantMetadataAnnotations("already_revoked")
+}
+
+func grantMetadataAnnotations(flag string) annotations.Annotations {
+	return annotations.New(&v2.GrantMetadata{
+		Metadata: &structpb.Struct{
+			Fields: map[string]*structpb.Value{
+				flag: structpb.NewBoolValue(true),
+			},
+		},
+	})
+}
+
+const (
+	// grantSourceDirect is access granted to the principal itself.
+	grantSourceDirect = "direct"
+	// grantSourceGroup is access granted to a user group, which its members receive.
+	grantSourceGroup = "group"
+	// grantSourceInherited is access derived from other access, e.g. deployments limited to repository admins.
+	grantSourceInherited = "inherited"
+)
+
+// grantSource annotates a grant with the Bitbucket endpoint it was read from, how the access is
+// given to the principal and the raw permission value returned by Bitbucket.
+func grantSource(endpoint, kind, permission string) grant.GrantOption {
+	return grant.WithGrantMetadata(map[string]interface{}{
+		"source_endpoint": endpoint,
+		"source_kind":     kind,
+		"permission":      permission,
+	})
+}
+
+// permissionSource returns the endpoint a repository permission was read from, the 1.0 one when the
+// client fell back to it.
+func permissionSource(permission bitbucket.Permission, endpoint, legacyEndpoint string) string {
+	if permission.Legacy {
+		return legacyEndpoint
+	}
+
+	return endpoint
+}
+
 func titleCase(s string) string {
 	titleCaser := cases.Title(language.English)
 
@@ -56,16 +178,6 @@ func contains(payload string, values []string) bool {
 	return false
 }
 
-func isUserPresent(users []bitbucket.User, targetUserId string) bool {
-	for _, user := range users {
-		if user.Id == targetUserId {
-			return true
-		}
-	}
-
-	return false
-}
-
 func splitFullName(fullName string) (string, string) {
 	parts := strings.Split(fullName, " ")
 
@@ -73,15 +185,20 @@ func splitFullName(fullName string) (string, string) {
 }
 
 func GetIdFromComposedId(resource *v2.Resource) string {
-	parts := strings.Split(resource.Id.Resource, ":")
-	return parts[len(parts)-1]
+	parts := strings.Split(resource.Id.Resource, resourceIdSeparator)
+	id, err := url.PathUnescape(parts[len(parts)-1])
+	if err != nil {
+		return parts[len(parts)-1]
+	}
+
+	return id
 }
 
 func ParseEntitlementID(id string) (*v2.ResourceId, string, error) {
 	parts := strings.Split(id, ":")
 
-	// Need to be at least 3 parts type:entitlement_id:slug
-	if len(parts) < 4 {
+	// Need to be at least 3 parts type:resource_id:slug, composed resource ids contain more
+	if len(parts) < 3 {
 		return nil, "", fmt.Errorf("bitbucket-connector: invalid resource id")
 	}
 
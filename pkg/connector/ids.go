@@ -0,0 +1,72 @@
+package connector
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Composed resource IDs are a version prefix followed by segments joined with ':',
+// e.g. "v1:{workspace-uuid}:{project-uuid}:KEY". Every segment is percent-encoded, so
+// a ':' or '%' in a segment can't be mistaken for a separator, and the version allows
+// changing the layout without breaking parsing of IDs already stored by ConductorOne.
+// Unversioned IDs composed by older releases are decoded as well.
+const (
+	resourceIdVersion   = "v1"
+	resourceIdSeparator = ":"
+)
+
+var resourceIdSegmentEscaper = strings.NewReplacer("%", "%25", resourceIdSeparator, "%3A")
+
+// encodeResourceId composes a resource ID out of its segments.
+func encodeResourceId(segments ...string) string {
+	encoded := make([]string, 0, len(segments)+1)
+	encoded = append(encoded, resourceIdVersion)
+	for _, segment := range segments {
+		encoded = append(encoded, resourceIdSegmentEscaper.Replace(segment))
+	}
+
+	return strings.Join(encoded, resourceIdSeparator)
+}
+
+// composeChildId appends a segment to the composed ID of the parent resource.
+func composeChildId(parentId string, id string) string {
+	return parentId + resourceIdSeparator + resourceIdSegmentEscaper.Replace(id)
+}
+
+// decodeResourceId splits a resource ID composed by encodeResourceId into exactly n segments.
+func decodeResourceId(id string, n int) ([]string, error) {
+	parts := strings.Split(id, resourceIdSeparator)
+
+	// IDs synced by older releases are still referenced by ConductorOne entitlement bindings,
+	// so they keep working for Grant/Revoke. Legacy IDs are never versioned, as every
+	// one of them starts with a workspace UUID.
+	if parts[0] != resourceIdVersion {
+		return decodeLegacyResourceId(parts, n)
+	}
+
+	if len(parts) != n+1 {
+		return nil, fmt.Errorf("expected %d segments, got %d", n, len(parts)-1)
+	}
+
+	segments := make([]string, 0, n)
+	for _, part := range parts[1:] {
+		segment, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return segments, nil
+}
+
+// decodeLegacyResourceId maps the plain ':' join used before IDs were versioned to its segments.
+func decodeLegacyResourceId(parts []string, n int) ([]string, error) {
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d segments, got %d", n, len(parts))
+	}
+
+	return parts, nil
+}
@@ -0,0 +1,91 @@
+package connector
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+)
+
+type workspacesPage struct {
+	workspaces []bitbucket.Workspace
+	nextToken  string
+}
+
+// workspaceIndex keeps the workspaces listed during a sync by their UUID, so the workspace
+// and user builders, which both page through the synced workspaces, and the lookups of a
+// single workspace don't fetch them again. Project keys don't need an index, as they are
+// part of the composed project IDs. It is reset whenever a new sync starts listing workspaces.
+type workspaceIndex struct {
+	client     BitbucketClient
+	mtx        sync.Mutex
+	pages      map[string]*workspacesPage
+	workspaces map[string]bitbucket.Workspace
+}
+
+func newWorkspaceIndex(client BitbucketClient) *workspaceIndex {
+	return &workspaceIndex{
+		client:     client,
+		pages:      make(map[string]*workspacesPage),
+		workspaces: make(map[string]bitbucket.Workspace),
+	}
+}
+
+func workspacesPageKey(vars bitbucket.PaginationVars) string {
+	return encodeResourceId(strconv.Itoa(vars.Limit), vars.Page)
+}
+
+// Reset drops all indexed workspaces.
+func (i *workspaceIndex) Reset() {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	i.pages = make(map[string]*workspacesPage)
+	i.workspaces = make(map[string]bitbucket.Workspace)
+}
+
+// GetWorkspaces returns the page of workspaces available to the credentials, fetching it when it was not listed yet.
+func (i *workspaceIndex) GetWorkspaces(ctx context.Context, vars bitbucket.PaginationVars) ([]bitbucket.Workspace, string, error) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	key := workspacesPageKey(vars)
+	if page, ok := i.pages[key]; ok {
+		return page.workspaces, page.nextToken, nil
+	}
+
+	workspaces, nextToken, err := i.client.GetWorkspaces(ctx, vars)
+	if err != nil {
+		return nil, "", err
+	}
+
+	i.pages[key] = &workspacesPage{
+		workspaces: workspaces,
+		nextToken:  nextToken,
+	}
+	for _, workspace := range workspaces {
+		i.workspaces[workspace.Id] = workspace
+	}
+
+	return workspaces, nextToken, nil
+}
+
+// GetWorkspace returns the workspace with the UUID, fetching it when it was not listed yet.
+func (i *workspaceIndex) GetWorkspace(ctx context.Context, workspaceId string) (*bitbucket.Workspace, error) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	if workspace, ok := i.workspaces[workspaceId]; ok {
+		return &workspace, nil
+	}
+
+	workspace, err := i.client.GetWorkspace(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	i.workspaces[workspaceId] = *workspace
+
+	return workspace, nil
+}
@@ -0,0 +1,300 @@
+package connector
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/conductorone/baton-bitbucket/pkg/connector"
+
+var syncMetrics = newSyncerMetrics(otel.Meter(instrumentationName))
+
+// instrumentedSyncer wraps a resource syncer with a span for every call, so the API requests made
+// by the call show up under it, and records the sync metrics. Both are no-ops unless a tracer or
+// meter provider is configured. The sync calls are also bounded by the sync deadline, timed
+// per sync phase, the pages they return are sorted by ID, their retries on server errors are capped
+// and their errors get the gRPC status the SDK expects.
+type instrumentedSyncer struct {
+	syncer   connectorbuilder.ResourceSyncer
+	deadline *syncDeadline
+	timings  *syncTimings
+	retries  *serverErrorRetries
+}
+
+// instrumentedProvisioner keeps Grant/Revoke of syncers which provision access visible to the SDK.
+type instrumentedProvisioner struct {
+	instrumentedSyncer
+	provisioner connectorbuilder.ResourceProvisioner
+}
+
+// withInstrumentation wraps the syncers with tracing, metrics, the sync deadline, phase timings and a stable order.
+// Without provisioning, Grant/Revoke of the syncers are hidden so the SDK reports them as sync only.
+func withInstrumentation(deadline *syncDeadline, timings *syncTimings, provisioning bool, syncers []connectorbuilder.ResourceSyncer) []connectorbuilder.ResourceSyncer {
+	retries := newServerErrorRetries()
+
+	rv := make([]connectorbuilder.ResourceSyncer, 0, len(syncers))
+	for _, syncer := range syncers {
+		traced := instrumentedSyncer{syncer: syncer, deadline: deadline, timings: timings, retries: retries}
+
+		if provisioner, ok := syncer.(connectorbuilder.ResourceProvisioner); ok && provisioning {
+			rv = append(rv, &instrumentedProvisioner{instrumentedSyncer: traced, provisioner: provisioner})
+			continue
+		}
+
+		rv = append(rv, &traced)
+	}
+
+	return rv
+}
+
+// end records the outcome of the call.
+func (t *instrumentedSyncer) end(ctx context.Context, span trace.Span, operation string, started time.Time, err error) {
+	syncMetrics.recordCall(ctx, t.syncer.ResourceType(ctx).Id, operation, time.Since(started), err)
+	endSpan(span, err)
+}
+
+// timed adds a sync call to the timings of its phase.
+func (t *instrumentedSyncer) timed(ctx context.Context, operation string, resourceId *v2.ResourceId, started time.Time, items int, requests *bitbucket.RequestCounter) {
+	workspaceId := ""
+	if resourceId != nil {
+		workspaceId = workspaceIdOf(resourceId)
+	}
+
+	phase := syncPhase{
+		operation:    operation,
+		resourceType: t.syncer.ResourceType(ctx).Id,
+		workspaceId:  workspaceId,
+	}
+	t.timings.record(ctx, phase, started, items, requests.Count())
+}
+
+// retried caps the retries of the sync call on server errors, the SDK retries the call with the same page token.
+func (t *instrumentedSyncer) retried(ctx context.Context, operation string, resourceId *v2.ResourceId, token *pagination.Token, err error) error {
+	key := strings.Join([]string{operation, t.syncer.ResourceType(ctx).Id, resourceId.GetResource(), token.Token}, "/")
+
+	return t.retries.check(key, err)
+}
+
+func (t *instrumentedSyncer) ResourceType(ctx context.Context) *v2.ResourceType {
+	return t.syncer.ResourceType(ctx)
+}
+
+func (t *instrumentedSyncer) List(ctx context.Context, parentId *v2.ResourceId, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	// a sync starts by listing the workspaces
+	if t.syncer.ResourceType(ctx).Id == resourceTypeWorkspace.Id && parentId == nil && token.Token == "" {
+		syncMetrics.startSync()
+		t.deadline.start()
+		t.timings.Reset()
+	}
+
+	ctx, cancel, err := t.deadline.bound(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer cancel()
+
+	started := time.Now()
+	ctx, span := t.start(ctx, "List", parentId, attribute.String("baton.page_token", token.Token))
+	ctx, requests := bitbucket.WithRequestCounter(ctx)
+
+	rv, nextToken, annos, err := t.syncer.List(ctx, parentId, token)
+	err = statusError(t.retried(ctx, "List", parentId, token, err))
+	sortResources(rv)
+	span.SetAttributes(attribute.Int("baton.resources", len(rv)))
+	syncMetrics.recordResources(ctx, t.syncer.ResourceType(ctx).Id, len(rv))
+	t.end(ctx, span, "List", started, err)
+	t.timed(ctx, "List", parentId, started, len(rv), requests)
+
+	return rv, nextToken, annos, err
+}
+
+func (t *instrumentedSyncer) Entitlements(ctx context.Context, resource *v2.Resource, token *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	ctx, cancel, err := t.deadline.bound(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer cancel()
+
+	started := time.Now()
+	ctx, span := t.start(ctx, "Entitlements", resource.Id, attribute.String("baton.page_token", token.Token))
+	ctx, requests := bitbucket.WithRequestCounter(ctx)
+
+	rv, nextToken, annos, err := t.syncer.Entitlements(ctx, resource, token)
+	err = statusError(t.retried(ctx, "Entitlements", resource.Id, token, err))
+	sortEntitlements(rv)
+	span.SetAttributes(attribute.Int("baton.entitlements", len(rv)))
+	t.end(ctx, span, "Entitlements", started, err)
+	t.timed(ctx, "Entitlements", resource.Id, started, len(rv), requests)
+
+	return rv, nextToken, annos, err
+}
+
+func (t *instrumentedSyncer) Grants(ctx context.Context, resource *v2.Resource, token *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ctx, cancel, err := t.deadline.bound(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer cancel()
+
+	started := time.Now()
+	ctx, span := t.start(ctx, "Grants", resource.Id, attribute.String("baton.page_token", token.Token))
+	ctx, requests := bitbucket.WithRequestCounter(ctx)
+
+	rv, nextToken, annos, err := t.syncer.Grants(ctx, resource, token)
+	err = statusError(t.retried(ctx, "Grants", resource.Id, token, err))
+	sortGrants(rv)
+	span.SetAttributes(attribute.Int("baton.grants", len(rv)))
+	syncMetrics.recordGrants(ctx, t.syncer.ResourceType(ctx).Id, len(rv))
+	t.end(ctx, span, "Grants", started, err)
+	t.timed(ctx, "Grants", resource.Id, started, len(rv), requests)
+
+	return rv, nextToken, annos, err
+}
+
+func (t *instrumentedProvisioner) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	started := time.Now()
+	ctx, span := t.start(ctx, "Grant", entitlement.GetResource().GetId(),
+		attribute.String("baton.entitlement_id", entitlement.Id),
+		attribute.String("baton.principal_id", principal.Id.Resource),
+	)
+
+	annos, err := t.provisioner.Grant(ctx, principal, entitlement)
+	err = statusError(err)
+	t.end(ctx, span, "Grant", started, err)
+
+	return annos, err
+}
+
+func (t *instrumentedProvisioner) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	started := time.Now()
+	ctx, span := t.start(ctx, "Revoke", grant.GetEntitlement().GetResource().GetId(),
+		attribute.String("baton.entitlement_id", grant.GetEntitlement().GetId()),
+		attribute.String("baton.principal_id", grant.GetPrincipal().GetId().GetResource()),
+	)
+
+	annos, err := t.provisioner.Revoke(ctx, grant)
+	err = statusError(err)
+	t.end(ctx, span, "Revoke", started, err)
+
+	return annos, err
+}
+
+// syncerMetrics measures the progress of syncs.
+type syncerMetrics struct {
+	calls     metric.Float64Histogram
+	errors    metric.Int64Counter
+	resources metric.Int64Counter
+	grants    metric.Int64Counter
+
+	mtx          sync.Mutex
+	syncStarted  time.Time
+	lastActivity time.Time
+}
+
+func newSyncerMetrics(meter metric.Meter) *syncerMetrics {
+	m := &syncerMetrics{}
+
+	var err error
+	m.calls, err = meter.Float64Histogram(
+		"bitbucket.syncer.call_duration_seconds",
+		metric.WithDescription("Duration of resource syncer calls."),
+		metric.WithExplicitBucketBoundaries(0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	m.errors, err = meter.Int64Counter(
+		"bitbucket.syncer.errors",
+		metric.WithDescription("Resource syncer calls which failed."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	m.resources, err = meter.Int64Counter(
+		"bitbucket.resources.synced",
+		metric.WithDescription("Resources listed by the resource syncers."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	m.grants, err = meter.Int64Counter(
+		"bitbucket.grants.synced",
+		metric.WithDescription("Grants listed by the resource syncers."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	_, err = meter.Float64ObservableGauge(
+		"bitbucket.sync.duration_seconds",
+		metric.WithDescription("Duration of the latest sync, up to its latest resource syncer call."),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			m.mtx.Lock()
+			defer m.mtx.Unlock()
+
+			if !m.syncStarted.IsZero() {
+				o.Observe(m.lastActivity.Sub(m.syncStarted).Seconds())
+			}
+
+			return nil
+		}),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return m
+}
+
+func (m *syncerMetrics) startSync() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.syncStarted = time.Now()
+	m.lastActivity = m.syncStarted
+}
+
+func (m *syncerMetrics) recordCall(ctx context.Context, resourceTypeId, operation string, duration time.Duration, err error) {
+	m.mtx.Lock()
+	m.lastActivity = time.Now()
+	m.mtx.Unlock()
+
+	attrs := metric.WithAttributes(
+		attribute.String("resource_type", resourceTypeId),
+		attribute.String("operation", operation),
+	)
+
+	if m.calls != nil {
+		m.calls.Record(ctx, duration.Seconds(), attrs)
+	}
+	if err != nil && m.errors != nil {
+		m.errors.Add(ctx, 1, attrs)
+	}
+}
+
+func (m *syncerMetrics) recordResources(ctx context.Context, resourceTypeId string, count int) {
+	if m.resources != nil {
+		m.resources.Add(ctx, int64(count), metric.WithAttributes(attribute.String("resource_type", resourceTypeId)))
+	}
+}
+
+func (m *syncerMetrics) recordGrants(ctx context.Context, resourceTypeId string, count int) {
+	if m.grants != nil {
+		m.grants.Add(ctx, int64(count), metric.WithAttributes(attribute.String("resource_type", resourceTypeId)))
+	}
+}
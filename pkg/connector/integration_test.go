@@ -0,0 +1,245 @@
+package connector
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/internal/walk"
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+)
+
+// The integration tests run against a real, disposable Bitbucket workspace and are skipped
+// unless its credentials are set:
+//
+//	BATON_BITBUCKET_IT_TOKEN      access token with admin access to the workspace
+//	BATON_BITBUCKET_IT_WORKSPACE  slug of the workspace
+//	BATON_BITBUCKET_IT_GROUP      slug of a user group the round trip adds the user to and removes it from
+//	BATON_BITBUCKET_IT_USER_ID    UUID of a workspace member who isn't a member of the group
+const (
+	integrationTokenEnv     = "BATON_BITBUCKET_IT_TOKEN"
+	integrationWorkspaceEnv = "BATON_BITBUCKET_IT_WORKSPACE"
+	integrationGroupEnv     = "BATON_BITBUCKET_IT_GROUP"
+	integrationUserIdEnv    = "BATON_BITBUCKET_IT_USER_ID"
+
+	// Bitbucket takes a moment until a membership change shows in the listings
+	integrationSettleTimeout = 30 * time.Second
+)
+
+// newIntegrationConnector returns a connector of the sandbox workspace, every call starts with
+// empty caches, so it reads the current state.
+func newIntegrationConnector(t *testing.T) (context.Context, *Bitbucket) {
+	t.Helper()
+
+	token := os.Getenv(integrationTokenEnv)
+	workspace := os.Getenv(integrationWorkspaceEnv)
+	if token == "" || workspace == "" {
+		t.Skipf("%s and %s are not set", integrationTokenEnv, integrationWorkspaceEnv)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	t.Cleanup(cancel)
+
+	bb, err := New(ctx, Config{
+		Workspaces: []string{workspace},
+		HTTPCache:  bitbucket.HTTPCacheConfig{Disabled: true},
+	}, uhttp.NewBearerAuth(token))
+	if err != nil {
+		t.Fatalf("failed to create connector: %v", err)
+	}
+
+	_, err = bb.Validate(ctx)
+	if err != nil {
+		t.Fatalf("failed to validate credentials: %v", err)
+	}
+
+	return ctx, bb
+}
+
+func TestIntegrationSync(t *testing.T) {
+	ctx, bb := newIntegrationConnector(t)
+
+	counts := make(map[string]int)
+	err := walk.Resources(ctx, bb, func(resource *v2.Resource) error {
+		counts[resource.Id.ResourceType]++
+
+		entitlements, err := walk.Entitlements(ctx, bb, resource)
+		if err != nil {
+			return err
+		}
+		for _, entitlement := range entitlements {
+			if entitlement.Resource.Id.Resource != resource.Id.Resource {
+				t.Errorf("entitlement %s doesn't belong to resource %s", entitlement.Id, resource.Id.Resource)
+			}
+		}
+
+		grants, err := walk.Grants(ctx, bb, resource)
+		if err != nil {
+			return err
+		}
+		for _, grant := range grants {
+			if grant.Entitlement.Resource.Id.Resource != resource.Id.Resource {
+				t.Errorf("grant %s doesn't belong to resource %s", grant.Id, resource.Id.Resource)
+			}
+			if grant.Principal == nil || grant.Principal.Id == nil {
+				t.Errorf("grant %s has no principal", grant.Id)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+
+	for _, resourceType := range []*v2.ResourceType{resourceTypeWorkspace, resourceTypeUser} {
+		if counts[resourceType.Id] == 0 {
+			t.Errorf("no %s resources synced", resourceType.Id)
+		}
+	}
+
+	t.Logf("synced resources: %v", counts)
+}
+
+func TestIntegrationGroupMembershipRoundTrip(t *testing.T) {
+	groupSlug := os.Getenv(integrationGroupEnv)
+	userId := os.Getenv(integrationUserIdEnv)
+	if groupSlug == "" || userId == "" {
+		t.Skipf("%s and %s are not set", integrationGroupEnv, integrationUserIdEnv)
+	}
+
+	ctx, bb := newIntegrationConnector(t)
+
+	var group, user *v2.Resource
+	err := walk.Resources(ctx, bb, func(resource *v2.Resource) error {
+		switch resource.Id.ResourceType {
+		case resourceTypeUserGroup.Id:
+			_, slug, err := DecomposeGroupId(resource.Id.Resource)
+			if err != nil {
+				return err
+			}
+			if slug == groupSlug {
+				group = resource
+			}
+		case resourceTypeUser.Id:
+			if resource.Id.Resource == userId {
+				user = resource
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to list resources: %v", err)
+	}
+	if group == nil {
+		t.Fatalf("user group %s not found", groupSlug)
+	}
+	if user == nil {
+		t.Fatalf("user %s not found", userId)
+	}
+
+	entitlements, err := walk.Entitlements(ctx, bb, group)
+	if err != nil {
+		t.Fatalf("failed to list entitlements: %v", err)
+	}
+
+	var membership *v2.Entitlement
+	for _, entitlement := range entitlements {
+		if entitlement.Slug == memberEntitlement {
+			membership = entitlement
+		}
+	}
+	if membership == nil {
+		t.Fatalf("user group %s has no %s entitlement", groupSlug, memberEntitlement)
+	}
+
+	if findMembershipGrant(ctx, t, group, userId) != nil {
+		t.Fatalf("user %s is already a member of user group %s, the sandbox has to be reset", userId, groupSlug)
+	}
+
+	syncer, err := walk.ResourceSyncer(ctx, bb, group.Id.ResourceType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provisioner, ok := syncer.(connectorbuilder.ResourceProvisioner)
+	if !ok {
+		t.Fatalf("user groups are not provisionable")
+	}
+
+	_, err = provisioner.Grant(ctx, user, membership)
+	if err != nil {
+		t.Fatalf("failed to grant membership: %v", err)
+	}
+
+	// leave the sandbox as it was, even when the round trip fails half way
+	revoked := false
+	t.Cleanup(func() {
+		if revoked {
+			return
+		}
+		_, err := provisioner.Revoke(ctx, &v2.Grant{Entitlement: membership, Principal: user})
+		if err != nil {
+			t.Errorf("failed to clean up membership: %v", err)
+		}
+	})
+
+	grant := waitForMembership(ctx, t, group, userId, true)
+
+	_, err = provisioner.Revoke(ctx, grant)
+	if err != nil {
+		t.Fatalf("failed to revoke membership: %v", err)
+	}
+	revoked = true
+
+	waitForMembership(ctx, t, group, userId, false)
+}
+
+// findMembershipGrant syncs the grants of the group with a fresh connector and returns
+// the membership of the user, nil when the user isn't a member.
+func findMembershipGrant(ctx context.Context, t *testing.T, group *v2.Resource, userId string) *v2.Grant {
+	t.Helper()
+
+	_, bb := newIntegrationConnector(t)
+
+	grants, err := walk.Grants(ctx, bb, group)
+	if err != nil {
+		t.Fatalf("failed to list grants: %v", err)
+	}
+
+	for _, grant := range grants {
+		_, slug, err := ParseEntitlementID(grant.Entitlement.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if slug == memberEntitlement && grant.Principal.Id.Resource == userId {
+			return grant
+		}
+	}
+
+	return nil
+}
+
+// waitForMembership waits until the grants of the group show the membership of the user as expected.
+func waitForMembership(ctx context.Context, t *testing.T, group *v2.Resource, userId string, member bool) *v2.Grant {
+	t.Helper()
+
+	deadline := time.Now().Add(integrationSettleTimeout)
+	for {
+		grant := findMembershipGrant(ctx, t, group, userId)
+		if (grant != nil) == member {
+			return grant
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("membership of user %s in user group %s is still %t after %s", userId, group.Id.Resource, !member, integrationSettleTimeout)
+		}
+
+		time.Sleep(2 * time.Second)
+	}
+}
@@ -0,0 +1,220 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+// errActivityWindowEnd stops walking the commits once they are older than the activity window.
+var errActivityWindowEnd = errors.New("end of activity window")
+
+// RepositoryActivity counts what users did in a repository, keyed by their UUID.
+type RepositoryActivity struct {
+	Commits      map[string]int
+	PullRequests map[string]int
+	Merges       map[string]int
+}
+
+func (a *RepositoryActivity) total(userId string) int {
+	return a.Commits[userId] + a.PullRequests[userId] + a.Merges[userId]
+}
+
+// PrivilegeRecommendation suggests a lower repository permission for a user, based on its recent activity.
+type PrivilegeRecommendation struct {
+	WorkspaceId    string `json:"workspace_id"`
+	WorkspaceName  string `json:"workspace_name"`
+	UserId         string `json:"user_id"`
+	UserName       string `json:"user_name"`
+	RepositoryId   string `json:"repository_id"`
+	RepositoryName string `json:"repository_name"`
+	Permission     string `json:"permission"`
+	Recommended    string `json:"recommended"`
+	Commits        int    `json:"commits"`
+	PullRequests   int    `json:"pull_requests"`
+	Merges         int    `json:"merges"`
+	Reason         string `json:"reason"`
+}
+
+// RepositoryActivity counts the commits, the authored pull requests and the merged pull requests of every user
+// in the repository since provided time. Commits are only attributed to users when their author email belongs
+// to a Bitbucket account.
+func (bb *Bitbucket) RepositoryActivity(ctx context.Context, repositoryResourceId string, since time.Time) (*RepositoryActivity, error) {
+	composedProjectId, repositoryId, err := DecomposeRepositoryId(repositoryResourceId)
+	if err != nil {
+		return nil, err
+	}
+
+	workspaceId, _, _, err := DecomposeProjectId(composedProjectId)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := &RepositoryActivity{
+		Commits:      make(map[string]int),
+		PullRequests: make(map[string]int),
+		Merges:       make(map[string]int),
+	}
+
+	err = bb.api.ForEachRepositoryCommit(ctx, workspaceId, repositoryId, func(commit bitbucket.Commit) error {
+		date, err := time.Parse(time.RFC3339, commit.Date)
+		if err == nil && date.Before(since) {
+			return errActivityWindowEnd
+		}
+
+		if commit.Author.User != nil {
+			activity.Commits[commit.Author.User.Id]++
+		}
+
+		return nil
+	})
+	// an empty repository has no commits to list
+	if err != nil && !errors.Is(err, errActivityWindowEnd) && !errors.Is(err, bitbucket.ErrNotFound) {
+		return nil, fmt.Errorf("bitbucket-connector: failed to list repository commits: %w", err)
+	}
+
+	err = bb.api.ForEachRepositoryPullRequest(ctx, workspaceId, repositoryId, since, func(pullRequest bitbucket.PullRequest) error {
+		createdOn, err := time.Parse(time.RFC3339, pullRequest.CreatedOn)
+		if pullRequest.Author != nil && (err != nil || !createdOn.Before(since)) {
+			activity.PullRequests[pullRequest.Author.Id]++
+		}
+
+		if pullRequest.State == "MERGED" && pullRequest.ClosedBy != nil {
+			activity.Merges[pullRequest.ClosedBy.Id]++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket-connector: failed to list repository pull requests: %w", err)
+	}
+
+	return activity, nil
+}
+
+// LeastPrivilegeCandidates returns the IDs of the repositories with users granted the admin or write role directly,
+// the repositories whose activity is needed to recommend lower permissions.
+func LeastPrivilegeCandidates(grants []*v2.Grant) ([]string, error) {
+	seen := make(map[string]struct{})
+	var rv []string
+	for _, g := range grants {
+		ok, err := isPrivilegedRepositoryGrant(g)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		repositoryId := g.Entitlement.Resource.Id.Resource
+		if _, ok := seen[repositoryId]; ok {
+			continue
+		}
+		seen[repositoryId] = struct{}{}
+
+		rv = append(rv, repositoryId)
+	}
+
+	sort.Strings(rv)
+
+	return rv, nil
+}
+
+// RecommendLeastPrivilege compares the repository roles granted directly to users with their activity in the
+// repositories, keyed by the repository resource IDs, and recommends lower roles: read for writers and admins
+// without any commits or pull requests, write for admins whose activity only needs write access. Admin actions,
+// like changing the repository settings, are not part of the activity, so the latter need a review. The grants
+// of user groups are not considered, their members are managed in the groups.
+func RecommendLeastPrivilege(resources []*v2.Resource, grants []*v2.Grant, activity map[string]*RepositoryActivity, window time.Duration) ([]PrivilegeRecommendation, error) {
+	byId := make(map[string]*v2.Resource, len(resources))
+	for _, resource := range resources {
+		byId[resourceKey(resource.Id)] = resource
+	}
+
+	days := int(window.Hours() / 24)
+
+	var rv []PrivilegeRecommendation
+	for _, g := range grants {
+		ok, err := isPrivilegedRepositoryGrant(g)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		repositoryId := g.Entitlement.Resource.Id
+		userId := g.Principal.Id
+
+		repositoryActivity, ok := activity[repositoryId.Resource]
+		if !ok {
+			continue
+		}
+
+		_, permission, err := ParseEntitlementID(g.Entitlement.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		var recommended, reason string
+		switch {
+		case repositoryActivity.total(userId.Resource) == 0:
+			recommended = roleRead
+			reason = fmt.Sprintf("no commits or pull requests in the last %d days, downgrade to read", days)
+		case permission == roleAdmin:
+			recommended = roleWrite
+			reason = fmt.Sprintf("only commits and pull requests in the last %d days, which need write access; review whether admin access is still needed for the repository settings", days)
+		default:
+			continue
+		}
+
+		workspaceId := resourceWorkspace(byId, repositoryId)
+
+		rv = append(rv, PrivilegeRecommendation{
+			WorkspaceId:    workspaceId,
+			WorkspaceName:  resourceName(byId, &v2.ResourceId{ResourceType: resourceTypeWorkspace.Id, Resource: workspaceId}),
+			UserId:         userId.Resource,
+			UserName:       resourceName(byId, userId),
+			RepositoryId:   repositoryId.Resource,
+			RepositoryName: resourceName(byId, repositoryId),
+			Permission:     permission,
+			Recommended:    recommended,
+			Commits:        repositoryActivity.Commits[userId.Resource],
+			PullRequests:   repositoryActivity.PullRequests[userId.Resource],
+			Merges:         repositoryActivity.Merges[userId.Resource],
+			Reason:         reason,
+		})
+	}
+
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].WorkspaceId != rv[j].WorkspaceId {
+			return rv[i].WorkspaceId < rv[j].WorkspaceId
+		}
+		if rv[i].RepositoryId != rv[j].RepositoryId {
+			return rv[i].RepositoryId < rv[j].RepositoryId
+		}
+
+		return rv[i].UserId < rv[j].UserId
+	})
+
+	return rv, nil
+}
+
+// isPrivilegedRepositoryGrant reports whether the grant gives a user the admin or write role of a repository directly.
+func isPrivilegedRepositoryGrant(g *v2.Grant) (bool, error) {
+	if g.Entitlement.Resource.Id.ResourceType != resourceTypeRepository.Id || g.Principal.Id.ResourceType != resourceTypeUser.Id || !isDirect(g) {
+		return false, nil
+	}
+
+	_, slug, err := ParseEntitlementID(g.Entitlement.Id)
+	if err != nil {
+		return false, err
+	}
+
+	return slug == roleAdmin || slug == roleWrite, nil
+}
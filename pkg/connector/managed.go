@@ -0,0 +1,104 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/conductorone/baton-bitbucket/pkg/atlassian"
+)
+
+// managedGroups tells which user groups are managed by an identity provider, their membership is
+// restored by the next provisioning when changed in Bitbucket. These are the groups of the Atlassian
+// Access directory, which it syncs to Bitbucket under the same name, and the groups matching the
+// configured slug patterns, which mark groups the directory doesn't know about, e.g. when it is not
+// configured. The directory groups are loaded on first use and kept for the rest of the sync.
+type managedGroups struct {
+	// client is nil when no directory is configured
+	client   *atlassian.DirectoryClient
+	patterns []string
+	mtx      sync.Mutex
+	// names and slugs of the directory groups, nil until they are loaded
+	names map[string]struct{}
+	slugs map[string]struct{}
+}
+
+func newManagedGroups(client *atlassian.DirectoryClient, patterns []string) *managedGroups {
+	return &managedGroups{
+		client:   client,
+		patterns: patterns,
+	}
+}
+
+// Reset drops the loaded directory groups, so the next sync sees the groups provisioned meanwhile.
+func (m *managedGroups) Reset() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.names = nil
+	m.slugs = nil
+}
+
+// IsManaged reports whether the user group is managed outside of Bitbucket. The name is empty when
+// only the slug is known, e.g. in Grant, the group is then matched by the slug of the directory group.
+func (m *managedGroups) IsManaged(ctx context.Context, groupSlug, groupName string) (bool, error) {
+	for _, pattern := range m.patterns {
+		if matched, _ := path.Match(pattern, groupSlug); matched {
+			return true, nil
+		}
+	}
+
+	if m.client == nil {
+		return false, nil
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.names == nil {
+		groups, err := m.client.ListAllGroups(ctx)
+		if err != nil {
+			return false, fmt.Errorf("bitbucket-connector: failed to list directory groups: %w", err)
+		}
+
+		m.names = make(map[string]struct{}, len(groups))
+		m.slugs = make(map[string]struct{}, len(groups))
+		for _, group := range groups {
+			m.names[strings.ToLower(group.DisplayName)] = struct{}{}
+			m.slugs[userGroupSlug(group.DisplayName)] = struct{}{}
+		}
+	}
+
+	if _, ok := m.names[strings.ToLower(groupName)]; ok && groupName != "" {
+		return true, nil
+	}
+
+	_, ok := m.slugs[groupSlug]
+
+	return ok, nil
+}
+
+// userGroupSlug returns the slug Bitbucket derives from the name of a user group: lower case,
+// with every run of characters other than letters, digits and underscores replaced by a dash.
+func userGroupSlug(name string) string {
+	var b strings.Builder
+
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
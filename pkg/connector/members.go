@@ -0,0 +1,158 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+)
+
+// groupMembersTTL bounds how long the member list of a group is trusted by the Grant/Revoke
+// preflight, so memberships changed outside of the connector after a sync are picked up.
+const groupMembersTTL = 5 * time.Minute
+
+type groupMembers struct {
+	users     map[string]struct{}
+	expiresAt time.Time
+}
+
+// groupMembersFetch is a fetch of the member list of a group in flight, which concurrent lookups of the group wait for.
+type groupMembersFetch struct {
+	done    chan struct{}
+	members *groupMembers
+	err     error
+}
+
+// groupMemberCache keeps member lists of user groups for a short time, so the v1 members
+// endpoint is not hit again for every Grant/Revoke of a hot group. It is reset whenever
+// a new sync starts listing workspaces.
+type groupMemberCache struct {
+	client   BitbucketClient
+	mtx      sync.Mutex
+	members  map[string]*groupMembers
+	inFlight map[string]*groupMembersFetch
+}
+
+func newGroupMemberCache(client BitbucketClient) *groupMemberCache {
+	return &groupMemberCache{
+		client:   client,
+		members:  make(map[string]*groupMembers),
+		inFlight: make(map[string]*groupMembersFetch),
+	}
+}
+
+func groupMembersKey(workspaceId, groupSlug string) string {
+	return ComposedGroupId(workspaceId, groupSlug)
+}
+
+// Reset drops all cached member lists.
+func (c *groupMemberCache) Reset() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.members = make(map[string]*groupMembers)
+}
+
+// Store caches the members of a group which were just fetched, e.g. while listing groups.
+func (c *groupMemberCache) Store(workspaceId, groupSlug string, members []bitbucket.User) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.members[groupMembersKey(workspaceId, groupSlug)] = newGroupMembers(members)
+}
+
+// IsMember reports whether the user is a member of the group, fetching the members when they are
+// not cached or expired. The lock is not held during the fetch, concurrent lookups of the same group
+// share it instead.
+func (c *groupMemberCache) IsMember(ctx context.Context, workspaceId, groupSlug, userId string) (bool, error) {
+	key := groupMembersKey(workspaceId, groupSlug)
+
+	c.mtx.Lock()
+	members, ok := c.members[key]
+	if ok && time.Now().Before(members.expiresAt) {
+		_, isMember := members.users[userId]
+		c.mtx.Unlock()
+
+		return isMember, nil
+	}
+
+	fetch, fetching := c.inFlight[key]
+	if !fetching {
+		fetch = &groupMembersFetch{done: make(chan struct{})}
+		c.inFlight[key] = fetch
+	}
+	c.mtx.Unlock()
+
+	if !fetching {
+		c.fetch(ctx, key, workspaceId, groupSlug, fetch)
+	}
+
+	select {
+	case <-fetch.done:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+
+	if fetch.err != nil {
+		return false, fetch.err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	_, isMember := fetch.members.users[userId]
+
+	return isMember, nil
+}
+
+func (c *groupMemberCache) fetch(ctx context.Context, key, workspaceId, groupSlug string, fetch *groupMembersFetch) {
+	users, err := c.client.GetUserGroupMembers(ctx, workspaceId, groupSlug)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err != nil {
+		fetch.err = fmt.Errorf("bitbucket-connector: failed to get user group members: %w", err)
+	} else {
+		fetch.members = newGroupMembers(users)
+		c.members[key] = fetch.members
+	}
+
+	delete(c.inFlight, key)
+	close(fetch.done)
+}
+
+// Set records the result of a membership change, groups which are not cached are left alone.
+func (c *groupMemberCache) Set(workspaceId, groupSlug, userId string, isMember bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	members, ok := c.members[groupMembersKey(workspaceId, groupSlug)]
+	if !ok {
+		return
+	}
+
+	if isMember {
+		members.users[userId] = struct{}{}
+	} else {
+		delete(members.users, userId)
+	}
+}
+
+func newGroupMembers(users []bitbucket.User) *groupMembers {
+	return &groupMembers{
+		users:     memberSet(users),
+		expiresAt: time.Now().Add(groupMembersTTL),
+	}
+}
+
+func memberSet(users []bitbucket.User) map[string]struct{} {
+	rv := make(map[string]struct{}, len(users))
+	for _, user := range users {
+		rv[user.Id] = struct{}{}
+	}
+
+	return rv
+}
@@ -0,0 +1,144 @@
+package connector
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+// EntitlementTemplateData is passed to the entitlement display name and description templates.
+type EntitlementTemplateData struct {
+	// ResourceType is the display name of the resource type, e.g. Project.
+	ResourceType string
+	// Resource is the display name of the resource.
+	Resource string
+	// Entitlement is the entitlement slug, e.g. member or admin.
+	Entitlement string
+	// WorkspaceId is the identifier of the workspace the resource belongs to.
+	WorkspaceId string
+	// ProjectKey is the key of the project, empty for workspaces and user groups.
+	ProjectKey string
+	// Default is the text that would have been generated without a template.
+	Default string
+}
+
+// entitlementNames renders entitlement display names and descriptions from
+// configured templates. A nil value or an unset template keeps the defaults.
+type entitlementNames struct {
+	displayName *template.Template
+	description *template.Template
+}
+
+func newEntitlementNames(displayNameTemplate, descriptionTemplate string) (*entitlementNames, error) {
+	displayName, err := parseEntitlementTemplate("display-name", displayNameTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	description, err := parseEntitlementTemplate("description", descriptionTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entitlementNames{
+		displayName: displayName,
+		description: description,
+	}, nil
+}
+
+func parseEntitlementTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket-connector: invalid entitlement %s template: %w", name, err)
+	}
+
+	// execute the template once so that references to unknown fields fail on startup
+	err = t.Execute(&strings.Builder{}, EntitlementTemplateData{})
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket-connector: invalid entitlement %s template: %w", name, err)
+	}
+
+	return t, nil
+}
+
+// DisplayName returns the display name of the entitlement, falling back to provided default.
+func (n *entitlementNames) DisplayName(resource *v2.Resource, entitlement string, defaultName string) string {
+	if n == nil {
+		return defaultName
+	}
+
+	return render(n.displayName, resource, entitlement, defaultName)
+}
+
+// Description returns the description of the entitlement, falling back to provided default.
+func (n *entitlementNames) Description(resource *v2.Resource, entitlement string, defaultDescription string) string {
+	if n == nil {
+		return defaultDescription
+	}
+
+	return render(n.description, resource, entitlement, defaultDescription)
+}
+
+func render(t *template.Template, resource *v2.Resource, entitlement string, defaultText string) string {
+	if t == nil {
+		return defaultText
+	}
+
+	var out strings.Builder
+	err := t.Execute(&out, entitlementTemplateData(resource, entitlement, defaultText))
+	if err != nil {
+		return defaultText
+	}
+
+	return out.String()
+}
+
+func entitlementTemplateData(resource *v2.Resource, entitlement string, defaultText string) EntitlementTemplateData {
+	data := EntitlementTemplateData{
+		Resource:    resource.DisplayName,
+		Entitlement: entitlement,
+		Default:     defaultText,
+	}
+
+	id := resource.Id.Resource
+	switch resource.Id.ResourceType {
+	case resourceTypeWorkspace.Id:
+		data.ResourceType = resourceTypeWorkspace.DisplayName
+		data.WorkspaceId = id
+
+	case resourceTypeUserGroup.Id:
+		data.ResourceType = resourceTypeUserGroup.DisplayName
+		if _, err := rs.GetRoleTrait(resource); err == nil {
+			data.ResourceType = resourceTypeUserGroupRole.DisplayName
+		}
+		data.WorkspaceId, _, _ = DecomposeGroupId(id)
+
+	case resourceTypeProject.Id:
+		data.ResourceType = resourceTypeProject.DisplayName
+		data.WorkspaceId, _, data.ProjectKey, _ = DecomposeProjectId(id)
+
+	case resourceTypeRepository.Id:
+		data.ResourceType = resourceTypeRepository.DisplayName
+		projectId, _, err := DecomposeRepositoryId(id)
+		if err == nil {
+			data.WorkspaceId, _, data.ProjectKey, _ = DecomposeProjectId(projectId)
+		}
+
+	case resourceTypeEnvironment.Id:
+		data.ResourceType = resourceTypeEnvironment.DisplayName
+		repositoryId, _, err := DecomposeEnvironmentId(id)
+		if err == nil {
+			projectId, _, _ := DecomposeRepositoryId(repositoryId)
+			data.WorkspaceId, _, data.ProjectKey, _ = DecomposeProjectId(projectId)
+		}
+	}
+
+	return data
+}
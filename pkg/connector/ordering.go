@@ -0,0 +1,32 @@
+package connector
+
+import (
+	"cmp"
+	"slices"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+// The Bitbucket API doesn't guarantee the order of the listed items, so every page returned
+// by the syncers is sorted by ID and two syncs of unchanged data produce the same pages.
+
+func sortResources(resources []*v2.Resource) {
+	slices.SortStableFunc(resources, func(a, b *v2.Resource) int {
+		return cmp.Or(
+			cmp.Compare(a.GetId().GetResourceType(), b.GetId().GetResourceType()),
+			cmp.Compare(a.GetId().GetResource(), b.GetId().GetResource()),
+		)
+	})
+}
+
+func sortEntitlements(entitlements []*v2.Entitlement) {
+	slices.SortStableFunc(entitlements, func(a, b *v2.Entitlement) int {
+		return cmp.Compare(a.GetId(), b.GetId())
+	})
+}
+
+func sortGrants(grants []*v2.Grant) {
+	slices.SortStableFunc(grants, func(a, b *v2.Grant) int {
+		return cmp.Compare(a.GetId(), b.GetId())
+	})
+}
@@ -0,0 +1,203 @@
+package connector
+
+import (
+	"sort"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+// Reasons a grant is reported as orphaned.
+const (
+	// OrphanUnknownUser is a user which was not listed by the sync at all.
+	OrphanUnknownUser = "unknown_user"
+	// OrphanExternalCollaborator is a user with repository permissions which never was a workspace member.
+	OrphanExternalCollaborator = "external_collaborator"
+	// OrphanNotMember is a user which is not a member of the workspace anymore.
+	OrphanNotMember = "not_a_member"
+	// OrphanDisabled is a member whose account is deactivated.
+	OrphanDisabled = "disabled"
+)
+
+// OrphanedGrant is a grant held by a user which is not an active member of the workspace of the resource.
+type OrphanedGrant struct {
+	Reason        string `json:"reason"`
+	WorkspaceId   string `json:"workspace_id"`
+	WorkspaceName string `json:"workspace_name"`
+	PrincipalId   string `json:"principal_id"`
+	PrincipalName string `json:"principal_name"`
+	Entitlement   string `json:"entitlement"`
+	ResourceType  string `json:"resource_type"`
+	ResourceId    string `json:"resource_id"`
+	ResourceName  string `json:"resource_name"`
+}
+
+// FindOrphanedGrants returns the grants of a sync held by users which left the workspace of the resource,
+// never joined it, or whose account is deactivated, sorted by workspace, user and resource. Only grants
+// which can be revoked are considered: immutable grants and grants expanded from user groups follow the
+// grants they derive from.
+func FindOrphanedGrants(resources []*v2.Resource, grants []*v2.Grant) ([]OrphanedGrant, error) {
+	byId := make(map[string]*v2.Resource, len(resources))
+	for _, resource := range resources {
+		byId[resourceKey(resource.Id)] = resource
+	}
+
+	// the workspace members are the principals of the member grants of the workspaces
+	members := make(map[string]map[string]struct{})
+	for _, g := range grants {
+		resourceId := g.Entitlement.Resource.Id
+		if resourceId.ResourceType != resourceTypeWorkspace.Id || g.Principal.Id.ResourceType != resourceTypeUser.Id {
+			continue
+		}
+
+		_, slug, err := ParseEntitlementID(g.Entitlement.Id)
+		if err != nil {
+			return nil, err
+		}
+		if slug != memberEntitlement {
+			continue
+		}
+
+		if members[resourceId.Resource] == nil {
+			members[resourceId.Resource] = make(map[string]struct{})
+		}
+		members[resourceId.Resource][g.Principal.Id.Resource] = struct{}{}
+	}
+
+	var rv []OrphanedGrant
+	for _, g := range grants {
+		principalId := g.Principal.Id
+		resourceId := g.Entitlement.Resource.Id
+		if principalId.ResourceType != resourceTypeUser.Id || !isRevocable(g) {
+			continue
+		}
+
+		workspaceId := resourceWorkspace(byId, resourceId)
+
+		user, listed := byId[resourceKey(principalId)]
+		_, isMember := members[workspaceId][principalId.Resource]
+
+		var reason string
+		switch {
+		case !listed:
+			reason = OrphanUnknownUser
+		case workspaceId != "" && !isMember && isExternalCollaborator(user):
+			reason = OrphanExternalCollaborator
+		case workspaceId != "" && !isMember:
+			reason = OrphanNotMember
+		case !isEnabled(user):
+			reason = OrphanDisabled
+		default:
+			continue
+		}
+
+		_, slug, err := ParseEntitlementID(g.Entitlement.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		rv = append(rv, OrphanedGrant{
+			Reason:        reason,
+			WorkspaceId:   workspaceId,
+			WorkspaceName: resourceName(byId, &v2.ResourceId{ResourceType: resourceTypeWorkspace.Id, Resource: workspaceId}),
+			PrincipalId:   principalId.Resource,
+			PrincipalName: resourceName(byId, principalId),
+			Entitlement:   slug,
+			ResourceType:  resourceId.ResourceType,
+			ResourceId:    resourceId.Resource,
+			ResourceName:  resourceName(byId, resourceId),
+		})
+	}
+
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].WorkspaceId != rv[j].WorkspaceId {
+			return rv[i].WorkspaceId < rv[j].WorkspaceId
+		}
+		if rv[i].PrincipalId != rv[j].PrincipalId {
+			return rv[i].PrincipalId < rv[j].PrincipalId
+		}
+		if rv[i].ResourceType != rv[j].ResourceType {
+			return rv[i].ResourceType < rv[j].ResourceType
+		}
+		if rv[i].ResourceId != rv[j].ResourceId {
+			return rv[i].ResourceId < rv[j].ResourceId
+		}
+
+		return rv[i].Entitlement < rv[j].Entitlement
+	})
+
+	return rv, nil
+}
+
+func resourceKey(id *v2.ResourceId) string {
+	return id.ResourceType + "/" + id.Resource
+}
+
+func resourceName(byId map[string]*v2.Resource, id *v2.ResourceId) string {
+	resource, ok := byId[resourceKey(id)]
+	if !ok {
+		return ""
+	}
+
+	return resource.DisplayName
+}
+
+// resourceWorkspace returns the UUID of the workspace the resource belongs to, empty when it is unknown.
+func resourceWorkspace(byId map[string]*v2.Resource, id *v2.ResourceId) string {
+	for id != nil {
+		if id.ResourceType == resourceTypeWorkspace.Id {
+			return id.Resource
+		}
+
+		resource, ok := byId[resourceKey(id)]
+		if !ok {
+			return ""
+		}
+
+		id = resource.ParentResourceId
+	}
+
+	return ""
+}
+
+// isRevocable reports whether the grant can be revoked, rather than derived from another grant.
+func isRevocable(g *v2.Grant) bool {
+	annos := annotations.Annotations(g.Annotations)
+	if annos.Contains(&v2.GrantImmutable{}) {
+		return false
+	}
+
+	return isDirect(g)
+}
+
+// isDirect reports whether the grant was read from Bitbucket, rather than expanded by the sync.
+func isDirect(g *v2.Grant) bool {
+	// expanded grants are sourced from the entitlements of user groups instead of their own
+	sources := g.GetSources().GetSources()
+	if len(sources) == 0 {
+		return true
+	}
+
+	_, direct := sources[g.Entitlement.Id]
+
+	return direct
+}
+
+func isEnabled(user *v2.Resource) bool {
+	trait, err := rs.GetUserTrait(user)
+	if err != nil {
+		return true
+	}
+
+	return trait.GetStatus().GetStatus() != v2.UserTrait_Status_STATUS_DISABLED
+}
+
+func isExternalCollaborator(user *v2.Resource) bool {
+	trait, err := rs.GetUserTrait(user)
+	if err != nil {
+		return false
+	}
+
+	return trait.GetProfile().GetFields()["external_collaborator"].GetBoolValue()
+}
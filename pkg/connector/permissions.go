@@ -0,0 +1,192 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+const permissionCacheTTL = 5 * time.Minute
+
+type permissionSet struct {
+	users     map[string]string
+	groups    map[string]string
+	expiresAt time.Time
+}
+
+// permissionCache keeps the full permission listings of projects and repositories,
+// so bulk Grant/Revoke operations against the same object share a single lookup
+// instead of fetching the principal permission before every write.
+type permissionCache struct {
+	client BitbucketClient
+	mtx    sync.Mutex
+	sets   map[string]*permissionSet
+}
+
+func newPermissionCache(client BitbucketClient) *permissionCache {
+	return &permissionCache{
+		client: client,
+		sets:   make(map[string]*permissionSet),
+	}
+}
+
+func projectPermissionsKey(workspaceId, projectKey string) string {
+	return fmt.Sprintf("project:%s:%s", workspaceId, projectKey)
+}
+
+func repositoryPermissionsKey(workspaceId, repoId string) string {
+	return fmt.Sprintf("repository:%s:%s", workspaceId, repoId)
+}
+
+// principalKey returns identifier under which Bitbucket lists permissions of given principal.
+func principalKey(principal *v2.Resource) (bool, string, error) {
+	switch principal.Id.ResourceType {
+	case resourceTypeUser.Id:
+		return false, principal.Id.Resource, nil
+	case resourceTypeUserGroup.Id:
+		_, groupSlug, err := DecomposeGroupId(principal.Id.Resource)
+		if err != nil {
+			return false, "", err
+		}
+
+		return true, groupSlug, nil
+	default:
+		return false, "", fmt.Errorf("bitbucket-connector: invalid principal resource type: %s", principal.Id.ResourceType)
+	}
+}
+
+// ProjectPermission returns permission the principal holds under provided project.
+func (pc *permissionCache) ProjectPermission(ctx context.Context, workspaceId, projectKey string, principal *v2.Resource) (string, error) {
+	return pc.lookup(ctx, projectPermissionsKey(workspaceId, projectKey), principal, func(set *permissionSet) error {
+		err := pc.client.ForEachProjectUserPermission(ctx, workspaceId, projectKey, func(permission bitbucket.UserPermission) error {
+			set.users[permission.User.Id] = permission.Value
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("bitbucket-connector: failed to list project user permissions: %w", err)
+		}
+
+		err = pc.client.ForEachProjectGroupPermission(ctx, workspaceId, projectKey, func(permission bitbucket.GroupPermission) error {
+			set.groups[permission.Group.Slug] = permission.Value
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("bitbucket-connector: failed to list project group permissions: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// RepositoryPermission returns permission the principal holds under provided repository.
+func (pc *permissionCache) RepositoryPermission(ctx context.Context, workspaceId, repoId string, principal *v2.Resource) (string, error) {
+	return pc.lookup(ctx, repositoryPermissionsKey(workspaceId, repoId), principal, func(set *permissionSet) error {
+		err := pc.client.ForEachRepositoryUserPermission(ctx, workspaceId, repoId, func(permission bitbucket.UserPermission) error {
+			set.users[permission.User.Id] = permission.Value
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("bitbucket-connector: failed to list repository user permissions: %w", err)
+		}
+
+		err = pc.client.ForEachRepositoryGroupPermission(ctx, workspaceId, repoId, func(permission bitbucket.GroupPermission) error {
+			set.groups[permission.Group.Slug] = permission.Value
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("bitbucket-connector: failed to list repository group permissions: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (pc *permissionCache) lookup(ctx context.Context, key string, principal *v2.Resource, load func(set *permissionSet) error) (string, error) {
+	isGroup, id, err := principalKey(principal)
+	if err != nil {
+		return "", err
+	}
+
+	pc.mtx.Lock()
+	set, ok := pc.sets[key]
+	pc.mtx.Unlock()
+
+	if !ok || time.Now().After(set.expiresAt) {
+		set = &permissionSet{
+			users:     make(map[string]string),
+			groups:    make(map[string]string),
+			expiresAt: time.Now().Add(permissionCacheTTL),
+		}
+
+		err = load(set)
+		if err != nil {
+			return "", err
+		}
+
+		pc.mtx.Lock()
+		pc.sets[key] = set
+		pc.mtx.Unlock()
+	}
+
+	pc.mtx.Lock()
+	defer pc.mtx.Unlock()
+
+	permissions := set.users
+	if isGroup {
+		permissions = set.groups
+	}
+
+	if permission, ok := permissions[id]; ok {
+		return permission, nil
+	}
+
+	return roleNone, nil
+}
+
+// Reset drops all cached permissions.
+func (pc *permissionCache) Reset() {
+	pc.mtx.Lock()
+	defer pc.mtx.Unlock()
+
+	pc.sets = make(map[string]*permissionSet)
+}
+
+// Set records the permission after a successful write, roleNone removes the entry.
+func (pc *permissionCache) Set(key string, principal *v2.Resource, permission string) {
+	isGroup, id, err := principalKey(principal)
+	if err != nil {
+		return
+	}
+
+	pc.mtx.Lock()
+	defer pc.mtx.Unlock()
+
+	set, ok := pc.sets[key]
+	if !ok {
+		return
+	}
+
+	permissions := set.users
+	if isGroup {
+		permissions = set.groups
+	}
+
+	if permission == roleNone {
+		delete(permissions, id)
+		return
+	}
+
+	permissions[id] = permission
+}
+
+// Invalidate drops the cached permissions, e.g. after writes made outside of Grant/Revoke.
+func (pc *permissionCache) Invalidate(key string) {
+	pc.mtx.Lock()
+	defer pc.mtx.Unlock()
+
+	delete(pc.sets, key)
+}
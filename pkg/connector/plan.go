@@ -0,0 +1,159 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// workspacePlan is the plan of a workspace as far as the connector can tell.
+type workspacePlan int
+
+const (
+	// planUnknown is the plan of a workspace none of whose project permissions the credentials can read.
+	planUnknown workspacePlan = iota
+	planStandard
+	planPremium
+)
+
+// workspacePlans remembers which workspaces are on the Premium plan. The plan is
+// not exposed by the API, so it is detected by probing the project permissions
+// endpoint once per workspace. It is reset whenever a new sync starts listing workspaces,
+// so a changed plan is picked up by the next sync.
+type workspacePlans struct {
+	client BitbucketClient
+	mtx    sync.Mutex
+	plans  map[string]workspacePlan
+}
+
+func newWorkspacePlans(client BitbucketClient) *workspacePlans {
+	return &workspacePlans{
+		client: client,
+		plans:  make(map[string]workspacePlan),
+	}
+}
+
+// Reset forgets the detected plans.
+func (wp *workspacePlans) Reset() {
+	wp.mtx.Lock()
+	defer wp.mtx.Unlock()
+
+	wp.plans = make(map[string]workspacePlan)
+}
+
+// IsPremium reports whether the workspace is known to support premium-only features, the project
+// is used to probe the project permissions endpoint.
+func (wp *workspacePlans) IsPremium(ctx context.Context, workspaceId, projectKey string) (bool, error) {
+	plan, err := wp.Plan(ctx, workspaceId, projectKey)
+	if err != nil {
+		return false, err
+	}
+
+	return plan == planPremium, nil
+}
+
+// Plan returns the plan of the workspace, the project is probed first.
+func (wp *workspacePlans) Plan(ctx context.Context, workspaceId, projectKey string) (workspacePlan, error) {
+	wp.mtx.Lock()
+	plan, ok := wp.plans[workspaceId]
+	wp.mtx.Unlock()
+
+	if ok {
+		return plan, nil
+	}
+
+	// concurrent callers may probe the same workspace, which is cheaper than serializing the probes
+	plan, err := wp.detect(ctx, workspaceId, projectKey)
+	if err != nil {
+		return planUnknown, fmt.Errorf("bitbucket-connector: failed to detect workspace plan: %w", err)
+	}
+
+	l := ctxzap.Extract(ctx)
+	switch plan {
+	case planStandard:
+		l.Info(
+			"bitbucket-connector: workspace is not on the Premium plan, skipping project roles and permission grants",
+			zap.String("workspace_id", workspaceId),
+		)
+	case planUnknown:
+		l.Warn(
+			"bitbucket-connector: the credentials can't read the permissions of any project, skipping project roles and permission grants",
+			zap.String("workspace_id", workspaceId),
+		)
+	}
+
+	wp.mtx.Lock()
+	wp.plans[workspaceId] = plan
+	wp.mtx.Unlock()
+
+	return plan, nil
+}
+
+// detect probes the permissions of the project, and of the other projects of the workspace while the
+// credentials are denied access to them, as a denial only tells the credentials are not project admins.
+func (wp *workspacePlans) detect(ctx context.Context, workspaceId, projectKey string) (workspacePlan, error) {
+	plan, err := wp.probe(ctx, workspaceId, projectKey)
+	if !errors.Is(err, bitbucket.ErrPermissionDenied) {
+		return plan, err
+	}
+
+	page := ""
+	for {
+		projects, nextToken, err := wp.client.GetWorkspaceProjects(ctx, workspaceId, bitbucket.PaginationVars{
+			Limit: ResourcesPageSize,
+			Page:  page,
+		})
+		if err != nil {
+			return planUnknown, err
+		}
+
+		for _, project := range projects {
+			if project.Key == projectKey {
+				continue
+			}
+
+			plan, err := wp.probe(ctx, workspaceId, project.Key)
+			if errors.Is(err, bitbucket.ErrPermissionDenied) {
+				continue
+			}
+
+			return plan, err
+		}
+
+		if nextToken == "" {
+			return planUnknown, nil
+		}
+		page = nextToken
+	}
+}
+
+func (wp *workspacePlans) probe(ctx context.Context, workspaceId, projectKey string) (workspacePlan, error) {
+	premium, err := wp.client.HasProjectPermissions(ctx, workspaceId, projectKey)
+	if err != nil {
+		return planUnknown, err
+	}
+
+	if !premium {
+		return planStandard, nil
+	}
+
+	return planPremium, nil
+}
+
+// premiumRequiredError explains why a project role, e.g. create-repo, can't be granted or revoked. It
+// is a failed precondition, so the grant or revoke is reported as such instead of being retried.
+func premiumRequiredError(workspaceId, role string) error {
+	return status.Errorf(
+		codes.FailedPrecondition,
+		"bitbucket-connector: project role %s can only be managed in workspaces on the Premium plan, workspace %s is on a lower plan",
+		role,
+		workspaceId,
+	)
+}
@@ -0,0 +1,92 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrUserNotInWorkspace is returned by Grant when the user is not a member of the workspace of the entitlement,
+	// it is reported as a failed precondition.
+	ErrUserNotInWorkspace = errors.New("user not in workspace")
+	// ErrGroupNotFound is returned by Grant when the user group doesn't exist in the workspace of the entitlement,
+	// it is reported as not found.
+	ErrGroupNotFound = errors.New("user group not found")
+)
+
+// isUUID reports whether the identifier is a Bitbucket UUID, which are wrapped in curly braces.
+func isUUID(identifier string) bool {
+	return strings.HasPrefix(identifier, "{") && strings.HasSuffix(identifier, "}")
+}
+
+// resolvePrincipal replaces the identifier of a user principal which is not a UUID, e.g. the email,
+// nickname or Atlassian account ID a provisioning request arrived with, by the UUID of the matching
+// member of the workspace. Other principals are returned as they are.
+func resolvePrincipal(ctx context.Context, client BitbucketClient, workspaceId string, principal *v2.Resource) (*v2.Resource, error) {
+	if principal.Id.ResourceType != resourceTypeUser.Id || isUUID(principal.Id.Resource) {
+		return principal, nil
+	}
+
+	user, err := client.FindWorkspaceMember(ctx, workspaceId, principal.Id.Resource)
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket-connector: failed to resolve user %s: %w", principal.Id.Resource, err)
+	}
+
+	ctxzap.Extract(ctx).Debug(
+		"bitbucket-connector: resolved user principal",
+		zap.String("identifier", principal.Id.Resource),
+		zap.String("user_id", user.Id),
+	)
+
+	resolved, ok := proto.Clone(principal).(*v2.Resource)
+	if !ok {
+		return nil, fmt.Errorf("bitbucket-connector: failed to copy principal %s", principal.Id.Resource)
+	}
+	resolved.Id.Resource = user.Id
+
+	return resolved, nil
+}
+
+// checkPrincipal verifies the principal of a grant exists in the workspace, so a failed grant
+// explains why instead of surfacing the opaque 404 of the write. It runs even when the preflight
+// is skipped, as it validates the principal instead of reading its current access.
+func checkPrincipal(ctx context.Context, client BitbucketClient, workspaceId string, principal *v2.Resource) error {
+	switch principal.Id.ResourceType {
+	case resourceTypeUser.Id:
+		_, err := client.GetWorkspaceMember(ctx, workspaceId, principal.Id.Resource)
+		if errors.Is(err, bitbucket.ErrNotFound) {
+			return fmt.Errorf("bitbucket-connector: %w: %s is not a member of workspace %s", ErrUserNotInWorkspace, principal.Id.Resource, workspaceId)
+		}
+		if err != nil {
+			return fmt.Errorf("bitbucket-connector: failed to get workspace member: %w", err)
+		}
+
+	case resourceTypeUserGroup.Id:
+		groupWorkspaceId, groupSlug, err := DecomposeGroupId(principal.Id.Resource)
+		if err != nil {
+			return err
+		}
+
+		if groupWorkspaceId != workspaceId {
+			return fmt.Errorf("bitbucket-connector: %w: %s belongs to workspace %s instead of %s", ErrGroupNotFound, groupSlug, groupWorkspaceId, workspaceId)
+		}
+
+		_, err = client.GetUserGroupMembers(ctx, workspaceId, groupSlug)
+		if errors.Is(err, bitbucket.ErrNotFound) {
+			return fmt.Errorf("bitbucket-connector: %w: %s doesn't exist in workspace %s", ErrGroupNotFound, groupSlug, workspaceId)
+		}
+		if err != nil {
+			return fmt.Errorf("bitbucket-connector: failed to get user group members: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -28,8 +29,17 @@ const (
 var projectPermissions = []string{roleRead, roleWrite, roleCreate, roleAdmin}
 
 type projectResourceType struct {
-	resourceType *v2.ResourceType
-	client       *bitbucket.Client
+	resourceType  *v2.ResourceType
+	client        BitbucketClient
+	permissions   *permissionCache
+	repos         *projectRepoCache
+	retry         *retryPolicy
+	skipPreflight bool
+	// skipRepoGrants disables the repository membership grants,
+	// repositories are still linked to the project as its children.
+	skipRepoGrants bool
+	names          *entitlementNames
+	plans          *workspacePlans
 }
 
 func (p *projectResourceType) ResourceType(_ context.Context) *v2.ResourceType {
@@ -37,27 +47,52 @@ func (p *projectResourceType) ResourceType(_ context.Context) *v2.ResourceType {
 }
 
 func ComposeProjectId(workspaceId string, projectId string, key string) string {
-	return fmt.Sprintf("%s:%s:%s", workspaceId, projectId, key)
+	return encodeResourceId(workspaceId, projectId, key)
 }
 
 func DecomposeProjectId(id string) (string, string, string, error) {
-	parts := strings.Split(id, ":")
-	if len(parts) != 3 {
-		return "", "", "", fmt.Errorf("bitbucket-connector: invalid project resource id")
+	segments, err := decodeResourceId(id, 3)
+	if err != nil {
+		return "", "", "", fmt.Errorf("bitbucket-connector: invalid project resource id: %w", err)
 	}
 
-	// We need to split the project id into workspace and project id
-	return parts[0], parts[1], parts[2], nil
+	return segments[0], segments[1], segments[2], nil
 }
 
 // Create a new connector resource for an Bitbucket Project.
-func projectResource(ctx context.Context, project *bitbucket.Project, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+func projectResource(ctx context.Context, project *bitbucket.Project, parentResourceID *v2.ResourceId, branchingModel *bitbucket.BranchingModel) (*v2.Resource, error) {
 	profile := map[string]interface{}{
 		"project_id":   project.Id,
 		"project_name": project.Name,
 		"project_key":  project.Key,
 	}
 
+	if branchingModel != nil {
+		if branch := branchingModel.Development; branch != nil {
+			profile["project_development_branch"] = branch.Name
+			profile["project_development_branch_is_main"] = branch.UseMainBranch
+		}
+
+		// production branch can be disabled in the branching model
+		if branch := branchingModel.Production; branch != nil && (branch.Enabled == nil || *branch.Enabled) {
+			profile["project_production_branch"] = branch.Name
+			profile["project_production_branch_is_main"] = branch.UseMainBranch
+		}
+
+		var prefixes []string
+		for _, branchType := range branchingModel.BranchTypes {
+			if branchType.Enabled != nil && !*branchType.Enabled {
+				continue
+			}
+
+			prefixes = append(prefixes, fmt.Sprintf("%s=%s", branchType.Kind, branchType.Prefix))
+		}
+
+		if len(prefixes) > 0 {
+			profile["project_branch_prefixes"] = strings.Join(prefixes, ",")
+		}
+	}
+
 	resource, err := rs.NewGroupResource(
 		project.Name,
 		resourceTypeProject,
@@ -110,7 +145,17 @@ func (p *projectResourceType) List(ctx context.Context, parentId *v2.ResourceId,
 	for _, project := range projects {
 		projectCopy := project
 
-		pr, err := projectResource(ctx, &projectCopy, parentId)
+		branchingModel, err := p.client.GetProjectBranchingModel(ctx, parentId.Resource, projectCopy.Key)
+		if err != nil {
+			// the branching model is optional information, so missing access only skips it
+			if !errors.Is(err, bitbucket.ErrPermissionDenied) && !errors.Is(err, bitbucket.ErrNotFound) {
+				return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to get project branching model: %w", err)
+			}
+
+			branchingModel = nil
+		}
+
+		pr, err := projectResource(ctx, &projectCopy, parentId, branchingModel)
 		if err != nil {
 			return nil, "", nil, err
 		}
@@ -122,26 +167,45 @@ func (p *projectResourceType) List(ctx context.Context, parentId *v2.ResourceId,
 }
 
 func (p *projectResourceType) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	workspaceId, _, projectKey, err := DecomposeProjectId(resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	premium, err := p.plans.IsPremium(ctx, workspaceId, projectKey)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
 	var rv []*v2.Entitlement
-	assignmentOptions := []ent.EntitlementOption{
-		ent.WithGrantableTo(resourceTypeRepository),
-		ent.WithDisplayName(fmt.Sprintf("%s Project %s", resource.DisplayName, repoEntitlement)),
-		ent.WithDescription(fmt.Sprintf("Access to %s project in Bitbucket", resource.DisplayName)),
+
+	// create membership entitlement, repositories are moved between projects in Bitbucket so Grant rejects it
+	if !p.skipRepoGrants {
+		assignmentOptions := []ent.EntitlementOption{
+			ent.WithGrantableTo(resourceTypeRepository),
+			ent.WithDisplayName(p.names.DisplayName(resource, repoEntitlement, fmt.Sprintf("%s Project %s", resource.DisplayName, repoEntitlement))),
+			ent.WithDescription(p.names.Description(resource, repoEntitlement, fmt.Sprintf("Access to %s project in Bitbucket", resource.DisplayName))),
+			ent.WithAnnotation(&v2.EntitlementImmutable{}),
+		}
+
+		rv = append(rv, ent.NewAssignmentEntitlement(
+			resource,
+			repoEntitlement,
+			assignmentOptions...,
+		))
 	}
 
-	// create membership entitlement
-	rv = append(rv, ent.NewAssignmentEntitlement(
-		resource,
-		repoEntitlement,
-		assignmentOptions...,
-	))
+	// project roles are only available on the Premium plan
+	if !premium {
+		return rv, "", nil, nil
+	}
 
 	// create entitlements for each project role (read, write, create, admin)
 	for _, permission := range projectPermissions {
 		permissionOptions := []ent.EntitlementOption{
 			ent.WithGrantableTo(resourceTypeUser, resourceTypeUserGroup),
-			ent.WithDisplayName(fmt.Sprintf("%s Project %s", resource.DisplayName, permission)),
-			ent.WithDescription(fmt.Sprintf("%s access to %s project in Bitbucket", titleCase(permission), resource.DisplayName)),
+			ent.WithDisplayName(p.names.DisplayName(resource, permission, fmt.Sprintf("%s Project %s", resource.DisplayName, permission))),
+			ent.WithDescription(p.names.Description(resource, permission, fmt.Sprintf("%s access to %s project in Bitbucket", titleCase(permission), resource.DisplayName))),
 		}
 
 		rv = append(rv, ent.NewPermissionEntitlement(
@@ -169,30 +233,54 @@ func (p *projectResourceType) Grants(ctx context.Context, resource *v2.Resource,
 
 	switch bag.ResourceTypeID() {
 	case resourceTypeProject.Id:
+		premium, err := p.plans.IsPremium(ctx, workspaceId, projectKey)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
 		bag.Pop()
-		bag.Push(pagination.PageState{
-			ResourceTypeID: resourceTypeRepository.Id,
-		})
-		bag.Push(pagination.PageState{
-			ResourceTypeID: resourceTypeUserGroup.Id,
-		})
-		bag.Push(pagination.PageState{
-			ResourceTypeID: resourceTypeUser.Id,
-		})
+		if !p.skipRepoGrants {
+			bag.Push(pagination.PageState{
+				ResourceTypeID: resourceTypeRepository.Id,
+			})
+		}
+		if premium {
+			bag.Push(pagination.PageState{
+				ResourceTypeID: resourceTypeUserGroup.Id,
+			})
+			bag.Push(pagination.PageState{
+				ResourceTypeID: resourceTypeUser.Id,
+			})
+		}
 
 	// create a membership grant for each repository in the project
 	case resourceTypeRepository.Id:
-		repos, nextToken, err := p.client.GetProjectRepos(
-			ctx,
-			workspaceId,
-			projectId,
-			bitbucket.PaginationVars{
-				Limit: ResourcesPageSize,
-				Page:  bag.PageToken(),
-			},
-		)
-		if err != nil {
-			return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to list project repositories: %w", err)
+		// the repository listing usually read every repository of the project already
+		var repoIds []string
+		var nextToken string
+		cached := false
+		if bag.PageToken() == "" {
+			repoIds, cached = p.repos.ProjectRepoIds(workspaceId, projectId)
+		}
+
+		if !cached {
+			repos, next, err := p.client.GetProjectRepos(
+				ctx,
+				workspaceId,
+				projectId,
+				bitbucket.PaginationVars{
+					Limit: ResourcesPageSize,
+					Page:  bag.PageToken(),
+				},
+			)
+			if err != nil {
+				return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to list project repositories: %w", err)
+			}
+
+			for _, repo := range repos {
+				repoIds = append(repoIds, repo.Id)
+			}
+			nextToken = next
 		}
 
 		err = bag.Next(nextToken)
@@ -200,19 +288,18 @@ func (p *projectResourceType) Grants(ctx context.Context, resource *v2.Resource,
 			return nil, "", nil, err
 		}
 
-		for _, repo := range repos {
-			repoCopy := repo
-			rr, err := repositoryResource(ctx, &repoCopy, &v2.ResourceId{Resource: resource.Id.Resource})
-			if err != nil {
-				return nil, "", nil, err
-			}
-
+		for _, repoId := range repoIds {
 			rv = append(
 				rv,
 				grant.NewGrant(
 					resource,
 					repoEntitlement,
-					rr.Id,
+					&v2.ResourceId{
+						ResourceType: resourceTypeRepository.Id,
+						Resource:     ComposeRepositoryId(resource.Id.Resource, repoId),
+					},
+					grantSource("/2.0/repositories/{workspace}", grantSourceDirect, repoEntitlement),
+					grant.WithAnnotation(&v2.GrantImmutable{}),
 				),
 			)
 		}
@@ -243,19 +330,16 @@ func (p *projectResourceType) Grants(ctx context.Context, resource *v2.Resource,
 				continue
 			}
 
-			groupCopy := permission.Group
-
-			gr, err := userGroupResource(ctx, &groupCopy, &v2.ResourceId{Resource: workspaceId})
-			if err != nil {
-				return nil, "", nil, err
-			}
+			groupId := userGroupResourceId(workspaceId, permission.Group.Slug)
 
 			rv = append(
 				rv,
 				grant.NewGrant(
 					resource,
 					permission.Value,
-					gr.Id,
+					groupId,
+					groupMembersExpandable(groupId),
+					grantSource("/2.0/workspaces/{workspace}/projects/{project_key}/permissions-config/groups", grantSourceGroup, permission.Value),
 				),
 			)
 		}
@@ -286,9 +370,7 @@ func (p *projectResourceType) Grants(ctx context.Context, resource *v2.Resource,
 				continue
 			}
 
-			userCopy := permission.User
-
-			ur, err := userResource(ctx, &userCopy, &v2.ResourceId{Resource: workspaceId})
+			userId, err := rs.NewResourceID(resourceTypeUser, permission.User.Id)
 			if err != nil {
 				return nil, "", nil, err
 			}
@@ -298,7 +380,8 @@ func (p *projectResourceType) Grants(ctx context.Context, resource *v2.Resource,
 				grant.NewGrant(
 					resource,
 					permission.Value,
-					ur.Id,
+					userId,
+					grantSource("/2.0/workspaces/{workspace}/projects/{project_key}/permissions-config/users", grantSourceDirect, permission.Value),
 				),
 			)
 		}
@@ -316,33 +399,44 @@ func (p *projectResourceType) Grants(ctx context.Context, resource *v2.Resource,
 }
 
 func (p *projectResourceType) GetPermission(ctx context.Context, principal *v2.Resource, workspaceId, projectKey string) (*bitbucket.Permission, error) {
-	if principal.Id.ResourceType == resourceTypeUser.Id {
-		userPermission, err := p.client.GetProjectUserPermission(
-			ctx,
-			workspaceId,
-			projectKey,
-			principal.Id.Resource,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("bitbucket-connector: failed to get project user permission: %w", err)
-		}
+	permission, err := p.permissions.ProjectPermission(ctx, workspaceId, projectKey, principal)
+	if err != nil {
+		return nil, err
+	}
 
-		return &userPermission.Permission, nil
-	} else if principal.Id.ResourceType == resourceTypeUserGroup.Id {
-		groupPermission, err := p.client.GetProjectGroupPermission(
-			ctx,
-			workspaceId,
-			projectKey,
-			principal.Id.Resource,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("bitbucket-connector: failed to get project group permission: %w", err)
-		}
+	return &bitbucket.Permission{Value: permission}, nil
+}
 
-		return &groupPermission.Permission, nil
+// currentPermission reads the permission the principal holds under the project on its own, without
+// listing every permission of the project, so a revoke skipping the preflight still checks the role it deletes.
+func (p *projectResourceType) currentPermission(ctx context.Context, principal *v2.Resource, workspaceId, projectKey string) (string, error) {
+	isGroup, id, err := principalKey(principal)
+	if err != nil {
+		return "", err
 	}
 
-	return nil, fmt.Errorf("bitbucket-connector: invalid principal resource type: %s", principal.Id.ResourceType)
+	var permission string
+	if isGroup {
+		var groupPermission *bitbucket.GroupPermission
+		groupPermission, err = p.client.GetProjectGroupPermission(ctx, workspaceId, projectKey, id)
+		if err == nil {
+			permission = groupPermission.Value
+		}
+	} else {
+		var userPermission *bitbucket.UserPermission
+		userPermission, err = p.client.GetProjectUserPermission(ctx, workspaceId, projectKey, id)
+		if err == nil {
+			permission = userPermission.Value
+		}
+	}
+	if errors.Is(err, bitbucket.ErrNotFound) {
+		return roleNone, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("bitbucket-connector: failed to get project permission: %w", err)
+	}
+
+	return permission, nil
 }
 
 func (p *projectResourceType) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
@@ -386,43 +480,96 @@ func (p *projectResourceType) Grant(ctx context.Context, principal *v2.Resource,
 		return nil, fmt.Errorf("bitbucket-connector: unsupported project role: %s", slug)
 	}
 
-	permission, err := p.GetPermission(ctx, principal, workspaceId, projectKey)
+	// provisioning requests may identify the user otherwise than by its UUID
+	principal, err = resolvePrincipal(ctx, p.client, workspaceId, principal)
 	if err != nil {
 		return nil, err
 	}
 
-	// warn if the principal already has a project permission
-	if permission.Value != roleNone {
-		l.Warn(
-			"bitbucket-connector: principal already has a project permission",
-		)
+	err = checkPrincipal(ctx, p.client, workspaceId, principal)
+	if err != nil {
+		return nil, err
+	}
+
+	// when the plan is unknown the write is made anyway, Bitbucket rejects it if the plan doesn't allow it
+	plan, err := p.plans.Plan(ctx, workspaceId, projectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if plan == planStandard {
+		return nil, premiumRequiredError(workspaceId, slug)
+	}
+
+	if !p.skipPreflight {
+		permission, err := p.GetPermission(ctx, principal, workspaceId, projectKey)
+		if err != nil {
+			return nil, err
+		}
+
+		// nothing to do if the principal already has the requested project permission
+		if permission.Value == slug {
+			l.Info(
+				"bitbucket-connector: principal already has this project permission",
+				zap.String("principal_id", principal.Id.Resource),
+				zap.String("permission", slug),
+			)
+
+			return alreadyExistsAnnotations(), nil
+		}
+
+		// warn if the principal has a different project permission which is going to be replaced
+		if permission.Value != roleNone {
+			l.Warn(
+				"bitbucket-connector: principal already has a project permission",
+				zap.String("principal_id", principal.Id.Resource),
+				zap.String("permission", permission.Value),
+			)
+		}
 	}
 
 	// update the project permission
 	if principalIsUser {
-		err = p.client.UpdateProjectUserPermission(
-			ctx,
-			workspaceId,
-			projectKey,
-			principal.Id.Resource,
-			slug,
-		)
+		err = p.retry.withRateLimitRetry(ctx, func() error {
+			return p.client.UpdateProjectUserPermission(
+				ctx,
+				workspaceId,
+				projectKey,
+				principal.Id.Resource,
+				slug,
+			)
+		})
+		if bitbucket.IsPlanError(err) {
+			return nil, premiumRequiredError(workspaceId, slug)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("bitbucket-connector: failed to update project user permission: %w", err)
 		}
 	} else if principalIsGroup {
-		err = p.client.UpdateProjectGroupPermission(
-			ctx,
-			workspaceId,
-			projectKey,
-			principal.Id.Resource,
-			slug,
-		)
+		_, groupSlug, err := DecomposeGroupId(principal.Id.Resource)
+		if err != nil {
+			return nil, fmt.Errorf("bitbucket-connector: failed to update project permission: %w", err)
+		}
+
+		err = p.retry.withRateLimitRetry(ctx, func() error {
+			return p.client.UpdateProjectGroupPermission(
+				ctx,
+				workspaceId,
+				projectKey,
+				groupSlug,
+				slug,
+			)
+		})
+		if bitbucket.IsPlanError(err) {
+			return nil, premiumRequiredError(workspaceId, slug)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("bitbucket-connector: failed to update project group permission: %w", err)
 		}
 	}
 
+	p.permissions.Set(projectPermissionsKey(workspaceId, projectKey), principal, slug)
+
 	return nil, nil
 }
 
@@ -463,52 +610,119 @@ func (p *projectResourceType) Revoke(ctx context.Context, grant *v2.Grant) (anno
 		return nil, fmt.Errorf("bitbucket-connector: revoking repository memberships is not supported")
 	}
 
-	permission, err := p.GetPermission(ctx, principal, workspaceId, projectKey)
+	// check if the permission is supported project role
+	if !contains(slug, projectPermissions) {
+		return nil, fmt.Errorf("bitbucket-connector: unsupported project role: %s", slug)
+	}
+
+	plan, err := p.plans.Plan(ctx, workspaceId, projectKey)
 	if err != nil {
 		return nil, err
 	}
 
-	// check if the permission is supported project role
-	if !contains(slug, projectPermissions) {
-		return nil, fmt.Errorf("bitbucket-connector: unsupported project role: %s", permission.Value)
+	if plan == planStandard {
+		return nil, premiumRequiredError(workspaceId, slug)
 	}
 
-	// warn if the principal already doesnt have this project permission
-	if permission.Value == roleNone {
-		l.Warn(
+	// the DELETE removes whichever role the principal holds, so the current role is read even when
+	// the preflight is skipped, only without listing every permission of the project
+	var permission string
+	if p.skipPreflight {
+		permission, err = p.currentPermission(ctx, principal, workspaceId, projectKey)
+	} else {
+		var cached *bitbucket.Permission
+		cached, err = p.GetPermission(ctx, principal, workspaceId, projectKey)
+		if cached != nil {
+			permission = cached.Value
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing to do if the principal already doesnt have any project permission
+	if permission == roleNone {
+		l.Info(
 			"bitbucket-connector: principal already doesnt have this project permission",
+			zap.String("principal_id", principal.Id.Resource),
+		)
+
+		return alreadyRevokedAnnotations(), nil
+	}
+
+	// the revoked role is gone already when the principal holds another one, which must be kept
+	if permission != slug {
+		l.Info(
+			"bitbucket-connector: principal holds another project permission than the revoked one, keeping it",
+			zap.String("principal_id", principal.Id.Resource),
+			zap.String("permission", permission),
+			zap.String("revoked_permission", slug),
 		)
+
+		return alreadyRevokedAnnotations(), nil
 	}
 
 	// remove the project permission
 	if principalIsUser {
-		err = p.client.DeleteProjectUserPermission(
-			ctx,
-			workspaceId,
-			projectKey,
-			principal.Id.Resource,
-		)
+		err = p.retry.withRateLimitRetry(ctx, func() error {
+			return p.client.DeleteProjectUserPermission(
+				ctx,
+				workspaceId,
+				projectKey,
+				principal.Id.Resource,
+			)
+		})
+		if errors.Is(err, bitbucket.ErrNotFound) {
+			p.permissions.Set(projectPermissionsKey(workspaceId, projectKey), principal, roleNone)
+			return alreadyRevokedAnnotations(), nil
+		}
+		if bitbucket.IsPlanError(err) {
+			return nil, premiumRequiredError(workspaceId, slug)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("bitbucket-connector: failed to remove project user permission: %w", err)
 		}
 	} else if principalIsGroup {
-		err = p.client.DeleteProjectGroupPermission(
-			ctx,
-			workspaceId,
-			projectKey,
-			principal.Id.Resource,
-		)
+		_, groupSlug, err := DecomposeGroupId(principal.Id.Resource)
+		if err != nil {
+			return nil, fmt.Errorf("bitbucket-connector: failed to remove project permission: %w", err)
+		}
+
+		err = p.retry.withRateLimitRetry(ctx, func() error {
+			return p.client.DeleteProjectGroupPermission(
+				ctx,
+				workspaceId,
+				projectKey,
+				groupSlug,
+			)
+		})
+		if errors.Is(err, bitbucket.ErrNotFound) {
+			p.permissions.Set(projectPermissionsKey(workspaceId, projectKey), principal, roleNone)
+			return alreadyRevokedAnnotations(), nil
+		}
+		if bitbucket.IsPlanError(err) {
+			return nil, premiumRequiredError(workspaceId, slug)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("bitbucket-connector: failed to remove project group permission: %w", err)
 		}
 	}
 
+	p.permissions.Set(projectPermissionsKey(workspaceId, projectKey), principal, roleNone)
+
 	return nil, nil
 }
 
-func projectBuilder(client *bitbucket.Client) *projectResourceType {
+func projectBuilder(client BitbucketClient, permissions *permissionCache, repos *projectRepoCache, retry *retryPolicy, skipPreflight bool, skipRepoGrants bool, names *entitlementNames, plans *workspacePlans) *projectResourceType {
 	return &projectResourceType{
-		resourceType: resourceTypeProject,
-		client:       client,
+		resourceType:   resourceTypeProject,
+		client:         client,
+		permissions:    permissions,
+		repos:          repos,
+		retry:          retry,
+		skipPreflight:  skipPreflight,
+		skipRepoGrants: skipRepoGrants,
+		names:          names,
+		plans:          plans,
 	}
 }
@@ -0,0 +1,391 @@
+package connector_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/internal/walk"
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	"github.com/conductorone/baton-bitbucket/pkg/connector"
+	"github.com/conductorone/baton-bitbucket/pkg/connector/bitbucketmock"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+)
+
+// The tests in this file call the resource builders from many goroutines at once, the way a
+// parallel sync does, so the state shared through the connector (the caches, the workspace
+// index and the call counters of the fake) is checked by running them with -race:
+//
+//	go test -race -run Concurrent ./pkg/connector
+
+const (
+	raceWorkers = 8
+	// rounds of membership changes every worker makes, so the workers overlap long enough
+	raceRounds = 10
+	// the fake answers after a delay like the API, so the calls of the workers overlap
+	// instead of being ordered by the locks of the connector
+	raceLatency = 200 * time.Microsecond
+)
+
+var raceDatasetSize = bitbucketmock.DatasetSize{
+	Workspaces:      3,
+	Members:         40,
+	Groups:          6,
+	GroupMembers:    5,
+	Projects:        3,
+	ReposPerProject: 3,
+	Permissions:     6,
+}
+
+// groupMembers keeps the group memberships of the fake, so they can be changed concurrently.
+type groupMembers struct {
+	mtx     sync.Mutex
+	members map[string][]bitbucket.User
+}
+
+// newRaceClient returns the fake serving the dataset, with the memberships of the user groups
+// writable. Every workspace starts with the same groups and members.
+func newRaceClient(data *bitbucketmock.Dataset) *bitbucketmock.Client {
+	fake := bitbucketmock.NewFake(data, bitbucketmock.NewAPICalls(raceLatency))
+
+	state := &groupMembers{members: make(map[string][]bitbucket.User)}
+	listMembers := fake.GetUserGroupMembersFunc
+	users := make(map[string]bitbucket.User)
+
+	fake.GetUserGroupMembersFunc = func(ctx context.Context, workspaceId string, groupSlug string) ([]bitbucket.User, error) {
+		state.mtx.Lock()
+		defer state.mtx.Unlock()
+
+		key := workspaceId + "/" + groupSlug
+		if members, ok := state.members[key]; ok {
+			return append([]bitbucket.User(nil), members...), nil
+		}
+
+		members, err := listMembers(ctx, workspaceId, groupSlug)
+		if err != nil {
+			return nil, err
+		}
+		state.members[key] = append([]bitbucket.User(nil), members...)
+
+		return members, nil
+	}
+
+	fake.GetWorkspaceMemberFunc = func(ctx context.Context, workspaceId string, userId string) (*bitbucket.User, error) {
+		state.mtx.Lock()
+		user, ok := users[userId]
+		state.mtx.Unlock()
+		if ok {
+			return &user, nil
+		}
+
+		found, err := fake.GetUser(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+
+		state.mtx.Lock()
+		users[userId] = *found
+		state.mtx.Unlock()
+
+		return found, nil
+	}
+
+	fake.AddUserToGroupFunc = func(ctx context.Context, workspaceId string, groupSlug string, userId string) error {
+		members, err := fake.GetUserGroupMembers(ctx, workspaceId, groupSlug)
+		if err != nil {
+			return err
+		}
+
+		user, err := fake.GetUser(ctx, userId)
+		if err != nil {
+			return err
+		}
+
+		state.mtx.Lock()
+		defer state.mtx.Unlock()
+
+		for _, member := range members {
+			if member.Id == userId {
+				return fmt.Errorf("%w: user %s is already a member of %s", bitbucket.ErrConflict, userId, groupSlug)
+			}
+		}
+		key := workspaceId + "/" + groupSlug
+		state.members[key] = append(state.members[key], *user)
+
+		return nil
+	}
+
+	fake.RemoveUserFromGroupFunc = func(ctx context.Context, workspaceId string, groupSlug string, userId string) error {
+		_, err := fake.GetUserGroupMembers(ctx, workspaceId, groupSlug)
+		if err != nil {
+			return err
+		}
+
+		state.mtx.Lock()
+		defer state.mtx.Unlock()
+
+		key := workspaceId + "/" + groupSlug
+		for i, member := range state.members[key] {
+			if member.Id == userId {
+				state.members[key] = append(state.members[key][:i:i], state.members[key][i+1:]...)
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%w: user %s is not a member of %s", bitbucket.ErrNotFound, userId, groupSlug)
+	}
+
+	return fake
+}
+
+func newRaceConnector(t *testing.T, config connector.Config) *connector.Bitbucket {
+	t.Helper()
+
+	bb, err := connector.NewWithClient(context.Background(), config, newRaceClient(bitbucketmock.NewDataset(raceDatasetSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bb
+}
+
+func walkResources(ctx context.Context, bb *connector.Bitbucket) ([]*v2.Resource, error) {
+	var resources []*v2.Resource
+	err := walk.Resources(ctx, bb, func(resource *v2.Resource) error {
+		resources = append(resources, resource)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resources: %w", err)
+	}
+
+	return resources, nil
+}
+
+// syncedIds returns the sorted IDs of the entitlements and grants of the resources, listed by
+// the workers concurrently. Every worker walks all resources, starting at a different offset,
+// so the same caches are filled and read at the same time.
+func syncedIds(ctx context.Context, t *testing.T, bb *connector.Bitbucket, resources []*v2.Resource, workers int) []string {
+	t.Helper()
+
+	var mtx sync.Mutex
+	ids := make(map[string]struct{})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+
+			for i := range resources {
+				resource := resources[(offset+i)%len(resources)]
+
+				entitlements, err := walk.Entitlements(ctx, bb, resource)
+				if err != nil {
+					errs <- fmt.Errorf("failed to list entitlements of %s: %w", resource.Id.Resource, err)
+					return
+				}
+
+				grants, err := walk.Grants(ctx, bb, resource)
+				if err != nil {
+					errs <- fmt.Errorf("failed to list grants of %s: %w", resource.Id.Resource, err)
+					return
+				}
+
+				mtx.Lock()
+				for _, entitlement := range entitlements {
+					ids[entitlement.Id] = struct{}{}
+				}
+				for _, grant := range grants {
+					ids[grant.Id] = struct{}{}
+				}
+				mtx.Unlock()
+			}
+		}(w * len(resources) / workers)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	rv := make([]string, 0, len(ids))
+	for id := range ids {
+		rv = append(rv, id)
+	}
+	sort.Strings(rv)
+
+	return rv
+}
+
+func TestConcurrentSync(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config connector.Config
+	}{
+		{name: "default"},
+		{name: "deduplicated users", config: connector.Config{DeduplicateUsers: true, UserFetchConcurrency: 4}},
+		{name: "global users", config: connector.Config{GlobalUsers: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			// the same dataset synced one resource at a time
+			sequential := newRaceConnector(t, tc.config)
+			resources, err := walkResources(ctx, sequential)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := syncedIds(ctx, t, sequential, resources, 1)
+
+			bb := newRaceConnector(t, tc.config)
+
+			// the walks share the caches of the connector, like parallel syncs of its workspaces
+			var wg sync.WaitGroup
+			walked := make([][]*v2.Resource, raceWorkers)
+			errs := make([]error, raceWorkers)
+			for w := range walked {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					walked[w], errs[w] = walkResources(ctx, bb)
+				}(w)
+			}
+			wg.Wait()
+
+			// users listed only once per connector are listed by whichever walk gets to them first
+			var listed []*v2.Resource
+			seen := make(map[string]struct{})
+			for w := range walked {
+				if errs[w] != nil {
+					t.Fatal(errs[w])
+				}
+
+				for _, resource := range walked[w] {
+					key := resource.Id.ResourceType + "/" + resource.Id.Resource
+					if _, ok := seen[key]; !ok {
+						seen[key] = struct{}{}
+						listed = append(listed, resource)
+					}
+				}
+			}
+			if len(listed) != len(resources) {
+				t.Fatalf("concurrent walks listed %d resources, a sequential walk %d", len(listed), len(resources))
+			}
+
+			got := syncedIds(ctx, t, bb, listed, raceWorkers)
+			if len(got) != len(want) {
+				t.Fatalf("concurrent sync listed %d entitlements and grants, a sequential sync %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("concurrent sync listed %s, a sequential sync %s", got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConcurrentGroupMembershipChanges(t *testing.T) {
+	ctx := context.Background()
+	bb := newRaceConnector(t, connector.Config{})
+
+	resources, err := walkResources(ctx, bb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var groups, users []*v2.Resource
+	for _, resource := range resources {
+		switch resource.Id.ResourceType {
+		case "user_group":
+			groups = append(groups, resource)
+		case "user":
+			users = append(users, resource)
+		}
+	}
+	if len(groups) == 0 || len(users) < raceWorkers {
+		t.Fatalf("dataset has %d groups and %d users", len(groups), len(users))
+	}
+
+	var provisioner connectorbuilder.ResourceProvisioner
+	for _, syncer := range bb.ResourceSyncers(ctx) {
+		if syncer.ResourceType(ctx).Id == "user_group" {
+			provisioner, _ = syncer.(connectorbuilder.ResourceProvisioner)
+		}
+	}
+	if provisioner == nil {
+		t.Fatal("user groups are not provisionable")
+	}
+
+	memberships := make(map[string]*v2.Entitlement, len(groups))
+	for _, group := range groups {
+		entitlements, err := walk.Entitlements(ctx, bb, group)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entitlement := range entitlements {
+			if entitlement.Slug == "member" {
+				memberships[group.Id.Resource] = entitlement
+			}
+		}
+	}
+
+	// every worker moves its own user in and out of all groups, while the grants of the groups are listed
+	// the workers are released at once, so their calls overlap
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*raceWorkers)
+	for w := 0; w < raceWorkers; w++ {
+		user := users[len(users)-1-w]
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			for i := 0; i < raceRounds*len(groups); i++ {
+				membership := memberships[groups[i%len(groups)].Id.Resource]
+
+				_, err := provisioner.Grant(ctx, user, membership)
+				if err != nil {
+					errs <- fmt.Errorf("failed to grant %s: %w", membership.Id, err)
+					return
+				}
+
+				_, err = provisioner.Revoke(ctx, &v2.Grant{Entitlement: membership, Principal: user})
+				if err != nil {
+					errs <- fmt.Errorf("failed to revoke %s: %w", membership.Id, err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+
+			for i := 0; i < raceRounds*len(groups); i++ {
+				group := groups[i%len(groups)]
+
+				_, err := walk.Grants(ctx, bb, group)
+				if err != nil {
+					errs <- fmt.Errorf("failed to list grants of %s: %w", group.Id.Resource, err)
+					return
+				}
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
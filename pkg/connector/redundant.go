@@ -0,0 +1,195 @@
+package connector
+
+import (
+	"fmt"
+	"sort"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+// RedundantGroupGrant is a permission of a user group whose members all have equal or higher access
+// to the resource on their own, so the group doesn't give anyone access.
+type RedundantGroupGrant struct {
+	WorkspaceId   string `json:"workspace_id"`
+	WorkspaceName string `json:"workspace_name"`
+	GroupId       string `json:"group_id"`
+	GroupName     string `json:"group_name"`
+	Entitlement   string `json:"entitlement"`
+	Permission    string `json:"permission"`
+	ResourceType  string `json:"resource_type"`
+	ResourceId    string `json:"resource_id"`
+	ResourceName  string `json:"resource_name"`
+	Members       int    `json:"members"`
+	Suggestion    string `json:"suggestion"`
+}
+
+// FindRedundantGroupGrants returns the project and repository permissions and the workspace default
+// privileges of user groups whose members all have direct permissions on the same resources which are
+// equal or higher, sorted by workspace, group and resource. The default privileges apply to every
+// repository of the workspace, so they are redundant when the members have direct access to all of them.
+// Groups without members are left out, they don't give anyone access either.
+func FindRedundantGroupGrants(resources []*v2.Resource, grants []*v2.Grant) ([]RedundantGroupGrant, error) {
+	byId := make(map[string]*v2.Resource, len(resources))
+	for _, resource := range resources {
+		byId[resourceKey(resource.Id)] = resource
+	}
+
+	// the highest permission every user was granted directly on a resource
+	direct := make(map[string]map[string]int)
+	members := make(map[string][]string)
+	for _, g := range grants {
+		principalId := g.Principal.Id
+		resourceId := g.Entitlement.Resource.Id
+		if principalId.ResourceType != resourceTypeUser.Id || !isDirect(g) {
+			continue
+		}
+
+		_, slug, err := ParseEntitlementID(g.Entitlement.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		if resourceId.ResourceType == resourceTypeUserGroup.Id && slug == memberEntitlement {
+			members[resourceId.Resource] = append(members[resourceId.Resource], principalId.Resource)
+			continue
+		}
+
+		rank := permissionRank(slug)
+		if rank < 0 {
+			continue
+		}
+
+		key := resourceKey(resourceId)
+		if direct[key] == nil {
+			direct[key] = make(map[string]int)
+		}
+		if current, ok := direct[key][principalId.Resource]; !ok || rank > current {
+			direct[key][principalId.Resource] = rank
+		}
+	}
+
+	// the repositories of every workspace, the default privileges of a group apply to
+	repositories := make(map[string][]*v2.ResourceId)
+	for _, resource := range resources {
+		if resource.Id.ResourceType != resourceTypeRepository.Id {
+			continue
+		}
+
+		workspaceId := resourceWorkspace(byId, resource.Id)
+		repositories[workspaceId] = append(repositories[workspaceId], resource.Id)
+	}
+
+	// covered reports whether every member has direct access equal to or higher than the rank on all resources
+	covered := func(groupMembers []string, rank int, resourceIds []*v2.ResourceId) bool {
+		for _, resourceId := range resourceIds {
+			for _, userId := range groupMembers {
+				userRank, ok := direct[resourceKey(resourceId)][userId]
+				if !ok || userRank < rank {
+					return false
+				}
+			}
+		}
+
+		return true
+	}
+
+	var rv []RedundantGroupGrant
+	for _, g := range grants {
+		groupId := g.Principal.Id
+		resourceId := g.Entitlement.Resource.Id
+		if groupId.ResourceType != resourceTypeUserGroup.Id || !isDirect(g) {
+			continue
+		}
+
+		groupMembers := members[groupId.Resource]
+		if len(groupMembers) == 0 {
+			continue
+		}
+
+		_, slug, err := ParseEntitlementID(g.Entitlement.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		workspaceId := resourceWorkspace(byId, resourceId)
+
+		var permission string
+		var resourceIds []*v2.ResourceId
+		switch {
+		case resourceId.ResourceType == resourceTypeWorkspace.Id && slug == defaultAccessEntitlement:
+			permission = grantPermission(g)
+			resourceIds = repositories[workspaceId]
+		case resourceId.ResourceType == resourceTypeProject.Id || resourceId.ResourceType == resourceTypeRepository.Id:
+			permission = slug
+			resourceIds = []*v2.ResourceId{resourceId}
+		default:
+			continue
+		}
+
+		rank := permissionRank(permission)
+		if rank < 0 || len(resourceIds) == 0 || !covered(groupMembers, rank, resourceIds) {
+			continue
+		}
+
+		rv = append(rv, RedundantGroupGrant{
+			WorkspaceId:   workspaceId,
+			WorkspaceName: resourceName(byId, &v2.ResourceId{ResourceType: resourceTypeWorkspace.Id, Resource: workspaceId}),
+			GroupId:       groupId.Resource,
+			GroupName:     resourceName(byId, groupId),
+			Entitlement:   slug,
+			Permission:    permission,
+			ResourceType:  resourceId.ResourceType,
+			ResourceId:    resourceId.Resource,
+			ResourceName:  resourceName(byId, resourceId),
+			Members:       len(groupMembers),
+			Suggestion: fmt.Sprintf(
+				"all %d members have %s access or higher directly, remove the group permission or consolidate their direct permissions into the group",
+				len(groupMembers),
+				permission,
+			),
+		})
+	}
+
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].WorkspaceId != rv[j].WorkspaceId {
+			return rv[i].WorkspaceId < rv[j].WorkspaceId
+		}
+		if rv[i].GroupId != rv[j].GroupId {
+			return rv[i].GroupId < rv[j].GroupId
+		}
+		if rv[i].ResourceType != rv[j].ResourceType {
+			return rv[i].ResourceType < rv[j].ResourceType
+		}
+		if rv[i].ResourceId != rv[j].ResourceId {
+			return rv[i].ResourceId < rv[j].ResourceId
+		}
+
+		return rv[i].Entitlement < rv[j].Entitlement
+	})
+
+	return rv, nil
+}
+
+// permissionRank orders the project and repository permissions by the access they give, -1 for other entitlements.
+func permissionRank(permission string) int {
+	for i, p := range projectPermissions {
+		if p == permission {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// grantPermission returns the raw Bitbucket permission a grant was read with.
+func grantPermission(g *v2.Grant) string {
+	metadata := &v2.GrantMetadata{}
+	annos := annotations.Annotations(g.Annotations)
+	ok, err := annos.Pick(metadata)
+	if err != nil || !ok {
+		return ""
+	}
+
+	return metadata.GetMetadata().GetFields()["permission"].GetStringValue()
+}
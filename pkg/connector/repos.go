@@ -0,0 +1,126 @@
+package connector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+)
+
+const (
+	// maxProjectRepos bounds the repositories of a single project which are kept, the project grants
+	// page through the repositories of larger projects again.
+	maxProjectRepos = 1000
+	// maxCachedRepos bounds the repositories kept across all projects. The SDK lists every resource
+	// before collecting grants, so the ids of a whole workspace would be kept without it.
+	maxCachedRepos = 50000
+)
+
+type projectRepos struct {
+	ids []string
+	// nextPage is the page the repository listing reads next
+	nextPage string
+	complete bool
+}
+
+// projectRepoCache shares the repositories of a project between the repository List and the project
+// Grants, which page through the same listing during a sync. Only the ids of the repositories are
+// kept, per project, once the listing read every page of the project, and they are dropped when the
+// project grants read them. It is reset whenever a new sync starts listing workspaces.
+type projectRepoCache struct {
+	client BitbucketClient
+	// enabled is false when the project grants don't list repositories
+	enabled  bool
+	mtx      sync.Mutex
+	projects map[string]*projectRepos
+	size     int
+}
+
+func newProjectRepoCache(client BitbucketClient, enabled bool) *projectRepoCache {
+	return &projectRepoCache{
+		client:   client,
+		enabled:  enabled,
+		projects: make(map[string]*projectRepos),
+	}
+}
+
+func projectReposKey(workspaceId, projectId string) string {
+	return encodeResourceId(workspaceId, projectId)
+}
+
+// Reset drops all cached repositories.
+func (c *projectRepoCache) Reset() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.projects = make(map[string]*projectRepos)
+	c.size = 0
+}
+
+// GetProjectRepos returns the page of project repositories, keeping their ids for the project grants.
+func (c *projectRepoCache) GetProjectRepos(ctx context.Context, workspaceId, projectId string, vars bitbucket.PaginationVars) ([]bitbucket.Repository, string, error) {
+	repositories, nextToken, err := c.client.GetProjectRepos(ctx, workspaceId, projectId, vars)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if c.enabled {
+		c.store(projectReposKey(workspaceId, projectId), vars.Page, repositories, nextToken)
+	}
+
+	return repositories, nextToken, nil
+}
+
+// ProjectRepoIds returns the ids of every repository of the project and drops them, false when they
+// are not cached.
+func (c *projectRepoCache) ProjectRepoIds(workspaceId, projectId string) ([]string, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	key := projectReposKey(workspaceId, projectId)
+	project, ok := c.projects[key]
+	if !ok || !project.complete {
+		return nil, false
+	}
+
+	c.remove(key)
+
+	return project.ids, true
+}
+
+// store adds a page read by the repository listing to the repositories of the project. Pages must
+// follow each other, the project is dropped when one is missed or it doesn't fit within the bounds.
+func (c *projectRepoCache) store(key, page string, repositories []bitbucket.Repository, nextToken string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	project, ok := c.projects[key]
+	if page == "" {
+		c.remove(key)
+		project = &projectRepos{}
+		c.projects[key] = project
+	} else if !ok || project.complete || project.nextPage != page {
+		c.remove(key)
+		return
+	}
+
+	if len(project.ids)+len(repositories) > maxProjectRepos || c.size+len(repositories) > maxCachedRepos {
+		c.remove(key)
+		return
+	}
+
+	for _, repository := range repositories {
+		project.ids = append(project.ids, repository.Id)
+	}
+	c.size += len(repositories)
+
+	project.nextPage = nextToken
+	project.complete = nextToken == ""
+}
+
+func (c *projectRepoCache) remove(key string) {
+	if project, ok := c.projects[key]; ok {
+		c.size -= len(project.ids)
+		delete(c.projects, key)
+	}
+}
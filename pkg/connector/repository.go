@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
@@ -19,42 +20,203 @@ import (
 
 var repositoryRoles = []string{roleRead, roleWrite, roleAdmin}
 
+const (
+	branchMatchGlob        = "glob"
+	branchRestrictionPush  = "push"
+	branchRestrictionMerge = "restrict_merges"
+
+	mainBranchRestrictionsProfileKey = "repository_main_branch_restrictions"
+)
+
+// branchExemption is a branch restriction limiting who can push to or merge into the main branch,
+// the users and groups it lists are exempt from it and granted its entitlement.
+type branchExemption struct {
+	entitlement string
+	kind        string
+	// usersKey and groupsKey are the repository profile fields listing the exempt users and groups
+	usersKey  string
+	groupsKey string
+	name      string
+}
+
+var branchExemptions = []branchExemption{
+	{
+		entitlement: "main-branch-push",
+		kind:        branchRestrictionPush,
+		usersKey:    "repository_main_branch_push_users",
+		groupsKey:   "repository_main_branch_push_groups",
+		name:        "push to",
+	},
+	{
+		entitlement: "main-branch-merge",
+		kind:        branchRestrictionMerge,
+		usersKey:    "repository_main_branch_merge_users",
+		groupsKey:   "repository_main_branch_merge_groups",
+		name:        "merge pull requests into",
+	},
+}
+
+// mergeCheckProfileKeys maps the branch restrictions which are merge checks to the profile field of
+// the main branch they are reported in. Checks with a threshold report it, the others are flags.
+var mergeCheckProfileKeys = map[string]string{
+	"require_approvals_to_merge":                  "repository_main_branch_required_approvals",
+	"require_default_reviewer_approvals_to_merge": "repository_main_branch_required_default_reviewer_approvals",
+	"require_passing_builds_to_merge":             "repository_main_branch_required_successful_builds",
+	"require_tasks_to_be_completed":               "repository_main_branch_requires_completed_tasks",
+	"require_no_changes_requested":                "repository_main_branch_requires_no_changes_requested",
+	"reset_pullrequest_approvals_on_change":       "repository_main_branch_resets_approvals_on_change",
+	"enforce_merge_checks":                        "repository_main_branch_enforces_merge_checks",
+}
+
+// repositoryFeature is a part of a repository, like the wiki, which can be enabled per repository
+// and whose access follows the repository permissions, so it is easily forgotten in reviews.
+type repositoryFeature struct {
+	entitlement string
+	// profileKey is the repository profile field set when the feature is enabled
+	profileKey string
+	name       string
+}
+
+var repositoryFeatures = []repositoryFeature{
+	{entitlement: "wiki", profileKey: "repository_has_wiki", name: "wiki"},
+	{entitlement: "issues", profileKey: "repository_has_issues", name: "issue tracker"},
+}
+
 type repositoryResourceType struct {
-	resourceType *v2.ResourceType
-	client       *bitbucket.Client
+	resourceType  *v2.ResourceType
+	client        BitbucketClient
+	permissions   *permissionCache
+	repos         *projectRepoCache
+	retry         *retryPolicy
+	skipPreflight bool
+	names         *entitlementNames
+	staleAfter    time.Duration
 }
 
 func (r *repositoryResourceType) ResourceType(_ context.Context) *v2.ResourceType {
 	return r.resourceType
 }
 
+// ComposeRepositoryId composes the repository ID out of the composed ID of its project.
 func ComposeRepositoryId(projectId, repositoryId string) string {
-	return fmt.Sprintf("%s:%s", projectId, repositoryId)
+	return composeChildId(projectId, repositoryId)
 }
 
+// DecomposeRepositoryId returns the composed project ID and the repository ID.
 func DecomposeRepositoryId(repositoryId string) (string, string, error) {
-	parts := strings.Split(repositoryId, ":")
-	// There needs to be at least 2 parts (project id and repository id)
-	if len(parts) < 3 {
-		return "", "", errors.New("bitbucket-connector: invalid repository resource id")
-	}
-
-	// Check if the project id is valid
-	projectId := strings.Join(parts[0:len(parts)-1], ":")
-	if _, _, _, err := DecomposeProjectId(projectId); err != nil {
-		return "", "", errors.New("bitbucket-connector: invalid repository resource id, composed project id is invalid")
+	segments, err := decodeResourceId(repositoryId, 4)
+	if err != nil {
+		return "", "", fmt.Errorf("bitbucket-connector: invalid repository resource id: %w", err)
 	}
 
-	// Return the project id and repository id
-	return projectId, parts[len(parts)-1], nil
+	return encodeResourceId(segments[:3]...), segments[3], nil
 }
 
 // Create a new connector resource for an Bitbucket Repository.
-func repositoryResource(ctx context.Context, repository *bitbucket.Repository, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+func repositoryResource(
+	ctx context.Context,
+	repository *bitbucket.Repository,
+	parentResourceID *v2.ResourceId,
+	mainBranchRestrictions []bitbucket.BranchRestriction,
+	pipelinesConfig *bitbucket.PipelinesConfig,
+	staleAfter time.Duration,
+) (*v2.Resource, error) {
 	profile := map[string]interface{}{
-		"repository_id":        repository.Id,
-		"repository_name":      repository.Name,
-		"repository_full_name": repository.FullName,
+		"repository_id":         repository.Id,
+		"repository_name":       repository.Name,
+		"repository_full_name":  repository.FullName,
+		"repository_is_private": repository.IsPrivate,
+		"repository_has_wiki":   repository.HasWiki,
+		"repository_has_issues": repository.HasIssues,
+	}
+
+	// the full name is prefixed by the slug of the workspace
+	if workspaceSlug, _, ok := strings.Cut(repository.FullName, "/"); ok {
+		profile["repository_workspace"] = workspaceSlug
+	}
+
+	if repository.Project != nil {
+		profile["repository_project_key"] = repository.Project.Key
+		profile["repository_project_name"] = repository.Project.Name
+	}
+
+	if repository.Links.HTML.Href != "" {
+		profile["repository_url"] = repository.Links.HTML.Href
+	}
+
+	if repository.MainBranch != nil {
+		profile["repository_main_branch"] = repository.MainBranch.Name
+	}
+
+	if repository.Language != "" {
+		profile["repository_language"] = repository.Language
+	}
+
+	if repository.Size > 0 {
+		profile["repository_size"] = repository.Size
+	}
+
+	if repository.CreatedOn != "" {
+		profile["repository_created_on"] = repository.CreatedOn
+	}
+
+	// bumped by pushes as well as by changes of the repository settings
+	if repository.UpdatedOn != "" {
+		profile["repository_updated_on"] = repository.UpdatedOn
+
+		if staleAfter > 0 {
+			updatedAt, err := time.Parse(time.RFC3339Nano, repository.UpdatedOn)
+			if err != nil {
+				ctxzap.Extract(ctx).Debug(
+					"bitbucket-connector: failed to parse repository update date",
+					zap.String("repository_id", repository.Id),
+					zap.String("updated_on", repository.UpdatedOn),
+				)
+			} else {
+				sinceUpdate := time.Since(updatedAt)
+				profile["repository_days_since_update"] = int(sinceUpdate.Hours() / 24)
+				profile["repository_is_stale"] = sinceUpdate > staleAfter
+			}
+		}
+	}
+
+	if pipelinesConfig != nil {
+		profile["repository_pipelines_enabled"] = pipelinesConfig.Enabled
+	}
+
+	// link the main branch to restrictions applied to it, so it is clear who can push to it
+	// and which merge checks pull requests into it have to pass
+	if len(mainBranchRestrictions) > 0 {
+		var kinds []string
+		exemptUsers := make(map[string][]string)
+		exemptGroups := make(map[string][]string)
+		for _, restriction := range mainBranchRestrictions {
+			kinds = append(kinds, restriction.Kind)
+
+			// several patterns may match the main branch, the strictest threshold applies
+			if key, ok := mergeCheckProfileKeys[restriction.Kind]; ok {
+				if restriction.Value == nil {
+					profile[key] = true
+				} else if current, ok := profile[key].(int); !ok || *restriction.Value > current {
+					profile[key] = *restriction.Value
+				}
+			}
+
+			exemptUsers[restriction.Kind] = append(exemptUsers[restriction.Kind], mapUserIDs(restriction.Users)...)
+			for _, group := range restriction.Groups {
+				exemptGroups[restriction.Kind] = append(exemptGroups[restriction.Kind], group.Slug)
+			}
+		}
+
+		profile[mainBranchRestrictionsProfileKey] = strings.Join(kinds, ",")
+		for _, exemption := range branchExemptions {
+			if users := exemptUsers[exemption.kind]; len(users) > 0 {
+				profile[exemption.usersKey] = strings.Join(users, ",")
+			}
+			if groups := exemptGroups[exemption.kind]; len(groups) > 0 {
+				profile[exemption.groupsKey] = strings.Join(groups, ",")
+			}
+		}
 	}
 
 	resource, err := rs.NewGroupResource(
@@ -65,6 +227,10 @@ func repositoryResource(ctx context.Context, repository *bitbucket.Repository, p
 			rs.WithGroupProfile(profile),
 		},
 		rs.WithParentResourceID(parentResourceID),
+		rs.WithAnnotation(
+			&v2.ChildResourceType{ResourceTypeId: resourceTypeRunner.Id},
+			&v2.ChildResourceType{ResourceTypeId: resourceTypeEnvironment.Id},
+		),
 	)
 
 	if err != nil {
@@ -74,6 +240,90 @@ func repositoryResource(ctx context.Context, repository *bitbucket.Repository, p
 	return resource, nil
 }
 
+// matchBranchGlob reports whether the branch name matches the pattern of a branch restriction. Bitbucket
+// only treats * as a wildcard, which matches any run of characters including slashes, so release/*
+// matches release/1.0/hotfix too.
+func matchBranchGlob(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+
+	// the text before the first and after the last wildcard is anchored to the ends of the name
+	first, last := parts[0], parts[len(parts)-1]
+	if len(name) < len(first)+len(last) || !strings.HasPrefix(name, first) || !strings.HasSuffix(name, last) {
+		return false
+	}
+
+	// the parts in between match their leftmost occurrence, leaving the most room for the rest
+	rest := name[len(first) : len(name)-len(last)]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+
+	return true
+}
+
+// mainBranchRestrictions returns the branch restrictions which apply to the main branch of provided repository.
+func (r *repositoryResourceType) mainBranchRestrictions(ctx context.Context, workspaceId string, repository *bitbucket.Repository) ([]bitbucket.BranchRestriction, error) {
+	if repository.MainBranch == nil {
+		return nil, nil
+	}
+
+	var rv []bitbucket.BranchRestriction
+	err := r.client.ForEachRepositoryBranchRestriction(ctx, workspaceId, repository.Id, func(restriction bitbucket.BranchRestriction) error {
+		// restrictions based on the branching model can't be resolved to a branch name
+		if restriction.BranchMatchKind != branchMatchGlob {
+			return nil
+		}
+
+		if matchBranchGlob(restriction.Pattern, repository.MainBranch.Name) {
+			rv = append(rv, restriction)
+		}
+
+		return nil
+	})
+	if err != nil {
+		// branch restrictions are only visible to repository admins
+		if errors.Is(err, bitbucket.ErrPermissionDenied) {
+			ctxzap.Extract(ctx).Debug(
+				"bitbucket-connector: not allowed to list branch restrictions",
+				zap.String("repository_id", repository.Id),
+			)
+
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("bitbucket-connector: failed to list branch restrictions: %w", err)
+	}
+
+	return rv, nil
+}
+
+// pipelinesConfig returns the Pipelines configuration of provided repository, nil when it is not visible.
+func (r *repositoryResourceType) pipelinesConfig(ctx context.Context, workspaceId string, repository *bitbucket.Repository) (*bitbucket.PipelinesConfig, error) {
+	pipelinesConfig, err := r.client.GetRepositoryPipelinesConfig(ctx, workspaceId, repository.Id)
+	if err != nil {
+		// the configuration is only visible to repository admins
+		if errors.Is(err, bitbucket.ErrPermissionDenied) || errors.Is(err, bitbucket.ErrNotFound) {
+			ctxzap.Extract(ctx).Debug(
+				"bitbucket-connector: not allowed to get pipelines configuration",
+				zap.String("repository_id", repository.Id),
+			)
+
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("bitbucket-connector: failed to get pipelines configuration: %w", err)
+	}
+
+	return pipelinesConfig, nil
+}
+
 func (r *repositoryResourceType) List(ctx context.Context, parentId *v2.ResourceId, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
 	if parentId == nil {
 		return nil, "", nil, nil
@@ -90,7 +340,7 @@ func (r *repositoryResourceType) List(ctx context.Context, parentId *v2.Resource
 		return nil, "", nil, err
 	}
 
-	repositories, nextToken, err := r.client.GetProjectRepos(
+	repositories, nextToken, err := r.repos.GetProjectRepos(
 		ctx,
 		workspaceId,
 		projectId,
@@ -112,7 +362,17 @@ func (r *repositoryResourceType) List(ctx context.Context, parentId *v2.Resource
 	for _, repository := range repositories {
 		repositoryCopy := repository
 
-		tResource, err := repositoryResource(ctx, &repositoryCopy, parentId)
+		restrictions, err := r.mainBranchRestrictions(ctx, workspaceId, &repositoryCopy)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		pipelinesConfig, err := r.pipelinesConfig(ctx, workspaceId, &repositoryCopy)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		tResource, err := repositoryResource(ctx, &repositoryCopy, parentId, restrictions, pipelinesConfig, r.staleAfter)
 		if err != nil {
 			return nil, "", nil, err
 		}
@@ -130,8 +390,8 @@ func (r *repositoryResourceType) Entitlements(ctx context.Context, resource *v2.
 	for _, role := range repositoryRoles {
 		permissionOptions := []ent.EntitlementOption{
 			ent.WithGrantableTo(resourceTypeUser, resourceTypeUserGroup),
-			ent.WithDisplayName(fmt.Sprintf("%s Repository %s", resource.DisplayName, role)),
-			ent.WithDescription(fmt.Sprintf("%s access to %s repository in Bitbucket", titleCase(role), resource.DisplayName)),
+			ent.WithDisplayName(r.names.DisplayName(resource, role, fmt.Sprintf("%s Repository %s", resource.DisplayName, role))),
+			ent.WithDescription(r.names.Description(resource, role, fmt.Sprintf("%s access to %s repository in Bitbucket", titleCase(role), resource.DisplayName))),
 		}
 
 		rv = append(rv, ent.NewPermissionEntitlement(
@@ -141,9 +401,149 @@ func (r *repositoryResourceType) Entitlements(ctx context.Context, resource *v2.
 		))
 	}
 
+	// enabled features are accessible to everyone with access to the repository, they can't be granted on their own
+	for _, feature := range enabledFeatures(resource) {
+		description := fmt.Sprintf("Access to the %s of %s repository in Bitbucket, granted to everyone with a repository permission", feature.name, resource.DisplayName)
+		if !repositoryIsPrivate(resource) {
+			description = fmt.Sprintf("Access to the %s of %s repository in Bitbucket, the repository is public so anyone can read it", feature.name, resource.DisplayName)
+		}
+
+		rv = append(rv, ent.NewPermissionEntitlement(
+			resource,
+			feature.entitlement,
+			ent.WithGrantableTo(resourceTypeUser, resourceTypeUserGroup),
+			ent.WithDisplayName(r.names.DisplayName(resource, feature.entitlement, fmt.Sprintf("%s Repository %s", resource.DisplayName, feature.entitlement))),
+			ent.WithDescription(r.names.Description(resource, feature.entitlement, description)),
+			ent.WithAnnotation(&v2.EntitlementImmutable{}),
+		))
+	}
+
+	// branch restrictions are managed in the repository settings, not through permissions
+	for _, exemption := range mainBranchExemptions(resource) {
+		rv = append(rv, ent.NewPermissionEntitlement(
+			resource,
+			exemption.entitlement,
+			ent.WithGrantableTo(resourceTypeUser, resourceTypeUserGroup),
+			ent.WithDisplayName(r.names.DisplayName(resource, exemption.entitlement, fmt.Sprintf("%s Repository %s", resource.DisplayName, exemption.entitlement))),
+			ent.WithDescription(r.names.Description(resource, exemption.entitlement, fmt.Sprintf("Allowed to %s the main branch of %s repository in Bitbucket, which is restricted", exemption.name, resource.DisplayName))),
+			ent.WithAnnotation(&v2.EntitlementImmutable{}),
+		))
+	}
+
 	return rv, "", nil, nil
 }
 
+// mainBranchExemptions returns the branch exemptions of the restrictions applied to the main branch of the repository resource.
+func mainBranchExemptions(resource *v2.Resource) []branchExemption {
+	groupTrait, err := rs.GetGroupTrait(resource)
+	if err != nil {
+		return nil
+	}
+
+	restrictions := strings.Split(groupTrait.GetProfile().GetFields()[mainBranchRestrictionsProfileKey].GetStringValue(), ",")
+
+	var rv []branchExemption
+	for _, exemption := range branchExemptions {
+		if contains(exemption.kind, restrictions) {
+			rv = append(rv, exemption)
+		}
+	}
+
+	return rv
+}
+
+// branchExemptionGrants grants the branch exemptions to the users and groups listed in the repository profile.
+func branchExemptionGrants(resource *v2.Resource, workspaceId string) ([]*v2.Grant, error) {
+	groupTrait, err := rs.GetGroupTrait(resource)
+	if err != nil {
+		return nil, err
+	}
+	fields := groupTrait.GetProfile().GetFields()
+
+	const source = "/2.0/repositories/{workspace}/{repo_slug}/branch-restrictions"
+
+	var rv []*v2.Grant
+	for _, exemption := range mainBranchExemptions(resource) {
+		for _, id := range splitProfileList(fields[exemption.usersKey].GetStringValue()) {
+			userId, err := rs.NewResourceID(resourceTypeUser, id)
+			if err != nil {
+				return nil, err
+			}
+
+			rv = append(rv, grant.NewGrant(
+				resource,
+				exemption.entitlement,
+				userId,
+				grantSource(source, grantSourceDirect, exemption.kind),
+				grant.WithAnnotation(&v2.GrantImmutable{}),
+			))
+		}
+
+		for _, slug := range splitProfileList(fields[exemption.groupsKey].GetStringValue()) {
+			groupId := userGroupResourceId(workspaceId, slug)
+
+			rv = append(rv, grant.NewGrant(
+				resource,
+				exemption.entitlement,
+				groupId,
+				groupMembersExpandable(groupId),
+				grantSource(source, grantSourceGroup, exemption.kind),
+				grant.WithAnnotation(&v2.GrantImmutable{}),
+			))
+		}
+	}
+
+	return rv, nil
+}
+
+// splitProfileList splits a comma separated profile field, dropping the duplicates of overlapping restrictions.
+func splitProfileList(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	var rv []string
+	for _, item := range strings.Split(value, ",") {
+		if !contains(item, rv) {
+			rv = append(rv, item)
+		}
+	}
+
+	return rv
+}
+
+// enabledFeatures returns the features enabled on the repository resource.
+func enabledFeatures(resource *v2.Resource) []repositoryFeature {
+	groupTrait, err := rs.GetGroupTrait(resource)
+	if err != nil {
+		return nil
+	}
+
+	var rv []repositoryFeature
+	for _, feature := range repositoryFeatures {
+		if groupTrait.GetProfile().GetFields()[feature.profileKey].GetBoolValue() {
+			rv = append(rv, feature)
+		}
+	}
+
+	return rv
+}
+
+// repositoryIsPrivate reports whether the repository resource is private, repositories without the flag are treated as private.
+func repositoryIsPrivate(resource *v2.Resource) bool {
+	groupTrait, err := rs.GetGroupTrait(resource)
+	if err != nil {
+		return true
+	}
+
+	private, ok := groupTrait.GetProfile().GetFields()["repository_is_private"]
+	if !ok {
+		return true
+	}
+
+	return private.GetBoolValue()
+}
+
 func (r *repositoryResourceType) Grants(ctx context.Context, resource *v2.Resource, token *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
 	bag, err := parsePageToken(token.Token, resource.Id)
 	if err != nil {
@@ -160,9 +560,16 @@ func (r *repositoryResourceType) Grants(ctx context.Context, resource *v2.Resour
 		return nil, "", nil, err
 	}
 
+	features := enabledFeatures(resource)
+
 	var rv []*v2.Grant
 	switch bag.ResourceTypeID() {
 	case resourceTypeRepository.Id:
+		rv, err = branchExemptionGrants(resource, workspaceId)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
 		bag.Pop()
 		bag.Push(pagination.PageState{
 			ResourceTypeID: resourceTypeUserGroup.Id,
@@ -197,21 +604,29 @@ func (r *repositoryResourceType) Grants(ctx context.Context, resource *v2.Resour
 				continue
 			}
 
-			groupCopy := permission.Group
-
-			gr, err := userGroupResource(ctx, &groupCopy, &v2.ResourceId{Resource: workspaceId})
-			if err != nil {
-				return nil, "", nil, err
-			}
+			groupId := userGroupResourceId(workspaceId, permission.Group.Slug)
 
 			rv = append(
 				rv,
 				grant.NewGrant(
 					resource,
 					permission.Value,
-					gr.Id,
+					groupId,
+					groupMembersExpandable(groupId),
+					grantSource(permissionSource(permission.Permission, "/2.0/repositories/{workspace}/{repo_slug}/permissions-config/groups", "/1.0/group-privileges/{workspace}/{repo_slug}"), grantSourceGroup, permission.Value),
 				),
 			)
+
+			for _, feature := range features {
+				rv = append(rv, grant.NewGrant(
+					resource,
+					feature.entitlement,
+					groupId,
+					groupMembersExpandable(groupId),
+					grantSource(permissionSource(permission.Permission, "/2.0/repositories/{workspace}/{repo_slug}/permissions-config/groups", "/1.0/group-privileges/{workspace}/{repo_slug}"), grantSourceInherited, permission.Value),
+					grant.WithAnnotation(&v2.GrantImmutable{}),
+				))
+			}
 		}
 
 	// create a permission grant for each user in the repository
@@ -240,9 +655,7 @@ func (r *repositoryResourceType) Grants(ctx context.Context, resource *v2.Resour
 				continue
 			}
 
-			memberCopy := permission.User
-
-			ur, err := userResource(ctx, &memberCopy, &v2.ResourceId{Resource: workspaceId})
+			userId, err := rs.NewResourceID(resourceTypeUser, permission.User.Id)
 			if err != nil {
 				return nil, "", nil, err
 			}
@@ -252,9 +665,20 @@ func (r *repositoryResourceType) Grants(ctx context.Context, resource *v2.Resour
 				grant.NewGrant(
 					resource,
 					permission.Value,
-					ur.Id,
+					userId,
+					grantSource(permissionSource(permission.Permission, "/2.0/repositories/{workspace}/{repo_slug}/permissions-config/users", "/1.0/privileges/{workspace}/{repo_slug}"), grantSourceDirect, permission.Value),
 				),
 			)
+
+			for _, feature := range features {
+				rv = append(rv, grant.NewGrant(
+					resource,
+					feature.entitlement,
+					userId,
+					grantSource(permissionSource(permission.Permission, "/2.0/repositories/{workspace}/{repo_slug}/permissions-config/users", "/1.0/privileges/{workspace}/{repo_slug}"), grantSourceInherited, permission.Value),
+					grant.WithAnnotation(&v2.GrantImmutable{}),
+				))
+			}
 		}
 
 	default:
@@ -270,38 +694,44 @@ func (r *repositoryResourceType) Grants(ctx context.Context, resource *v2.Resour
 }
 
 func (r *repositoryResourceType) GetPermission(ctx context.Context, principal *v2.Resource, workspaceId, repoId string) (*bitbucket.Permission, error) {
-	if principal.Id.ResourceType == resourceTypeUser.Id {
-		userPermission, err := r.client.GetRepoUserPermission(
-			ctx,
-			workspaceId,
-			repoId,
-			principal.Id.Resource,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("bitbucket-connector: failed to get repository user permission: %w", err)
-		}
+	permission, err := r.permissions.RepositoryPermission(ctx, workspaceId, repoId, principal)
+	if err != nil {
+		return nil, err
+	}
 
-		return &userPermission.Permission, nil
-	} else if principal.Id.ResourceType == resourceTypeUserGroup.Id {
-		_, groupSlug, err := DecomposeGroupId(principal.Id.Resource)
-		if err != nil {
-			return nil, fmt.Errorf("bitbucket-connector: failed to grant repository permission: %w", err)
-		}
+	return &bitbucket.Permission{Value: permission}, nil
+}
 
-		groupPermission, err := r.client.GetRepoGroupPermission(
-			ctx,
-			workspaceId,
-			repoId,
-			groupSlug,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("bitbucket-connector: failed to get repository group permission: %w", err)
-		}
+// currentPermission reads the permission the principal holds under the repository on its own, without
+// listing every permission of the repository, so a revoke skipping the preflight still checks the role it deletes.
+func (r *repositoryResourceType) currentPermission(ctx context.Context, principal *v2.Resource, workspaceId, repoId string) (string, error) {
+	isGroup, id, err := principalKey(principal)
+	if err != nil {
+		return "", err
+	}
 
-		return &groupPermission.Permission, nil
+	var permission string
+	if isGroup {
+		var groupPermission *bitbucket.GroupPermission
+		groupPermission, err = r.client.GetRepoGroupPermission(ctx, workspaceId, repoId, id)
+		if err == nil {
+			permission = groupPermission.Value
+		}
+	} else {
+		var userPermission *bitbucket.UserPermission
+		userPermission, err = r.client.GetRepoUserPermission(ctx, workspaceId, repoId, id)
+		if err == nil {
+			permission = userPermission.Value
+		}
+	}
+	if errors.Is(err, bitbucket.ErrNotFound) {
+		return roleNone, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("bitbucket-connector: failed to get repository permission: %w", err)
 	}
 
-	return nil, fmt.Errorf("bitbucket-connector: invalid principal resource type: %s", principal.Id.ResourceType)
+	return permission, nil
 }
 
 func (r *repositoryResourceType) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
@@ -335,32 +765,59 @@ func (r *repositoryResourceType) Grant(ctx context.Context, principal *v2.Resour
 		return nil, err
 	}
 
-	permission, err := r.GetPermission(ctx, principal, workspaceId, repoId)
+	// check if the permission is supported repository role
+	if !contains(slug, repositoryRoles) {
+		return nil, fmt.Errorf("bitbucket-connector: unsupported repository role: %s", slug)
+	}
+
+	principal, err = resolvePrincipal(ctx, r.client, workspaceId, principal)
 	if err != nil {
 		return nil, err
 	}
 
-	// check if the permission is supported repository role
-	if !contains(slug, repositoryRoles) {
-		return nil, fmt.Errorf("bitbucket-connector: unsupported repository role: %s", entitlement.Slug)
+	err = checkPrincipal(ctx, r.client, workspaceId, principal)
+	if err != nil {
+		return nil, err
 	}
 
-	// warn if the principal already has a repository permission
-	if permission.Value != roleNone {
-		l.Warn(
-			"bitbucket-connector: principal already has a repository permission",
-		)
+	if !r.skipPreflight {
+		permission, err := r.GetPermission(ctx, principal, workspaceId, repoId)
+		if err != nil {
+			return nil, err
+		}
+
+		// nothing to do if the principal already has the requested repository permission
+		if permission.Value == slug {
+			l.Info(
+				"bitbucket-connector: principal already has this repository permission",
+				zap.String("principal_id", principal.Id.Resource),
+				zap.String("permission", slug),
+			)
+
+			return alreadyExistsAnnotations(), nil
+		}
+
+		// warn if the principal has a different repository permission which is going to be replaced
+		if permission.Value != roleNone {
+			l.Warn(
+				"bitbucket-connector: principal already has a repository permission",
+				zap.String("principal_id", principal.Id.Resource),
+				zap.String("permission", permission.Value),
+			)
+		}
 	}
 
 	// update the repository permission
 	if principalIsUser {
-		err := r.client.UpdateRepoUserPermission(
-			ctx,
-			workspaceId,
-			repoId,
-			principal.Id.Resource,
-			slug,
-		)
+		err := r.retry.withRateLimitRetry(ctx, func() error {
+			return r.client.UpdateRepoUserPermission(
+				ctx,
+				workspaceId,
+				repoId,
+				principal.Id.Resource,
+				slug,
+			)
+		})
 		if err != nil {
 			return nil, fmt.Errorf("bitbucket-connector: failed to update repository user permission: %w", err)
 		}
@@ -370,18 +827,22 @@ func (r *repositoryResourceType) Grant(ctx context.Context, principal *v2.Resour
 			return nil, fmt.Errorf("bitbucket-connector: failed to update repository permission: %w", err)
 		}
 
-		err = r.client.UpdateRepoGroupPermission(
-			ctx,
-			workspaceId,
-			repoId,
-			groupSlug,
-			slug,
-		)
+		err = r.retry.withRateLimitRetry(ctx, func() error {
+			return r.client.UpdateRepoGroupPermission(
+				ctx,
+				workspaceId,
+				repoId,
+				groupSlug,
+				slug,
+			)
+		})
 		if err != nil {
 			return nil, fmt.Errorf("bitbucket-connector: failed to update repository group permission: %w", err)
 		}
 	}
 
+	r.permissions.Set(repositoryPermissionsKey(workspaceId, repoId), principal, slug)
+
 	return nil, nil
 }
 
@@ -418,58 +879,103 @@ func (r *repositoryResourceType) Revoke(ctx context.Context, grant *v2.Grant) (a
 		return nil, err
 	}
 
-	permission, err := r.GetPermission(
-		ctx, principal, workspaceId, repoId)
+	// check if the permission is supported repository role
+	if !contains(slug, repositoryRoles) {
+		return nil, fmt.Errorf("bitbucket-connector: unsupported repository role: %s", slug)
+	}
+
+	// the DELETE removes whichever role the principal holds, so the current role is read even when
+	// the preflight is skipped, only without listing every permission of the repository
+	var permission string
+	if r.skipPreflight {
+		permission, err = r.currentPermission(ctx, principal, workspaceId, repoId)
+	} else {
+		var cached *bitbucket.Permission
+		cached, err = r.GetPermission(ctx, principal, workspaceId, repoId)
+		if cached != nil {
+			permission = cached.Value
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// check if the permission is supported repository role
-	if !contains(slug, repositoryRoles) {
-		return nil, fmt.Errorf("bitbucket-connector: unsupported repository role: %s", permission.Value)
+	// nothing to do if the principal already doesnt have any repository permission
+	if permission == roleNone {
+		l.Info(
+			"bitbucket-connector: principal already doesnt have this repository permission",
+			zap.String("principal_id", principal.Id.Resource),
+		)
+
+		return alreadyRevokedAnnotations(), nil
 	}
 
-	// warn if the principal already doesnt have this repository permission
-	if permission.Value == roleNone {
-		l.Warn(
-			"bitbucket-connector: principal already doesnt have this repository permission",
+	// the revoked role is gone already when the principal holds another one, which must be kept
+	if permission != slug {
+		l.Info(
+			"bitbucket-connector: principal holds another repository permission than the revoked one, keeping it",
+			zap.String("principal_id", principal.Id.Resource),
+			zap.String("permission", permission),
+			zap.String("revoked_permission", slug),
 		)
+
+		return alreadyRevokedAnnotations(), nil
 	}
 
 	// remove the repository permission
 	if principalIsUser {
-		err := r.client.DeleteRepoUserPermission(
-			ctx,
-			workspaceId,
-			repoId,
-			principal.Id.Resource,
-		)
+		err := r.retry.withRateLimitRetry(ctx, func() error {
+			return r.client.DeleteRepoUserPermission(
+				ctx,
+				workspaceId,
+				repoId,
+				principal.Id.Resource,
+			)
+		})
+		if errors.Is(err, bitbucket.ErrNotFound) {
+			r.permissions.Set(repositoryPermissionsKey(workspaceId, repoId), principal, roleNone)
+			return alreadyRevokedAnnotations(), nil
+		}
 		if err != nil {
 			return nil, fmt.Errorf("bitbucket-connector: failed to remove repository user permission: %w", err)
 		}
 	} else if principalIsGroup {
 		_, groupSlug, err := DecomposeGroupId(principal.Id.Resource)
 		if err != nil {
-			return nil, fmt.Errorf("bitbucket-connector: failed to remove repository user permission: %w", err)
+			return nil, fmt.Errorf("bitbucket-connector: failed to remove repository group permission: %w", err)
 		}
 
-		err = r.client.DeleteRepoGroupPermission(
-			ctx,
-			workspaceId,
-			repoId,
-			groupSlug,
-		)
+		err = r.retry.withRateLimitRetry(ctx, func() error {
+			return r.client.DeleteRepoGroupPermission(
+				ctx,
+				workspaceId,
+				repoId,
+				groupSlug,
+			)
+		})
+		if errors.Is(err, bitbucket.ErrNotFound) {
+			r.permissions.Set(repositoryPermissionsKey(workspaceId, repoId), principal, roleNone)
+			return alreadyRevokedAnnotations(), nil
+		}
 		if err != nil {
 			return nil, fmt.Errorf("bitbucket-connector: failed to remove repository group permission: %w", err)
 		}
 	}
 
+	r.permissions.Set(repositoryPermissionsKey(workspaceId, repoId), principal, roleNone)
+
 	return nil, nil
 }
 
-func repositoryBuilder(client *bitbucket.Client) *repositoryResourceType {
+func repositoryBuilder(client BitbucketClient, permissions *permissionCache, repos *projectRepoCache, retry *retryPolicy, skipPreflight bool, names *entitlementNames, staleAfter time.Duration) *repositoryResourceType {
 	return &repositoryResourceType{
-		resourceType: resourceTypeRepository,
-		client:       client,
+		resourceType:  resourceTypeRepository,
+		client:        client,
+		permissions:   permissions,
+		repos:         repos,
+		retry:         retry,
+		skipPreflight: skipPreflight,
+		names:         names,
+		staleAfter:    staleAfter,
 	}
 }
@@ -0,0 +1,36 @@
+package connector
+
+import "testing"
+
+func TestMatchBranchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "main", name: "main", want: true},
+		{pattern: "main", name: "main2", want: false},
+		{pattern: "*", name: "main", want: true},
+		{pattern: "*", name: "feature/login", want: true},
+		{pattern: "release/*", name: "release/1.0", want: true},
+		{pattern: "release/*", name: "release/1.0/hotfix", want: true},
+		{pattern: "release/*", name: "release", want: false},
+		{pattern: "release/*", name: "hotfix/release/1.0", want: false},
+		{pattern: "*/main", name: "team/main", want: true},
+		{pattern: "*/main", name: "org/team/main", want: true},
+		{pattern: "*/main", name: "main", want: false},
+		{pattern: "feature/*/ready", name: "feature/a/b/ready", want: true},
+		{pattern: "feature/*/ready", name: "feature/ready", want: false},
+		{pattern: "*-*", name: "a-b", want: true},
+		{pattern: "a*a", name: "a", want: false},
+		{pattern: "release/[0-9]", name: "release/1", want: false},
+		{pattern: "release/?", name: "release/1", want: false},
+		{pattern: "release/?", name: "release/?", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := matchBranchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchBranchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package connector
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxServerErrorAttempts is how many times a sync call failing with a server error is made before
+// the sync gives up on it.
+const maxServerErrorAttempts = 3
+
+// serverErrorRetries caps the retries of sync calls failing with a server error. Server errors are
+// reported as unavailable so the SDK retries the call from the page token it stored, but the SDK
+// retries unavailable calls without bound, so a call still failing after maxServerErrorAttempts
+// fails with a code the SDK doesn't retry.
+type serverErrorRetries struct {
+	mtx      sync.Mutex
+	attempts map[string]int
+}
+
+func newServerErrorRetries() *serverErrorRetries {
+	return &serverErrorRetries{
+		attempts: make(map[string]int),
+	}
+}
+
+// check counts the failed attempts of the call identified by the key, and returns the error the
+// call should fail with.
+func (r *serverErrorRetries) check(key string, err error) error {
+	if r == nil {
+		return err
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if err == nil || !errors.Is(err, bitbucket.ErrServerError) {
+		delete(r.attempts, key)
+		return err
+	}
+
+	r.attempts[key]++
+	if r.attempts[key] < maxServerErrorAttempts {
+		return err
+	}
+
+	delete(r.attempts, key)
+
+	return status.Errorf(codes.Internal, "bitbucket-connector: giving up after %d attempts: %v", maxServerErrorAttempts, err)
+}
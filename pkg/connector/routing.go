@@ -0,0 +1,541 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// workspaceClients routes every request to the client holding the credentials of the
+// workspace it targets, so workspaces can be synced with workspace-scoped credentials
+// without any principal having access to all of them. Requests to other workspaces
+// use the default credentials, when configured.
+type workspaceClients struct {
+	fallback *bitbucket.Client
+	bySlug   map[string]*bitbucket.Client
+
+	mtx        sync.RWMutex
+	byId       map[string]*bitbucket.Client
+	workspaces []bitbucket.Workspace
+}
+
+func newWorkspaceClients(fallback *bitbucket.Client, bySlug map[string]*bitbucket.Client) *workspaceClients {
+	return &workspaceClients{
+		fallback: fallback,
+		bySlug:   bySlug,
+		byId:     make(map[string]*bitbucket.Client),
+	}
+}
+
+// Resolve sets up the scope of the workspace credentials and maps them to the workspace ids,
+// which are what the resource builders route requests by.
+func (wc *workspaceClients) Resolve(ctx context.Context) error {
+	wc.mtx.Lock()
+	defer wc.mtx.Unlock()
+
+	wc.byId = make(map[string]*bitbucket.Client, len(wc.bySlug))
+	wc.workspaces = nil
+
+	for slug, client := range wc.bySlug {
+		user, err := client.Users.Current(ctx)
+		if err != nil {
+			return fmt.Errorf("bitbucket-connector: failed to get current user of workspace %s credentials: %w", slug, err)
+		}
+
+		err = setClientScope(client, user)
+		if err != nil {
+			return err
+		}
+
+		err = validateScopes(ctx, client, fmt.Sprintf("the credentials of workspace %s", slug))
+		if err != nil {
+			return err
+		}
+
+		workspace, err := client.Workspaces.Get(ctx, slug)
+		if err != nil {
+			return fmt.Errorf("bitbucket-connector: failed to get workspace %s: %w", slug, err)
+		}
+
+		wc.byId[workspace.Id] = client
+		wc.workspaces = append(wc.workspaces, *workspace)
+	}
+
+	return nil
+}
+
+// client returns the client holding the credentials of the workspace.
+func (wc *workspaceClients) client(workspaceId string) (*bitbucket.Client, error) {
+	wc.mtx.RLock()
+	defer wc.mtx.RUnlock()
+
+	if client, ok := wc.byId[workspaceId]; ok {
+		return client, nil
+	}
+
+	if wc.fallback != nil {
+		return wc.fallback, nil
+	}
+
+	return nil, status.Errorf(codes.PermissionDenied, "bitbucket-connector: no credentials configured for workspace %s", workspaceId)
+}
+
+// isMapped reports whether the workspace has its own credentials.
+func (wc *workspaceClients) isMapped(workspaceId string) bool {
+	wc.mtx.RLock()
+	defer wc.mtx.RUnlock()
+
+	_, ok := wc.byId[workspaceId]
+
+	return ok
+}
+
+// IsUserScoped is always true, as the workspaces are spread across multiple credentials.
+func (wc *workspaceClients) IsUserScoped() bool {
+	return true
+}
+
+func (wc *workspaceClients) WorkspaceId() (string, error) {
+	return "", bitbucket.ErrNotWorkspaceScoped
+}
+
+// GetWorkspaces lists the workspaces with their own credentials on the first page,
+// followed by the workspaces available to the default credentials.
+func (wc *workspaceClients) GetWorkspaces(ctx context.Context, getWorkspacesVars bitbucket.PaginationVars) ([]bitbucket.Workspace, string, error) {
+	var rv []bitbucket.Workspace
+	if getWorkspacesVars.Page == "" {
+		wc.mtx.RLock()
+		rv = append(rv, wc.workspaces...)
+		wc.mtx.RUnlock()
+	}
+
+	if wc.fallback == nil {
+		return rv, "", nil
+	}
+
+	if !wc.fallback.IsUserScoped() {
+		if getWorkspacesVars.Page != "" {
+			return rv, "", nil
+		}
+
+		workspaceId, err := wc.fallback.WorkspaceId()
+		if err != nil {
+			return nil, "", err
+		}
+
+		if wc.isMapped(workspaceId) {
+			return rv, "", nil
+		}
+
+		workspace, err := wc.fallback.Workspaces.Get(ctx, workspaceId)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return append(rv, *workspace), "", nil
+	}
+
+	workspaces, nextToken, err := wc.fallback.Workspaces.List(ctx, getWorkspacesVars)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, workspace := range workspaces {
+		if wc.isMapped(workspace.Id) {
+			continue
+		}
+
+		rv = append(rv, workspace)
+	}
+
+	return rv, nextToken, nil
+}
+
+// GetUser doesn't target a workspace, any of the credentials can read users.
+func (wc *workspaceClients) GetUser(ctx context.Context, userId string) (*bitbucket.User, error) {
+	if wc.fallback != nil {
+		return wc.fallback.Users.Get(ctx, userId)
+	}
+
+	for _, client := range wc.bySlug {
+		return client.Users.Get(ctx, userId)
+	}
+
+	return nil, status.Error(codes.InvalidArgument, "bitbucket-connector: no credentials configured")
+}
+
+func (wc *workspaceClients) GetWorkspace(ctx context.Context, workspaceId string) (*bitbucket.Workspace, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Workspaces.Get(ctx, workspaceId)
+}
+
+func (wc *workspaceClients) GetWorkspaceMembers(ctx context.Context, workspaceId string, getWorkspacesVars bitbucket.PaginationVars) ([]bitbucket.User, string, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client.Workspaces.Members(ctx, workspaceId, getWorkspacesVars)
+}
+
+func (wc *workspaceClients) GetWorkspaceMember(ctx context.Context, workspaceId string, userId string) (*bitbucket.User, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Workspaces.Member(ctx, workspaceId, userId)
+}
+
+func (wc *workspaceClients) FindWorkspaceMember(ctx context.Context, workspaceId string, identifier string) (*bitbucket.User, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Workspaces.FindMember(ctx, workspaceId, identifier)
+}
+
+func (wc *workspaceClients) GetWorkspaceProjects(ctx context.Context, workspaceId string, getWorkspaceProjectsVars bitbucket.PaginationVars) ([]bitbucket.Project, string, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client.Projects.List(ctx, workspaceId, getWorkspaceProjectsVars)
+}
+
+func (wc *workspaceClients) GetProjectRepos(ctx context.Context, workspaceId string, projectId string, getProjectReposVars bitbucket.PaginationVars) ([]bitbucket.Repository, string, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client.Repos.List(ctx, workspaceId, projectId, getProjectReposVars)
+}
+
+func (wc *workspaceClients) GetWorkspaceUserGroups(ctx context.Context, workspaceId string) ([]bitbucket.UserGroup, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.V1.Groups.List(ctx, workspaceId)
+}
+
+func (wc *workspaceClients) GetUserGroupMembers(ctx context.Context, workspaceId string, groupSlug string) ([]bitbucket.User, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.V1.Groups.Members(ctx, workspaceId, groupSlug)
+}
+
+func (wc *workspaceClients) AddUserToGroup(ctx context.Context, workspaceId string, groupSlug string, userId string) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.V1.Groups.AddMember(ctx, workspaceId, groupSlug, userId)
+}
+
+func (wc *workspaceClients) RemoveUserFromGroup(ctx context.Context, workspaceId string, groupSlug string, userId string) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.V1.Groups.RemoveMember(ctx, workspaceId, groupSlug, userId)
+}
+
+func (wc *workspaceClients) ForEachProjectGroupPermission(ctx context.Context, workspaceId string, projectKey string, fn func(bitbucket.GroupPermission) error) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Projects.ForEachGroupPermission(ctx, workspaceId, projectKey, fn)
+}
+
+func (wc *workspaceClients) ForEachProjectUserPermission(ctx context.Context, workspaceId string, projectKey string, fn func(bitbucket.UserPermission) error) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Projects.ForEachUserPermission(ctx, workspaceId, projectKey, fn)
+}
+
+func (wc *workspaceClients) ForEachRepositoryGroupPermission(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.GroupPermission) error) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Repos.ForEachGroupPermission(ctx, workspaceId, repoId, fn)
+}
+
+func (wc *workspaceClients) ForEachRepositoryUserPermission(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.UserPermission) error) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Repos.ForEachUserPermission(ctx, workspaceId, repoId, fn)
+}
+
+func (wc *workspaceClients) GetProjectBranchingModel(ctx context.Context, workspaceId string, projectKey string) (*bitbucket.BranchingModel, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Projects.BranchingModel(ctx, workspaceId, projectKey)
+}
+
+func (wc *workspaceClients) HasProjectPermissions(ctx context.Context, workspaceId string, projectKey string) (bool, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return false, err
+	}
+
+	return client.Projects.HasPermissions(ctx, workspaceId, projectKey)
+}
+
+func (wc *workspaceClients) GetProjectGroupPermissions(ctx context.Context, workspaceId string, projectKey string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.GroupPermission, string, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client.Projects.GroupPermissions(ctx, workspaceId, projectKey, getPermissionsVars)
+}
+
+func (wc *workspaceClients) GetProjectGroupPermission(ctx context.Context, workspaceId string, projectKey string, groupSlug string) (*bitbucket.GroupPermission, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Projects.GroupPermission(ctx, workspaceId, projectKey, groupSlug)
+}
+
+func (wc *workspaceClients) UpdateProjectGroupPermission(ctx context.Context, workspaceId string, projectKey string, groupSlug string, permission string) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Projects.UpdateGroupPermission(ctx, workspaceId, projectKey, groupSlug, permission)
+}
+
+func (wc *workspaceClients) DeleteProjectGroupPermission(ctx context.Context, workspaceId string, projectKey string, groupSlug string) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Projects.DeleteGroupPermission(ctx, workspaceId, projectKey, groupSlug)
+}
+
+func (wc *workspaceClients) GetProjectUserPermissions(ctx context.Context, workspaceId string, projectKey string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client.Projects.UserPermissions(ctx, workspaceId, projectKey, getPermissionsVars)
+}
+
+func (wc *workspaceClients) GetProjectUserPermission(ctx context.Context, workspaceId string, projectKey string, userId string) (*bitbucket.UserPermission, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Projects.UserPermission(ctx, workspaceId, projectKey, userId)
+}
+
+func (wc *workspaceClients) UpdateProjectUserPermission(ctx context.Context, workspaceId string, projectKey string, userId string, permission string) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Projects.UpdateUserPermission(ctx, workspaceId, projectKey, userId, permission)
+}
+
+func (wc *workspaceClients) DeleteProjectUserPermission(ctx context.Context, workspaceId string, projectKey string, userId string) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Projects.DeleteUserPermission(ctx, workspaceId, projectKey, userId)
+}
+
+func (wc *workspaceClients) GetRepositoryGroupPermissions(ctx context.Context, workspaceId string, repoId string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.GroupPermission, string, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client.Repos.GroupPermissions(ctx, workspaceId, repoId, getPermissionsVars)
+}
+
+func (wc *workspaceClients) GetRepoGroupPermission(ctx context.Context, workspaceId string, repoId string, groupSlug string) (*bitbucket.GroupPermission, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Repos.GroupPermission(ctx, workspaceId, repoId, groupSlug)
+}
+
+func (wc *workspaceClients) UpdateRepoGroupPermission(ctx context.Context, workspaceId string, repoId string, groupSlug string, permission string) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Repos.UpdateGroupPermission(ctx, workspaceId, repoId, groupSlug, permission)
+}
+
+func (wc *workspaceClients) DeleteRepoGroupPermission(ctx context.Context, workspaceId string, repoId string, groupSlug string) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Repos.DeleteGroupPermission(ctx, workspaceId, repoId, groupSlug)
+}
+
+func (wc *workspaceClients) GetRepositoryUserPermissions(ctx context.Context, workspaceId string, repoId string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client.Repos.UserPermissions(ctx, workspaceId, repoId, getPermissionsVars)
+}
+
+func (wc *workspaceClients) GetWorkspaceRepositoryUserPermissions(ctx context.Context, workspaceId string, getPermissionsVars bitbucket.PaginationVars) ([]bitbucket.UserPermission, string, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client.Workspaces.RepositoryUserPermissions(ctx, workspaceId, getPermissionsVars)
+}
+
+func (wc *workspaceClients) GetRepoUserPermission(ctx context.Context, workspaceId string, repoId string, userId string) (*bitbucket.UserPermission, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Repos.UserPermission(ctx, workspaceId, repoId, userId)
+}
+
+func (wc *workspaceClients) UpdateRepoUserPermission(ctx context.Context, workspaceId string, repoId string, userId string, permission string) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Repos.UpdateUserPermission(ctx, workspaceId, repoId, userId, permission)
+}
+
+func (wc *workspaceClients) DeleteRepoUserPermission(ctx context.Context, workspaceId string, repoId string, userId string) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Repos.DeleteUserPermission(ctx, workspaceId, repoId, userId)
+}
+
+func (wc *workspaceClients) GetRepositoryBranchRestrictions(ctx context.Context, workspaceId string, repoId string, getRestrictionsVars bitbucket.PaginationVars) ([]bitbucket.BranchRestriction, string, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client.Repos.BranchRestrictions(ctx, workspaceId, repoId, getRestrictionsVars)
+}
+
+func (wc *workspaceClients) ForEachRepositoryBranchRestriction(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.BranchRestriction) error) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Repos.ForEachBranchRestriction(ctx, workspaceId, repoId, fn)
+}
+
+func (wc *workspaceClients) ForEachRepositoryCommit(ctx context.Context, workspaceId string, repoId string, fn func(bitbucket.Commit) error) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Repos.ForEachCommit(ctx, workspaceId, repoId, fn)
+}
+
+func (wc *workspaceClients) ForEachRepositoryPullRequest(ctx context.Context, workspaceId string, repoId string, since time.Time, fn func(bitbucket.PullRequest) error) error {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	return client.Repos.ForEachPullRequest(ctx, workspaceId, repoId, since, fn)
+}
+
+func (wc *workspaceClients) GetRepositoryPipelinesConfig(ctx context.Context, workspaceId string, repoId string) (*bitbucket.PipelinesConfig, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Repos.PipelinesConfig(ctx, workspaceId, repoId)
+}
+
+func (wc *workspaceClients) GetRepositoryEnvironments(ctx context.Context, workspaceId string, repoId string, getEnvironmentsVars bitbucket.PaginationVars) ([]bitbucket.Environment, string, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client.Repos.Environments(ctx, workspaceId, repoId, getEnvironmentsVars)
+}
+
+func (wc *workspaceClients) GetWorkspaceRunners(ctx context.Context, workspaceId string, getRunnersVars bitbucket.PaginationVars) ([]bitbucket.Runner, string, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client.Workspaces.Runners(ctx, workspaceId, getRunnersVars)
+}
+
+func (wc *workspaceClients) GetRepositoryRunners(ctx context.Context, workspaceId string, repoId string, getRunnersVars bitbucket.PaginationVars) ([]bitbucket.Runner, string, error) {
+	client, err := wc.client(workspaceId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client.Repos.Runners(ctx, workspaceId, repoId, getRunnersVars)
+}
+
+var _ BitbucketClient = (*workspaceClients)(nil)
@@ -0,0 +1,159 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+type runnerResourceType struct {
+	resourceType *v2.ResourceType
+	client       BitbucketClient
+}
+
+func (r *runnerResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return r.resourceType
+}
+
+// Create a new connector resource for a Bitbucket Pipelines runner.
+func runnerResource(ctx context.Context, runner *bitbucket.Runner, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"runner_id":       runner.Id,
+		"runner_name":     runner.Name,
+		"runner_status":   runner.State.Status,
+		"runner_cordoned": runner.State.Cordoned,
+	}
+
+	if len(runner.Labels) > 0 {
+		profile["runner_labels"] = strings.Join(runner.Labels, ",")
+	}
+
+	if runner.State.UpdatedOn != "" {
+		profile["runner_last_contact"] = runner.State.UpdatedOn
+	}
+
+	resource, err := rs.NewGroupResource(
+		runner.Name,
+		resourceTypeRunner,
+		runner.Id,
+		[]rs.GroupTraitOption{
+			rs.WithGroupProfile(profile),
+		},
+		rs.WithParentResourceID(parentResourceID),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (r *runnerResourceType) List(ctx context.Context, parentId *v2.ResourceId, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentId == nil {
+		return nil, "", nil, nil
+	}
+
+	bag, err := parsePageToken(token.Token, &v2.ResourceId{ResourceType: resourceTypeRunner.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	runners, nextToken, err := r.listRunners(ctx, parentId, bag.PageToken())
+	if err != nil {
+		// runners are only visible to admins of workspaces and repositories with Pipelines enabled
+		if errors.Is(err, bitbucket.ErrPermissionDenied) {
+			ctxzap.Extract(ctx).Debug(
+				"bitbucket-connector: not allowed to list runners",
+				zap.String("parent_id", parentId.Resource),
+			)
+
+			return nil, "", nil, nil
+		}
+
+		// runners are only exposed by the undocumented internal API, which can change without notice
+		if errors.Is(err, bitbucket.ErrNotFound) || errors.Is(err, bitbucket.ErrUnexpectedResponse) {
+			ctxzap.Extract(ctx).Warn(
+				"bitbucket-connector: runners unavailable, skipping them",
+				zap.String("parent_id", parentId.Resource),
+				zap.Error(err),
+			)
+
+			return nil, "", nil, nil
+		}
+
+		return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to list runners: %w", err)
+	}
+
+	pageToken, err := bag.NextToken(nextToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Resource
+	for _, runner := range runners {
+		runnerCopy := runner
+
+		rr, err := runnerResource(ctx, &runnerCopy, parentId)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		rv = append(rv, rr)
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+// listRunners returns a page of runners registered to the workspace or repository.
+func (r *runnerResourceType) listRunners(ctx context.Context, parentId *v2.ResourceId, page string) ([]bitbucket.Runner, string, error) {
+	paginationVars := bitbucket.PaginationVars{
+		Limit: ResourcesPageSize,
+		Page:  page,
+	}
+
+	switch parentId.ResourceType {
+	case resourceTypeWorkspace.Id:
+		return r.client.GetWorkspaceRunners(ctx, parentId.Resource, paginationVars)
+
+	case resourceTypeRepository.Id:
+		composedProjectId, repositoryId, err := DecomposeRepositoryId(parentId.Resource)
+		if err != nil {
+			return nil, "", err
+		}
+
+		workspaceId, _, _, err := DecomposeProjectId(composedProjectId)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return r.client.GetRepositoryRunners(ctx, workspaceId, repositoryId, paginationVars)
+
+	default:
+		return nil, "", fmt.Errorf("bitbucket-connector: invalid runner parent resource type: %s", parentId.ResourceType)
+	}
+}
+
+func (r *runnerResourceType) Entitlements(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (r *runnerResourceType) Grants(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func runnerBuilder(client BitbucketClient) *runnerResourceType {
+	return &runnerResourceType{
+		resourceType: resourceTypeRunner,
+		client:       client,
+	}
+}
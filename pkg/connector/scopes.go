@@ -0,0 +1,92 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// requiredScope is an OAuth scope the connector relies on.
+type requiredScope struct {
+	scope string
+	// usage describes what the scope is needed for in the error listing missing scopes
+	usage string
+	// userScoped is set for scopes only needed by credentials of a user
+	userScoped bool
+	// project is set for scopes also needed by project access tokens, which only sync their project
+	project bool
+	// repository is set for scopes also needed by repository access tokens, which only sync their repository
+	repository bool
+	// optional scopes only limit what is synced, a warning is logged when they are missing
+	optional bool
+}
+
+var requiredScopes = []requiredScope{
+	{scope: "account", usage: "listing the workspaces of the user", userScoped: true},
+	{scope: "team", usage: "listing workspace members and user groups"},
+	{scope: "project:admin", usage: "reading project permissions", project: true},
+	{scope: "repository:admin", usage: "reading repository permissions", project: true, repository: true},
+	{scope: "runner", usage: "syncing Pipelines runners", optional: true},
+}
+
+// hasScope reports whether the scope was granted, either directly or through a
+// scope granting more access to the same resource, e.g. team through team:write.
+func hasScope(granted []string, scope string) bool {
+	for _, g := range granted {
+		if g == scope || strings.HasPrefix(g, scope+":") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateScopes fails when the credentials of the client lack some of the OAuth scopes a sync needs,
+// instead of the sync failing once it reaches the first request the credentials are not allowed to make.
+// Credentials whose scopes Bitbucket doesn't report are not checked.
+func validateScopes(ctx context.Context, client *bitbucket.Client, credentials string) error {
+	l := ctxzap.Extract(ctx)
+
+	granted, ok := client.OAuthScopes()
+	if !ok {
+		l.Debug("bitbucket-connector: OAuth scopes not reported, skipping the scope validation", zap.String("credentials", credentials))
+		return nil
+	}
+
+	var missing []string
+	for _, required := range requiredScopes {
+		if required.userScoped && !client.IsUserScoped() {
+			continue
+		}
+
+		if !required.project && client.IsProjectScoped() || !required.repository && client.IsRepositoryScoped() {
+			continue
+		}
+
+		if hasScope(granted, required.scope) {
+			continue
+		}
+
+		if required.optional {
+			l.Warn(
+				"bitbucket-connector: credentials are missing an optional OAuth scope",
+				zap.String("credentials", credentials),
+				zap.String("scope", required.scope),
+				zap.String("usage", required.usage),
+			)
+			continue
+		}
+
+		missing = append(missing, fmt.Sprintf("%s (%s)", required.scope, required.usage))
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("bitbucket-connector: %s are missing required OAuth scopes: %s", credentials, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusError gives the errors of the Bitbucket client the gRPC status the SDK reasons about,
+// e.g. it retries the unavailable listings from the page token it stored instead of failing the sync.
+// Errors which already carry a status keep it.
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	return status.Error(statusCode(err), err.Error())
+}
+
+func statusCode(err error) codes.Code {
+	var apiErr *bitbucket.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusUnauthorized:
+			return codes.Unauthenticated
+		case http.StatusForbidden:
+			return codes.PermissionDenied
+		case http.StatusNotFound:
+			return codes.NotFound
+		case http.StatusRequestTimeout:
+			return codes.DeadlineExceeded
+		case http.StatusConflict:
+			return codes.AlreadyExists
+		case http.StatusTooManyRequests:
+			return codes.Unavailable
+		case http.StatusNotImplemented:
+			return codes.Unimplemented
+		}
+
+		// the connector caps the retries of server errors, as the SDK doesn't
+		if apiErr.StatusCode >= http.StatusInternalServerError {
+			return codes.Unavailable
+		}
+
+		return codes.Unknown
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, ErrUserNotInWorkspace):
+		return codes.FailedPrecondition
+	case errors.Is(err, ErrGroupNotFound):
+		return codes.NotFound
+	case errors.Is(err, bitbucket.ErrNoWorkspaces):
+		return codes.Unauthenticated
+	case errors.Is(err, bitbucket.ErrNotWorkspaceScoped), errors.Is(err, bitbucket.ErrNotUserScoped):
+		return codes.InvalidArgument
+	}
+
+	return codes.Unknown
+}
@@ -0,0 +1,153 @@
+package connector
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// syncPhaseIdle is how long no syncer call has to be made for a phase before it is logged,
+// the connector can't tell when the SDK is done with a phase.
+const syncPhaseIdle = 10 * time.Second
+
+// syncPhase is one operation (List, Entitlements, Grants) of one resource type in a workspace.
+type syncPhase struct {
+	operation    string
+	resourceType string
+	workspaceId  string
+}
+
+// phaseTiming sums up the syncer calls of a phase.
+type phaseTiming struct {
+	started  time.Time
+	ended    time.Time
+	calls    int
+	items    int
+	apiCalls int64
+	busy     time.Duration
+}
+
+// syncTimings logs how long every phase of a sync took, so operators can find the resource types
+// and workspaces a long sync spends its time in. The SDK interleaves the phases, e.g. it lists the
+// runners and environments of one repository after another, so a phase is logged once it had no
+// calls for a while, or when the next sync starts. Every call is logged at debug level as well,
+// as the last phases of a sync may not be logged before the process exits.
+type syncTimings struct {
+	mtx    sync.Mutex
+	phases map[syncPhase]*phaseTiming
+	sweep  *time.Timer
+	// ctx is the context of the latest call, its logger is used by the sweeps
+	ctx context.Context
+}
+
+func newSyncTimings() *syncTimings {
+	return &syncTimings{
+		phases: make(map[syncPhase]*phaseTiming),
+	}
+}
+
+// record adds a syncer call to the timing of its phase.
+func (t *syncTimings) record(ctx context.Context, phase syncPhase, started time.Time, items int, apiCalls int64) {
+	ended := time.Now()
+
+	ctxzap.Extract(ctx).Debug(
+		"bitbucket-connector: sync call finished",
+		zap.String("operation", phase.operation),
+		zap.String("resource_type", phase.resourceType),
+		zap.String("workspace_id", phase.workspaceId),
+		zap.Duration("duration", ended.Sub(started)),
+		zap.Int("count", items),
+		zap.Int64("api_calls", apiCalls),
+	)
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	timing, ok := t.phases[phase]
+	if !ok {
+		timing = &phaseTiming{started: started}
+		t.phases[phase] = timing
+	}
+
+	timing.ended = ended
+	timing.calls++
+	timing.items += items
+	timing.apiCalls += apiCalls
+	timing.busy += ended.Sub(started)
+
+	t.ctx = ctx
+	if t.sweep == nil {
+		t.sweep = time.AfterFunc(syncPhaseIdle, t.logIdle)
+	}
+}
+
+// Reset logs the phases of the previous sync when a new sync starts.
+func (t *syncTimings) Reset() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.log(func(*phaseTiming) bool { return true })
+}
+
+func (t *syncTimings) logIdle() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.sweep = nil
+
+	idleSince := time.Now().Add(-syncPhaseIdle)
+	t.log(func(timing *phaseTiming) bool { return !timing.ended.After(idleSince) })
+
+	// sweep again once the phase with the oldest call becomes idle
+	var oldest time.Time
+	for _, timing := range t.phases {
+		if oldest.IsZero() || timing.ended.Before(oldest) {
+			oldest = timing.ended
+		}
+	}
+	if !oldest.IsZero() {
+		t.sweep = time.AfterFunc(time.Until(oldest.Add(syncPhaseIdle)), t.logIdle)
+	}
+}
+
+// log logs and forgets the matching phases, in the order they started.
+func (t *syncTimings) log(match func(*phaseTiming) bool) {
+	var phases []syncPhase
+	for phase, timing := range t.phases {
+		if match(timing) {
+			phases = append(phases, phase)
+		}
+	}
+	if len(phases) == 0 {
+		return
+	}
+
+	sort.Slice(phases, func(i, j int) bool {
+		return t.phases[phases[i]].started.Before(t.phases[phases[j]].started)
+	})
+
+	l := ctxzap.Extract(t.ctx)
+	for _, phase := range phases {
+		timing := t.phases[phase]
+
+		l.Info(
+			"bitbucket-connector: sync phase finished",
+			zap.String("operation", phase.operation),
+			zap.String("resource_type", phase.resourceType),
+			zap.String("workspace_id", phase.workspaceId),
+			zap.Time("started_at", timing.started),
+			zap.Time("ended_at", timing.ended),
+			zap.Duration("duration", timing.ended.Sub(timing.started)),
+			zap.Duration("busy", timing.busy),
+			zap.Int("calls", timing.calls),
+			zap.Int("count", timing.items),
+			zap.Int64("api_calls", timing.apiCalls),
+		)
+
+		delete(t.phases, phase)
+	}
+}
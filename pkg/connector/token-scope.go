@@ -0,0 +1,182 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+)
+
+// Types of the principal behind project and repository access tokens.
+const (
+	projectPrincipalType    = "project"
+	repositoryPrincipalType = "repository"
+)
+
+// tokenScope is what a project or repository access token is bound to. The repository is nil for project tokens.
+type tokenScope struct {
+	workspace  *bitbucket.Workspace
+	project    *bitbucket.Project
+	repository *bitbucket.Repository
+}
+
+// scopedClient narrows the synced resources to the project or the repository an access token
+// is bound to, along with the workspace they belong to. Such tokens are not allowed to list
+// anything above their project or repository, so these listings are answered from the scope
+// instead of failing. Until a project or repository token is detected by Validate, every
+// request is passed to the wrapped client as is.
+type scopedClient struct {
+	BitbucketClient
+	client *bitbucket.Client
+
+	mtx   sync.RWMutex
+	scope *tokenScope
+}
+
+func newScopedClient(client *bitbucket.Client) *scopedClient {
+	return &scopedClient{
+		BitbucketClient: apiClient{client},
+		client:          client,
+	}
+}
+
+// isScopedPrincipal reports whether the principal is a project or repository access token.
+func isScopedPrincipal(user *bitbucket.User) bool {
+	return user.Type == projectPrincipalType || user.Type == repositoryPrincipalType
+}
+
+// Resolve fetches the project or repository of the token along with its workspace and limits the client to it.
+func (sc *scopedClient) Resolve(ctx context.Context, user *bitbucket.User) error {
+	var scope *tokenScope
+
+	// the token can't list workspaces, so its project or repository is addressed by the UUID alone
+	switch user.Type {
+	case projectPrincipalType:
+		project, err := sc.client.Projects.Get(ctx, "{}", user.Id)
+		if err != nil {
+			return fmt.Errorf("bitbucket-connector: failed to get project of the access token: %w", err)
+		}
+
+		if project.Workspace == nil {
+			return fmt.Errorf("bitbucket-connector: project %s is missing its workspace", user.Id)
+		}
+
+		sc.client.SetupProjectScope(project.Workspace.Id, project.Id)
+		scope = &tokenScope{
+			workspace: project.Workspace,
+			project:   project,
+		}
+
+	case repositoryPrincipalType:
+		repository, err := sc.client.Repos.Get(ctx, "{}", user.Id)
+		if err != nil {
+			return fmt.Errorf("bitbucket-connector: failed to get repository of the access token: %w", err)
+		}
+
+		if repository.Workspace == nil || repository.Project == nil {
+			return fmt.Errorf("bitbucket-connector: repository %s is missing its workspace or project", user.Id)
+		}
+
+		sc.client.SetupRepositoryScope(repository.Workspace.Id, repository.Project.Id, repository.Id)
+		scope = &tokenScope{
+			workspace: repository.Workspace,
+			project: &bitbucket.Project{
+				BaseResource: repository.Project.BaseResource,
+				Key:          repository.Project.Key,
+				Name:         repository.Project.Name,
+			},
+			repository: repository,
+		}
+
+	default:
+		return fmt.Errorf("bitbucket-connector: unsupported access token type: %s", user.Type)
+	}
+
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+
+	sc.scope = scope
+
+	return nil
+}
+
+// scoped returns what the client is limited to, nil when it is not limited.
+func (sc *scopedClient) scoped() *tokenScope {
+	sc.mtx.RLock()
+	defer sc.mtx.RUnlock()
+
+	return sc.scope
+}
+
+func (sc *scopedClient) GetWorkspace(ctx context.Context, workspaceId string) (*bitbucket.Workspace, error) {
+	scope := sc.scoped()
+	if scope == nil || scope.workspace.Id != workspaceId {
+		return sc.BitbucketClient.GetWorkspace(ctx, workspaceId)
+	}
+
+	workspace := *scope.workspace
+
+	return &workspace, nil
+}
+
+func (sc *scopedClient) GetWorkspaceMembers(ctx context.Context, workspaceId string, getWorkspacesVars bitbucket.PaginationVars) ([]bitbucket.User, string, error) {
+	if sc.scoped() == nil {
+		return sc.BitbucketClient.GetWorkspaceMembers(ctx, workspaceId, getWorkspacesVars)
+	}
+
+	return nil, "", nil
+}
+
+func (sc *scopedClient) GetWorkspaceUserGroups(ctx context.Context, workspaceId string) ([]bitbucket.UserGroup, error) {
+	if sc.scoped() == nil {
+		return sc.BitbucketClient.GetWorkspaceUserGroups(ctx, workspaceId)
+	}
+
+	return nil, nil
+}
+
+func (sc *scopedClient) GetWorkspaceProjects(ctx context.Context, workspaceId string, getWorkspaceProjectsVars bitbucket.PaginationVars) ([]bitbucket.Project, string, error) {
+	scope := sc.scoped()
+	if scope == nil {
+		return sc.BitbucketClient.GetWorkspaceProjects(ctx, workspaceId, getWorkspaceProjectsVars)
+	}
+
+	if scope.workspace.Id != workspaceId || getWorkspaceProjectsVars.Page != "" {
+		return nil, "", nil
+	}
+
+	return []bitbucket.Project{*scope.project}, "", nil
+}
+
+// GetProjectRepos lists the repositories of a project token as usual, a repository token only gets its repository.
+func (sc *scopedClient) GetProjectRepos(ctx context.Context, workspaceId string, projectId string, getProjectReposVars bitbucket.PaginationVars) ([]bitbucket.Repository, string, error) {
+	scope := sc.scoped()
+	if scope == nil || scope.repository == nil {
+		return sc.BitbucketClient.GetProjectRepos(ctx, workspaceId, projectId, getProjectReposVars)
+	}
+
+	if scope.project.Id != projectId || getProjectReposVars.Page != "" {
+		return nil, "", nil
+	}
+
+	return []bitbucket.Repository{*scope.repository}, "", nil
+}
+
+// HasProjectPermissions is always false for a repository token, as it can't read the project permissions.
+func (sc *scopedClient) HasProjectPermissions(ctx context.Context, workspaceId string, projectKey string) (bool, error) {
+	scope := sc.scoped()
+	if scope == nil || scope.repository == nil {
+		return sc.BitbucketClient.HasProjectPermissions(ctx, workspaceId, projectKey)
+	}
+
+	return false, nil
+}
+
+func (sc *scopedClient) GetWorkspaceRunners(ctx context.Context, workspaceId string, getRunnersVars bitbucket.PaginationVars) ([]bitbucket.Runner, string, error) {
+	if sc.scoped() == nil {
+		return sc.BitbucketClient.GetWorkspaceRunners(ctx, workspaceId, getRunnersVars)
+	}
+
+	return nil, "", nil
+}
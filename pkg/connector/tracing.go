@@ -0,0 +1,73 @@
+package connector
+
+import (
+	"context"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts a span for every call of the resource syncers, so the API requests made by the call
+// show up under it. Spans are no-ops unless a tracer provider is configured.
+var tracer = otel.Tracer(instrumentationName)
+
+func (t *instrumentedSyncer) start(ctx context.Context, operation string, resourceId *v2.ResourceId, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("baton.resource_type", t.syncer.ResourceType(ctx).Id))
+	if resourceId != nil {
+		attrs = append(attrs,
+			attribute.String("baton.resource_id", resourceId.Resource),
+			attribute.String("bitbucket.workspace", workspaceIdOf(resourceId)),
+		)
+	}
+
+	return tracer.Start(ctx, t.syncer.ResourceType(ctx).Id+"."+operation, trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// workspaceIdOf returns the workspace the resource belongs to, empty for users and unknown IDs.
+func workspaceIdOf(resourceId *v2.ResourceId) string {
+	id := resourceId.Resource
+
+	switch resourceId.ResourceType {
+	case resourceTypeWorkspace.Id:
+		return id
+
+	case resourceTypeUserGroup.Id:
+		workspaceId, _, _ := DecomposeGroupId(id)
+		return workspaceId
+
+	case resourceTypeProject.Id:
+		workspaceId, _, _, _ := DecomposeProjectId(id)
+		return workspaceId
+
+	case resourceTypeRepository.Id:
+		projectId, _, err := DecomposeRepositoryId(id)
+		if err != nil {
+			return ""
+		}
+
+		workspaceId, _, _, _ := DecomposeProjectId(projectId)
+		return workspaceId
+
+	case resourceTypeEnvironment.Id:
+		repositoryId, _, err := DecomposeEnvironmentId(id)
+		if err != nil {
+			return ""
+		}
+
+		return workspaceIdOf(&v2.ResourceId{ResourceType: resourceTypeRepository.Id, Resource: repositoryId})
+	}
+
+	return ""
+}
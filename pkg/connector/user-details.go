@@ -0,0 +1,145 @@
+package connector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
+)
+
+const defaultUserFetchConcurrency = 10
+
+// userDetails fetches the users behind workspace members, as the member listing lacks
+// some of their details, e.g. the account status. The users of a page are fetched by a
+// bounded number of concurrent requests, and a user belonging to multiple workspaces is
+// fetched only once per sync.
+type userDetails struct {
+	client      BitbucketClient
+	concurrency int
+	mtx         sync.Mutex
+	users       map[string]*userFetch
+}
+
+// userFetch is a fetch of a user, done is closed once the user or the error is set.
+type userFetch struct {
+	done chan struct{}
+	user *bitbucket.User
+	err  error
+}
+
+func newUserDetails(client BitbucketClient, concurrency int) *userDetails {
+	if concurrency <= 0 {
+		concurrency = defaultUserFetchConcurrency
+	}
+
+	return &userDetails{
+		client:      client,
+		concurrency: concurrency,
+		users:       make(map[string]*userFetch),
+	}
+}
+
+// Reset drops the fetched users, so the next sync sees fresh details.
+func (d *userDetails) Reset() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.users = make(map[string]*userFetch)
+}
+
+// Fetch returns the users with the given IDs in the same order. The first failed
+// fetch cancels the remaining ones and is returned.
+func (d *userDetails) Fetch(ctx context.Context, userIds []string) ([]*bitbucket.User, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rv := make([]*bitbucket.User, len(userIds))
+
+	var failed sync.Once
+	var firstErr error
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(d.concurrency, len(userIds)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range next {
+				user, err := d.get(ctx, userIds[i])
+				if err != nil {
+					failed.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+
+				rv[i] = user
+			}
+		}()
+	}
+
+feed:
+	for i := range userIds {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	// the sync was cancelled before every user was handed to a worker
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+// get returns a copy of the user, waiting for a fetch of the same user which is already in flight.
+func (d *userDetails) get(ctx context.Context, userId string) (*bitbucket.User, error) {
+	d.mtx.Lock()
+	f, inFlight := d.users[userId]
+	if !inFlight {
+		f = &userFetch{done: make(chan struct{})}
+		d.users[userId] = f
+	}
+	d.mtx.Unlock()
+
+	if inFlight {
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	} else {
+		f.user, f.err = d.client.GetUser(ctx, userId)
+		close(f.done)
+
+		// a failed fetch is retried by the next lookup instead of failing it as well
+		if f.err != nil {
+			d.mtx.Lock()
+			if d.users[userId] == f {
+				delete(d.users, userId)
+			}
+			d.mtx.Unlock()
+		}
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	// the caller sets the membership details of its workspace on the user
+	user := *f.user
+
+	return &user, nil
+}
@@ -2,6 +2,7 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -14,11 +15,23 @@ import (
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type userGroupResourceType struct {
-	resourceType *v2.ResourceType
-	client       *bitbucket.Client
+	resourceType  *v2.ResourceType
+	client        BitbucketClient
+	skipPreflight bool
+	names         *entitlementNames
+	// managed tells the groups synced from an identity provider (SCIM/Atlassian Access),
+	// their membership can not be changed via the API.
+	managed *managedGroups
+	members *groupMemberCache
+	retry   *retryPolicy
+	// checkpoints persist the group listings for a sync restarted after a crash
+	checkpoints *groupCheckpoints
+	// asRoles emits the groups with the role trait, for platforms which model them as roles
+	asRoles bool
 }
 
 func (ug *userGroupResourceType) ResourceType(_ context.Context) *v2.ResourceType {
@@ -26,31 +39,47 @@ func (ug *userGroupResourceType) ResourceType(_ context.Context) *v2.ResourceTyp
 }
 
 func ComposedGroupId(workspaceId, groupSlug string) string {
-	return fmt.Sprintf("%s:%s", workspaceId, groupSlug)
+	return encodeResourceId(workspaceId, groupSlug)
 }
 
 func DecomposeGroupId(id string) (string, string, error) {
-	parts := strings.Split(id, ":")
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("bitbucket-connector: invalid user group resource id")
+	segments, err := decodeResourceId(id, 2)
+	if err != nil {
+		return "", "", fmt.Errorf("bitbucket-connector: invalid user group resource id: %w", err)
 	}
 
-	return parts[0], parts[1], nil
+	return segments[0], segments[1], nil
 }
 
-// Create a new connector resource for an Bitbucket UserGroup.
-func userGroupResource(ctx context.Context, userGroup *bitbucket.UserGroup, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+// Create a new connector resource for an Bitbucket UserGroup, with the role trait when asRole is set.
+func userGroupResource(ctx context.Context, userGroup *bitbucket.UserGroup, parentResourceID *v2.ResourceId, asRole bool) (*v2.Resource, error) {
 	userIDsTotal := len(userGroup.Members)
 	profile := map[string]interface{}{
 		"userGroup_name":       userGroup.Name,
 		"userGroup_slug":       userGroup.Slug,
 		"userGroup_permission": userGroup.Permission,
+		"userGroup_auto_add":   userGroup.AutoAdd,
 	}
 
+	profile["userGroup_member_count"] = userIDsTotal
+
 	if userIDsTotal > 0 {
 		userIDs := mapUserIDs(userGroup.Members)
 
 		profile["userGroup_members"] = strings.Join(userIDs, ",")
+	} else {
+		// the project and repository permissions of a group without members are dormant standing access
+		profile["userGroup_empty"] = true
+	}
+
+	if asRole {
+		return rs.NewRoleResource(
+			userGroup.Name,
+			resourceTypeUserGroupRole,
+			ComposedGroupId(parentResourceID.Resource, userGroup.Slug),
+			[]rs.RoleTraitOption{rs.WithRoleProfile(profile)},
+			rs.WithParentResourceID(parentResourceID),
+		)
 	}
 
 	resource, err := rs.NewGroupResource(
@@ -68,21 +97,46 @@ func userGroupResource(ctx context.Context, userGroup *bitbucket.UserGroup, pare
 	return resource, nil
 }
 
+// userGroupProfile returns the profile of a user group resource, whichever trait it was built with.
+func userGroupProfile(resource *v2.Resource) (*structpb.Struct, error) {
+	if roleTrait, err := rs.GetRoleTrait(resource); err == nil {
+		return roleTrait.Profile, nil
+	}
+
+	groupTrait, err := rs.GetGroupTrait(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	return groupTrait.Profile, nil
+}
+
 func (ug *userGroupResourceType) List(ctx context.Context, parentId *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
 	if parentId == nil {
 		return nil, "", nil, nil
 	}
 
-	userGroups, err := ug.client.GetWorkspaceUserGroups(ctx, parentId.Resource)
-	if err != nil {
-		return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to list userGroups: %w", err)
+	userGroups, ok := ug.checkpoints.Load(ctx, parentId.Resource)
+	if !ok {
+		var err error
+		userGroups, err = ug.client.GetWorkspaceUserGroups(ctx, parentId.Resource)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to list userGroups: %w", err)
+		}
+
+		ug.checkpoints.Save(ctx, parentId.Resource, userGroups)
 	}
 
 	var rv []*v2.Resource
 	for _, userGroup := range userGroups {
 		userGroupCopy := userGroup
 
-		gr, err := userGroupResource(ctx, &userGroupCopy, parentId)
+		// the v1 listing already contains members, share them with Grant/Revoke unless they come from an older checkpoint
+		if !ok {
+			ug.members.Store(parentId.Resource, userGroupCopy.Slug, userGroupCopy.Members)
+		}
+
+		gr, err := userGroupResource(ctx, &userGroupCopy, parentId, ug.asRoles)
 		if err != nil {
 			return nil, "", nil, err
 		}
@@ -94,11 +148,33 @@ func (ug *userGroupResourceType) List(ctx context.Context, parentId *v2.Resource
 }
 
 func (ug *userGroupResourceType) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	_, groupSlug, err := DecomposeGroupId(resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	displayName := fmt.Sprintf("%s UserGroup %s", resource.DisplayName, memberEntitlement)
+	description := fmt.Sprintf("Access to %s userGroup in Bitbucket", resource.DisplayName)
+	if ug.asRoles {
+		displayName = fmt.Sprintf("%s Role", resource.DisplayName)
+		description = fmt.Sprintf("Assignment of the %s role in Bitbucket", resource.DisplayName)
+	}
+
 	var rv []*v2.Entitlement
 	assignmentOptions := []ent.EntitlementOption{
 		ent.WithGrantableTo(resourceTypeUser),
-		ent.WithDisplayName(fmt.Sprintf("%s UserGroup %s", resource.DisplayName, memberEntitlement)),
-		ent.WithDescription(fmt.Sprintf("Access to %s userGroup in Bitbucket", resource.DisplayName)),
+		ent.WithDisplayName(ug.names.DisplayName(resource, memberEntitlement, displayName)),
+		ent.WithDescription(ug.names.Description(resource, memberEntitlement, description)),
+	}
+
+	managed, err := ug.managed.IsManaged(ctx, groupSlug, resource.DisplayName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// membership of managed groups can only be changed in the identity provider
+	if managed {
+		assignmentOptions = append(assignmentOptions, ent.WithAnnotation(&v2.EntitlementImmutable{}))
 	}
 
 	// create membership entitlement
@@ -112,18 +188,34 @@ func (ug *userGroupResourceType) Entitlements(ctx context.Context, resource *v2.
 }
 
 func (ug *userGroupResourceType) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	userGroupTrait, err := rs.GetGroupTrait(resource)
+	profile, err := userGroupProfile(resource)
 	if err != nil {
 		return nil, "", nil, err
 	}
 
-	userIDsString, ok := rs.GetProfileStringValue(userGroupTrait.Profile, "userGroup_members")
+	userIDsString, ok := rs.GetProfileStringValue(profile, "userGroup_members")
 	if !ok {
 		return nil, "", nil, nil
 	}
 
 	userIDs := strings.Split(userIDsString, ",")
 
+	_, groupSlug, err := DecomposeGroupId(resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	grantOptions := []grant.GrantOption{
+		grantSource("/1.0/groups/{workspace}", grantSourceDirect, memberEntitlement),
+	}
+	managed, err := ug.managed.IsManaged(ctx, groupSlug, resource.DisplayName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if managed {
+		grantOptions = append(grantOptions, grant.WithAnnotation(&v2.GrantImmutable{}))
+	}
+
 	// create membership grants
 	var rv []*v2.Grant
 	for _, id := range userIDs {
@@ -138,6 +230,7 @@ func (ug *userGroupResourceType) Grants(ctx context.Context, resource *v2.Resour
 				resource,
 				memberEntitlement,
 				rID,
+				grantOptions...,
 			),
 		)
 	}
@@ -145,6 +238,20 @@ func (ug *userGroupResourceType) Grants(ctx context.Context, resource *v2.Resour
 	return rv, "", nil, nil
 }
 
+// checkUnmanaged fails when the membership of the group is managed by an identity provider, which would overwrite the change.
+func (ug *userGroupResourceType) checkUnmanaged(ctx context.Context, groupSlug string) error {
+	managed, err := ug.managed.IsManaged(ctx, groupSlug, "")
+	if err != nil {
+		return err
+	}
+
+	if managed {
+		return fmt.Errorf("bitbucket-connector: user group %s is managed by an identity provider and can not be modified", groupSlug)
+	}
+
+	return nil
+}
+
 func (ug *userGroupResourceType) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
 
@@ -168,30 +275,58 @@ func (ug *userGroupResourceType) Grant(ctx context.Context, principal *v2.Resour
 		return nil, err
 	}
 
-	userId := principal.Id.Resource
+	err = ug.checkUnmanaged(ctx, groupSlug)
+	if err != nil {
+		return nil, err
+	}
 
-	// check if user is already a member of the group
-	members, err := ug.client.GetUserGroupMembers(ctx, workspaceId, groupSlug)
+	principal, err = resolvePrincipal(ctx, ug.client, workspaceId, principal)
 	if err != nil {
-		return nil, fmt.Errorf("bitbucket-connector: failed to get user group members: %w", err)
+		return nil, err
 	}
 
-	if isUserPresent(members, userId) {
-		l.Warn(
-			"bitbucket-connector: user is already a member of the group",
-			zap.String("principal_id", principal.Id.String()),
-			zap.String("principal_type", principal.Id.ResourceType),
-		)
+	err = checkPrincipal(ctx, ug.client, workspaceId, principal)
+	if err != nil {
+		return nil, err
+	}
 
-		return nil, fmt.Errorf("bitbucket-connector: user is already a member of the group")
+	userId := principal.Id.Resource
+
+	// check if user is already a member of the group
+	if !ug.skipPreflight {
+		isMember, err := ug.members.IsMember(ctx, workspaceId, groupSlug, userId)
+		if err != nil {
+			return nil, err
+		}
+
+		if isMember {
+			l.Info(
+				"bitbucket-connector: user is already a member of the group",
+				zap.String("principal_id", principal.Id.String()),
+				zap.String("principal_type", principal.Id.ResourceType),
+			)
+
+			return alreadyExistsAnnotations(), nil
+		}
 	}
 
 	// add user to the group
-	err = ug.client.AddUserToGroup(ctx, workspaceId, groupSlug, userId)
+	err = ug.retry.withRateLimitRetry(ctx, func() error {
+		return ug.client.AddUserToGroup(ctx, workspaceId, groupSlug, userId)
+	})
+	if err == nil || errors.Is(err, bitbucket.ErrConflict) {
+		ug.checkpoints.Delete(ctx, workspaceId)
+	}
 	if err != nil {
+		if errors.Is(err, bitbucket.ErrConflict) {
+			ug.members.Set(workspaceId, groupSlug, userId, true)
+			return alreadyExistsAnnotations(), nil
+		}
 		return nil, fmt.Errorf("bitbucket-connector: failed to add user to user group: %w", err)
 	}
 
+	ug.members.Set(workspaceId, groupSlug, userId, true)
+
 	return nil, nil
 }
 
@@ -221,34 +356,83 @@ func (ug *userGroupResourceType) Revoke(ctx context.Context, grant *v2.Grant) (a
 		return nil, err
 	}
 
-	userId := principal.Id.Resource
-
-	members, err := ug.client.GetUserGroupMembers(ctx, workspaceId, groupSlug)
+	err = ug.checkUnmanaged(ctx, groupSlug)
 	if err != nil {
-		return nil, fmt.Errorf("bitbucket-connector: failed to get user group members: %w", err)
+		return nil, err
 	}
 
-	if !isUserPresent(members, userId) {
-		l.Warn(
-			"bitbucket-connector: user is not a member of the group",
-			zap.String("principal_id", principal.Id.String()),
-			zap.String("principal_type", principal.Id.ResourceType),
-		)
+	userId := principal.Id.Resource
+
+	if !ug.skipPreflight {
+		isMember, err := ug.members.IsMember(ctx, workspaceId, groupSlug, userId)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isMember {
+			l.Info(
+				"bitbucket-connector: user is not a member of the group",
+				zap.String("principal_id", principal.Id.String()),
+				zap.String("principal_type", principal.Id.ResourceType),
+			)
+
+			return alreadyRevokedAnnotations(), nil
+		}
+	}
 
-		return nil, fmt.Errorf("bitbucket-connector: user is not a member of the group")
+	// remove user from the group
+	err = ug.retry.withRateLimitRetry(ctx, func() error {
+		return ug.client.RemoveUserFromGroup(ctx, workspaceId, groupSlug, userId)
+	})
+	if err == nil || errors.Is(err, bitbucket.ErrNotFound) {
+		ug.checkpoints.Delete(ctx, workspaceId)
 	}
-	// add user to the group
-	err = ug.client.RemoveUserFromGroup(ctx, workspaceId, groupSlug, userId)
 	if err != nil {
+		if errors.Is(err, bitbucket.ErrNotFound) {
+			ug.members.Set(workspaceId, groupSlug, userId, false)
+			return alreadyRevokedAnnotations(), nil
+		}
 		return nil, fmt.Errorf("bitbucket-connector: failed to remove user from user group: %w", err)
 	}
 
+	ug.members.Set(workspaceId, groupSlug, userId, false)
+
 	return nil, nil
 }
 
-func userGroupBuilder(client *bitbucket.Client) *userGroupResourceType {
+func userGroupBuilder(client BitbucketClient, skipPreflight bool, names *entitlementNames, managed *managedGroups, members *groupMemberCache, retry *retryPolicy, checkpoints *groupCheckpoints, asRoles bool) *userGroupResourceType {
+	resourceType := resourceTypeUserGroup
+	if asRoles {
+		resourceType = resourceTypeUserGroupRole
+	}
+
 	return &userGroupResourceType{
-		resourceType: resourceTypeUserGroup,
-		client:       client,
+		resourceType:  resourceType,
+		client:        client,
+		skipPreflight: skipPreflight,
+		names:         names,
+		managed:       managed,
+		members:       members,
+		retry:         retry,
+		checkpoints:   checkpoints,
+		asRoles:       asRoles,
+	}
+}
+
+// userGroupResourceId returns the ID of the user group resource without building the whole resource,
+// which is all the grants of the group need.
+func userGroupResourceId(workspaceId, groupSlug string) *v2.ResourceId {
+	return &v2.ResourceId{
+		ResourceType: resourceTypeUserGroup.Id,
+		Resource:     ComposedGroupId(workspaceId, groupSlug),
 	}
 }
+
+// groupMembersExpandable makes a grant to the user group expand to all of its members.
+func groupMembersExpandable(groupId *v2.ResourceId) grant.GrantOption {
+	return grant.WithAnnotation(&v2.GrantExpandable{
+		EntitlementIds: []string{
+			ent.NewEntitlementID(&v2.Resource{Id: groupId}, memberEntitlement),
+		},
+	})
+}
@@ -2,18 +2,44 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/conductorone/baton-bitbucket/pkg/atlassian"
 	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
 )
 
+// userStatusActive is the account status of users who can log in.
+const userStatusActive = "active"
+
 type userResourceType struct {
 	resourceType *v2.ResourceType
-	client       *bitbucket.Client
+	client       BitbucketClient
+	index        *workspaceIndex
+	directory    *userDirectory
+	org          *orgUsers
+	details      *userDetails
+	// skipStatus treats every member as enabled instead of fetching its status
+	skipStatus bool
+	// syncEmails sets the emails known to the directory on the users
+	syncEmails bool
+	// resolveEmails uses emails of managed accounts when the directory doesn't know them
+	resolveEmails bool
+	// canonical is set when every user is listed only under the first workspace it belongs to
+	canonical *canonicalUsers
+	// globalUsers lists the members of all synced workspaces as top-level users
+	globalUsers bool
+	workspaces  map[string]struct{}
+	external    *externalCollaborators
 }
 
 func (u *userResourceType) ResourceType(_ context.Context) *v2.ResourceType {
@@ -21,7 +47,7 @@ func (u *userResourceType) ResourceType(_ context.Context) *v2.ResourceType {
 }
 
 // Create a new connector resource for an Bitbucket user.
-func userResource(ctx context.Context, user *bitbucket.User, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+func userResource(ctx context.Context, user *bitbucket.User, parentResourceID *v2.ResourceId, identity *userIdentity, external bool) (*v2.Resource, error) {
 	firstName, lastName := splitFullName(user.Name)
 
 	profile := map[string]interface{}{
@@ -31,14 +57,101 @@ func userResource(ctx context.Context, user *bitbucket.User, parentResourceID *v
 		"user_id":    user.Id,
 	}
 
+	if user.AccountId != "" {
+		profile["account_id"] = user.AccountId
+	}
+
+	if user.Links.Avatar.Href != "" {
+		profile["avatar_url"] = user.Links.Avatar.Href
+	}
+
+	// external collaborators only have access to repositories, they are not members of the workspace
+	if external {
+		profile["external_collaborator"] = true
+	}
+
+	// a user listed once across workspaces keeps the date it joined the first of them
+	if user.JoinedOn != "" {
+		profile["workspace_joined_on"] = user.JoinedOn
+	}
+
 	status := rs.WithStatus(v2.UserTrait_Status_STATUS_ENABLED)
-	if user.Status != "active" {
+	if user.Status != userStatusActive {
 		status = rs.WithStatus(v2.UserTrait_Status_STATUS_DISABLED)
 	}
 
-	userTraitOptions := []rs.UserTraitOption{
+	var userTraitOptions []rs.UserTraitOption
+
+	if identity != nil && identity.email != "" {
+		userTraitOptions = append(userTraitOptions, rs.WithEmail(identity.email, true))
+	}
+
+	if user.CreatedOn != "" {
+		profile["created_on"] = user.CreatedOn
+
+		createdAt, err := time.Parse(time.RFC3339Nano, user.CreatedOn)
+		if err != nil {
+			ctxzap.Extract(ctx).Debug(
+				"bitbucket-connector: failed to parse account creation date",
+				zap.String("user_id", user.Id),
+				zap.String("created_on", user.CreatedOn),
+			)
+		} else {
+			userTraitOptions = append(userTraitOptions, rs.WithCreatedAt(createdAt))
+		}
+	}
+
+	// merge the identity from the Atlassian Access directory
+	if identity != nil && identity.directory != nil {
+		directoryUser := identity.directory
+		profile["directory_user_id"] = directoryUser.Id
+
+		if len(directoryUser.Groups) > 0 {
+			groups := make([]string, 0, len(directoryUser.Groups))
+			for _, group := range directoryUser.Groups {
+				groups = append(groups, group.Display)
+			}
+
+			profile["directory_groups"] = strings.Join(groups, ",")
+		}
+
+		// users suspended in the directory can't log in to Bitbucket either
+		if !directoryUser.Active {
+			profile["directory_suspended"] = true
+			status = rs.WithStatus(v2.UserTrait_Status_STATUS_DISABLED)
+		}
+	}
+
+	// deactivated or closed managed accounts can't log in to any Atlassian product
+	if identity != nil && identity.account != nil {
+		profile["atlassian_account_status"] = identity.account.AccountStatus
+		if identity.account.AccountStatus != atlassian.AccountStatusActive {
+			status = rs.WithStatus(v2.UserTrait_Status_STATUS_DISABLED)
+		}
+	}
+
+	userTraitOptions = append(userTraitOptions,
 		rs.WithUserProfile(profile),
 		status,
+	)
+
+	resourceOptions := []rs.ResourceOption{
+		rs.WithParentResourceID(parentResourceID),
+	}
+
+	// the Atlassian account is shared by Bitbucket, Jira, Confluence and other
+	// Atlassian products, so it is what links the user across their connectors,
+	// the email helps connectors which only know the users by it
+	if user.AccountId != "" {
+		description := "Atlassian account ID"
+		if identity != nil && identity.email != "" {
+			description = fmt.Sprintf("Atlassian account ID of %s", identity.email)
+		}
+
+		resourceOptions = append(resourceOptions, rs.WithExternalID(&v2.ExternalId{
+			Id:          user.AccountId,
+			Description: description,
+		}))
 	}
 
 	resource, err := rs.NewUserResource(
@@ -46,7 +159,7 @@ func userResource(ctx context.Context, user *bitbucket.User, parentResourceID *v
 		resourceTypeUser,
 		user.Id,
 		userTraitOptions,
-		rs.WithParentResourceID(parentResourceID),
+		resourceOptions...,
 	)
 
 	if err != nil {
@@ -56,7 +169,48 @@ func userResource(ctx context.Context, user *bitbucket.User, parentResourceID *v
 	return resource, nil
 }
 
+// identity collects what the directory and the organization know about the Atlassian account.
+func (u *userResourceType) identity(ctx context.Context, accountId string) (*userIdentity, error) {
+	directoryUser, err := u.directory.Lookup(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := u.org.Lookup(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &userIdentity{
+		directory: directoryUser,
+		account:   account,
+	}
+
+	if !u.syncEmails {
+		return identity, nil
+	}
+
+	if directoryUser != nil {
+		identity.email = directoryUser.PrimaryEmail()
+	}
+
+	// fall back to the organization directory when the email is still unknown
+	if identity.email == "" && u.resolveEmails && account != nil {
+		identity.email = account.Email
+	}
+
+	return identity, nil
+}
+
 func (u *userResourceType) List(ctx context.Context, parentId *v2.ResourceId, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if u.globalUsers {
+		if parentId != nil {
+			return nil, "", nil, nil
+		}
+
+		return u.listGlobal(ctx, token)
+	}
+
 	if parentId == nil {
 		return nil, "", nil, nil
 	}
@@ -67,40 +221,291 @@ func (u *userResourceType) List(ctx context.Context, parentId *v2.ResourceId, to
 		return nil, "", nil, err
 	}
 
+	// the external collaborators, when synced, are listed once all members of the workspace are known
+	if token.Token == "" && u.external != nil {
+		bag.Pop()
+		bag.Push(pagination.PageState{
+			ResourceTypeID: resourceTypeRepository.Id,
+			ResourceID:     parentId.Resource,
+		})
+		bag.Push(pagination.PageState{
+			ResourceTypeID: resourceTypeUser.Id,
+		})
+	}
+
+	var rv []*v2.Resource
+	var nextToken string
+
+	switch bag.ResourceTypeID() {
+	case resourceTypeUser.Id:
+		rv, nextToken, err = u.listMembers(ctx, parentId.Resource, bag.PageToken(), parentId)
+	case resourceTypeRepository.Id:
+		rv, nextToken, err = u.listExternal(ctx, parentId.Resource, bag.PageToken(), parentId)
+	default:
+		return nil, "", nil, fmt.Errorf("bitbucket-connector: invalid user resource type: %s", bag.ResourceTypeID())
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	pageToken, err := bag.NextToken(nextToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+// listGlobal lists members of all synced workspaces as top-level users.
+func (u *userResourceType) listGlobal(ctx context.Context, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	// users are listed once per sync, whichever workspace they are found in first
+	if token.Token == "" {
+		u.canonical.Reset()
+		u.external.Reset()
+	}
+
+	bag, err := parsePageToken(token.Token, &v2.ResourceId{ResourceType: resourceTypeWorkspace.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// the external collaborators, when synced, are listed once the members of all workspaces were listed,
+	// so a user is only listed as external collaborator when it is not a member of any workspace
+	if token.Token == "" && u.external != nil {
+		bag.Pop()
+		bag.Push(pagination.PageState{
+			ResourceTypeID: resourceTypeRepository.Id,
+		})
+		bag.Push(pagination.PageState{
+			ResourceTypeID: resourceTypeWorkspace.Id,
+		})
+	}
+
+	var rv []*v2.Resource
+
+	switch bag.ResourceTypeID() {
+	case resourceTypeWorkspace.Id:
+		workspaces, nextToken, err := syncedWorkspaces(ctx, u.index, u.workspaces, bag.PageToken())
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		bag.Pop()
+		if nextToken != "" {
+			bag.Push(pagination.PageState{
+				ResourceTypeID: resourceTypeWorkspace.Id,
+				Token:          nextToken,
+			})
+		}
+
+		for _, workspace := range workspaces {
+			bag.Push(pagination.PageState{
+				ResourceTypeID: resourceTypeUser.Id,
+				ResourceID:     workspace.Id,
+			})
+		}
+
+	case resourceTypeUser.Id:
+		members, nextToken, err := u.listMembers(ctx, bag.ResourceID(), bag.PageToken(), nil)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		err = bag.Next(nextToken)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		rv = members
+
+	// without a workspace, the state pages through the workspaces to list their external collaborators
+	case resourceTypeRepository.Id:
+		if bag.ResourceID() != "" {
+			external, nextToken, err := u.listExternal(ctx, bag.ResourceID(), bag.PageToken(), nil)
+			if err != nil {
+				return nil, "", nil, err
+			}
+
+			err = bag.Next(nextToken)
+			if err != nil {
+				return nil, "", nil, err
+			}
+
+			rv = external
+			break
+		}
+
+		workspaces, nextToken, err := syncedWorkspaces(ctx, u.index, u.workspaces, bag.PageToken())
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		err = bag.Next(nextToken)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		for _, workspace := range workspaces {
+			bag.Push(pagination.PageState{
+				ResourceTypeID: resourceTypeRepository.Id,
+				ResourceID:     workspace.Id,
+			})
+		}
+
+	default:
+		return nil, "", nil, fmt.Errorf("bitbucket-connector: invalid user resource type: %s", bag.ResourceTypeID())
+	}
+
+	pageToken, err := bag.Marshal()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+// listMembers returns a page of workspace members as user resources.
+func (u *userResourceType) listMembers(ctx context.Context, workspaceId, page string, parentId *v2.ResourceId) ([]*v2.Resource, string, error) {
 	users, nextToken, err := u.client.GetWorkspaceMembers(
 		ctx,
-		parentId.Resource,
+		workspaceId,
 		bitbucket.PaginationVars{
 			Limit: ResourcesPageSize,
-			Page:  bag.PageToken(),
+			Page:  page,
 		},
 	)
 	if err != nil {
-		return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to list user: %w", err)
+		return nil, "", fmt.Errorf("bitbucket-connector: failed to list user: %w", err)
 	}
 
-	pageToken, err := bag.NextToken(nextToken)
+	u.external.AddMembers(workspaceId, users)
+
+	// members of other workspaces were already listed, the workspace grants link them to this one
+	members := make([]bitbucket.User, 0, len(users))
+	for _, user := range users {
+		if !u.canonical.Claim(user.Id) {
+			continue
+		}
+
+		members = append(members, user)
+	}
+
+	rv, err := u.userResources(ctx, members, parentId, false)
 	if err != nil {
-		return nil, "", nil, err
+		// the page is listed again when the SDK retries it, so the users must be listed then
+		u.canonical.Release(mapUserIDs(members))
+		return nil, "", err
 	}
 
-	var rv []*v2.Resource
+	return rv, nextToken, nil
+}
+
+// listExternal returns a page of the external collaborators of a workspace, the users which have
+// permissions on its repositories without being members. Only workspace admins can list them.
+func (u *userResourceType) listExternal(ctx context.Context, workspaceId, page string, parentId *v2.ResourceId) ([]*v2.Resource, string, error) {
+	permissions, nextToken, err := u.client.GetWorkspaceRepositoryUserPermissions(
+		ctx,
+		workspaceId,
+		bitbucket.PaginationVars{
+			Limit: ResourcesPageSize,
+			Page:  page,
+		},
+	)
+	if err != nil {
+		if errors.Is(err, bitbucket.ErrPermissionDenied) {
+			ctxzap.Extract(ctx).Debug(
+				"bitbucket-connector: not allowed to list external collaborators",
+				zap.String("workspace_id", workspaceId),
+			)
+
+			return nil, "", nil
+		}
+
+		return nil, "", fmt.Errorf("bitbucket-connector: failed to list repository permissions: %w", err)
+	}
+
+	users, err := u.external.Find(ctx, workspaceId, permissions)
+	if err != nil {
+		return nil, "", err
+	}
+
+	collaborators := make([]bitbucket.User, 0, len(users))
 	for _, user := range users {
-		// retrieve a user to get a status
-		u, err := u.client.GetUser(ctx, user.Id)
+		if !u.canonical.Claim(user.Id) {
+			continue
+		}
+
+		collaborators = append(collaborators, user)
+	}
+
+	if len(collaborators) > 0 {
+		ctxzap.Extract(ctx).Info(
+			"bitbucket-connector: found external collaborators",
+			zap.String("workspace_id", workspaceId),
+			zap.Strings("user_ids", mapUserIDs(collaborators)),
+		)
+	}
+
+	rv, err := u.userResources(ctx, collaborators, parentId, true)
+	if err != nil {
+		u.canonical.Release(mapUserIDs(collaborators))
+		return nil, "", err
+	}
+
+	return rv, nextToken, nil
+}
+
+// userResources creates the user resources of the users, along with their details and identities.
+func (u *userResourceType) userResources(ctx context.Context, users []bitbucket.User, parentId *v2.ResourceId, external bool) ([]*v2.Resource, error) {
+	details, err := u.memberDetails(ctx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]*v2.Resource, 0, len(users))
+	for i, user := range users {
+		identity, err := u.identity(ctx, user.AccountId)
 		if err != nil {
-			return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to get user: %w", err)
+			return nil, err
 		}
 
-		ur, err := userResource(ctx, u, parentId)
+		details[i].JoinedOn = user.JoinedOn
+
+		ur, err := userResource(ctx, details[i], parentId, identity, external)
 		if err != nil {
-			return nil, "", nil, err
+			return nil, err
 		}
 
 		rv = append(rv, ur)
 	}
 
-	return rv, pageToken, nil, nil
+	return rv, nil
+}
+
+// memberDetails retrieves the users behind the members to get their status. When the status
+// lookups are skipped, the members are used as listed and treated as enabled.
+func (u *userResourceType) memberDetails(ctx context.Context, members []bitbucket.User) ([]*bitbucket.User, error) {
+	if u.skipStatus {
+		rv := make([]*bitbucket.User, 0, len(members))
+		for _, member := range members {
+			member.Status = userStatusActive
+			rv = append(rv, &member)
+		}
+
+		return rv, nil
+	}
+
+	userIds := make([]string, 0, len(members))
+	for _, member := range members {
+		userIds = append(userIds, member.Id)
+	}
+
+	rv, err := u.details.Fetch(ctx, userIds)
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket-connector: failed to get user: %w", err)
+	}
+
+	return rv, nil
 }
 
 func (u *userResourceType) Entitlements(ctx context.Context, resource *v2.Resource, token *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
@@ -111,9 +516,77 @@ func (u *userResourceType) Grants(ctx context.Context, resource *v2.Resource, to
 	return nil, "", nil, nil
 }
 
-func userBuilder(client *bitbucket.Client) *userResourceType {
+// canonicalUsers remembers which users were already listed during a sync, so a user
+// belonging to multiple workspaces is emitted as a single resource keyed by its UUID.
+type canonicalUsers struct {
+	mtx   sync.Mutex
+	users map[string]struct{}
+}
+
+func newCanonicalUsers() *canonicalUsers {
+	return &canonicalUsers{
+		users: make(map[string]struct{}),
+	}
+}
+
+// Reset forgets the listed users.
+func (c *canonicalUsers) Reset() {
+	if c == nil {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.users = make(map[string]struct{})
+}
+
+// Claim reports whether the user should be listed, which is only the first time
+// it is seen. Every user is listed when de-duplication is disabled.
+func (c *canonicalUsers) Claim(userId string) bool {
+	if c == nil {
+		return true
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.users[userId]; ok {
+		return false
+	}
+	c.users[userId] = struct{}{}
+
+	return true
+}
+
+// Release forgets the claims of users which failed to be listed, so they are listed when their page is retried.
+func (c *canonicalUsers) Release(userIds []string) {
+	if c == nil {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, userId := range userIds {
+		delete(c.users, userId)
+	}
+}
+
+func userBuilder(client BitbucketClient, index *workspaceIndex, directory *userDirectory, org *orgUsers, details *userDetails, skipStatus bool, syncEmails bool, resolveEmails bool, canonical *canonicalUsers, globalUsers bool, workspaces []string, external *externalCollaborators) *userResourceType {
 	return &userResourceType{
-		resourceType: resourceTypeUser,
-		client:       client,
+		resourceType:  resourceTypeUser,
+		client:        client,
+		index:         index,
+		directory:     directory,
+		org:           org,
+		details:       details,
+		skipStatus:    skipStatus,
+		syncEmails:    syncEmails,
+		resolveEmails: resolveEmails,
+		canonical:     canonical,
+		globalUsers:   globalUsers,
+		workspaces:    workspaceSet(workspaces),
+		external:      external,
 	}
 }
@@ -2,6 +2,7 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/conductorone/baton-bitbucket/pkg/bitbucket"
@@ -11,14 +12,33 @@ import (
 	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
 	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
 )
 
-const memberEntitlement = "member"
+const (
+	memberEntitlement        = "member"
+	defaultAccessEntitlement = "default-access"
+)
 
 type workspaceResourceType struct {
 	resourceType *v2.ResourceType
-	client       *bitbucket.Client
+	client       BitbucketClient
+	index        *workspaceIndex
 	workspaces   map[string]struct{}
+	names        *entitlementNames
+	syncCaches   []syncCache
+	globalUsers  bool
+	// defaultAccess emits an entitlement granted to the groups new members are added to
+	defaultAccess bool
+	// memberGroup is the slug of the group users granted the workspace membership are added to,
+	// the membership can't be granted when it is empty
+	memberGroup   string
+	members       *groupMemberCache
+	retry         *retryPolicy
+	checkpoints   *groupCheckpoints
+	skipPreflight bool
 }
 
 func (w *workspaceResourceType) ResourceType(_ context.Context) *v2.ResourceType {
@@ -26,16 +46,26 @@ func (w *workspaceResourceType) ResourceType(_ context.Context) *v2.ResourceType
 }
 
 // Create a new connector resource for an Bitbucket workspace.
-func workspaceResource(ctx context.Context, workspace *bitbucket.Workspace) (*v2.Resource, error) {
+func workspaceResource(ctx context.Context, workspace *bitbucket.Workspace, globalUsers bool) (*v2.Resource, error) {
+	children := []proto.Message{
+		&v2.ChildResourceType{ResourceTypeId: resourceTypeUserGroup.Id},
+	}
+
+	// top-level users are not listed per workspace
+	if !globalUsers {
+		children = append(children, &v2.ChildResourceType{ResourceTypeId: resourceTypeUser.Id})
+	}
+
+	children = append(children,
+		&v2.ChildResourceType{ResourceTypeId: resourceTypeProject.Id},
+		&v2.ChildResourceType{ResourceTypeId: resourceTypeRunner.Id},
+	)
+
 	resource, err := rs.NewResource(
 		workspace.Slug,
 		resourceTypeWorkspace,
 		workspace.Id,
-		rs.WithAnnotation(
-			&v2.ChildResourceType{ResourceTypeId: resourceTypeUserGroup.Id},
-			&v2.ChildResourceType{ResourceTypeId: resourceTypeUser.Id},
-			&v2.ChildResourceType{ResourceTypeId: resourceTypeProject.Id},
-		),
+		rs.WithAnnotation(children...),
 	)
 
 	if err != nil {
@@ -45,83 +75,107 @@ func workspaceResource(ctx context.Context, workspace *bitbucket.Workspace) (*v2
 	return resource, nil
 }
 
-func (w *workspaceResourceType) List(ctx context.Context, _ *v2.ResourceId, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	var rv []*v2.Resource
+// syncedWorkspaces returns a page of the workspaces which are synced, i.e. the ones
+// available to the credentials limited to the configured workspace slugs.
+func syncedWorkspaces(ctx context.Context, index *workspaceIndex, allowed map[string]struct{}, page string) ([]bitbucket.Workspace, string, error) {
+	var rv []bitbucket.Workspace
 
-	if w.client.IsUserScoped() {
-		bag, err := parsePageToken(token.Token, &v2.ResourceId{ResourceType: resourceTypeWorkspace.Id})
-		if err != nil {
-			return nil, "", nil, err
-		}
-
-		workspaces, nextToken, err := w.client.GetWorkspaces(
+	if index.client.IsUserScoped() {
+		workspaces, nextToken, err := index.GetWorkspaces(
 			ctx,
 			bitbucket.PaginationVars{
 				Limit: ResourcesPageSize,
-				Page:  bag.PageToken(),
+				Page:  page,
 			},
 		)
 		if err != nil {
-			return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to list workspace: %w", err)
-		}
-
-		pageToken, err := bag.NextToken(nextToken)
-		if err != nil {
-			return nil, "", nil, err
+			return nil, "", fmt.Errorf("bitbucket-connector: failed to list workspace: %w", err)
 		}
 
 		for _, workspace := range workspaces {
 			// Skip workspaces that are not in the list of allowed workspaces.
-			if _, ok := w.workspaces[workspace.Slug]; !ok && len(w.workspaces) > 0 {
+			if _, ok := allowed[workspace.Slug]; !ok && len(allowed) > 0 {
 				continue
 			}
 
-			workspaceCopy := workspace
-
-			wr, err := workspaceResource(ctx, &workspaceCopy)
-			if err != nil {
-				return nil, "", nil, err
-			}
-
-			rv = append(rv, wr)
+			rv = append(rv, workspace)
 		}
 
-		return rv, pageToken, nil, nil
+		return rv, nextToken, nil
 	}
 
-	workspaceId, err := w.client.WorkspaceId()
+	workspaceId, err := index.client.WorkspaceId()
 	if err != nil {
-		return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to get workspace id: %w", err)
+		return nil, "", fmt.Errorf("bitbucket-connector: failed to get workspace id: %w", err)
 	}
 
 	// If the scope is a workspace/project/repo, we only want to return that one available workspace.
-	workspace, err := w.client.GetWorkspace(ctx, workspaceId)
+	workspace, err := index.GetWorkspace(ctx, workspaceId)
 	if err != nil {
-		return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to get workspace: %w", err)
+		return nil, "", fmt.Errorf("bitbucket-connector: failed to get workspace: %w", err)
 	}
 
 	// Return empty list if the workspace is not in the list of allowed workspaces.
-	if _, ok := w.workspaces[workspace.Slug]; !ok && len(w.workspaces) > 0 {
-		return rv, "", nil, nil
+	if _, ok := allowed[workspace.Slug]; !ok && len(allowed) > 0 {
+		return rv, "", nil
+	}
+
+	rv = append(rv, *workspace)
+
+	return rv, "", nil
+}
+
+func (w *workspaceResourceType) List(ctx context.Context, _ *v2.ResourceId, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	// every sync starts by listing workspaces, so state cached during the previous one is dropped
+	if token.Token == "" {
+		for _, cache := range w.syncCaches {
+			cache.Reset()
+		}
 	}
 
-	wr, err := workspaceResource(ctx, workspace)
+	bag, err := parsePageToken(token.Token, &v2.ResourceId{ResourceType: resourceTypeWorkspace.Id})
 	if err != nil {
 		return nil, "", nil, err
 	}
 
-	rv = append(rv, wr)
+	workspaces, nextToken, err := syncedWorkspaces(ctx, w.index, w.workspaces, bag.PageToken())
+	if err != nil {
+		return nil, "", nil, err
+	}
 
-	return rv, "", nil, nil
+	pageToken, err := bag.NextToken(nextToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Resource
+	for _, workspace := range workspaces {
+		workspaceCopy := workspace
+
+		wr, err := workspaceResource(ctx, &workspaceCopy, w.globalUsers)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		rv = append(rv, wr)
+	}
+
+	return rv, pageToken, nil, nil
 }
 
 func (w *workspaceResourceType) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
 	var rv []*v2.Entitlement
 
+	// workspace members are invited in Bitbucket, the connector only grants the membership through the default member group
 	assignmentOptions := []ent.EntitlementOption{
 		ent.WithGrantableTo(resourceTypeUser),
-		ent.WithDisplayName(fmt.Sprintf("%s Workspace %s", resource.DisplayName, titleCase(memberEntitlement))),
-		ent.WithDescription(fmt.Sprintf("Workspace %s role in Bitbucket", resource.DisplayName)),
+		ent.WithDisplayName(w.names.DisplayName(resource, memberEntitlement, fmt.Sprintf("%s Workspace %s", resource.DisplayName, titleCase(memberEntitlement)))),
+		ent.WithDescription(w.names.Description(resource, memberEntitlement, fmt.Sprintf("Workspace %s role in Bitbucket", resource.DisplayName))),
+	}
+
+	// Bitbucket has no API to invite members, they can only join through the default member group
+	if w.memberGroup == "" {
+		assignmentOptions = append(assignmentOptions, ent.WithAnnotation(&v2.EntitlementImmutable{}))
 	}
 
 	// create the membership entitlement
@@ -131,6 +185,18 @@ func (w *workspaceResourceType) Entitlements(ctx context.Context, resource *v2.R
 		assignmentOptions...,
 	))
 
+	// the default access is configured in Bitbucket, it can't be granted by the connector
+	if w.defaultAccess {
+		rv = append(rv, ent.NewPermissionEntitlement(
+			resource,
+			defaultAccessEntitlement,
+			ent.WithGrantableTo(resourceTypeUserGroup),
+			ent.WithDisplayName(w.names.DisplayName(resource, defaultAccessEntitlement, fmt.Sprintf("%s Workspace Default Access", resource.DisplayName))),
+			ent.WithDescription(w.names.Description(resource, defaultAccessEntitlement, fmt.Sprintf("User groups new members of %s workspace are added to automatically", resource.DisplayName))),
+			ent.WithAnnotation(&v2.EntitlementImmutable{}),
+		))
+	}
+
 	return rv, "", nil, nil
 }
 
@@ -141,51 +207,203 @@ func (w *workspaceResourceType) Grants(ctx context.Context, resource *v2.Resourc
 		return nil, "", nil, err
 	}
 
-	users, nextToken, err := w.client.GetWorkspaceMembers(
-		ctx,
-		resource.Id.Resource,
-		bitbucket.PaginationVars{Limit: ResourcesPageSize, Page: bag.PageToken()},
-	)
-	if err != nil {
-		return nil, "", nil, err
-	}
-
-	pageToken, err := bag.NextToken(nextToken)
-	if err != nil {
-		return nil, "", nil, err
+	// default access groups are listed before the members
+	if token.Token == "" && w.defaultAccess {
+		bag.Push(pagination.PageState{
+			ResourceTypeID: resourceTypeUserGroup.Id,
+		})
 	}
 
 	var rv []*v2.Grant
-	for _, user := range users {
-		userCopy := user
-		u, err := userResource(ctx, &userCopy, nil)
+
+	switch bag.ResourceTypeID() {
+	// create a default access grant for each group new members are added to
+	case resourceTypeUserGroup.Id:
+		userGroups, err := w.client.GetWorkspaceUserGroups(ctx, resource.Id.Resource)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("bitbucket-connector: failed to list userGroups: %w", err)
+		}
+
+		err = bag.Next("")
 		if err != nil {
 			return nil, "", nil, err
 		}
 
-		rv = append(
-			rv,
-			grant.NewGrant(
-				resource,
-				memberEntitlement,
-				u.Id,
-			),
+		for _, userGroup := range userGroups {
+			if !userGroup.AutoAdd {
+				continue
+			}
+
+			rv = append(
+				rv,
+				grant.NewGrant(
+					resource,
+					defaultAccessEntitlement,
+					userGroupResourceId(resource.Id.Resource, userGroup.Slug),
+					grantSource("/1.0/groups/{workspace}", grantSourceGroup, userGroup.Permission),
+					grant.WithAnnotation(&v2.GrantImmutable{}),
+				),
+			)
+		}
+
+	case resourceTypeUser.Id:
+		// the memberships are only granted through the default member group
+		grantOptions := []grant.GrantOption{
+			grantSource("/2.0/workspaces/{workspace}/members", grantSourceDirect, memberEntitlement),
+		}
+		if w.memberGroup == "" {
+			grantOptions = append(grantOptions, grant.WithAnnotation(&v2.GrantImmutable{}))
+		}
+
+		users, nextToken, err := w.client.GetWorkspaceMembers(
+			ctx,
+			resource.Id.Resource,
+			bitbucket.PaginationVars{Limit: ResourcesPageSize, Page: bag.PageToken()},
 		)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		err = bag.Next(nextToken)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		for _, user := range users {
+			userId, err := rs.NewResourceID(resourceTypeUser, user.Id)
+			if err != nil {
+				return nil, "", nil, err
+			}
+
+			rv = append(
+				rv,
+				grant.NewGrant(
+					resource,
+					memberEntitlement,
+					userId,
+					grantOptions...,
+				),
+			)
+		}
+
+	default:
+		return nil, "", nil, fmt.Errorf("bitbucket-connector: invalid grant resource type: %s", bag.ResourceTypeID())
+	}
+
+	pageToken, err := bag.Marshal()
+	if err != nil {
+		return nil, "", nil, err
 	}
 
 	return rv, pageToken, nil, nil
 }
 
-func workspaceBuilder(client *bitbucket.Client, workspaces []string) *workspaceResourceType {
+// Grant adds the user to the default member group, which gives it access to the workspace.
+func (w *workspaceResourceType) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	if principal.Id.ResourceType != resourceTypeUser.Id {
+		l.Warn(
+			"bitbucket-connector: only users can be granted workspace membership",
+			zap.String("principal_id", principal.Id.String()),
+			zap.String("principal_type", principal.Id.ResourceType),
+		)
+
+		return nil, fmt.Errorf("bitbucket-connector: only users can be granted workspace membership")
+	}
+
+	workspaceResourceId, slug, err := ParseEntitlementID(entitlement.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if slug != memberEntitlement {
+		return nil, fmt.Errorf("bitbucket-connector: granting workspace entitlement %s is not supported", slug)
+	}
+
+	if w.memberGroup == "" {
+		return nil, fmt.Errorf("bitbucket-connector: granting workspace memberships requires a default member group")
+	}
+
+	workspaceId := workspaceResourceId.Resource
+
+	principal, err = resolvePrincipal(ctx, w.client, workspaceId, principal)
+	if err != nil {
+		return nil, err
+	}
+
+	userId := principal.Id.Resource
+
+	if !w.skipPreflight {
+		_, err := w.client.GetWorkspaceMember(ctx, workspaceId, userId)
+		if err == nil {
+			l.Info(
+				"bitbucket-connector: user is already a member of the workspace",
+				zap.String("principal_id", principal.Id.String()),
+				zap.String("workspace_id", workspaceId),
+			)
+
+			return alreadyExistsAnnotations(), nil
+		}
+
+		if !errors.Is(err, bitbucket.ErrNotFound) {
+			return nil, fmt.Errorf("bitbucket-connector: failed to get workspace member: %w", err)
+		}
+	}
+
+	err = w.retry.withRateLimitRetry(ctx, func() error {
+		return w.client.AddUserToGroup(ctx, workspaceId, w.memberGroup, userId)
+	})
+	if err == nil || errors.Is(err, bitbucket.ErrConflict) {
+		w.checkpoints.Delete(ctx, workspaceId)
+	}
+	if err != nil {
+		if errors.Is(err, bitbucket.ErrConflict) {
+			w.members.Set(workspaceId, w.memberGroup, userId, true)
+			return alreadyExistsAnnotations(), nil
+		}
+		return nil, fmt.Errorf("bitbucket-connector: failed to add user to default member group %s: %w", w.memberGroup, err)
+	}
+
+	w.members.Set(workspaceId, w.memberGroup, userId, true)
+
+	return nil, nil
+}
+
+// Revoke is not supported, workspace memberships are synced as immutable grants.
+func (w *workspaceResourceType) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	return nil, fmt.Errorf("bitbucket-connector: revoking workspace memberships is not supported")
+}
+
+// syncCache is state which is only valid for the duration of a single sync.
+type syncCache interface {
+	Reset()
+}
+
+func workspaceSet(workspaces []string) map[string]struct{} {
 	workspaceMap := make(map[string]struct{}, len(workspaces))
 
 	for _, workspaceSlug := range workspaces {
 		workspaceMap[workspaceSlug] = struct{}{}
 	}
 
+	return workspaceMap
+}
+
+func workspaceBuilder(client BitbucketClient, index *workspaceIndex, workspaces []string, names *entitlementNames, syncCaches []syncCache, globalUsers, defaultAccess bool, memberGroup string, members *groupMemberCache, retry *retryPolicy, checkpoints *groupCheckpoints, skipPreflight bool) *workspaceResourceType {
 	return &workspaceResourceType{
-		resourceType: resourceTypeWorkspace,
-		client:       client,
-		workspaces:   workspaceMap,
+		resourceType:  resourceTypeWorkspace,
+		client:        client,
+		index:         index,
+		workspaces:    workspaceSet(workspaces),
+		names:         names,
+		syncCaches:    syncCaches,
+		globalUsers:   globalUsers,
+		defaultAccess: defaultAccess,
+		memberGroup:   memberGroup,
+		members:       members,
+		retry:         retry,
+		checkpoints:   checkpoints,
+		skipPreflight: skipPreflight,
 	}
 }